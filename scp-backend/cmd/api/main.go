@@ -12,6 +12,7 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/scp-platform/backend/internal/api"
 	"github.com/scp-platform/backend/internal/api/handlers"
+	"github.com/scp-platform/backend/internal/api/websocket"
 	"github.com/scp-platform/backend/internal/config"
 	"github.com/scp-platform/backend/internal/repository"
 	"github.com/scp-platform/backend/internal/services"
@@ -48,6 +49,9 @@ func main() {
 	conversationRepo := repository.NewConversationRepository(db.DB)
 	messageRepo := repository.NewMessageRepository(db.DB)
 	notificationRepo := repository.NewNotificationRepository(db.DB)
+	userEventRepo := repository.NewUserEventRepository(db.DB)
+	presenceRepo := repository.NewPresenceRepository(db.DB)
+	cannedReplyRepo := repository.NewCannedReplyRepository(db.DB)
 
 	// Initialize JWT service
 	jwtService := jwt.NewJWTService(
@@ -58,7 +62,43 @@ func main() {
 
 	// Initialize services
 	authService := services.NewAuthService(userRepo, jwtService)
-	orderService := services.NewOrderService(orderRepo, productRepo, linkRepo)
+	orderService := services.NewOrderService(orderRepo, productRepo, linkRepo, notificationRepo, userRepo)
+	orderService.SetStockReservation(time.Duration(cfg.Orders.StockReservation) * time.Minute)
+	chatService := services.NewChatService(conversationRepo, linkRepo, messageRepo, userRepo, orderRepo, complaintRepo, productRepo, notificationRepo, supplierRepo)
+	chatService.SetEditWindow(time.Duration(cfg.Chat.EditWindow) * time.Minute)
+	cannedReplyService := services.NewCannedReplyService(cannedReplyRepo, userRepo, supplierRepo, orderRepo)
+
+	// Initialize WebSocket hub
+	hub := websocket.NewHub(websocket.Config{
+		PingInterval:          time.Duration(cfg.WebSocket.PingInterval) * time.Second,
+		PongTimeout:           time.Duration(cfg.WebSocket.PongTimeout) * time.Second,
+		MaxMessageSize:        int64(cfg.WebSocket.MaxMessageSize),
+		MaxConnectionsPerUser: cfg.WebSocket.MaxConnectionsPerUser,
+	})
+	if cfg.WebSocket.Backplane == "postgres" {
+		backplane := websocket.NewPostgresBackplane(db.DB, db.DSN)
+		if err := hub.UseBackplane(backplane); err != nil {
+			log.Printf("Warning: WebSocket backplane unavailable, events stay on this instance: %v", err)
+		}
+		defer backplane.Close()
+	}
+	hub.UseEventStore(userEventRepo, time.Duration(cfg.WebSocket.EventRetention)*time.Hour)
+	hub.UsePresence(presenceRepo)
+	go hub.Run()
+
+	// Release stock held for orders whose reservation has ended. This also
+	// runs with reservations turned off, for orders placed before that.
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			if released, err := orderService.ReleaseExpiredReservations(time.Now()); err != nil {
+				log.Printf("Error releasing expired stock reservations: %v", err)
+			} else if released > 0 {
+				log.Printf("Released stock reserved for %d orders", released)
+			}
+		}
+	}()
 
 	// Create uploads directory for static file serving
 	uploadDir := "./uploads"
@@ -69,13 +109,17 @@ func main() {
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(authService, userRepo)
 	productHandler := handlers.NewProductHandler(productRepo)
-	orderHandler := handlers.NewOrderHandler(orderService, orderRepo)
-	consumerHandler := handlers.NewConsumerHandler(supplierRepo, linkRepo, productRepo, orderService, userRepo)
-	complaintHandler := handlers.NewComplaintHandler(complaintRepo, conversationRepo, messageRepo)
-	chatHandler := handlers.NewChatHandler(conversationRepo, messageRepo)
+	orderHandler := handlers.NewOrderHandler(orderService, orderRepo, hub)
+	consumerHandler := handlers.NewConsumerHandler(supplierRepo, linkRepo, productRepo, orderService, userRepo, hub)
+	complaintHandler := handlers.NewComplaintHandler(complaintRepo, chatService, hub)
+	chatHandler := handlers.NewChatHandler(chatService, cannedReplyService, conversationRepo, messageRepo, hub)
+	chatHandler.SetPublicURL(cfg.Server.PublicURL)
+	cannedReplyHandler := handlers.NewCannedReplyHandler(cannedReplyRepo)
 	notificationHandler := handlers.NewNotificationHandler(notificationRepo)
-	supplierHandler := handlers.NewSupplierHandler(supplierRepo)
+	supplierHandler := handlers.NewSupplierHandler(supplierRepo, userRepo)
 	uploadHandler := handlers.NewUploadHandler(uploadDir)
+	eventStreamHandler := handlers.NewEventStreamHandler(hub)
+	webSocketHandler := handlers.NewWebSocketHandler(hub, chatService, messageRepo, cfg.Server.CORSOrigins)
 
 	// Setup routes
 	router := api.SetupRoutes(
@@ -85,9 +129,12 @@ func main() {
 		consumerHandler,
 		complaintHandler,
 		chatHandler,
+		cannedReplyHandler,
 		notificationHandler,
 		supplierHandler,
 		uploadHandler,
+		webSocketHandler,
+		eventStreamHandler,
 		jwtService,
 		cfg.Server.CORSOrigins,
 	)
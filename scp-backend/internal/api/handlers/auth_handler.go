@@ -279,6 +279,20 @@ func PaginatedResponse(results interface{}, page, pageSize, total int) gin.H {
 	}
 }
 
+// CursorPaginatedResponse is the keyset counterpart of PaginatedResponse.
+// next_cursor is the ID of the last result, to pass back as before or after
+// for the following page.
+func CursorPaginatedResponse(results interface{}, pageSize int, hasMore bool, nextCursor *string) gin.H {
+	return gin.H{
+		"results": results,
+		"pagination": gin.H{
+			"page_size":   pageSize,
+			"has_more":    hasMore,
+			"next_cursor": nextCursor,
+		},
+	}
+}
+
 func ParsePagination(c *gin.Context) (int, int) {
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/scp-platform/backend/internal/models"
+)
+
+type CannedReplyHandler struct {
+	cannedReplyRepo CannedReplyRepositoryInterface
+}
+
+func NewCannedReplyHandler(cannedReplyRepo CannedReplyRepositoryInterface) *CannedReplyHandler {
+	return &CannedReplyHandler{
+		cannedReplyRepo: cannedReplyRepo,
+	}
+}
+
+// GetCannedReplies lists the supplier's canned replies with how often each
+// has been sent.
+func (h *CannedReplyHandler) GetCannedReplies(c *gin.Context) {
+	supplierID := c.GetString("supplier_id")
+	if supplierID == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse("Supplier ID required"))
+		return
+	}
+
+	replies, err := h.cannedReplyRepo.GetBySupplierID(supplierID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(replies))
+}
+
+func (h *CannedReplyHandler) CreateCannedReply(c *gin.Context) {
+	supplierID := c.GetString("supplier_id")
+	if supplierID == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse("Supplier ID required"))
+		return
+	}
+
+	var req struct {
+		Title   string `json:"title" binding:"required,max=255"`
+		Content string `json:"content" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(err.Error()))
+		return
+	}
+
+	reply := &models.CannedReply{
+		SupplierID: supplierID,
+		Title:      req.Title,
+		Content:    req.Content,
+	}
+
+	if err := h.cannedReplyRepo.Create(reply); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusCreated, SuccessResponse(reply))
+}
+
+func (h *CannedReplyHandler) UpdateCannedReply(c *gin.Context) {
+	reply, ok := h.supplierCannedReply(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Title   *string `json:"title" binding:"omitempty,min=1,max=255"`
+		Content *string `json:"content" binding:"omitempty,min=1"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(err.Error()))
+		return
+	}
+
+	if req.Title != nil {
+		reply.Title = *req.Title
+	}
+	if req.Content != nil {
+		reply.Content = *req.Content
+	}
+
+	if err := h.cannedReplyRepo.Update(reply); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(reply))
+}
+
+func (h *CannedReplyHandler) DeleteCannedReply(c *gin.Context) {
+	reply, ok := h.supplierCannedReply(c)
+	if !ok {
+		return
+	}
+
+	if err := h.cannedReplyRepo.Delete(reply.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(gin.H{"message": "Canned reply deleted"}))
+}
+
+// supplierCannedReply loads the canned reply in the URL if it belongs to the
+// caller's supplier. Replies of other suppliers are reported as not found.
+func (h *CannedReplyHandler) supplierCannedReply(c *gin.Context) (*models.CannedReply, bool) {
+	reply, err := h.cannedReplyRepo.GetByID(c.Param("id"))
+	if err != nil || reply.SupplierID != c.GetString("supplier_id") {
+		c.JSON(http.StatusNotFound, ErrorResponse("Canned reply not found"))
+		return nil, false
+	}
+	return reply, true
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/scp-platform/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockCannedReplyRepository struct {
+	mock.Mock
+}
+
+func (m *MockCannedReplyRepository) GetByID(id string) (*models.CannedReply, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.CannedReply), args.Error(1)
+}
+
+func (m *MockCannedReplyRepository) GetBySupplierID(supplierID string) ([]models.CannedReply, error) {
+	args := m.Called(supplierID)
+	return args.Get(0).([]models.CannedReply), args.Error(1)
+}
+
+func (m *MockCannedReplyRepository) Create(reply *models.CannedReply) error {
+	args := m.Called(reply)
+	return args.Error(0)
+}
+
+func (m *MockCannedReplyRepository) Update(reply *models.CannedReply) error {
+	args := m.Called(reply)
+	return args.Error(0)
+}
+
+func (m *MockCannedReplyRepository) Delete(id string) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+type MockCannedReplyService struct {
+	mock.Mock
+}
+
+func (m *MockCannedReplyService) Render(replyID string, conversation *models.Conversation, orderID string) (string, error) {
+	args := m.Called(replyID, conversation, orderID)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockCannedReplyService) RecordUsage(replyID string) error {
+	args := m.Called(replyID)
+	return args.Error(0)
+}
+
+func TestCannedReplyHandler_GetCannedReplies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockRepo := new(MockCannedReplyRepository)
+	mockRepo.On("GetBySupplierID", "supplier1").Return([]models.CannedReply{
+		{ID: "reply1", SupplierID: "supplier1", Title: "Greeting", Content: "Hi {{consumer_name}}", UsageCount: 3},
+	}, nil)
+	handler := NewCannedReplyHandler(mockRepo)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set("supplier_id", "supplier1")
+	c.Request = httptest.NewRequest("GET", "/supplier/canned-replies", nil)
+
+	handler.GetCannedReplies(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"usage_count":3`)
+}
+
+func TestCannedReplyHandler_CreateCannedReply(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockRepo := new(MockCannedReplyRepository)
+	mockRepo.On("Create", mock.MatchedBy(func(r *models.CannedReply) bool {
+		return r.SupplierID == "supplier1" && r.Title == "Shipped" && r.Content == "Order {{order_id}} shipped"
+	})).Return(nil)
+	handler := NewCannedReplyHandler(mockRepo)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set("supplier_id", "supplier1")
+	c.Request = httptest.NewRequest("POST", "/supplier/canned-replies", bytes.NewBufferString(`{"title":"Shipped","content":"Order {{order_id}} shipped"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	handler.CreateCannedReply(c)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestCannedReplyHandler_CreateCannedReply_MissingContent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockRepo := new(MockCannedReplyRepository)
+	handler := NewCannedReplyHandler(mockRepo)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set("supplier_id", "supplier1")
+	c.Request = httptest.NewRequest("POST", "/supplier/canned-replies", bytes.NewBufferString(`{"title":"Shipped"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	handler.CreateCannedReply(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockRepo.AssertNotCalled(t, "Create", mock.Anything)
+}
+
+func TestCannedReplyHandler_UpdateCannedReply(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockRepo := new(MockCannedReplyRepository)
+	mockRepo.On("GetByID", "reply1").Return(&models.CannedReply{ID: "reply1", SupplierID: "supplier1", Title: "Old", Content: "Old content"}, nil)
+	mockRepo.On("Update", mock.MatchedBy(func(r *models.CannedReply) bool {
+		return r.Title == "New" && r.Content == "Old content"
+	})).Return(nil)
+	handler := NewCannedReplyHandler(mockRepo)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set("supplier_id", "supplier1")
+	c.Params = gin.Params{{Key: "id", Value: "reply1"}}
+	c.Request = httptest.NewRequest("PUT", "/supplier/canned-replies/reply1", bytes.NewBufferString(`{"title":"New"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	handler.UpdateCannedReply(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestCannedReplyHandler_OtherSuppliersReply(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range []struct {
+		name   string
+		method string
+		handle func(h *CannedReplyHandler, c *gin.Context)
+	}{
+		{"update", "PUT", (*CannedReplyHandler).UpdateCannedReply},
+		{"delete", "DELETE", (*CannedReplyHandler).DeleteCannedReply},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockCannedReplyRepository)
+			mockRepo.On("GetByID", "reply1").Return(&models.CannedReply{ID: "reply1", SupplierID: "supplier2"}, nil)
+			mockRepo.On("GetByID", "missing").Return(nil, errors.New("not found"))
+			handler := NewCannedReplyHandler(mockRepo)
+
+			for _, id := range []string{"reply1", "missing"} {
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+				c.Set("supplier_id", "supplier1")
+				c.Params = gin.Params{{Key: "id", Value: id}}
+				c.Request = httptest.NewRequest(tt.method, "/supplier/canned-replies/"+id, bytes.NewBufferString(`{"title":"Mine now"}`))
+				c.Request.Header.Set("Content-Type", "application/json")
+
+				tt.handle(handler, c)
+
+				assert.Equal(t, http.StatusNotFound, w.Code)
+			}
+			mockRepo.AssertNotCalled(t, "Update", mock.Anything)
+			mockRepo.AssertNotCalled(t, "Delete", mock.Anything)
+		})
+	}
+}
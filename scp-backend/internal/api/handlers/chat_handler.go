@@ -1,15 +1,22 @@
 package handlers
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/scp-platform/backend/internal/api/websocket"
 	"github.com/scp-platform/backend/internal/models"
+	"github.com/scp-platform/backend/internal/repository"
+	"github.com/scp-platform/backend/internal/services"
 )
 
 // MessageResponse transforms backend Message model to Flutter-compatible format
@@ -27,32 +34,43 @@ func MessageResponse(msg *models.Message) gin.H {
 		}
 	} else {
 		// Fallback: use sender_id if sender info not available
-		senderName = "User " + msg.SenderID[:8]
+		shortID := msg.SenderID
+		if len(shortID) > 8 {
+			shortID = shortID[:8]
+		}
+		senderName = "User " + shortID
 	}
 
 	// Use the sender's actual role from the users table if available
 	// This ensures we return the original role (owner/manager/sales_rep) instead of the stored 'sales_rep'
 	senderRole := msg.SenderRole
-	if msg.Sender != nil && msg.Sender.Role != "" {
+	if msg.Sender != nil && msg.Sender.Role != "" && msg.SenderRole != models.SenderRoleSystem {
 		senderRole = msg.Sender.Role
 	}
+	if msg.SenderRole == models.SenderRoleSystem {
+		senderName = "System"
+	} else if msg.SenderID == "" {
+		senderName = "Deleted user"
+	}
 
-	// Determine message type from attachment_url
-	messageType := "text"
-	if msg.AttachmentURL != nil && *msg.AttachmentURL != "" {
-		// Check file extension
-		url := *msg.AttachmentURL
-		ext := strings.ToLower(filepath.Ext(url))
-		switch ext {
-		case ".jpg", ".jpeg", ".png", ".gif", ".webp":
-			messageType = "image"
-		case ".mp3", ".wav", ".m4a", ".aac", ".ogg":
-			messageType = "audio"
-		default:
-			messageType = "file"
+	// type is what older clients switch on: text, image, audio, file or
+	// system, or the kind of a card. kind and payload are the full message.
+	kind := messageKind(msg)
+	messageType := kind
+	if kind == models.MessageKindAttachment {
+		var attachment models.AttachmentPayload
+		json.Unmarshal(msg.Payload, &attachment)
+		messageType = attachment.MediaType
+		if messageType == "" && msg.AttachmentURL != nil {
+			messageType = services.MediaTypeOf(*msg.AttachmentURL)
 		}
 	}
 
+	payload := msg.Payload
+	if len(payload) == 0 {
+		payload = json.RawMessage("{}")
+	}
+
 	response := gin.H{
 		"id":              msg.ID,
 		"conversation_id": msg.ConversationID,
@@ -61,8 +79,26 @@ func MessageResponse(msg *models.Message) gin.H {
 		"sender_name":     senderName,
 		"content":         msg.Content,
 		"type":            messageType,
+		"kind":            kind,
+		"payload":         payload,
 		"timestamp":       msg.CreatedAt.Format("2006-01-02T15:04:05.000Z"),
 		"is_read":         msg.IsRead,
+		"edited_at":       msg.EditedAt,
+		"deleted_at":      msg.DeletedAt,
+	}
+
+	// Cards carry the snapshot taken when they were sent
+	switch kind {
+	case models.MessageKindProductRef:
+		var ref models.ProductRefPayload
+		if json.Unmarshal(payload, &ref) == nil && ref.Product != nil {
+			response["product"] = ref.Product
+		}
+	case models.MessageKindOrderRef:
+		var ref models.OrderRefPayload
+		if json.Unmarshal(payload, &ref) == nil && ref.Order != nil {
+			response["order"] = ref.Order
+		}
 	}
 
 	if msg.AttachmentURL != nil {
@@ -77,18 +113,51 @@ func MessageResponse(msg *models.Message) gin.H {
 	return response
 }
 
+// messageKind is the kind of a message, inferred for messages stored
+// without one.
+func messageKind(msg *models.Message) string {
+	switch {
+	case msg.Kind != "":
+		return msg.Kind
+	case msg.SenderRole == models.SenderRoleSystem:
+		return models.MessageKindSystem
+	case msg.AttachmentURL != nil && *msg.AttachmentURL != "":
+		return models.MessageKindAttachment
+	default:
+		return models.MessageKindText
+	}
+}
+
 type ChatHandler struct {
-	conversationRepo ConversationRepositoryInterface
-	messageRepo      MessageRepositoryInterface
+	chatService        ChatServiceInterface
+	cannedReplyService CannedReplyServiceInterface
+	conversationRepo   ConversationRepositoryInterface
+	messageRepo        MessageRepositoryInterface
+	publisher          RealtimePublisher
+	publicURL          string
 }
 
-func NewChatHandler(conversationRepo ConversationRepositoryInterface, messageRepo MessageRepositoryInterface) *ChatHandler {
+func NewChatHandler(chatService ChatServiceInterface, cannedReplyService CannedReplyServiceInterface, conversationRepo ConversationRepositoryInterface, messageRepo MessageRepositoryInterface, publisher RealtimePublisher) *ChatHandler {
 	return &ChatHandler{
-		conversationRepo: conversationRepo,
-		messageRepo:      messageRepo,
+		chatService:        chatService,
+		cannedReplyService: cannedReplyService,
+		conversationRepo:   conversationRepo,
+		messageRepo:        messageRepo,
+		publisher:          publisher,
 	}
 }
 
+// SetPublicURL sets the URL clients reach the API at, which exported
+// transcripts link attachments to. Without it, links use the host the
+// request was made to.
+func (h *ChatHandler) SetPublicURL(url string) {
+	h.publicURL = url
+}
+
+// GetConversations lists the caller's conversations. Staff may filter by
+// ?assigned=mine|unassigned|all; sales reps see their own by default and
+// owners and managers see all of them. ?group_by=counterparty gathers the
+// threads with each supplier or consumer.
 func (h *ChatHandler) GetConversations(c *gin.Context) {
 	userID := c.GetString("user_id")
 	role := c.GetString("role")
@@ -98,18 +167,39 @@ func (h *ChatHandler) GetConversations(c *gin.Context) {
 		return
 	}
 
+	groupBy := c.Query("group_by")
+	if groupBy != "" && groupBy != "counterparty" {
+		c.JSON(http.StatusBadRequest, ErrorResponse("group_by must be counterparty"))
+		return
+	}
+
 	var conversations []models.Conversation
 	var err error
 
 	if role == "consumer" {
 		conversations, err = h.conversationRepo.GetByConsumerID(userID)
-	} else if role == "sales_rep" {
+	} else if services.IsStaff(role) {
 		supplierID := c.GetString("supplier_id")
 		if supplierID == "" {
 			c.JSON(http.StatusBadRequest, ErrorResponse("Supplier ID required"))
 			return
 		}
-		conversations, err = h.conversationRepo.GetBySupplierID(supplierID)
+
+		assignment := c.Query("assigned")
+		if assignment == "" {
+			assignment = models.AssignmentAll
+			if role == "sales_rep" {
+				assignment = models.AssignmentMine
+			}
+		}
+		switch assignment {
+		case models.AssignmentAll, models.AssignmentMine, models.AssignmentUnassigned:
+		default:
+			c.JSON(http.StatusBadRequest, ErrorResponse("assigned must be mine, unassigned or all"))
+			return
+		}
+
+		conversations, err = h.conversationRepo.GetBySupplierID(supplierID, userID, assignment)
 	} else {
 		c.JSON(http.StatusForbidden, ErrorResponse("Unauthorized role"))
 		return
@@ -125,21 +215,128 @@ func (h *ChatHandler) GetConversations(c *gin.Context) {
 		conversations = []models.Conversation{}
 	}
 
-	// Use proper pagination - if no conversations, use pageSize of 1 to avoid division by zero
+	var results interface{} = conversations
 	total := len(conversations)
+	if groupBy == "counterparty" {
+		groups := groupByCounterparty(conversations, role == "consumer")
+		results = groups
+		total = len(groups)
+	}
+
+	// Use proper pagination - if no conversations, use pageSize of 1 to avoid division by zero
 	pageSize := total
 	if pageSize == 0 {
 		pageSize = 1
 	}
 
 	// Return paginated format expected by Flutter frontend
-	c.JSON(http.StatusOK, PaginatedResponse(conversations, 1, pageSize, total))
+	c.JSON(http.StatusOK, PaginatedResponse(results, 1, pageSize, total))
 }
-func (h *ChatHandler) GetMessages(c *gin.Context) {
-	conversationID := c.Param("id")
+
+// groupByCounterparty gathers threads by the supplier (for a consumer) or
+// consumer (for staff) on the other side, keeping the listing's order.
+func groupByCounterparty(conversations []models.Conversation, forConsumer bool) []models.ConversationGroup {
+	groups := []models.ConversationGroup{}
+	index := make(map[string]int)
+
+	for _, conversation := range conversations {
+		counterpartyID, counterpartyName := conversation.ConsumerID, ""
+		if conversation.ConsumerName != nil {
+			counterpartyName = *conversation.ConsumerName
+		}
+		if forConsumer {
+			counterpartyID, counterpartyName = conversation.SupplierID, conversation.SupplierName
+		}
+
+		i, ok := index[counterpartyID]
+		if !ok {
+			i = len(groups)
+			index[counterpartyID] = i
+			groups = append(groups, models.ConversationGroup{
+				CounterpartyID:   counterpartyID,
+				CounterpartyName: counterpartyName,
+				LastMessageAt:    conversation.LastMessageAt,
+				Threads:          []models.Conversation{},
+			})
+		}
+
+		group := &groups[i]
+		group.UnreadCount += conversation.UnreadCount
+		if conversation.LastMessageAt != nil && (group.LastMessageAt == nil || conversation.LastMessageAt.After(*group.LastMessageAt)) {
+			group.LastMessageAt = conversation.LastMessageAt
+		}
+		group.Threads = append(group.Threads, conversation)
+	}
+
+	return groups
+}
+
+// SearchConversations finds messages matching ?q= in the caller's
+// conversations. Each result names the conversation and message to open and
+// carries a snippet with the matched words in <mark>.
+func (h *ChatHandler) SearchConversations(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse("q is required"))
+		return
+	}
 	page, pageSize := ParsePagination(c)
 
-	messages, err := h.messageRepo.GetByConversationID(conversationID, page, pageSize)
+	search := models.MessageSearch{Query: query, Page: page, PageSize: pageSize}
+	user := chatUser(c)
+	switch {
+	case user.IsConsumer():
+		search.ConsumerID = user.ID
+	case services.IsStaff(user.Role) && user.SupplierID != "":
+		search.SupplierID = user.SupplierID
+	default:
+		c.JSON(http.StatusForbidden, ErrorResponse("Unauthorized role"))
+		return
+	}
+
+	results, total, err := h.messageRepo.Search(search)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, PaginatedResponse(results, page, pageSize, total))
+}
+
+// GetMessages returns a page of history, newest first. ?before=<message_id>
+// loads older messages and ?after=<message_id> syncs newer ones, oldest
+// first.
+func (h *ChatHandler) GetMessages(c *gin.Context) {
+	conversation, err := h.chatService.GetConversation(c.Param("id"), chatUser(c))
+	if err != nil {
+		respondChatError(c, err)
+		return
+	}
+	_, pageSize := ParsePagination(c)
+
+	page := models.MessagePage{
+		Before: c.Query("before"),
+		After:  c.Query("after"),
+		Limit:  pageSize,
+		// Only the supplier's staff see internal notes
+		Internal: !chatUser(c).IsConsumer(),
+	}
+	if page.Before != "" && page.After != "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse("Use either before or after, not both"))
+		return
+	}
+	for _, cursor := range []string{page.Before, page.After} {
+		if _, err := uuid.Parse(cursor); cursor != "" && err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse("Invalid cursor"))
+			return
+		}
+	}
+
+	messages, hasMore, err := h.messageRepo.GetByConversationID(conversation.ID, page)
+	if errors.Is(err, repository.ErrCursorNotFound) {
+		c.JSON(http.StatusBadRequest, ErrorResponse("Invalid cursor"))
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse(err.Error()))
 		return
@@ -151,17 +348,33 @@ func (h *ChatHandler) GetMessages(c *gin.Context) {
 		transformedMessages[i] = MessageResponse(&msg)
 	}
 
-	c.JSON(http.StatusOK, PaginatedResponse(transformedMessages, page, pageSize, len(transformedMessages)))
+	var nextCursor *string
+	if len(messages) > 0 {
+		nextCursor = &messages[len(messages)-1].ID
+	}
+
+	c.JSON(http.StatusOK, CursorPaginatedResponse(transformedMessages, pageSize, hasMore, nextCursor))
 }
 
+// SendMessage posts {"kind", "content", "payload"} to the conversation: text,
+// an attachment (or a multipart upload of "file"), or a product or order
+// card.
 func (h *ChatHandler) SendMessage(c *gin.Context) {
-	senderID := c.GetString("user_id")
 	senderRole := c.GetString("role")
 	conversationID := c.Param("id")
 
-	var content string
-	var attachmentURL *string
-	var messageType string
+	// Resolve the conversation before accepting any upload: the caller must
+	// belong to it, or be linked to the counterpart of a new one.
+	conversation, err := h.senderConversation(c, conversationID)
+	if err != nil {
+		respondChatError(c, err)
+		return
+	}
+	if conversation == nil {
+		return
+	}
+
+	var draft services.MessageDraft
 
 	// Check if this is a multipart form (file upload) or JSON
 	contentType := c.GetHeader("Content-Type")
@@ -193,45 +406,42 @@ func (h *ChatHandler) SendMessage(c *gin.Context) {
 			// Log file upload for debugging
 			fmt.Printf("📤 [UPLOAD] File saved: %s, size: %d bytes\n", filepath, file.Size)
 
-			url := fmt.Sprintf("/uploads/%s", filename)
-			attachmentURL = &url
-
-			// Determine message type from form data or file extension
-			messageType = c.PostForm("type")
-			if messageType == "" {
-				extLower := strings.ToLower(ext)
-				if extLower == ".jpg" || extLower == ".jpeg" || extLower == ".png" || extLower == ".gif" {
-					messageType = "image"
-				} else if extLower == ".mp3" || extLower == ".wav" || extLower == ".m4a" || extLower == ".aac" {
-					messageType = "audio"
-				} else {
-					messageType = "file"
-				}
+			// The form's type may name the media type; otherwise it is
+			// guessed from the extension
+			attachment := models.AttachmentPayload{
+				URL:       fmt.Sprintf("/uploads/%s", filename),
+				FileName:  file.Filename,
+				MediaType: c.PostForm("type"),
 			}
+			switch attachment.MediaType {
+			case models.MediaTypeImage, models.MediaTypeAudio, models.MediaTypeFile:
+			default:
+				attachment.MediaType = services.MediaTypeOf(file.Filename)
+			}
+			payload, _ := json.Marshal(attachment)
 
 			// Content can be optional for file messages
-			content = c.PostForm("content")
-			if content == "" {
-				content = file.Filename
+			draft = services.MessageDraft{
+				Kind:    models.MessageKindAttachment,
+				Content: c.PostForm("content"),
+				Payload: payload,
 			}
 		} else {
 			// No file, but multipart form - get content from form
-			content = c.PostForm("content")
-			if content == "" {
-				c.JSON(http.StatusBadRequest, ErrorResponse("content is required"))
-				return
-			}
-			messageType = c.PostForm("type")
-			if messageType == "" {
-				messageType = "text"
+			draft = services.MessageDraft{
+				Kind:    models.MessageKindText,
+				Content: c.PostForm("content"),
 			}
 		}
 	} else {
-		// Handle JSON request
+		// Handle JSON request. kind defaults to text, or to attachment for
+		// older clients that only send attachment_url.
 		var req struct {
-			Content       string  `json:"content" binding:"required"`
-			AttachmentURL *string `json:"attachment_url"`
-			Type          string  `json:"type"`
+			Kind          string          `json:"kind"`
+			Content       string          `json:"content"`
+			Payload       json.RawMessage `json:"payload"`
+			AttachmentURL *string         `json:"attachment_url"`
+			Type          string          `json:"type"`
 		}
 
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -239,123 +449,518 @@ func (h *ChatHandler) SendMessage(c *gin.Context) {
 			return
 		}
 
-		content = req.Content
-		attachmentURL = req.AttachmentURL
-		messageType = req.Type
-		if messageType == "" {
-			messageType = "text"
+		draft = services.MessageDraft{
+			Kind:    req.Kind,
+			Content: req.Content,
+			Payload: req.Payload,
+		}
+		if req.Kind == "" && req.AttachmentURL != nil && *req.AttachmentURL != "" {
+			draft.Kind = models.MessageKindAttachment
+			draft.Payload, _ = json.Marshal(models.AttachmentPayload{URL: *req.AttachmentURL})
 		}
 	}
 
-	// Get conversation by ID from URL path
-	var conversation *models.Conversation
-	var err error
+	message, err := h.chatService.ComposeMessage(conversation, chatUser(c), draft)
+	if err != nil {
+		respondChatError(c, err)
+		return
+	}
 
-	if conversationID != "" {
-		// Try to get existing conversation by ID
-		conversation, err = h.conversationRepo.GetByID(conversationID)
-		if err != nil || conversation == nil {
-			// If conversation not found, try to get or create one based on role
-			if senderRole == "consumer" {
-				supplierID := c.Query("supplier_id")
-				if supplierID == "" {
-					c.JSON(http.StatusBadRequest, ErrorResponse("Conversation not found and supplier_id required for new conversation"))
-					return
-				}
-				conversation, err = h.conversationRepo.GetOrCreate(senderID, supplierID)
-			} else {
-				consumerID := c.Query("consumer_id")
-				if consumerID == "" {
-					c.JSON(http.StatusBadRequest, ErrorResponse("Conversation not found and consumer_id required for new conversation"))
-					return
-				}
-				conversation, err = h.conversationRepo.GetOrCreate(consumerID, c.GetString("supplier_id"))
-			}
-		}
-	} else {
-		// No conversation ID, must create new one
-		if senderRole == "consumer" {
-			supplierID := c.Query("supplier_id")
-			if supplierID == "" {
-				c.JSON(http.StatusBadRequest, ErrorResponse("supplier_id required"))
-				return
-			}
-			conversation, err = h.conversationRepo.GetOrCreate(senderID, supplierID)
-		} else {
-			consumerID := c.Query("consumer_id")
-			if consumerID == "" {
-				c.JSON(http.StatusBadRequest, ErrorResponse("consumer_id required"))
-				return
-			}
-			conversation, err = h.conversationRepo.GetOrCreate(consumerID, c.GetString("supplier_id"))
-		}
+	response, err := h.postMessage(conversation, message, senderRole)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(err.Error()))
+		return
+	}
+	h.sendAwayReply(conversation, chatUser(c))
+
+	c.JSON(http.StatusCreated, SuccessResponse(response))
+}
+
+// sendAwayReply posts and publishes the supplier's away message if a
+// consumer wrote outside business hours. Failing to post it does not fail
+// the request.
+func (h *ChatHandler) sendAwayReply(conversation *models.Conversation, sender services.ChatUser) {
+	message, err := h.chatService.AwayReply(conversation, sender, time.Now())
+	if err != nil {
+		fmt.Printf("⚠️  [CHAT] Failed to post away reply in conversation %s: %v\n", conversation.ID, err)
+		return
+	}
+	if message != nil {
+		h.publishMessage(conversation, MessageResponse(message))
+	}
+}
+
+// SendCannedReply sends one of the supplier's canned replies to the
+// conversation, with its placeholders filled from the conversation and the
+// optional order.
+func (h *ChatHandler) SendCannedReply(c *gin.Context) {
+	conversation, err := h.chatService.GetConversation(c.Param("id"), chatUser(c))
+	if err != nil {
+		respondChatError(c, err)
+		return
 	}
 
-	if err != nil || conversation == nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse("Failed to get or create conversation"))
+	var req struct {
+		CannedReplyID string `json:"canned_reply_id" binding:"required"`
+		OrderID       string `json:"order_id"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(err.Error()))
+		return
+	}
+
+	content, err := h.cannedReplyService.Render(req.CannedReplyID, conversation, req.OrderID)
+	switch {
+	case errors.Is(err, services.ErrCannedReplyNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse("Canned reply not found"))
+		return
+	case errors.Is(err, services.ErrOrderNotInConversation):
+		c.JSON(http.StatusBadRequest, ErrorResponse("Order not found in this conversation"))
+		return
+	case errors.Is(err, services.ErrOrderRequired):
+		c.JSON(http.StatusBadRequest, ErrorResponse("order_id required by this canned reply"))
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, ErrorResponse(err.Error()))
+		return
+	}
+
+	// The rendered reply is validated like any text message
+	message, err := h.chatService.ComposeMessage(conversation, chatUser(c), services.MessageDraft{
+		Kind:    models.MessageKindText,
+		Content: content,
+	})
+	if err != nil {
+		respondChatError(c, err)
 		return
 	}
 
+	response, err := h.postMessage(conversation, message, c.GetString("role"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(err.Error()))
+		return
+	}
+
+	if err := h.cannedReplyService.RecordUsage(req.CannedReplyID); err != nil {
+		fmt.Printf("⚠️  [CHAT] Failed to record usage of canned reply %s: %v\n", req.CannedReplyID, err)
+	}
+
+	c.JSON(http.StatusCreated, SuccessResponse(response))
+}
+
+// postMessage stores a message from a user of the given role and delivers
+// it: the conversation is bumped, the sender's read cursor moves to it and
+// both sides are notified. Internal notes only reach the supplier's staff,
+// and the teammates they mention are notified. It returns the message as
+// sent to clients.
+func (h *ChatHandler) postMessage(conversation *models.Conversation, message *models.Message, senderRole string) (gin.H, error) {
 	// Map supplier-side roles (manager, owner) to 'sales_rep' for database constraint
 	// The messages table only allows 'consumer' or 'sales_rep'
 	// NOTE: We store 'sales_rep' in DB but return the original role in API response
-	messageSenderRole := senderRole
+	message.SenderRole = senderRole
 	if senderRole == "manager" || senderRole == "owner" {
-		messageSenderRole = "sales_rep"
-	}
-
-	message := &models.Message{
-		ConversationID: conversation.ID,
-		SenderID:       senderID,
-		SenderRole:     messageSenderRole,
-		Content:        content,
-		AttachmentURL:  attachmentURL,
-		IsRead:         false,
+		message.SenderRole = "sales_rep"
 	}
 
 	if err := h.messageRepo.Create(message); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse(err.Error()))
-		return
+		return nil, err
 	}
 
-	// Update conversation last message time
-	h.conversationRepo.UpdateLastMessage(conversation.ID)
+	if message.Kind == models.MessageKindInternalNote {
+		h.notifyMentions(conversation, message)
+	} else {
+		// Update conversation last message time
+		h.conversationRepo.UpdateLastMessage(conversation.ID)
+
+		// Replying means the sender has read everything up to their message
+		if cursor, err := h.messageRepo.MarkAsRead(conversation.ID, message.SenderID, senderRole, message.ID); err == nil {
+			publishReadReceipt(h.publisher, conversation, cursor, senderRole)
+		}
+	}
 
 	// Get the created message with sender info for response
 	// Reload messages to get sender information
-	messages, err := h.messageRepo.GetByConversationID(conversation.ID, 1, 100)
+	// Fallback: transformed message without sender info, should rarely happen
+	response := MessageResponse(message)
+	if stored, err := h.messageRepo.GetByID(message.ID); err == nil {
+		// Override SenderRole with original role for response (not the stored 'sales_rep')
+		// This ensures the response shows the actual role (owner/manager/sales_rep)
+		stored.SenderRole = senderRole
+		response = MessageResponse(stored)
+	}
+
+	h.publishMessage(conversation, response)
+
+	return response, nil
+}
+
+// notifyMentions notifies the teammates an internal note mentions and pushes
+// the notifications to them. Failing to notify does not fail the note.
+func (h *ChatHandler) notifyMentions(conversation *models.Conversation, message *models.Message) {
+	notifications, err := h.chatService.NotifyMentions(conversation, message)
+	if err != nil {
+		fmt.Printf("⚠️  [CHAT] Failed to notify mentions in message %s: %v\n", message.ID, err)
+	}
+	if h.publisher == nil {
+		return
+	}
+	for _, notification := range notifications {
+		h.publisher.SendToUser(notification.UserID, websocket.Message{
+			Type: websocket.MessageTypeNotification,
+			Data: notification,
+		})
+	}
+}
+
+// senderConversation returns the conversation a message is sent to: the one
+// in the URL, or, when it does not exist, the caller's conversation with the
+// supplier_id (for consumers) or consumer_id (for staff) in the query. It
+// returns nil without an error once it has already responded.
+func (h *ChatHandler) senderConversation(c *gin.Context, conversationID string) (*models.Conversation, error) {
+	user := chatUser(c)
+
+	if conversationID != "" {
+		conversation, err := h.chatService.GetConversation(conversationID, user)
+		if !errors.Is(err, services.ErrConversationNotFound) {
+			return conversation, err
+		}
+	}
+
+	counterpartParam := "consumer_id"
+	if user.IsConsumer() {
+		counterpartParam = "supplier_id"
+	}
+	counterpartID := c.Query(counterpartParam)
+	if counterpartID == "" {
+		if conversationID != "" {
+			c.JSON(http.StatusBadRequest, ErrorResponse("Conversation not found and "+counterpartParam+" required for new conversation"))
+		} else {
+			c.JSON(http.StatusBadRequest, ErrorResponse(counterpartParam+" required"))
+		}
+		return nil, nil
+	}
+
+	conversation, err := h.chatService.OpenConversation(user, counterpartID, models.ThreadSubject{})
 	if err == nil {
-		// Find the message we just created (should be the first one since DESC order)
-		for _, m := range messages {
-			if m.ID == message.ID {
-				// Override SenderRole with original role for response (not the stored 'sales_rep')
-				// This ensures the response shows the actual role (owner/manager/sales_rep)
-				m.SenderRole = senderRole
-				c.JSON(http.StatusCreated, SuccessResponse(MessageResponse(&m)))
-				return
-			}
+		h.routeConversation(conversation)
+	}
+	return conversation, err
+}
+
+// routeConversation assigns a conversation that has never been assigned and
+// publishes the announcement. Failing to route does not fail the request;
+// the next open tries again.
+func (h *ChatHandler) routeConversation(conversation *models.Conversation) {
+	message, err := h.chatService.RouteConversation(conversation)
+	if err != nil {
+		fmt.Printf("⚠️  [CHAT] Failed to route conversation %s: %v\n", conversation.ID, err)
+		return
+	}
+	h.publishAssignment(conversation, message)
+}
+
+// AssignConversation lets owners and managers hand a conversation to a
+// member of their staff with {"user_id"}, or unassign it with null.
+func (h *ChatHandler) AssignConversation(c *gin.Context) {
+	user := chatUser(c)
+
+	conversation, err := h.chatService.GetConversation(c.Param("id"), user)
+	if err != nil {
+		respondChatError(c, err)
+		return
+	}
+
+	var req struct {
+		UserID *string `json:"user_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(err.Error()))
+		return
+	}
+
+	message, err := h.chatService.AssignConversation(conversation, req.UserID, user)
+	if errors.Is(err, services.ErrInvalidAssignee) {
+		c.JSON(http.StatusBadRequest, ErrorResponse("user_id must be a member of your staff"))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(err.Error()))
+		return
+	}
+
+	h.publishAssignment(conversation, message)
+
+	c.JSON(http.StatusOK, SuccessResponse(conversation))
+}
+
+// publishAssignment sends the system message announcing an assignment change
+// to both sides, and the new assignment to the supplier's staff. It does
+// nothing when the assignment did not change.
+func (h *ChatHandler) publishAssignment(conversation *models.Conversation, message *models.Message) {
+	if message == nil {
+		return
+	}
+	h.publishMessage(conversation, MessageResponse(message))
+
+	if h.publisher == nil {
+		return
+	}
+	h.publisher.SendToSupplier(conversation.SupplierID, websocket.Message{
+		Type: websocket.MessageTypeAssignment,
+		Data: gin.H{
+			"conversation_id":  conversation.ID,
+			"assigned_user_id": conversation.AssignedUserID,
+			"assigned_at":      conversation.AssignedAt,
+		},
+	})
+}
+
+// publishMessage pushes a stored message to both sides of the conversation:
+// the consumer and every connected member of the supplier's staff. Internal
+// notes only go to the staff.
+func (h *ChatHandler) publishMessage(conversation *models.Conversation, message gin.H) {
+	publishMessage(h.publisher, conversation, message)
+}
+
+func publishMessage(publisher RealtimePublisher, conversation *models.Conversation, message gin.H) {
+	publishToConversation(publisher, conversation, websocket.Message{
+		Type: websocket.MessageTypeNewMessage,
+		Data: message,
+	}, message["kind"] == models.MessageKindInternalNote)
+}
+
+// publishToConversation pushes an event to the supplier's staff and, unless
+// it is staffOnly, to the consumer.
+func publishToConversation(publisher RealtimePublisher, conversation *models.Conversation, event websocket.Message, staffOnly bool) {
+	if publisher == nil {
+		return
+	}
+	if !staffOnly {
+		publisher.SendToUser(conversation.ConsumerID, event)
+	}
+	publisher.SendToSupplier(conversation.SupplierID, event)
+}
+
+// EditMessage replaces the text of one of the caller's recent messages with
+// {"content"} and pushes message_edited to both sides.
+func (h *ChatHandler) EditMessage(c *gin.Context) {
+	user := chatUser(c)
+	conversation, err := h.chatService.GetConversation(c.Param("id"), user)
+	if err != nil {
+		respondChatError(c, err)
+		return
+	}
+
+	var req struct {
+		Content string `json:"content" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(err.Error()))
+		return
+	}
+
+	message, err := h.chatService.EditMessage(conversation, c.Param("message_id"), user, req.Content)
+	if err != nil {
+		respondChatError(c, err)
+		return
+	}
+
+	response := MessageResponse(message)
+	publishToConversation(h.publisher, conversation, websocket.Message{
+		Type: websocket.MessageTypeMessageEdited,
+		Data: response,
+	}, message.Kind == models.MessageKindInternalNote)
+
+	c.JSON(http.StatusOK, SuccessResponse(response))
+}
+
+// DeleteMessage removes one of the caller's recent messages, leaving a
+// deleted placeholder in the history, and pushes message_deleted to both
+// sides.
+func (h *ChatHandler) DeleteMessage(c *gin.Context) {
+	user := chatUser(c)
+	conversation, err := h.chatService.GetConversation(c.Param("id"), user)
+	if err != nil {
+		respondChatError(c, err)
+		return
+	}
+
+	message, err := h.chatService.DeleteMessage(conversation, c.Param("message_id"), user)
+	if err != nil {
+		respondChatError(c, err)
+		return
+	}
+
+	response := MessageResponse(message)
+	publishToConversation(h.publisher, conversation, websocket.Message{
+		Type: websocket.MessageTypeMessageDeleted,
+		Data: response,
+	}, message.Kind == models.MessageKindInternalNote)
+
+	c.JSON(http.StatusOK, SuccessResponse(response))
+}
+
+// GetMessageRevisions shows owners and managers what a message said before
+// each edit and its deletion.
+func (h *ChatHandler) GetMessageRevisions(c *gin.Context) {
+	conversation, err := h.chatService.GetConversation(c.Param("id"), chatUser(c))
+	if err != nil {
+		respondChatError(c, err)
+		return
+	}
+
+	message, err := h.messageRepo.GetByID(c.Param("message_id"))
+	if err != nil || message.ConversationID != conversation.ID {
+		respondChatError(c, services.ErrMessageNotFound)
+		return
+	}
+
+	revisions, err := h.messageRepo.GetRevisions(message.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(gin.H{
+		"message":   MessageResponse(message),
+		"revisions": revisions,
+	}))
+}
+
+// transcriptContentTypes are the content types of the transcript formats.
+var transcriptContentTypes = map[string]string{
+	services.TranscriptJSON: "application/json; charset=utf-8",
+	services.TranscriptCSV:  "text/csv; charset=utf-8",
+	services.TranscriptHTML: "text/html; charset=utf-8",
+	services.TranscriptPDF:  "application/pdf",
+}
+
+// ExportConversation downloads the whole thread as the consumer saw it, in
+// ?format=json (the default), csv, html or pdf, with times in the
+// supplier's time zone.
+func (h *ChatHandler) ExportConversation(c *gin.Context) {
+	format := strings.ToLower(c.DefaultQuery("format", services.TranscriptJSON))
+	contentType, ok := transcriptContentTypes[format]
+	if !ok {
+		c.JSON(http.StatusBadRequest, ErrorResponse(services.ErrUnknownTranscriptFormat.Error()))
+		return
+	}
+
+	conversation, err := h.chatService.GetConversation(c.Param("id"), chatUser(c))
+	if err != nil {
+		respondChatError(c, err)
+		return
+	}
+
+	messages, err := h.messageRepo.GetTranscript(conversation.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(err.Error()))
+		return
+	}
+
+	baseURL := h.publicURL
+	if baseURL == "" {
+		scheme := "http"
+		if c.Request.TLS != nil {
+			scheme = "https"
 		}
+		baseURL = scheme + "://" + c.Request.Host
+	}
+	transcript, err := h.chatService.Transcript(conversation, messages, baseURL, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(err.Error()))
+		return
 	}
 
-	// Fallback: return transformed message without sender info
-	// This should rarely happen, but handle gracefully
-	c.JSON(http.StatusCreated, SuccessResponse(MessageResponse(message)))
+	var body bytes.Buffer
+	if err := transcript.Write(&body, format); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(err.Error()))
+		return
+	}
+
+	shortID := conversation.ID
+	if len(shortID) > 8 {
+		shortID = shortID[:8]
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="conversation-%s.%s"`, shortID, format))
+	c.Data(http.StatusOK, contentType, body.Bytes())
 }
 
+// MarkMessagesAsRead moves the caller's read cursor to the message named in
+// an optional {"message_id"} body, or to the newest message.
 func (h *ChatHandler) MarkMessagesAsRead(c *gin.Context) {
-	conversationID := c.Param("id")
 	userID := c.GetString("user_id")
+	role := c.GetString("role")
 
-	if err := h.messageRepo.MarkAsRead(conversationID, userID); err != nil {
+	conversation, err := h.chatService.GetConversation(c.Param("id"), chatUser(c))
+	if err != nil {
+		respondChatError(c, err)
+		return
+	}
+
+	var req struct {
+		MessageID string `json:"message_id"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse(err.Error()))
+			return
+		}
+	}
+	if _, err := uuid.Parse(req.MessageID); req.MessageID != "" && err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse("Invalid message_id"))
+		return
+	}
+
+	cursor, err := h.messageRepo.MarkAsRead(conversation.ID, userID, role, req.MessageID)
+	if errors.Is(err, repository.ErrCursorNotFound) {
+		c.JSON(http.StatusBadRequest, ErrorResponse("Message not found in conversation"))
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse(err.Error()))
 		return
 	}
 
-	c.JSON(http.StatusOK, SuccessResponse(gin.H{"message": "Messages marked as read"}))
+	publishReadReceipt(h.publisher, conversation, cursor, role)
+
+	c.JSON(http.StatusOK, SuccessResponse(gin.H{"message": "Messages marked as read", "read_cursor": cursor}))
 }
 
+// GetUnreadSummary lists the caller's conversations with unread messages.
+// Staff get their own counts, so reps sharing an inbox each see what they
+// have not read yet.
+func (h *ChatHandler) GetUnreadSummary(c *gin.Context) {
+	userID := c.GetString("user_id")
+	role := c.GetString("role")
+	supplierID := c.GetString("supplier_id")
 
-// CreateConversation creates a new conversation or returns existing one
+	if role != "consumer" && supplierID == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse("Supplier ID required"))
+		return
+	}
+
+	conversations, err := h.conversationRepo.GetUnreadSummary(userID, role, supplierID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(err.Error()))
+		return
+	}
+
+	total := 0
+	for _, conversation := range conversations {
+		total += conversation.UnreadCount
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total_unread":  total,
+		"conversations": conversations,
+	})
+}
+
+// CreateConversation returns the consumer's thread with a supplier, creating
+// it if needed: the thread about order_id or complaint_id if one is given,
+// otherwise the general one.
 func (h *ChatHandler) CreateConversation(c *gin.Context) {
 	consumerID := c.GetString("user_id")
 	role := c.GetString("role")
@@ -371,22 +976,79 @@ func (h *ChatHandler) CreateConversation(c *gin.Context) {
 	}
 
 	var req struct {
-		SupplierID string `json:"supplier_id" binding:"required"`
-		OrderID    string `json:"order_id,omitempty"`
+		SupplierID  string `json:"supplier_id" binding:"required"`
+		OrderID     string `json:"order_id,omitempty"`
+		ComplaintID string `json:"complaint_id,omitempty"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, ErrorResponse(err.Error()))
 		return
 	}
+	if req.OrderID != "" && req.ComplaintID != "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse("Use either order_id or complaint_id, not both"))
+		return
+	}
 
 	// Get or create conversation
-	conversation, err := h.conversationRepo.GetOrCreate(consumerID, req.SupplierID)
+	subject := models.ThreadSubject{OrderID: req.OrderID, ComplaintID: req.ComplaintID}
+	conversation, err := h.chatService.OpenConversation(chatUser(c), req.SupplierID, subject)
+	if errors.Is(err, services.ErrNotLinked) || errors.Is(err, services.ErrSubjectNotFound) {
+		respondChatError(c, err)
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse("Failed to create conversation"))
 		return
 	}
+	h.routeConversation(conversation)
 
 	// Return the conversation
 	c.JSON(http.StatusOK, SuccessResponse(conversation))
 }
+
+// OpenOrderConversation opens or reuses the thread about an order for either
+// side of it.
+func (h *ChatHandler) OpenOrderConversation(c *gin.Context) {
+	conversation, err := h.chatService.OpenOrderConversation(chatUser(c), c.Param("id"))
+	if err != nil {
+		respondChatError(c, err)
+		return
+	}
+	h.routeConversation(conversation)
+
+	c.JSON(http.StatusOK, SuccessResponse(conversation))
+}
+
+// chatUser identifies the caller from the claims set by AuthMiddleware.
+func chatUser(c *gin.Context) services.ChatUser {
+	return services.ChatUser{
+		ID:         c.GetString("user_id"),
+		Role:       c.GetString("role"),
+		SupplierID: c.GetString("supplier_id"),
+	}
+}
+
+// respondChatError answers with the status matching a chat service error.
+func respondChatError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrConversationNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse("Conversation not found"))
+	case errors.Is(err, services.ErrNotConversationMember):
+		c.JSON(http.StatusForbidden, ErrorResponse("Not a member of this conversation"))
+	case errors.Is(err, services.ErrNotLinked):
+		c.JSON(http.StatusForbidden, ErrorResponse("Consumer and supplier are not linked"))
+	case errors.Is(err, services.ErrSubjectNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse("Order or complaint not found"))
+	case errors.Is(err, services.ErrInvalidMessage):
+		c.JSON(http.StatusBadRequest, ErrorResponse(err.Error()))
+	case errors.Is(err, services.ErrMessageNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse("Message not found"))
+	case errors.Is(err, services.ErrNotMessageSender):
+		c.JSON(http.StatusForbidden, ErrorResponse("Only the sender may change a message"))
+	case errors.Is(err, services.ErrEditWindowClosed):
+		c.JSON(http.StatusForbidden, ErrorResponse("Message can no longer be changed"))
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse(err.Error()))
+	}
+}
@@ -1,15 +1,21 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/scp-platform/backend/internal/api/websocket"
 	"github.com/scp-platform/backend/internal/models"
+	"github.com/scp-platform/backend/internal/repository"
+	"github.com/scp-platform/backend/internal/services"
 )
 
 // Mock repositories
@@ -17,18 +23,31 @@ type MockConversationRepository struct {
 	mock.Mock
 }
 
+func (m *MockConversationRepository) GetByID(id string) (*models.Conversation, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Conversation), args.Error(1)
+}
+
 func (m *MockConversationRepository) GetByConsumerID(consumerID string) ([]models.Conversation, error) {
 	args := m.Called(consumerID)
 	return args.Get(0).([]models.Conversation), args.Error(1)
 }
 
-func (m *MockConversationRepository) GetBySupplierID(supplierID string) ([]models.Conversation, error) {
-	args := m.Called(supplierID)
+func (m *MockConversationRepository) GetBySupplierID(supplierID, staffID, assignment string) ([]models.Conversation, error) {
+	args := m.Called(supplierID, staffID, assignment)
 	return args.Get(0).([]models.Conversation), args.Error(1)
 }
 
-func (m *MockConversationRepository) GetOrCreate(consumerID, supplierID string) (*models.Conversation, error) {
-	args := m.Called(consumerID, supplierID)
+func (m *MockConversationRepository) GetUnreadSummary(userID, role, supplierID string) ([]models.UnreadConversation, error) {
+	args := m.Called(userID, role, supplierID)
+	return args.Get(0).([]models.UnreadConversation), args.Error(1)
+}
+
+func (m *MockConversationRepository) GetOrCreate(consumerID, supplierID string, subject models.ThreadSubject) (*models.Conversation, error) {
+	args := m.Called(consumerID, supplierID, subject)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
@@ -40,12 +59,43 @@ func (m *MockConversationRepository) UpdateLastMessage(conversationID string) er
 	return args.Error(0)
 }
 
+func (m *MockConversationRepository) ClaimAwayReply(conversationID string, closedSince time.Time) (bool, error) {
+	args := m.Called(conversationID, closedSince)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockConversationRepository) Route(conversationID string) (*string, error) {
+	args := m.Called(conversationID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*string), args.Error(1)
+}
+
+func (m *MockConversationRepository) Assign(conversationID string, assigneeID *string) (bool, error) {
+	args := m.Called(conversationID, assigneeID)
+	return args.Bool(0), args.Error(1)
+}
+
 type MockMessageRepository struct {
 	mock.Mock
 }
 
-func (m *MockMessageRepository) GetByConversationID(conversationID string, page, pageSize int) ([]models.Message, error) {
-	args := m.Called(conversationID, page, pageSize)
+func (m *MockMessageRepository) GetByID(id string) (*models.Message, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Message), args.Error(1)
+}
+
+func (m *MockMessageRepository) GetByConversationID(conversationID string, page models.MessagePage) ([]models.Message, bool, error) {
+	args := m.Called(conversationID, page)
+	return args.Get(0).([]models.Message), args.Bool(1), args.Error(2)
+}
+
+func (m *MockMessageRepository) GetTranscript(conversationID string) ([]models.Message, error) {
+	args := m.Called(conversationID)
 	return args.Get(0).([]models.Message), args.Error(1)
 }
 
@@ -54,11 +104,75 @@ func (m *MockMessageRepository) Create(message *models.Message) error {
 	return args.Error(0)
 }
 
-func (m *MockMessageRepository) MarkAsRead(conversationID string, userID string) error {
-	args := m.Called(conversationID, userID)
+func (m *MockMessageRepository) MarkAsRead(conversationID, userID, userRole, upToMessageID string) (*models.ReadCursor, error) {
+	args := m.Called(conversationID, userID, userRole, upToMessageID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ReadCursor), args.Error(1)
+}
+
+func (m *MockMessageRepository) Edit(message *models.Message, editorID, content string) error {
+	args := m.Called(message, editorID, content)
 	return args.Error(0)
 }
 
+func (m *MockMessageRepository) SoftDelete(message *models.Message, deleterID string) error {
+	args := m.Called(message, deleterID)
+	return args.Error(0)
+}
+
+func (m *MockMessageRepository) GetRevisions(messageID string) ([]models.MessageRevision, error) {
+	args := m.Called(messageID)
+	return args.Get(0).([]models.MessageRevision), args.Error(1)
+}
+
+func (m *MockMessageRepository) Search(search models.MessageSearch) ([]models.MessageSearchResult, int, error) {
+	args := m.Called(search)
+	return args.Get(0).([]models.MessageSearchResult), args.Int(1), args.Error(2)
+}
+
+type MockConsumerLinkRepository struct {
+	mock.Mock
+}
+
+func (m *MockConsumerLinkRepository) GetByConsumerAndSupplier(consumerID, supplierID string) (*models.ConsumerLink, error) {
+	args := m.Called(consumerID, supplierID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ConsumerLink), args.Error(1)
+}
+
+// newMemberConversationRepo knows a single conversation, conv1, between
+// consumer1 and supplier1.
+func newMemberConversationRepo() *MockConversationRepository {
+	convRepo := new(MockConversationRepository)
+	convRepo.On("GetByID", "conv1").Return(&models.Conversation{
+		ID:         "conv1",
+		ConsumerID: "consumer1",
+		SupplierID: "supplier1",
+	}, nil)
+	convRepo.On("GetByID", mock.Anything).Return(nil, errors.New("not found"))
+	return convRepo
+}
+
+func newTestChatHandler(convRepo *MockConversationRepository, msgRepo *MockMessageRepository, publisher RealtimePublisher) *ChatHandler {
+	return NewChatHandler(services.NewChatService(convRepo, new(MockConsumerLinkRepository), msgRepo, new(MockUserRepository), nil, nil, nil, nil, nil), nil, convRepo, msgRepo, publisher)
+}
+
+type MockRealtimePublisher struct {
+	mock.Mock
+}
+
+func (m *MockRealtimePublisher) SendToUser(userID string, message websocket.Message) {
+	m.Called(userID, message)
+}
+
+func (m *MockRealtimePublisher) SendToSupplier(supplierID string, message websocket.Message) {
+	m.Called(supplierID, message)
+}
+
 func TestChatHandler_GetConversations(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -108,10 +222,10 @@ func TestChatHandler_GetConversations(t *testing.T) {
 			if tt.role == "consumer" {
 				mockConvRepo.On("GetByConsumerID", tt.userID).Return(tt.mockConvs, tt.mockError)
 			} else if tt.role == "sales_rep" {
-				mockConvRepo.On("GetBySupplierID", tt.supplierID).Return(tt.mockConvs, tt.mockError)
+				mockConvRepo.On("GetBySupplierID", tt.supplierID, tt.userID, "mine").Return(tt.mockConvs, tt.mockError)
 			}
 
-			handler := NewChatHandler(mockConvRepo, mockMsgRepo)
+			handler := newTestChatHandler(mockConvRepo, mockMsgRepo, nil)
 
 			w := httptest.NewRecorder()
 			c, _ := gin.CreateTestContext(w)
@@ -140,21 +254,23 @@ func TestChatHandler_GetConversations(t *testing.T) {
 func TestChatHandler_GetMessages(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
-	mockConvRepo := new(MockConversationRepository)
+	mockConvRepo := newMemberConversationRepo()
 	mockMsgRepo := new(MockMessageRepository)
 
 	mockMessages := []models.Message{
 		{ID: "msg1", ConversationID: "conv1", Content: "Hello"},
 	}
 
-	mockMsgRepo.On("GetByConversationID", "conv1", 1, 50).Return(mockMessages, nil)
+	mockMsgRepo.On("GetByConversationID", "conv1", models.MessagePage{Limit: 50}).Return(mockMessages, true, nil)
 
-	handler := NewChatHandler(mockConvRepo, mockMsgRepo)
+	handler := newTestChatHandler(mockConvRepo, mockMsgRepo, nil)
 
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
+	c.Set("user_id", "consumer1")
+	c.Set("role", "consumer")
 	c.Params = gin.Params{{Key: "id", Value: "conv1"}}
-	c.Request = httptest.NewRequest("GET", "/conversations/conv1/messages?page=1&page_size=50", nil)
+	c.Request = httptest.NewRequest("GET", "/conversations/conv1/messages?page_size=50", nil)
 
 	handler.GetMessages(c)
 
@@ -164,7 +280,987 @@ func TestChatHandler_GetMessages(t *testing.T) {
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(t, err)
 	assert.NotNil(t, response["results"])
+	pagination := response["pagination"].(map[string]interface{})
+	assert.Equal(t, true, pagination["has_more"])
+	assert.Equal(t, "msg1", pagination["next_cursor"])
+
+	mockMsgRepo.AssertExpectations(t)
+}
+
+func TestChatHandler_GetMessages_Cursors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cursor := "6f1c7a52-3c1e-4b8e-9d1a-2f6b8f0e4c11"
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedPage   *models.MessagePage
+		repoErr        error
+		expectedStatus int
+	}{
+		{
+			name:           "load older",
+			query:          "?before=" + cursor,
+			expectedPage:   &models.MessagePage{Before: cursor, Limit: 20},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "sync newer",
+			query:          "?after=" + cursor + "&page_size=100",
+			expectedPage:   &models.MessagePage{After: cursor, Limit: 100},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "both cursors",
+			query:          "?before=" + cursor + "&after=" + cursor,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "malformed cursor",
+			query:          "?before=not-a-message",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "cursor from another conversation",
+			query:          "?before=" + cursor,
+			expectedPage:   &models.MessagePage{Before: cursor, Limit: 20},
+			repoErr:        repository.ErrCursorNotFound,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMsgRepo := new(MockMessageRepository)
+			if tt.expectedPage != nil {
+				mockMsgRepo.On("GetByConversationID", "conv1", *tt.expectedPage).Return([]models.Message{}, false, tt.repoErr)
+			}
+
+			handler := newTestChatHandler(newMemberConversationRepo(), mockMsgRepo, nil)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set("user_id", "consumer1")
+			c.Set("role", "consumer")
+			c.Params = gin.Params{{Key: "id", Value: "conv1"}}
+			c.Request = httptest.NewRequest("GET", "/conversations/conv1/messages"+tt.query, nil)
+
+			handler.GetMessages(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockMsgRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestChatHandler_SendMessage_PublishesToBothSides(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockConvRepo := new(MockConversationRepository)
+	mockMsgRepo := new(MockMessageRepository)
+	mockPublisher := new(MockRealtimePublisher)
+
+	conversation := &models.Conversation{ID: "conv1", ConsumerID: "consumer1", SupplierID: "supplier1"}
+	mockConvRepo.On("GetByID", "conv1").Return(conversation, nil)
+	mockConvRepo.On("UpdateLastMessage", "conv1").Return(nil)
+	mockMsgRepo.On("Create", mock.AnythingOfType("*models.Message")).Run(func(args mock.Arguments) {
+		args.Get(0).(*models.Message).ID = "msg1"
+	}).Return(nil)
+	mockMsgRepo.On("GetByID", "msg1").Return(&models.Message{ID: "msg1", ConversationID: "conv1", Content: "Hello"}, nil)
+	mockMsgRepo.On("MarkAsRead", "conv1", "sales-rep-1", "sales_rep", "msg1").Return(nil, nil)
+
+	isNewMessage := mock.MatchedBy(func(message websocket.Message) bool {
+		return message.Type == websocket.MessageTypeNewMessage
+	})
+	mockPublisher.On("SendToUser", "consumer1", isNewMessage).Return()
+	mockPublisher.On("SendToSupplier", "supplier1", isNewMessage).Return()
+
+	handler := newTestChatHandler(mockConvRepo, mockMsgRepo, mockPublisher)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set("user_id", "sales-rep-1")
+	c.Set("role", "sales_rep")
+	c.Set("supplier_id", "supplier1")
+	c.Params = gin.Params{{Key: "id", Value: "conv1"}}
+	c.Request = httptest.NewRequest("POST", "/conversations/conv1/messages", bytes.NewBufferString(`{"content":"Hello"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	handler.SendMessage(c)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	mockPublisher.AssertExpectations(t)
+}
+
+type MockNotificationRepository struct {
+	mock.Mock
+}
+
+func (m *MockNotificationRepository) Create(notification *models.Notification) error {
+	args := m.Called(notification)
+	return args.Error(0)
+}
+
+func TestChatHandler_SendMessage_InternalNoteStaysWithStaff(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	supplierID := "supplier1"
+	convRepo := newMemberConversationRepo()
+	mockMsgRepo := new(MockMessageRepository)
+	mockMsgRepo.On("Create", mock.MatchedBy(func(m *models.Message) bool {
+		return m.Kind == models.MessageKindInternalNote
+	})).Run(func(args mock.Arguments) {
+		args.Get(0).(*models.Message).ID = "msg1"
+	}).Return(nil)
+	mockMsgRepo.On("GetByID", "msg1").Return(&models.Message{ID: "msg1", ConversationID: "conv1", Kind: models.MessageKindInternalNote, Content: "Can we waive the fee?"}, nil)
+	users := new(MockUserRepository)
+	users.On("GetByID", "manager1").Return(&models.User{ID: "manager1", Email: "manager@example.com", Role: "manager", SupplierID: &supplierID}, nil)
+	users.On("GetByID", "rep1").Return(&models.User{ID: "rep1", Email: "rep@example.com", Role: "sales_rep", SupplierID: &supplierID}, nil)
+	notifications := new(MockNotificationRepository)
+	notifications.On("Create", mock.AnythingOfType("*models.Notification")).Return(nil)
+
+	mockPublisher := new(MockRealtimePublisher)
+	mockPublisher.On("SendToSupplier", "supplier1", mock.MatchedBy(func(m websocket.Message) bool {
+		return m.Type == websocket.MessageTypeNewMessage
+	})).Return()
+	mockPublisher.On("SendToUser", "manager1", mock.MatchedBy(func(m websocket.Message) bool {
+		return m.Type == websocket.MessageTypeNotification
+	})).Return()
+
+	handler := NewChatHandler(services.NewChatService(convRepo, new(MockConsumerLinkRepository), mockMsgRepo, users, nil, nil, nil, notifications, nil), nil, convRepo, mockMsgRepo, mockPublisher)
 
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set("user_id", "rep1")
+	c.Set("role", "sales_rep")
+	c.Set("supplier_id", "supplier1")
+	c.Params = gin.Params{{Key: "id", Value: "conv1"}}
+	c.Request = httptest.NewRequest("POST", "/conversations/conv1/messages", bytes.NewBufferString(`{"kind":"internal_note","content":"Can we waive the fee?","payload":{"mentions":["manager1"]}}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	handler.SendMessage(c)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	mockPublisher.AssertExpectations(t)
+	mockPublisher.AssertNotCalled(t, "SendToUser", "consumer1", mock.Anything)
+	convRepo.AssertNotCalled(t, "UpdateLastMessage", mock.Anything)
+	notifications.AssertExpectations(t)
+}
+
+func TestChatHandler_GetMessages_StaffSeeInternalNotes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockMsgRepo := new(MockMessageRepository)
+	mockMsgRepo.On("GetByConversationID", "conv1", models.MessagePage{Limit: 20, Internal: true}).Return([]models.Message{}, false, nil)
+	handler := newTestChatHandler(newMemberConversationRepo(), mockMsgRepo, nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set("user_id", "rep1")
+	c.Set("role", "sales_rep")
+	c.Set("supplier_id", "supplier1")
+	c.Params = gin.Params{{Key: "id", Value: "conv1"}}
+	c.Request = httptest.NewRequest("GET", "/conversations/conv1/messages", nil)
+
+	handler.GetMessages(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
 	mockMsgRepo.AssertExpectations(t)
 }
 
+func TestChatHandler_MarkMessagesAsRead_SendsReadReceipt(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockConvRepo := new(MockConversationRepository)
+	mockMsgRepo := new(MockMessageRepository)
+	mockPublisher := new(MockRealtimePublisher)
+
+	conversation := &models.Conversation{ID: "conv1", ConsumerID: "consumer1", SupplierID: "supplier1"}
+	mockConvRepo.On("GetByID", "conv1").Return(conversation, nil)
+	cursor := &models.ReadCursor{ConversationID: "conv1", UserID: "consumer1", LastReadMessageID: "msg2"}
+	mockMsgRepo.On("MarkAsRead", "conv1", "consumer1", "consumer", "").Return(cursor, nil)
+	isReadReceipt := mock.MatchedBy(func(message websocket.Message) bool {
+		return message.Type == websocket.MessageTypeMessagesRead &&
+			message.Data.(gin.H)["last_read_message_id"] == "msg2"
+	})
+	mockPublisher.On("SendToSupplier", "supplier1", isReadReceipt).Return()
+	mockPublisher.On("SendToUser", "consumer1", isReadReceipt).Return()
+
+	handler := newTestChatHandler(mockConvRepo, mockMsgRepo, mockPublisher)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set("user_id", "consumer1")
+	c.Set("role", "consumer")
+	c.Params = gin.Params{{Key: "id", Value: "conv1"}}
+	c.Request = httptest.NewRequest("POST", "/conversations/conv1/read", nil)
+
+	handler.MarkMessagesAsRead(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockPublisher.AssertExpectations(t)
+	mockPublisher.AssertNumberOfCalls(t, "SendToUser", 1)
+}
+
+func TestChatHandler_MarkMessagesAsRead_UpToMessage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	messageID := "6f1c7a52-3c1e-4b8e-9d1a-2f6b8f0e4c11"
+
+	tests := []struct {
+		name           string
+		body           string
+		repoErr        error
+		expectRepo     bool
+		expectedStatus int
+	}{
+		{"up to a message", `{"message_id":"` + messageID + `"}`, nil, true, http.StatusOK},
+		{"message from another conversation", `{"message_id":"` + messageID + `"}`, repository.ErrCursorNotFound, true, http.StatusBadRequest},
+		{"malformed message id", `{"message_id":"latest"}`, nil, false, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMsgRepo := new(MockMessageRepository)
+			if tt.expectRepo {
+				cursor := &models.ReadCursor{ConversationID: "conv1", UserID: "rep1", LastReadMessageID: messageID}
+				if tt.repoErr != nil {
+					cursor = nil
+				}
+				mockMsgRepo.On("MarkAsRead", "conv1", "rep1", "sales_rep", messageID).Return(cursor, tt.repoErr)
+			}
+
+			handler := newTestChatHandler(newMemberConversationRepo(), mockMsgRepo, nil)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set("user_id", "rep1")
+			c.Set("role", "sales_rep")
+			c.Set("supplier_id", "supplier1")
+			c.Params = gin.Params{{Key: "id", Value: "conv1"}}
+			c.Request = httptest.NewRequest("POST", "/conversations/conv1/messages/read", bytes.NewBufferString(tt.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+
+			handler.MarkMessagesAsRead(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockMsgRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestChatHandler_GetUnreadSummary(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockConvRepo := new(MockConversationRepository)
+	mockConvRepo.On("GetUnreadSummary", "rep1", "sales_rep", "supplier1").Return([]models.UnreadConversation{
+		{ConversationID: "conv1", UnreadCount: 2},
+		{ConversationID: "conv2", UnreadCount: 3},
+	}, nil)
+
+	handler := newTestChatHandler(mockConvRepo, new(MockMessageRepository), nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set("user_id", "rep1")
+	c.Set("role", "sales_rep")
+	c.Set("supplier_id", "supplier1")
+	c.Request = httptest.NewRequest("GET", "/supplier/unread-summary", nil)
+
+	handler.GetUnreadSummary(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, float64(5), response["total_unread"])
+	assert.Len(t, response["conversations"], 2)
+	mockConvRepo.AssertExpectations(t)
+}
+
+func TestChatHandler_RejectsCrossTenantAccess(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	callers := []struct {
+		name           string
+		userID         string
+		role           string
+		supplierID     string
+		conversationID string
+		expectedStatus int
+	}{
+		{"other consumer", "consumer2", "consumer", "", "conv1", http.StatusForbidden},
+		{"other supplier's staff", "rep2", "sales_rep", "supplier2", "conv1", http.StatusForbidden},
+		{"staff without supplier", "rep3", "manager", "", "conv1", http.StatusForbidden},
+	}
+	actions := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		handle func(h *ChatHandler, c *gin.Context)
+	}{
+		{"read history", "GET", "/messages", "", (*ChatHandler).GetMessages},
+		{"send message", "POST", "/messages", `{"content":"Hello"}`, (*ChatHandler).SendMessage},
+		{"mark read", "POST", "/messages/read", "", (*ChatHandler).MarkMessagesAsRead},
+	}
+
+	for _, caller := range callers {
+		for _, action := range actions {
+			t.Run(caller.name+"/"+action.name, func(t *testing.T) {
+				mockMsgRepo := new(MockMessageRepository)
+				handler := newTestChatHandler(newMemberConversationRepo(), mockMsgRepo, nil)
+
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+				c.Set("user_id", caller.userID)
+				c.Set("role", caller.role)
+				c.Set("supplier_id", caller.supplierID)
+				c.Params = gin.Params{{Key: "id", Value: caller.conversationID}}
+				c.Request = httptest.NewRequest(action.method, "/conversations/"+caller.conversationID+action.path, bytes.NewBufferString(action.body))
+				c.Request.Header.Set("Content-Type", "application/json")
+
+				action.handle(handler, c)
+
+				assert.Equal(t, caller.expectedStatus, w.Code)
+				assert.Empty(t, mockMsgRepo.Calls, "no message may be read or written")
+			})
+		}
+	}
+}
+
+func TestChatHandler_GetMessages_UnknownConversation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockMsgRepo := new(MockMessageRepository)
+	handler := newTestChatHandler(newMemberConversationRepo(), mockMsgRepo, nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set("user_id", "consumer1")
+	c.Set("role", "consumer")
+	c.Params = gin.Params{{Key: "id", Value: "conv404"}}
+	c.Request = httptest.NewRequest("GET", "/conversations/conv404/messages", nil)
+
+	handler.GetMessages(c)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Empty(t, mockMsgRepo.Calls)
+}
+
+func TestChatHandler_SendMessage_NewConversationRequiresLink(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		userID     string
+		role       string
+		supplierID string
+		query      string
+		consumerID string
+		supplier   string
+	}{
+		{"consumer to unlinked supplier", "consumer1", "consumer", "", "?supplier_id=supplier2", "consumer1", "supplier2"},
+		{"staff to unlinked consumer", "rep1", "sales_rep", "supplier1", "?consumer_id=consumer2", "consumer2", "supplier1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			convRepo := newMemberConversationRepo()
+			linkRepo := new(MockConsumerLinkRepository)
+			linkRepo.On("GetByConsumerAndSupplier", tt.consumerID, tt.supplier).Return(&models.ConsumerLink{Status: "rejected"}, nil)
+			mockMsgRepo := new(MockMessageRepository)
+			handler := NewChatHandler(services.NewChatService(convRepo, linkRepo, mockMsgRepo, new(MockUserRepository), nil, nil, nil, nil, nil), nil, convRepo, mockMsgRepo, nil)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set("user_id", tt.userID)
+			c.Set("role", tt.role)
+			c.Set("supplier_id", tt.supplierID)
+			c.Params = gin.Params{{Key: "id", Value: "conv404"}}
+			c.Request = httptest.NewRequest("POST", "/conversations/conv404/messages"+tt.query, bytes.NewBufferString(`{"content":"Hello"}`))
+			c.Request.Header.Set("Content-Type", "application/json")
+
+			handler.SendMessage(c)
+
+			assert.Equal(t, http.StatusForbidden, w.Code)
+			convRepo.AssertNotCalled(t, "GetOrCreate", mock.Anything, mock.Anything, mock.Anything)
+			assert.Empty(t, mockMsgRepo.Calls)
+		})
+	}
+}
+
+func TestChatHandler_SendCannedReply(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	convRepo := newMemberConversationRepo()
+	convRepo.On("UpdateLastMessage", "conv1").Return(nil)
+
+	mockMsgRepo := new(MockMessageRepository)
+	mockMsgRepo.On("Create", mock.MatchedBy(func(m *models.Message) bool {
+		return m.Content == "Order order1 ships today" && m.Kind == models.MessageKindText && m.SenderID == "manager1" && m.SenderRole == "sales_rep"
+	})).Return(nil)
+	mockMsgRepo.On("MarkAsRead", "conv1", "manager1", "manager", mock.Anything).Return(nil, nil)
+	mockMsgRepo.On("GetByID", mock.Anything).Return(nil, errors.New("not found"))
+
+	cannedReplies := new(MockCannedReplyService)
+	cannedReplies.On("Render", "reply1", mock.AnythingOfType("*models.Conversation"), "order1").Return("Order order1 ships today", nil)
+	cannedReplies.On("RecordUsage", "reply1").Return(nil)
+
+	handler := NewChatHandler(services.NewChatService(convRepo, new(MockConsumerLinkRepository), mockMsgRepo, new(MockUserRepository), nil, nil, nil, nil, nil), cannedReplies, convRepo, mockMsgRepo, nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set("user_id", "manager1")
+	c.Set("role", "manager")
+	c.Set("supplier_id", "supplier1")
+	c.Params = gin.Params{{Key: "id", Value: "conv1"}}
+	c.Request = httptest.NewRequest("POST", "/supplier/conversations/conv1/canned-replies", bytes.NewBufferString(`{"canned_reply_id":"reply1","order_id":"order1"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	handler.SendCannedReply(c)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	mockMsgRepo.AssertExpectations(t)
+	cannedReplies.AssertExpectations(t)
+}
+
+func TestChatHandler_SendCannedReply_Errors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name           string
+		supplierID     string
+		rendered       string
+		renderError    error
+		expectedStatus int
+	}{
+		{"other supplier's staff", "supplier2", "", nil, http.StatusForbidden},
+		{"unknown canned reply", "supplier1", "", services.ErrCannedReplyNotFound, http.StatusNotFound},
+		{"order of another conversation", "supplier1", "", services.ErrOrderNotInConversation, http.StatusBadRequest},
+		{"order required", "supplier1", "", services.ErrOrderRequired, http.StatusBadRequest},
+		{"renders to nothing", "supplier1", "  \n ", nil, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			convRepo := newMemberConversationRepo()
+			mockMsgRepo := new(MockMessageRepository)
+			cannedReplies := new(MockCannedReplyService)
+			cannedReplies.On("Render", "reply1", mock.Anything, "").Return(tt.rendered, tt.renderError)
+
+			handler := NewChatHandler(services.NewChatService(convRepo, new(MockConsumerLinkRepository), mockMsgRepo, new(MockUserRepository), nil, nil, nil, nil, nil), cannedReplies, convRepo, mockMsgRepo, nil)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set("user_id", "rep1")
+			c.Set("role", "sales_rep")
+			c.Set("supplier_id", tt.supplierID)
+			c.Params = gin.Params{{Key: "id", Value: "conv1"}}
+			c.Request = httptest.NewRequest("POST", "/supplier/conversations/conv1/canned-replies", bytes.NewBufferString(`{"canned_reply_id":"reply1"}`))
+			c.Request.Header.Set("Content-Type", "application/json")
+
+			handler.SendCannedReply(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Empty(t, mockMsgRepo.Calls)
+			cannedReplies.AssertNotCalled(t, "RecordUsage", mock.Anything)
+		})
+	}
+}
+
+func TestChatHandler_GetConversations_AssignmentFilter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name               string
+		role               string
+		query              string
+		expectedAssignment string
+		expectedStatus     int
+	}{
+		{"sales rep sees own by default", "sales_rep", "", "mine", http.StatusOK},
+		{"manager sees all by default", "manager", "", "all", http.StatusOK},
+		{"owner sees all by default", "owner", "", "all", http.StatusOK},
+		{"sales rep asks for unassigned", "sales_rep", "?assigned=unassigned", "unassigned", http.StatusOK},
+		{"manager asks for own", "manager", "?assigned=mine", "mine", http.StatusOK},
+		{"unknown filter", "manager", "?assigned=others", "", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockConvRepo := new(MockConversationRepository)
+			if tt.expectedAssignment != "" {
+				mockConvRepo.On("GetBySupplierID", "supplier1", "staff1", tt.expectedAssignment).Return([]models.Conversation{}, nil)
+			}
+			handler := newTestChatHandler(mockConvRepo, new(MockMessageRepository), nil)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set("user_id", "staff1")
+			c.Set("role", tt.role)
+			c.Set("supplier_id", "supplier1")
+			c.Request = httptest.NewRequest("GET", "/supplier/conversations"+tt.query, nil)
+
+			handler.GetConversations(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockConvRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestChatHandler_AssignConversation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	supplierID := "supplier1"
+	convRepo := newMemberConversationRepo()
+	convRepo.On("Assign", "conv1", mock.MatchedBy(func(id *string) bool { return id != nil && *id == "rep1" })).Return(true, nil)
+	convRepo.On("UpdateLastMessage", "conv1").Return(nil)
+	mockMsgRepo := new(MockMessageRepository)
+	mockMsgRepo.On("Create", mock.MatchedBy(func(m *models.Message) bool {
+		return m.SenderRole == models.SenderRoleSystem
+	})).Return(nil)
+	users := new(MockUserRepository)
+	users.On("GetByID", "rep1").Return(&models.User{ID: "rep1", Email: "rep@example.com", Role: "sales_rep", SupplierID: &supplierID}, nil)
+	users.On("GetByID", "manager1").Return(&models.User{ID: "manager1", Email: "manager@example.com", Role: "manager", SupplierID: &supplierID}, nil)
+
+	mockPublisher := new(MockRealtimePublisher)
+	mockPublisher.On("SendToUser", "consumer1", mock.MatchedBy(func(m websocket.Message) bool {
+		return m.Type == websocket.MessageTypeNewMessage
+	})).Return()
+	mockPublisher.On("SendToSupplier", "supplier1", mock.MatchedBy(func(m websocket.Message) bool {
+		return m.Type == websocket.MessageTypeNewMessage
+	})).Return()
+	mockPublisher.On("SendToSupplier", "supplier1", mock.MatchedBy(func(m websocket.Message) bool {
+		return m.Type == websocket.MessageTypeAssignment
+	})).Return()
+
+	handler := NewChatHandler(services.NewChatService(convRepo, new(MockConsumerLinkRepository), mockMsgRepo, users, nil, nil, nil, nil, nil), nil, convRepo, mockMsgRepo, mockPublisher)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set("user_id", "manager1")
+	c.Set("role", "manager")
+	c.Set("supplier_id", "supplier1")
+	c.Params = gin.Params{{Key: "id", Value: "conv1"}}
+	c.Request = httptest.NewRequest("PUT", "/supplier/conversations/conv1/assignment", bytes.NewBufferString(`{"user_id":"rep1"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	handler.AssignConversation(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"assigned_user_id":"rep1"`)
+	mockMsgRepo.AssertExpectations(t)
+	mockPublisher.AssertExpectations(t)
+}
+
+func TestChatHandler_AssignConversation_InvalidAssignee(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	otherSupplierID := "supplier2"
+	convRepo := newMemberConversationRepo()
+	users := new(MockUserRepository)
+	users.On("GetByID", "rep2").Return(&models.User{ID: "rep2", Role: "sales_rep", SupplierID: &otherSupplierID}, nil)
+	handler := NewChatHandler(services.NewChatService(convRepo, new(MockConsumerLinkRepository), new(MockMessageRepository), users, nil, nil, nil, nil, nil), nil, convRepo, new(MockMessageRepository), nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set("user_id", "manager1")
+	c.Set("role", "manager")
+	c.Set("supplier_id", "supplier1")
+	c.Params = gin.Params{{Key: "id", Value: "conv1"}}
+	c.Request = httptest.NewRequest("PUT", "/supplier/conversations/conv1/assignment", bytes.NewBufferString(`{"user_id":"rep2"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	handler.AssignConversation(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	convRepo.AssertNotCalled(t, "Assign", mock.Anything, mock.Anything)
+}
+
+func TestMessageResponse_SystemMessage(t *testing.T) {
+	response := MessageResponse(&models.Message{
+		ID:         "msg1",
+		SenderID:   "manager1",
+		SenderRole: models.SenderRoleSystem,
+		Content:    "Max assigned this conversation to Ada",
+		Sender:     &models.User{Role: "manager", Email: "max@example.com"},
+	})
+
+	assert.Equal(t, "system", response["type"])
+	assert.Equal(t, "system", response["sender_role"])
+	assert.Equal(t, "System", response["sender_name"])
+}
+
+func TestChatHandler_GetConversations_GroupByCounterparty(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	earlier := time.Now().Add(-time.Hour)
+	later := time.Now()
+	mockConvRepo := new(MockConversationRepository)
+	mockConvRepo.On("GetByConsumerID", "consumer1").Return([]models.Conversation{
+		{ID: "conv1", ConsumerID: "consumer1", SupplierID: "supplier1", SupplierName: "Supplier One", Topic: models.TopicGeneral, UnreadCount: 1, LastMessageAt: &earlier},
+		{ID: "conv2", ConsumerID: "consumer1", SupplierID: "supplier2", SupplierName: "Supplier Two", Topic: models.TopicGeneral},
+		{ID: "conv3", ConsumerID: "consumer1", SupplierID: "supplier1", SupplierName: "Supplier One", Topic: models.TopicOrder, UnreadCount: 2, LastMessageAt: &later},
+	}, nil)
+	handler := newTestChatHandler(mockConvRepo, new(MockMessageRepository), nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set("user_id", "consumer1")
+	c.Set("role", "consumer")
+	c.Request = httptest.NewRequest("GET", "/consumer/conversations?group_by=counterparty", nil)
+
+	handler.GetConversations(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Results []models.ConversationGroup `json:"results"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response.Results, 2)
+	assert.Equal(t, "supplier1", response.Results[0].CounterpartyID)
+	assert.Equal(t, "Supplier One", response.Results[0].CounterpartyName)
+	assert.Equal(t, 3, response.Results[0].UnreadCount)
+	assert.Len(t, response.Results[0].Threads, 2)
+	assert.WithinDuration(t, later, *response.Results[0].LastMessageAt, time.Second)
+	assert.Equal(t, "supplier2", response.Results[1].CounterpartyID)
+}
+
+func TestChatHandler_CreateConversation_OneSubject(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockConvRepo := new(MockConversationRepository)
+	handler := newTestChatHandler(mockConvRepo, new(MockMessageRepository), nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set("user_id", "consumer1")
+	c.Set("role", "consumer")
+	c.Request = httptest.NewRequest("POST", "/consumer/conversations",
+		bytes.NewBufferString(`{"supplier_id":"supplier1","order_id":"order1","complaint_id":"complaint1"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	handler.CreateConversation(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockConvRepo.AssertNotCalled(t, "GetOrCreate", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestMessageResponse_Cards(t *testing.T) {
+	url := "/uploads/abc.png"
+	tests := []struct {
+		name         string
+		message      *models.Message
+		expectedType string
+		cardKey      string
+	}{
+		{
+			name:         "legacy attachment",
+			message:      &models.Message{ID: "msg1", AttachmentURL: &url},
+			expectedType: "image",
+		},
+		{
+			name:         "attachment",
+			message:      &models.Message{ID: "msg1", Kind: models.MessageKindAttachment, AttachmentURL: &url, Payload: json.RawMessage(`{"url":"/uploads/abc.png","media_type":"file"}`)},
+			expectedType: "file",
+		},
+		{
+			name:         "product card",
+			message:      &models.Message{ID: "msg1", Kind: models.MessageKindProductRef, Payload: json.RawMessage(`{"product_id":"product1","product":{"id":"product1","name":"Tomatoes","price":3.5}}`)},
+			expectedType: "product_ref",
+			cardKey:      "product",
+		},
+		{
+			name:         "order card",
+			message:      &models.Message{ID: "msg1", Kind: models.MessageKindOrderRef, Payload: json.RawMessage(`{"order_id":"order1","order":{"id":"order1","status":"pending","total":42}}`)},
+			expectedType: "order_ref",
+			cardKey:      "order",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := MessageResponse(tt.message)
+
+			assert.Equal(t, tt.expectedType, response["type"])
+			assert.NotNil(t, response["payload"])
+			if tt.cardKey != "" {
+				assert.NotNil(t, response[tt.cardKey])
+			}
+		})
+	}
+}
+
+func TestChatHandler_SendMessage_RejectsInvalidKinds(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for _, body := range []string{
+		`{"kind":"system","content":"Conversation closed"}`,
+		`{"kind":"text","content":""}`,
+		`{"kind":"attachment","payload":{"url":"ftp://example.com/a.png"}}`,
+	} {
+		mockMsgRepo := new(MockMessageRepository)
+		handler := newTestChatHandler(newMemberConversationRepo(), mockMsgRepo, nil)
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Set("user_id", "consumer1")
+		c.Set("role", "consumer")
+		c.Params = gin.Params{{Key: "id", Value: "conv1"}}
+		c.Request = httptest.NewRequest("POST", "/conversations/conv1/messages", bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+
+		handler.SendMessage(c)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+		mockMsgRepo.AssertNotCalled(t, "Create", mock.Anything)
+	}
+}
+
+func TestChatHandler_EditMessage_PublishesEdit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	message := &models.Message{ID: "msg1", ConversationID: "conv1", SenderID: "consumer1", SenderRole: "consumer", Kind: "text", Content: "50 crates", CreatedAt: time.Now()}
+	mockMsgRepo := new(MockMessageRepository)
+	mockMsgRepo.On("GetByID", "msg1").Return(message, nil)
+	mockMsgRepo.On("Edit", message, "consumer1", "5 crates").Run(func(args mock.Arguments) {
+		args.Get(0).(*models.Message).Content = "5 crates"
+	}).Return(nil)
+
+	isEdit := mock.MatchedBy(func(event websocket.Message) bool {
+		return event.Type == websocket.MessageTypeMessageEdited
+	})
+	mockPublisher := new(MockRealtimePublisher)
+	mockPublisher.On("SendToUser", "consumer1", isEdit).Return()
+	mockPublisher.On("SendToSupplier", "supplier1", isEdit).Return()
+
+	handler := newTestChatHandler(newMemberConversationRepo(), mockMsgRepo, mockPublisher)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set("user_id", "consumer1")
+	c.Set("role", "consumer")
+	c.Params = gin.Params{{Key: "id", Value: "conv1"}, {Key: "message_id", Value: "msg1"}}
+	c.Request = httptest.NewRequest("PUT", "/conversations/conv1/messages/msg1", bytes.NewBufferString(`{"content":"5 crates"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	handler.EditMessage(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "5 crates")
+	mockPublisher.AssertExpectations(t)
+}
+
+func TestChatHandler_DeleteMessage_NotSender(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockMsgRepo := new(MockMessageRepository)
+	mockMsgRepo.On("GetByID", "msg1").Return(&models.Message{ID: "msg1", ConversationID: "conv1", SenderID: "rep1", SenderRole: "sales_rep", CreatedAt: time.Now()}, nil)
+	handler := newTestChatHandler(newMemberConversationRepo(), mockMsgRepo, nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set("user_id", "consumer1")
+	c.Set("role", "consumer")
+	c.Params = gin.Params{{Key: "id", Value: "conv1"}, {Key: "message_id", Value: "msg1"}}
+	c.Request = httptest.NewRequest("DELETE", "/conversations/conv1/messages/msg1", nil)
+
+	handler.DeleteMessage(c)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	mockMsgRepo.AssertNotCalled(t, "SoftDelete", mock.Anything, mock.Anything)
+}
+
+func TestChatHandler_GetMessageRevisions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name           string
+		messageConvID  string
+		expectedStatus int
+	}{
+		{"message of the conversation", "conv1", http.StatusOK},
+		{"message of another conversation", "conv2", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMsgRepo := new(MockMessageRepository)
+			mockMsgRepo.On("GetByID", "msg1").Return(&models.Message{ID: "msg1", ConversationID: tt.messageConvID, SenderID: "consumer1"}, nil)
+			mockMsgRepo.On("GetRevisions", "msg1").Return([]models.MessageRevision{{ID: "rev1", MessageID: "msg1", Action: models.RevisionEdit, Content: "50 crates"}}, nil)
+			handler := newTestChatHandler(newMemberConversationRepo(), mockMsgRepo, nil)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set("user_id", "manager1")
+			c.Set("role", "manager")
+			c.Set("supplier_id", "supplier1")
+			c.Params = gin.Params{{Key: "id", Value: "conv1"}, {Key: "message_id", Value: "msg1"}}
+			c.Request = httptest.NewRequest("GET", "/supplier/conversations/conv1/messages/msg1/revisions", nil)
+
+			handler.GetMessageRevisions(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Contains(t, w.Body.String(), "50 crates")
+			}
+		})
+	}
+}
+
+func TestChatHandler_SearchConversations(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name           string
+		userID         string
+		role           string
+		supplierID     string
+		query          string
+		expectedSearch *models.MessageSearch
+		expectedStatus int
+	}{
+		{"consumer searches own conversations", "consumer1", "consumer", "", "?q=friday+delivery", &models.MessageSearch{Query: "friday delivery", ConsumerID: "consumer1", Page: 1, PageSize: 20}, http.StatusOK},
+		{"staff search their supplier's", "rep1", "sales_rep", "supplier1", "?q=friday&page_size=5", &models.MessageSearch{Query: "friday", SupplierID: "supplier1", Page: 1, PageSize: 5}, http.StatusOK},
+		{"missing query", "consumer1", "consumer", "", "?q=+", nil, http.StatusBadRequest},
+		{"staff without supplier", "rep1", "sales_rep", "", "?q=friday", nil, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMsgRepo := new(MockMessageRepository)
+			if tt.expectedSearch != nil {
+				mockMsgRepo.On("Search", *tt.expectedSearch).Return([]models.MessageSearchResult{
+					{ConversationID: "conv1", MessageID: "msg1", Snippet: "see you <mark>Friday</mark>"},
+				}, 1, nil)
+			}
+			handler := newTestChatHandler(new(MockConversationRepository), mockMsgRepo, nil)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set("user_id", tt.userID)
+			c.Set("role", tt.role)
+			c.Set("supplier_id", tt.supplierID)
+			c.Request = httptest.NewRequest("GET", "/conversations/search"+tt.query, nil)
+
+			handler.SearchConversations(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockMsgRepo.AssertExpectations(t)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Contains(t, w.Body.String(), "msg1")
+			} else {
+				mockMsgRepo.AssertNotCalled(t, "Search", mock.Anything)
+			}
+		})
+	}
+}
+
+type MockSupplierRepository struct {
+	mock.Mock
+}
+
+func (m *MockSupplierRepository) GetByID(id string) (*models.Supplier, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Supplier), args.Error(1)
+}
+
+func TestChatHandler_ExportConversation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	convRepo := newMemberConversationRepo()
+	mockMsgRepo := new(MockMessageRepository)
+	mockMsgRepo.On("GetTranscript", "conv1").Return([]models.Message{
+		{ID: "msg1", ConversationID: "conv1", SenderID: "consumer1", SenderRole: "consumer", Kind: "text", Content: "Hello", CreatedAt: time.Date(2026, 12, 14, 4, 30, 0, 0, time.UTC),
+			Sender: &models.User{ID: "consumer1", Email: "chef@example.com", Role: "consumer"}},
+	}, nil)
+	suppliers := new(MockSupplierRepository)
+	suppliers.On("GetByID", "supplier1").Return(&models.Supplier{ID: "supplier1", Name: "Fresh Farms", Timezone: "Europe/Berlin"}, nil)
+	users := new(MockUserRepository)
+	users.On("GetByID", mock.Anything).Return(nil, errors.New("not found"))
+	handler := NewChatHandler(services.NewChatService(convRepo, new(MockConsumerLinkRepository), mockMsgRepo, users, nil, nil, nil, nil, suppliers), nil, convRepo, mockMsgRepo, nil)
+
+	tests := []struct {
+		format       string
+		expectedCode int
+		contentType  string
+		expectedBody string
+	}{
+		{"csv", http.StatusOK, "text/csv; charset=utf-8", "2026-12-14T05:30:00+01:00,chef@example.com,consumer,text,Hello"},
+		{"pdf", http.StatusOK, "application/pdf", "%PDF-1.4"},
+		{"docx", http.StatusBadRequest, "application/json; charset=utf-8", "format must be json, csv, html or pdf"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set("user_id", "manager1")
+			c.Set("role", "manager")
+			c.Set("supplier_id", "supplier1")
+			c.Params = gin.Params{{Key: "id", Value: "conv1"}}
+			c.Request = httptest.NewRequest("GET", "/supplier/conversations/conv1/export?format="+tt.format, nil)
+
+			handler.ExportConversation(c)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.Equal(t, tt.contentType, w.Header().Get("Content-Type"))
+			assert.Contains(t, w.Body.String(), tt.expectedBody)
+			if tt.expectedCode == http.StatusOK {
+				assert.Equal(t, `attachment; filename="conversation-conv1.`+tt.format+`"`, w.Header().Get("Content-Disposition"))
+			}
+		})
+	}
+}
+
+func TestChatHandler_ExportConversation_AttachmentLinks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	attachment := "/uploads/invoice.pdf"
+	convRepo := newMemberConversationRepo()
+	mockMsgRepo := new(MockMessageRepository)
+	mockMsgRepo.On("GetTranscript", "conv1").Return([]models.Message{
+		{ID: "msg1", ConversationID: "conv1", SenderID: "consumer1", SenderRole: "consumer", Kind: "attachment", AttachmentURL: &attachment, CreatedAt: time.Date(2026, 12, 14, 4, 30, 0, 0, time.UTC)},
+	}, nil)
+	suppliers := new(MockSupplierRepository)
+	suppliers.On("GetByID", "supplier1").Return(&models.Supplier{ID: "supplier1", Name: "Fresh Farms"}, nil)
+	users := new(MockUserRepository)
+	users.On("GetByID", mock.Anything).Return(nil, errors.New("not found"))
+
+	tests := []struct {
+		name      string
+		publicURL string
+		expected  string
+	}{
+		{"configured public URL", "https://api.example.com", "https://api.example.com/uploads/invoice.pdf"},
+		{"request host without forwarded headers", "", "http://backend.internal:3000/uploads/invoice.pdf"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewChatHandler(services.NewChatService(convRepo, new(MockConsumerLinkRepository), mockMsgRepo, users, nil, nil, nil, nil, suppliers), nil, convRepo, mockMsgRepo, nil)
+			handler.SetPublicURL(tt.publicURL)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set("user_id", "manager1")
+			c.Set("role", "manager")
+			c.Set("supplier_id", "supplier1")
+			c.Params = gin.Params{{Key: "id", Value: "conv1"}}
+			c.Request = httptest.NewRequest("GET", "http://backend.internal:3000/supplier/conversations/conv1/export", nil)
+			c.Request.Header.Set("X-Forwarded-Proto", "https")
+
+			handler.ExportConversation(c)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Contains(t, w.Body.String(), `"attachment_url": "`+tt.expected+`"`)
+		})
+	}
+}
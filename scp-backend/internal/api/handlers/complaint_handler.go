@@ -10,16 +10,16 @@ import (
 )
 
 type ComplaintHandler struct {
-	complaintRepo   *repository.ComplaintRepository
-	conversationRepo ConversationRepositoryInterface
-	messageRepo      MessageRepositoryInterface
+	complaintRepo *repository.ComplaintRepository
+	chatService   ChatServiceInterface
+	publisher     RealtimePublisher
 }
 
-func NewComplaintHandler(complaintRepo *repository.ComplaintRepository, conversationRepo ConversationRepositoryInterface, messageRepo MessageRepositoryInterface) *ComplaintHandler {
+func NewComplaintHandler(complaintRepo *repository.ComplaintRepository, chatService ChatServiceInterface, publisher RealtimePublisher) *ComplaintHandler {
 	return &ComplaintHandler{
-		complaintRepo:   complaintRepo,
-		conversationRepo: conversationRepo,
-		messageRepo:      messageRepo,
+		complaintRepo: complaintRepo,
+		chatService:   chatService,
+		publisher:     publisher,
 	}
 }
 
@@ -107,6 +107,11 @@ func (h *ComplaintHandler) EscalateComplaint(c *gin.Context) {
 		return
 	}
 
+	if complaint.SupplierID != c.GetString("supplier_id") {
+		c.JSON(http.StatusForbidden, ErrorResponse("Unauthorized"))
+		return
+	}
+
 	complaint.Status = "escalated"
 	complaint.EscalatedBy = &salesRepID
 	now := time.Now()
@@ -117,27 +122,14 @@ func (h *ComplaintHandler) EscalateComplaint(c *gin.Context) {
 		return
 	}
 
-	// Also write a system-style message into the related conversation so that
-	// both web and mobile chat history clearly show the escalation event.
-	escalationMessage := &models.Message{
-		ConversationID: complaint.ConversationID,
-		SenderID:       salesRepID,
-		SenderRole:     "sales_rep",
-		Content:        "this problem escalated to manager",
-		AttachmentURL:  nil,
-		IsRead:         false,
-	}
-
-	if err := h.messageRepo.Create(escalationMessage); err != nil {
+	// Announce the escalation in the complaint's conversation so that both
+	// web and mobile chat history show it as a system event.
+	conversation, message, err := h.chatService.AnnounceEscalation(complaint, chatUser(c))
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse("Failed to record escalation message"))
 		return
 	}
-
-	// Update conversation metadata so UIs see the escalation as the latest activity.
-	if err := h.conversationRepo.UpdateLastMessage(complaint.ConversationID); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse("Failed to update conversation after escalation"))
-		return
-	}
+	publishMessage(h.publisher, conversation, MessageResponse(message))
 
 	c.JSON(http.StatusOK, SuccessResponse(complaint))
 }
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/scp-platform/backend/internal/api/websocket"
 	"github.com/scp-platform/backend/internal/models"
 	"github.com/scp-platform/backend/internal/repository"
 	"github.com/scp-platform/backend/internal/services"
@@ -16,6 +17,7 @@ type ConsumerHandler struct {
 	productRepo  *repository.ProductRepository
 	orderService *services.OrderService
 	userRepo     *repository.UserRepository
+	publisher    RealtimePublisher
 }
 
 func NewConsumerHandler(
@@ -24,6 +26,7 @@ func NewConsumerHandler(
 	productRepo *repository.ProductRepository,
 	orderService *services.OrderService,
 	userRepo *repository.UserRepository,
+	publisher RealtimePublisher,
 ) *ConsumerHandler {
 	return &ConsumerHandler{
 		supplierRepo: supplierRepo,
@@ -31,9 +34,25 @@ func NewConsumerHandler(
 		productRepo:  productRepo,
 		orderService: orderService,
 		userRepo:     userRepo,
+		publisher:    publisher,
 	}
 }
 
+// publishLinkStatus pushes a link's new status to the consumer and the
+// supplier's staff.
+func (h *ConsumerHandler) publishLinkStatus(link *models.ConsumerLink) {
+	if h.publisher == nil || link == nil {
+		return
+	}
+
+	event := websocket.Message{
+		Type: websocket.MessageTypeLinkStatus,
+		Data: link,
+	}
+	h.publisher.SendToUser(link.ConsumerID, event)
+	h.publisher.SendToSupplier(link.SupplierID, event)
+}
+
 func (h *ConsumerHandler) GetSuppliers(c *gin.Context) {
 	page, pageSize := ParsePagination(c)
 	consumerID := c.GetString("user_id")
@@ -176,6 +195,8 @@ func (h *ConsumerHandler) RequestLink(c *gin.Context) {
 	// Enrich with supplier info
 	createdLink.Supplier = supplier
 
+	h.publishLinkStatus(createdLink)
+
 	// Return link with supplier info as expected by Flutter frontend
 	c.JSON(http.StatusCreated, createdLink)
 }
@@ -306,6 +327,8 @@ func (h *ConsumerHandler) ApproveLink(c *gin.Context) {
 	}
 
 	link, _ = h.linkRepo.GetByID(linkID)
+	h.publishLinkStatus(link)
+
 	// Return link directly as expected by Flutter frontend
 	c.JSON(http.StatusOK, link)
 }
@@ -331,6 +354,8 @@ func (h *ConsumerHandler) RejectLink(c *gin.Context) {
 	}
 
 	link, _ = h.linkRepo.GetByID(linkID)
+	h.publishLinkStatus(link)
+
 	// Return link directly as expected by Flutter frontend
 	c.JSON(http.StatusOK, link)
 }
@@ -356,6 +381,8 @@ func (h *ConsumerHandler) BlockLink(c *gin.Context) {
 	}
 
 	link, _ = h.linkRepo.GetByID(linkID)
+	h.publishLinkStatus(link)
+
 	// Return link directly as expected by Flutter frontend
 	c.JSON(http.StatusOK, link)
 }
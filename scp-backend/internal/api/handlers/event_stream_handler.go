@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/scp-platform/backend/internal/api/websocket"
+)
+
+// EventStreamHandler serves the hub's events over Server-Sent Events for
+// clients whose network blocks WebSocket upgrades.
+type EventStreamHandler struct {
+	Hub *websocket.Hub
+}
+
+func NewEventStreamHandler(hub *websocket.Hub) *EventStreamHandler {
+	return &EventStreamHandler{
+		Hub: hub,
+	}
+}
+
+// streamEvent is a hub frame with its data left encoded.
+type streamEvent struct {
+	Type string          `json:"type"`
+	Seq  int64           `json:"seq"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Stream sends every event the user's WebSocket connection would receive.
+// Durable events carry their sequence number as the SSE id, so a browser
+// reconnecting with Last-Event-ID gets what it missed replayed first.
+func (h *EventStreamHandler) Stream(c *gin.Context) {
+	client := &websocket.Client{
+		ID:         c.GetString("user_id"),
+		Role:       c.GetString("role"),
+		SupplierID: c.GetString("supplier_id"),
+		Send:       make(chan []byte, 256),
+		Hub:        h.Hub,
+	}
+
+	h.Hub.Register(client)
+	defer h.Hub.Unregister(client)
+
+	if lastEventID := c.GetHeader("Last-Event-ID"); lastEventID != "" {
+		lastSeq, err := strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse("Invalid Last-Event-ID"))
+			return
+		}
+		h.Hub.Resume(client, &lastSeq)
+	}
+
+	config := h.Hub.Config()
+	// The server-wide write timeout would end the stream; each write gets
+	// its own deadline instead.
+	controller := http.NewResponseController(c.Writer)
+	controller.SetWriteDeadline(time.Time{})
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // stop nginx from buffering the stream
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	keepalive := time.NewTicker(config.PingInterval)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case frame, ok := <-client.Send:
+			if !ok {
+				return
+			}
+			controller.SetWriteDeadline(time.Now().Add(config.WriteTimeout))
+			if err := writeStreamEvent(c, frame); err != nil {
+				return
+			}
+
+		case <-keepalive.C:
+			controller.SetWriteDeadline(time.Now().Add(config.WriteTimeout))
+			if _, err := c.Writer.WriteString(": keepalive\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
+func writeStreamEvent(c *gin.Context, frame []byte) error {
+	var event streamEvent
+	if err := json.Unmarshal(frame, &event); err != nil {
+		return nil // not an event; nothing to forward
+	}
+
+	id := ""
+	if event.Seq > 0 {
+		id = strconv.FormatInt(event.Seq, 10)
+	} else if event.Type == websocket.MessageTypeResumed {
+		// Move the browser's Last-Event-ID to where the replay ended.
+		var status websocket.ResumeStatus
+		if err := json.Unmarshal(event.Data, &status); err == nil {
+			id = strconv.FormatInt(status.LastSeq, 10)
+		}
+	}
+
+	err := sse.Encode(c.Writer, sse.Event{
+		Id:    id,
+		Event: event.Type,
+		Data:  string(event.Data),
+	})
+	if err != nil {
+		return err
+	}
+	c.Writer.Flush()
+	return nil
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/scp-platform/backend/internal/api/websocket"
+	"github.com/scp-platform/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubEventStore holds one user's already stored events.
+type stubEventStore struct {
+	events []models.UserEvent
+}
+
+func (s *stubEventStore) AppendToUser(userID, eventType string, payload []byte) (int64, error) {
+	seq := int64(len(s.events) + 1)
+	s.events = append(s.events, models.UserEvent{UserID: userID, Seq: seq, Type: eventType, Payload: payload})
+	return seq, nil
+}
+
+func (s *stubEventStore) AppendToSupplier(supplierID, eventType string, payload []byte) ([]models.UserEvent, error) {
+	return []models.UserEvent{}, nil
+}
+
+func (s *stubEventStore) LatestSeq(userID string) (int64, error) {
+	return int64(len(s.events)), nil
+}
+
+func (s *stubEventStore) GetSince(userID string, afterSeq int64, limit int) ([]models.UserEvent, error) {
+	events := []models.UserEvent{}
+	for _, event := range s.events {
+		if event.Seq > afterSeq {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (s *stubEventStore) DeleteOlderThan(cutoff time.Time) error {
+	return nil
+}
+
+// sseEvent is one parsed Server-Sent Event, or a comment.
+type sseEvent struct {
+	id, event, data, comment string
+}
+
+func readSSE(t *testing.T, reader *bufio.Reader) sseEvent {
+	t.Helper()
+	var event sseEvent
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimRight(line, "\n")
+
+		switch {
+		case line == "":
+			return event
+		case strings.HasPrefix(line, ":"):
+			event.comment = strings.TrimSpace(strings.TrimPrefix(line, ":"))
+		case strings.HasPrefix(line, "id:"):
+			event.id = strings.TrimSpace(strings.TrimPrefix(line, "id:"))
+		case strings.HasPrefix(line, "event:"):
+			event.event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			event.data = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		}
+	}
+}
+
+func startEventStream(t *testing.T, config websocket.Config, store websocket.EventStore) (*websocket.Hub, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	hub := websocket.NewHub(config)
+	if store != nil {
+		hub.UseEventStore(store, time.Hour)
+	}
+	go hub.Run()
+	t.Cleanup(hub.Stop)
+
+	handler := NewEventStreamHandler(hub)
+	router := gin.New()
+	router.GET("/events", func(c *gin.Context) {
+		c.Set("user_id", "consumer1")
+		c.Set("role", "consumer")
+	}, handler.Stream)
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return hub, server.URL + "/events"
+}
+
+func openEventStream(t *testing.T, url, lastEventID string) *bufio.Reader {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	require.NoError(t, err)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	return bufio.NewReader(resp.Body)
+}
+
+func TestEventStreamHandler_StreamsEvents(t *testing.T) {
+	hub, url := startEventStream(t, websocket.DefaultConfig(), &stubEventStore{})
+	reader := openEventStream(t, url, "")
+	require.Eventually(t, func() bool { return hub.ClientCount() == 1 }, time.Second, time.Millisecond)
+
+	hub.SendToUser("consumer1", websocket.Message{Type: websocket.MessageTypeOrderStatus, Data: gin.H{"id": "order1"}})
+
+	event := readSSE(t, reader)
+	assert.Equal(t, "1", event.id)
+	assert.Equal(t, websocket.MessageTypeOrderStatus, event.event)
+	assert.JSONEq(t, `{"id":"order1"}`, event.data)
+}
+
+func TestEventStreamHandler_ResumesFromLastEventID(t *testing.T) {
+	store := &stubEventStore{}
+	for _, payload := range []string{`"one"`, `"two"`, `"three"`} {
+		store.AppendToUser("consumer1", websocket.MessageTypeNewMessage, []byte(payload))
+	}
+	_, url := startEventStream(t, websocket.DefaultConfig(), store)
+
+	reader := openEventStream(t, url, "1")
+
+	event := readSSE(t, reader)
+	assert.Equal(t, "2", event.id)
+	assert.Equal(t, `"two"`, event.data)
+	event = readSSE(t, reader)
+	assert.Equal(t, "3", event.id)
+
+	event = readSSE(t, reader)
+	assert.Equal(t, websocket.MessageTypeResumed, event.event)
+	assert.Equal(t, "3", event.id)
+}
+
+func TestEventStreamHandler_Keepalive(t *testing.T) {
+	config := websocket.Config{PingInterval: 20 * time.Millisecond, PongTimeout: time.Second}
+	_, url := startEventStream(t, config, nil)
+
+	reader := openEventStream(t, url, "")
+
+	assert.Equal(t, "keepalive", readSSE(t, reader).comment)
+}
+
+func TestEventStreamHandler_InvalidLastEventID(t *testing.T) {
+	_, url := startEventStream(t, websocket.DefaultConfig(), &stubEventStore{})
+
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("Last-Event-ID", "not-a-number")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
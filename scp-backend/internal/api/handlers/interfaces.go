@@ -1,6 +1,9 @@
 package handlers
 
 import (
+	"time"
+
+	"github.com/scp-platform/backend/internal/api/websocket"
 	"github.com/scp-platform/backend/internal/models"
 	"github.com/scp-platform/backend/internal/services"
 )
@@ -9,15 +12,30 @@ import (
 type ConversationRepositoryInterface interface {
 	GetByID(id string) (*models.Conversation, error)
 	GetByConsumerID(consumerID string) ([]models.Conversation, error)
-	GetBySupplierID(supplierID string) ([]models.Conversation, error)
-	GetOrCreate(consumerID, supplierID string) (*models.Conversation, error)
+	GetBySupplierID(supplierID, staffID, assignment string) ([]models.Conversation, error)
+	GetOrCreate(consumerID, supplierID string, subject models.ThreadSubject) (*models.Conversation, error)
 	UpdateLastMessage(conversationID string) error
+	GetUnreadSummary(userID, role, supplierID string) ([]models.UnreadConversation, error)
 }
 
 type MessageRepositoryInterface interface {
-	GetByConversationID(conversationID string, page, pageSize int) ([]models.Message, error)
+	GetByID(id string) (*models.Message, error)
+	GetByConversationID(conversationID string, page models.MessagePage) ([]models.Message, bool, error)
+	GetTranscript(conversationID string) ([]models.Message, error)
 	Create(message *models.Message) error
-	MarkAsRead(conversationID string, userID string) error
+	MarkAsRead(conversationID, userID, userRole, upToMessageID string) (*models.ReadCursor, error)
+	Edit(message *models.Message, editorID, content string) error
+	SoftDelete(message *models.Message, deleterID string) error
+	GetRevisions(messageID string) ([]models.MessageRevision, error)
+	Search(search models.MessageSearch) ([]models.MessageSearchResult, int, error)
+}
+
+type CannedReplyRepositoryInterface interface {
+	GetByID(id string) (*models.CannedReply, error)
+	GetBySupplierID(supplierID string) ([]models.CannedReply, error)
+	Create(reply *models.CannedReply) error
+	Update(reply *models.CannedReply) error
+	Delete(id string) error
 }
 
 type OrderRepositoryInterface interface {
@@ -27,9 +45,44 @@ type OrderRepositoryInterface interface {
 	Update(order *models.Order) error
 }
 
+type ChatServiceInterface interface {
+	GetConversation(conversationID string, user services.ChatUser) (*models.Conversation, error)
+	OpenConversation(user services.ChatUser, counterpartID string, subject models.ThreadSubject) (*models.Conversation, error)
+	OpenOrderConversation(user services.ChatUser, orderID string) (*models.Conversation, error)
+	RouteConversation(conversation *models.Conversation) (*models.Message, error)
+	AssignConversation(conversation *models.Conversation, assigneeID *string, actor services.ChatUser) (*models.Message, error)
+	ComposeMessage(conversation *models.Conversation, sender services.ChatUser, draft services.MessageDraft) (*models.Message, error)
+	AnnounceEscalation(complaint *models.Complaint, actor services.ChatUser) (*models.Conversation, *models.Message, error)
+	EditMessage(conversation *models.Conversation, messageID string, user services.ChatUser, content string) (*models.Message, error)
+	DeleteMessage(conversation *models.Conversation, messageID string, user services.ChatUser) (*models.Message, error)
+	NotifyMentions(conversation *models.Conversation, message *models.Message) ([]models.Notification, error)
+	AwayReply(conversation *models.Conversation, sender services.ChatUser, now time.Time) (*models.Message, error)
+	Transcript(conversation *models.Conversation, messages []models.Message, baseURL string, now time.Time) (*services.Transcript, error)
+}
+
+type CannedReplyServiceInterface interface {
+	Render(replyID string, conversation *models.Conversation, orderID string) (string, error)
+	RecordUsage(replyID string) error
+}
+
 type OrderServiceInterface interface {
 	CreateOrder(consumerID string, req services.CreateOrderRequest) (*models.Order, error)
-	AcceptOrder(orderID, supplierID string) error
-	RejectOrder(orderID, supplierID string) error
+	AcceptOrder(orderID string, actor services.OrderActor) (*models.Order, error)
+	RejectOrder(orderID string, actor services.OrderActor, reason string) (*models.Order, error)
+	TransitionOrder(orderID string, actor services.OrderActor, status, reason string) (*models.Order, error)
+	Timeline(orderID string, actor services.OrderActor) ([]models.OrderEvent, error)
+	CancelOrder(orderID string, actor services.OrderActor, reason string) (*models.Order, *models.OrderEvent, error)
+	ApproveCancellation(orderID string, actor services.OrderActor) (*models.Order, *models.OrderEvent, error)
+	DeclineCancellation(orderID string, actor services.OrderActor, reason string) (*models.Order, *models.OrderEvent, error)
+	NotifyOrderEvent(order *models.Order, event *models.OrderEvent) ([]models.Notification, error)
+	ProposeCounterOffer(orderID string, actor services.OrderActor, lines []services.CounterOfferLine, reason string) (*models.Order, *models.OrderEvent, error)
+	AcceptCounterOffer(orderID string, actor services.OrderActor) (*models.Order, *models.OrderEvent, error)
+	DeclineCounterOffer(orderID string, actor services.OrderActor, reason string) (*models.Order, *models.OrderEvent, error)
+	Revisions(orderID string, actor services.OrderActor) ([]models.OrderRevision, error)
 }
 
+// RealtimePublisher pushes events to connected WebSocket clients.
+type RealtimePublisher interface {
+	SendToUser(userID string, message websocket.Message)
+	SendToSupplier(supplierID string, message websocket.Message)
+}
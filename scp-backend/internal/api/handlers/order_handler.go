@@ -1,24 +1,46 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/scp-platform/backend/internal/api/websocket"
+	"github.com/scp-platform/backend/internal/models"
 	"github.com/scp-platform/backend/internal/services"
 )
 
 type OrderHandler struct {
 	orderService OrderServiceInterface
 	orderRepo    OrderRepositoryInterface
+	publisher    RealtimePublisher
 }
 
-func NewOrderHandler(orderService OrderServiceInterface, orderRepo OrderRepositoryInterface) *OrderHandler {
+func NewOrderHandler(orderService OrderServiceInterface, orderRepo OrderRepositoryInterface, publisher RealtimePublisher) *OrderHandler {
 	return &OrderHandler{
 		orderService: orderService,
 		orderRepo:    orderRepo,
+		publisher:    publisher,
 	}
 }
 
+// publishOrderStatus pushes an order's new state to the consumer and the
+// supplier's staff.
+func (h *OrderHandler) publishOrderStatus(order *models.Order) {
+	if h.publisher == nil || order == nil {
+		return
+	}
+
+	event := websocket.Message{
+		Type: websocket.MessageTypeOrderStatus,
+		Data: order,
+	}
+	h.publisher.SendToUser(order.ConsumerID, event)
+	h.publisher.SendToSupplier(order.SupplierID, event)
+}
+
 func (h *OrderHandler) CreateOrder(c *gin.Context) {
 	consumerID := c.GetString("user_id")
 
@@ -53,6 +75,8 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 		return
 	}
 
+	h.publishOrderStatus(order)
+
 	// Return order directly as expected by Flutter frontend
 	c.JSON(http.StatusCreated, order)
 }
@@ -133,29 +157,67 @@ func (h *OrderHandler) GetSupplierOrders(c *gin.Context) {
 }
 
 func (h *OrderHandler) AcceptOrder(c *gin.Context) {
-	orderID := c.Param("id")
-	supplierID := c.GetString("supplier_id")
-
-	if err := h.orderService.AcceptOrder(orderID, supplierID); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse(err.Error()))
+	order, err := h.orderService.AcceptOrder(c.Param("id"), orderActor(c))
+	if err != nil {
+		respondOrderError(c, err)
 		return
 	}
 
-	order, _ := h.orderRepo.GetByID(orderID)
+	h.publishOrderStatus(order)
+
 	// Return order directly as expected by Flutter frontend
 	c.JSON(http.StatusOK, order)
 }
 
 func (h *OrderHandler) RejectOrder(c *gin.Context) {
-	orderID := c.Param("id")
-	supplierID := c.GetString("supplier_id")
+	reason, ok := orderReason(c)
+	if !ok {
+		return
+	}
 
-	if err := h.orderService.RejectOrder(orderID, supplierID); err != nil {
+	order, err := h.orderService.RejectOrder(c.Param("id"), orderActor(c), reason)
+	if err != nil {
+		respondOrderError(c, err)
+		return
+	}
+
+	h.publishOrderStatus(order)
+
+	// Return order directly as expected by Flutter frontend
+	c.JSON(http.StatusOK, order)
+}
+
+// UpdateOrderStatus moves an order to the status in the body, e.g. from
+// accepted to preparing, as far as the order lifecycle allows. The
+// optional reason is kept in the order's timeline. Orders are rejected and
+// cancelled through their own endpoints, which also settle cancellation
+// requests and notify both sides.
+func (h *OrderHandler) UpdateOrderStatus(c *gin.Context) {
+	var req struct {
+		Status string `json:"status" binding:"required"`
+		Reason string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, ErrorResponse(err.Error()))
 		return
 	}
+	switch req.Status {
+	case models.OrderStatusRejected:
+		c.JSON(http.StatusBadRequest, ErrorResponse("Use POST /orders/:id/reject to reject an order"))
+		return
+	case models.OrderStatusCancelled:
+		c.JSON(http.StatusBadRequest, ErrorResponse("Use POST /orders/:id/cancel to cancel an order"))
+		return
+	}
+
+	order, err := h.orderService.TransitionOrder(c.Param("id"), orderActor(c), req.Status, req.Reason)
+	if err != nil {
+		respondOrderError(c, err)
+		return
+	}
+
+	h.publishOrderStatus(order)
 
-	order, _ := h.orderRepo.GetByID(orderID)
 	// Return order directly as expected by Flutter frontend
 	c.JSON(http.StatusOK, order)
 }
@@ -170,10 +232,10 @@ func (h *OrderHandler) GetCurrentOrders(c *gin.Context) {
 		return
 	}
 
-	// Filter to only pending/accepted orders (current/active)
+	// Filter to orders still under way (current/active)
 	currentOrders := []interface{}{}
 	for _, order := range orders {
-		if order.Status == "pending" || order.Status == "accepted" {
+		if order.IsCurrent() {
 			currentOrders = append(currentOrders, order)
 		}
 	}
@@ -182,33 +244,248 @@ func (h *OrderHandler) GetCurrentOrders(c *gin.Context) {
 	c.JSON(http.StatusOK, PaginatedResponse(currentOrders, page, pageSize, len(currentOrders)))
 }
 
+// CompleteOrder confirms that a delivered order arrived.
+func (h *OrderHandler) CompleteOrder(c *gin.Context) {
+	reason, ok := orderReason(c)
+	if !ok {
+		return
+	}
+
+	order, err := h.orderService.TransitionOrder(c.Param("id"), orderActor(c), models.OrderStatusCompleted, reason)
+	if err != nil {
+		respondOrderError(c, err)
+		return
+	}
+
+	h.publishOrderStatus(order)
+
+	// Return order directly as expected by Flutter frontend
+	c.JSON(http.StatusOK, order)
+}
+
+// CancelOrder cancels an order for the consumer or the supplier. A
+// consumer whose order the supplier has already accepted only asks to
+// cancel it, which is answered with 202.
 func (h *OrderHandler) CancelOrder(c *gin.Context) {
-	orderID := c.Param("id")
-	consumerID := c.GetString("user_id")
+	reason, ok := orderReason(c)
+	if !ok {
+		return
+	}
 
-	order, err := h.orderRepo.GetByID(orderID)
+	order, event, err := h.orderService.CancelOrder(c.Param("id"), orderActor(c), reason)
 	if err != nil {
-		c.JSON(http.StatusNotFound, ErrorResponse("Order not found"))
+		respondOrderError(c, err)
 		return
 	}
 
-	if order.ConsumerID != consumerID {
-		c.JSON(http.StatusForbidden, ErrorResponse("Unauthorized"))
+	h.publishOrderStatus(order)
+	h.notifyOrderEvent(order, event)
+
+	status := http.StatusOK
+	if event.Kind == models.OrderEventCancellationRequested {
+		status = http.StatusAccepted
+	}
+	// Return order directly as expected by Flutter frontend
+	c.JSON(status, order)
+}
+
+// ApproveCancellation cancels an order whose consumer asked to cancel it.
+func (h *OrderHandler) ApproveCancellation(c *gin.Context) {
+	order, event, err := h.orderService.ApproveCancellation(c.Param("id"), orderActor(c))
+	if err != nil {
+		respondOrderError(c, err)
 		return
 	}
 
-	if order.Status != "pending" {
-		c.JSON(http.StatusBadRequest, ErrorResponse("Only pending orders can be cancelled"))
+	h.publishOrderStatus(order)
+	h.notifyOrderEvent(order, event)
+
+	// Return order directly as expected by Flutter frontend
+	c.JSON(http.StatusOK, order)
+}
+
+// DeclineCancellation turns down a consumer's request to cancel an order.
+func (h *OrderHandler) DeclineCancellation(c *gin.Context) {
+	reason, ok := orderReason(c)
+	if !ok {
 		return
 	}
 
-	order.Status = "cancelled"
-	if err := h.orderRepo.Update(order); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse(err.Error()))
+	order, event, err := h.orderService.DeclineCancellation(c.Param("id"), orderActor(c), reason)
+	if err != nil {
+		respondOrderError(c, err)
 		return
 	}
 
+	h.publishOrderStatus(order)
+	h.notifyOrderEvent(order, event)
+
 	// Return order directly as expected by Flutter frontend
 	c.JSON(http.StatusOK, order)
 }
 
+// ProposeCounterOffer offers the consumer of a pending order changed
+// quantities or prices, or substitute products, instead of what they
+// ordered.
+func (h *OrderHandler) ProposeCounterOffer(c *gin.Context) {
+	var req struct {
+		Items []struct {
+			ProductID string   `json:"product_id" binding:"required"`
+			Quantity  int      `json:"quantity" binding:"required,gt=0"`
+			UnitPrice *float64 `json:"unit_price" binding:"omitempty,gte=0"`
+		} `json:"items" binding:"required,min=1,dive"`
+		Reason string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(err.Error()))
+		return
+	}
+
+	lines := make([]services.CounterOfferLine, len(req.Items))
+	for i, item := range req.Items {
+		lines[i] = services.CounterOfferLine{
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+			UnitPrice: item.UnitPrice,
+		}
+	}
+
+	order, event, err := h.orderService.ProposeCounterOffer(c.Param("id"), orderActor(c), lines, req.Reason)
+	if err != nil {
+		respondOrderError(c, err)
+		return
+	}
+
+	h.publishOrderStatus(order)
+	h.notifyOrderEvent(order, event)
+
+	// Return order directly as expected by Flutter frontend
+	c.JSON(http.StatusOK, order)
+}
+
+// AcceptCounterOffer takes the supplier's counter-offer, which accepts the
+// order with the offered lines.
+func (h *OrderHandler) AcceptCounterOffer(c *gin.Context) {
+	order, event, err := h.orderService.AcceptCounterOffer(c.Param("id"), orderActor(c))
+	if err != nil {
+		respondOrderError(c, err)
+		return
+	}
+
+	h.publishOrderStatus(order)
+	h.notifyOrderEvent(order, event)
+
+	// Return order directly as expected by Flutter frontend
+	c.JSON(http.StatusOK, order)
+}
+
+// DeclineCounterOffer turns down the supplier's counter-offer, leaving the
+// order pending as it was placed.
+func (h *OrderHandler) DeclineCounterOffer(c *gin.Context) {
+	reason, ok := orderReason(c)
+	if !ok {
+		return
+	}
+
+	order, event, err := h.orderService.DeclineCounterOffer(c.Param("id"), orderActor(c), reason)
+	if err != nil {
+		respondOrderError(c, err)
+		return
+	}
+
+	h.publishOrderStatus(order)
+	h.notifyOrderEvent(order, event)
+
+	// Return order directly as expected by Flutter frontend
+	c.JSON(http.StatusOK, order)
+}
+
+// GetOrderRevisions returns every version of the lines of one of the
+// caller's orders, oldest first.
+func (h *OrderHandler) GetOrderRevisions(c *gin.Context) {
+	revisions, err := h.orderService.Revisions(c.Param("id"), orderActor(c))
+	if err != nil {
+		respondOrderError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(gin.H{
+		"revisions": revisions,
+	}))
+}
+
+// notifyOrderEvent notifies both sides of a cancellation, a request to
+// cancel or a counter-offer, and pushes the notifications to them.
+func (h *OrderHandler) notifyOrderEvent(order *models.Order, event *models.OrderEvent) {
+	notifications, err := h.orderService.NotifyOrderEvent(order, event)
+	if err != nil {
+		fmt.Printf("⚠️  [ORDER] Failed to notify about order %s: %v\n", order.ID, err)
+	}
+	if h.publisher == nil {
+		return
+	}
+	for _, notification := range notifications {
+		h.publisher.SendToUser(notification.UserID, websocket.Message{
+			Type: websocket.MessageTypeNotification,
+			Data: notification,
+		})
+	}
+}
+
+// GetOrderTimeline returns every status change of one of the caller's
+// orders, oldest first.
+func (h *OrderHandler) GetOrderTimeline(c *gin.Context) {
+	events, err := h.orderService.Timeline(c.Param("id"), orderActor(c))
+	if err != nil {
+		respondOrderError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(gin.H{
+		"events": events,
+	}))
+}
+
+func orderActor(c *gin.Context) services.OrderActor {
+	return services.OrderActor{
+		ID:         c.GetString("user_id"),
+		Role:       c.GetString("role"),
+		SupplierID: c.GetString("supplier_id"),
+	}
+}
+
+// orderReason reads the optional {"reason"} body of an order status
+// change. It answers 400 and returns false if the body is malformed.
+func orderReason(c *gin.Context) (string, bool) {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, ErrorResponse(err.Error()))
+		return "", false
+	}
+	return req.Reason, true
+}
+
+// respondOrderError answers with the status matching an order service
+// error.
+func respondOrderError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrOrderNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse("Order not found"))
+	case errors.Is(err, services.ErrNotOrderParty):
+		c.JSON(http.StatusForbidden, ErrorResponse("Unauthorized"))
+	case errors.Is(err, services.ErrOrderTransitionForbidden):
+		c.JSON(http.StatusForbidden, ErrorResponse(err.Error()))
+	case errors.Is(err, services.ErrIllegalOrderTransition):
+		c.JSON(http.StatusConflict, ErrorResponse(err.Error()))
+	case errors.Is(err, services.ErrOrderReasonRequired):
+		c.JSON(http.StatusBadRequest, ErrorResponse(err.Error()))
+	case errors.Is(err, services.ErrCancellationRequested), errors.Is(err, services.ErrNoCancellationRequest):
+		c.JSON(http.StatusConflict, ErrorResponse(err.Error()))
+	case errors.Is(err, services.ErrNoCounterOffer):
+		c.JSON(http.StatusConflict, ErrorResponse(err.Error()))
+	default:
+		c.JSON(http.StatusBadRequest, ErrorResponse(err.Error()))
+	}
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -10,6 +11,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/scp-platform/backend/internal/api/websocket"
 	"github.com/scp-platform/backend/internal/models"
 	"github.com/scp-platform/backend/internal/services"
 )
@@ -27,14 +29,86 @@ func (m *MockOrderService) CreateOrder(consumerID string, req services.CreateOrd
 	return args.Get(0).(*models.Order), args.Error(1)
 }
 
-func (m *MockOrderService) AcceptOrder(orderID, supplierID string) error {
-	args := m.Called(orderID, supplierID)
-	return args.Error(0)
+func (m *MockOrderService) AcceptOrder(orderID string, actor services.OrderActor) (*models.Order, error) {
+	args := m.Called(orderID, actor)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Order), args.Error(1)
 }
 
-func (m *MockOrderService) RejectOrder(orderID, supplierID string) error {
-	args := m.Called(orderID, supplierID)
-	return args.Error(0)
+func (m *MockOrderService) RejectOrder(orderID string, actor services.OrderActor, reason string) (*models.Order, error) {
+	args := m.Called(orderID, actor, reason)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Order), args.Error(1)
+}
+
+func (m *MockOrderService) TransitionOrder(orderID string, actor services.OrderActor, status, reason string) (*models.Order, error) {
+	args := m.Called(orderID, actor, status, reason)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Order), args.Error(1)
+}
+
+func (m *MockOrderService) CancelOrder(orderID string, actor services.OrderActor, reason string) (*models.Order, *models.OrderEvent, error) {
+	args := m.Called(orderID, actor, reason)
+	return orderAndEvent(args)
+}
+
+func (m *MockOrderService) ApproveCancellation(orderID string, actor services.OrderActor) (*models.Order, *models.OrderEvent, error) {
+	args := m.Called(orderID, actor)
+	return orderAndEvent(args)
+}
+
+func (m *MockOrderService) DeclineCancellation(orderID string, actor services.OrderActor, reason string) (*models.Order, *models.OrderEvent, error) {
+	args := m.Called(orderID, actor, reason)
+	return orderAndEvent(args)
+}
+
+func orderAndEvent(args mock.Arguments) (*models.Order, *models.OrderEvent, error) {
+	if args.Get(0) == nil {
+		return nil, nil, args.Error(2)
+	}
+	return args.Get(0).(*models.Order), args.Get(1).(*models.OrderEvent), args.Error(2)
+}
+
+func (m *MockOrderService) NotifyOrderEvent(order *models.Order, event *models.OrderEvent) ([]models.Notification, error) {
+	args := m.Called(order, event)
+	return args.Get(0).([]models.Notification), args.Error(1)
+}
+
+func (m *MockOrderService) ProposeCounterOffer(orderID string, actor services.OrderActor, lines []services.CounterOfferLine, reason string) (*models.Order, *models.OrderEvent, error) {
+	args := m.Called(orderID, actor, lines, reason)
+	return orderAndEvent(args)
+}
+
+func (m *MockOrderService) AcceptCounterOffer(orderID string, actor services.OrderActor) (*models.Order, *models.OrderEvent, error) {
+	args := m.Called(orderID, actor)
+	return orderAndEvent(args)
+}
+
+func (m *MockOrderService) DeclineCounterOffer(orderID string, actor services.OrderActor, reason string) (*models.Order, *models.OrderEvent, error) {
+	args := m.Called(orderID, actor, reason)
+	return orderAndEvent(args)
+}
+
+func (m *MockOrderService) Revisions(orderID string, actor services.OrderActor) ([]models.OrderRevision, error) {
+	args := m.Called(orderID, actor)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.OrderRevision), args.Error(1)
+}
+
+func (m *MockOrderService) Timeline(orderID string, actor services.OrderActor) ([]models.OrderEvent, error) {
+	args := m.Called(orderID, actor)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.OrderEvent), args.Error(1)
 }
 
 type MockOrderRepository struct {
@@ -76,7 +150,7 @@ func TestOrderHandler_GetOrders(t *testing.T) {
 
 	mockOrderRepo.On("GetByConsumerID", "consumer1", 1, 20).Return(mockOrders, 1, nil)
 
-	handler := NewOrderHandler(mockOrderService, mockOrderRepo)
+	handler := NewOrderHandler(mockOrderService, mockOrderRepo, nil)
 
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
@@ -117,7 +191,7 @@ func TestOrderHandler_CreateOrder(t *testing.T) {
 
 	mockOrderService.On("CreateOrder", "consumer1", orderReq).Return(mockOrder, nil)
 
-	handler := NewOrderHandler(mockOrderService, mockOrderRepo)
+	handler := NewOrderHandler(mockOrderService, mockOrderRepo, nil)
 
 	reqBody, _ := json.Marshal(map[string]interface{}{
 		"supplier_id": "supplier1",
@@ -144,3 +218,336 @@ func TestOrderHandler_CreateOrder(t *testing.T) {
 	mockOrderService.AssertExpectations(t)
 }
 
+func TestOrderHandler_AcceptOrder_PublishesOrderStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockOrderService := new(MockOrderService)
+	mockOrderRepo := new(MockOrderRepository)
+	mockPublisher := new(MockRealtimePublisher)
+
+	order := &models.Order{ID: "order1", ConsumerID: "consumer1", SupplierID: "supplier1", Status: "accepted"}
+	actor := services.OrderActor{ID: "manager1", Role: "manager", SupplierID: "supplier1"}
+	mockOrderService.On("AcceptOrder", "order1", actor).Return(order, nil)
+
+	isOrderStatus := mock.MatchedBy(func(message websocket.Message) bool {
+		return message.Type == websocket.MessageTypeOrderStatus && message.Data == order
+	})
+	mockPublisher.On("SendToUser", "consumer1", isOrderStatus).Return()
+	mockPublisher.On("SendToSupplier", "supplier1", isOrderStatus).Return()
+
+	handler := NewOrderHandler(mockOrderService, mockOrderRepo, mockPublisher)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set("user_id", "manager1")
+	c.Set("role", "manager")
+	c.Set("supplier_id", "supplier1")
+	c.Params = gin.Params{{Key: "id", Value: "order1"}}
+	c.Request = httptest.NewRequest("POST", "/orders/order1/accept", nil)
+
+	handler.AcceptOrder(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockPublisher.AssertExpectations(t)
+}
+
+func TestOrderHandler_UpdateOrderStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockOrderService := new(MockOrderService)
+	mockPublisher := new(MockRealtimePublisher)
+
+	actor := services.OrderActor{ID: "rep1", Role: "sales_rep", SupplierID: "supplier1"}
+	order := &models.Order{ID: "order1", ConsumerID: "consumer1", SupplierID: "supplier1", Status: models.OrderStatusPreparing}
+	mockOrderService.On("TransitionOrder", "order1", actor, models.OrderStatusPreparing, "").Return(order, nil)
+	mockPublisher.On("SendToUser", "consumer1", mock.Anything).Return()
+	mockPublisher.On("SendToSupplier", "supplier1", mock.Anything).Return()
+
+	handler := NewOrderHandler(mockOrderService, new(MockOrderRepository), mockPublisher)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set("user_id", "rep1")
+	c.Set("role", "sales_rep")
+	c.Set("supplier_id", "supplier1")
+	c.Params = gin.Params{{Key: "id", Value: "order1"}}
+	c.Request = httptest.NewRequest("POST", "/orders/order1/status", bytes.NewBufferString(`{"status":"preparing"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	handler.UpdateOrderStatus(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockOrderService.AssertExpectations(t)
+	mockPublisher.AssertExpectations(t)
+}
+
+func TestOrderHandler_UpdateOrderStatus_CancelOrReject(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for _, status := range []string{models.OrderStatusCancelled, models.OrderStatusRejected} {
+		t.Run(status, func(t *testing.T) {
+			mockOrderService := new(MockOrderService)
+			mockPublisher := new(MockRealtimePublisher)
+			handler := NewOrderHandler(mockOrderService, new(MockOrderRepository), mockPublisher)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set("user_id", "manager1")
+			c.Set("role", "manager")
+			c.Set("supplier_id", "supplier1")
+			c.Params = gin.Params{{Key: "id", Value: "order1"}}
+			c.Request = httptest.NewRequest("POST", "/orders/order1/status", bytes.NewBufferString(`{"status":"`+status+`","reason":"Out of stock"}`))
+			c.Request.Header.Set("Content-Type", "application/json")
+
+			handler.UpdateOrderStatus(c)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			mockOrderService.AssertNotCalled(t, "TransitionOrder", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			mockPublisher.AssertNotCalled(t, "SendToUser", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestOrderHandler_CancelOrder_IllegalTransition(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockOrderService := new(MockOrderService)
+
+	actor := services.OrderActor{ID: "consumer1", Role: "consumer"}
+	err := fmt.Errorf("%w: out_for_delivery orders cannot become cancelled", services.ErrIllegalOrderTransition)
+	mockOrderService.On("CancelOrder", "order1", actor, "Ordered by mistake").Return(nil, nil, err)
+
+	handler := NewOrderHandler(mockOrderService, new(MockOrderRepository), nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set("user_id", "consumer1")
+	c.Set("role", "consumer")
+	c.Params = gin.Params{{Key: "id", Value: "order1"}}
+	c.Request = httptest.NewRequest("POST", "/orders/order1/cancel", bytes.NewBufferString(`{"reason":"Ordered by mistake"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	handler.CancelOrder(c)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "out_for_delivery orders cannot become cancelled")
+}
+
+func TestOrderHandler_CancelOrder_NotOwnOrder(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockOrderService := new(MockOrderService)
+
+	actor := services.OrderActor{ID: "consumer2", Role: "consumer"}
+	mockOrderService.On("CancelOrder", "order1", actor, "").Return(nil, nil, services.ErrNotOrderParty)
+
+	handler := NewOrderHandler(mockOrderService, new(MockOrderRepository), nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set("user_id", "consumer2")
+	c.Set("role", "consumer")
+	c.Params = gin.Params{{Key: "id", Value: "order1"}}
+	c.Request = httptest.NewRequest("POST", "/orders/order1/cancel", nil)
+
+	handler.CancelOrder(c)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestOrderHandler_RejectOrder_WithoutReason(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockOrderService := new(MockOrderService)
+
+	actor := services.OrderActor{ID: "manager1", Role: "manager", SupplierID: "supplier1"}
+	mockOrderService.On("RejectOrder", "order1", actor, "").Return(nil, services.ErrOrderReasonRequired)
+
+	handler := NewOrderHandler(mockOrderService, new(MockOrderRepository), nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set("user_id", "manager1")
+	c.Set("role", "manager")
+	c.Set("supplier_id", "supplier1")
+	c.Params = gin.Params{{Key: "id", Value: "order1"}}
+	c.Request = httptest.NewRequest("POST", "/orders/order1/reject", nil)
+
+	handler.RejectOrder(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "reason is required")
+}
+
+func TestOrderHandler_GetOrderTimeline(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockOrderService := new(MockOrderService)
+
+	pending := models.OrderStatusPending
+	managerID := "manager1"
+	events := []models.OrderEvent{
+		{ID: "event1", OrderID: "order1", ToStatus: models.OrderStatusPending, ActorRole: "consumer"},
+		{ID: "event2", OrderID: "order1", FromStatus: &pending, ToStatus: models.OrderStatusAccepted, ActorID: &managerID, ActorRole: "manager"},
+	}
+	actor := services.OrderActor{ID: "consumer1", Role: "consumer"}
+	mockOrderService.On("Timeline", "order1", actor).Return(events, nil)
+
+	handler := NewOrderHandler(mockOrderService, new(MockOrderRepository), nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set("user_id", "consumer1")
+	c.Set("role", "consumer")
+	c.Params = gin.Params{{Key: "id", Value: "order1"}}
+	c.Request = httptest.NewRequest("GET", "/orders/order1/timeline", nil)
+
+	handler.GetOrderTimeline(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		Data struct {
+			Events []models.OrderEvent `json:"events"`
+		} `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response.Data.Events, 2)
+	assert.Equal(t, "pending", *response.Data.Events[1].FromStatus)
+}
+
+func TestOrderHandler_CancelOrder_RequestsCancellation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockOrderService := new(MockOrderService)
+	mockPublisher := new(MockRealtimePublisher)
+
+	actor := services.OrderActor{ID: "consumer1", Role: "consumer"}
+	order := &models.Order{ID: "order1", ConsumerID: "consumer1", SupplierID: "supplier1", Status: models.OrderStatusAccepted}
+	event := &models.OrderEvent{ID: "event1", Kind: models.OrderEventCancellationRequested, ToStatus: models.OrderStatusAccepted}
+	notification := models.Notification{ID: "notification1", UserID: "manager1", Type: models.NotificationTypeOrder}
+	mockOrderService.On("CancelOrder", "order1", actor, "Event was called off").Return(order, event, nil)
+	mockOrderService.On("NotifyOrderEvent", order, event).Return([]models.Notification{notification}, nil)
+
+	mockPublisher.On("SendToUser", "consumer1", mock.Anything).Return()
+	mockPublisher.On("SendToSupplier", "supplier1", mock.Anything).Return()
+	mockPublisher.On("SendToUser", "manager1", mock.MatchedBy(func(message websocket.Message) bool {
+		return message.Type == websocket.MessageTypeNotification
+	})).Return()
+
+	handler := NewOrderHandler(mockOrderService, new(MockOrderRepository), mockPublisher)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set("user_id", "consumer1")
+	c.Set("role", "consumer")
+	c.Params = gin.Params{{Key: "id", Value: "order1"}}
+	c.Request = httptest.NewRequest("POST", "/orders/order1/cancel", bytes.NewBufferString(`{"reason":"Event was called off"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	handler.CancelOrder(c)
+
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	mockOrderService.AssertExpectations(t)
+	mockPublisher.AssertExpectations(t)
+}
+
+func TestOrderHandler_DeclineCancellation_NoRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockOrderService := new(MockOrderService)
+
+	actor := services.OrderActor{ID: "manager1", Role: "manager", SupplierID: "supplier1"}
+	mockOrderService.On("DeclineCancellation", "order1", actor, "Already on the truck").Return(nil, nil, services.ErrNoCancellationRequest)
+
+	handler := NewOrderHandler(mockOrderService, new(MockOrderRepository), nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set("user_id", "manager1")
+	c.Set("role", "manager")
+	c.Set("supplier_id", "supplier1")
+	c.Params = gin.Params{{Key: "id", Value: "order1"}}
+	c.Request = httptest.NewRequest("POST", "/orders/order1/cancellation/decline", bytes.NewBufferString(`{"reason":"Already on the truck"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	handler.DeclineCancellation(c)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestOrderHandler_ProposeCounterOffer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockOrderService := new(MockOrderService)
+
+	actor := services.OrderActor{ID: "rep1", Role: "sales_rep", SupplierID: "supplier1"}
+	price := 11.5
+	lines := []services.CounterOfferLine{
+		{ProductID: "product1", Quantity: 15},
+		{ProductID: "product2", Quantity: 5, UnitPrice: &price},
+	}
+	order := &models.Order{ID: "order1", ConsumerID: "consumer1", SupplierID: "supplier1", Status: models.OrderStatusPending}
+	event := &models.OrderEvent{ID: "event1", Kind: models.OrderEventCounterOffered, ToStatus: models.OrderStatusPending}
+	mockOrderService.On("ProposeCounterOffer", "order1", actor, lines, "Only 15 cases left").Return(order, event, nil)
+	mockOrderService.On("NotifyOrderEvent", order, event).Return([]models.Notification{}, nil)
+
+	handler := NewOrderHandler(mockOrderService, new(MockOrderRepository), nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set("user_id", "rep1")
+	c.Set("role", "sales_rep")
+	c.Set("supplier_id", "supplier1")
+	c.Params = gin.Params{{Key: "id", Value: "order1"}}
+	body := `{"items":[{"product_id":"product1","quantity":15},{"product_id":"product2","quantity":5,"unit_price":11.5}],"reason":"Only 15 cases left"}`
+	c.Request = httptest.NewRequest("POST", "/orders/order1/counter-offer", bytes.NewBufferString(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	handler.ProposeCounterOffer(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockOrderService.AssertExpectations(t)
+}
+
+func TestOrderHandler_ProposeCounterOffer_InvalidQuantity(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockOrderService := new(MockOrderService)
+	handler := NewOrderHandler(mockOrderService, new(MockOrderRepository), nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set("user_id", "rep1")
+	c.Set("role", "sales_rep")
+	c.Set("supplier_id", "supplier1")
+	c.Params = gin.Params{{Key: "id", Value: "order1"}}
+	c.Request = httptest.NewRequest("POST", "/orders/order1/counter-offer", bytes.NewBufferString(`{"items":[{"product_id":"product1","quantity":0}]}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	handler.ProposeCounterOffer(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockOrderService.AssertNotCalled(t, "ProposeCounterOffer", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestOrderHandler_AcceptCounterOffer_NoOffer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockOrderService := new(MockOrderService)
+
+	actor := services.OrderActor{ID: "consumer1", Role: "consumer"}
+	mockOrderService.On("AcceptCounterOffer", "order1", actor).Return(nil, nil, services.ErrNoCounterOffer)
+
+	handler := NewOrderHandler(mockOrderService, new(MockOrderRepository), nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set("user_id", "consumer1")
+	c.Set("role", "consumer")
+	c.Params = gin.Params{{Key: "id", Value: "order1"}}
+	c.Request = httptest.NewRequest("POST", "/orders/order1/counter-offer/accept", nil)
+
+	handler.AcceptCounterOffer(c)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
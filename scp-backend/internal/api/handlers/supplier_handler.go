@@ -1,20 +1,26 @@
 package handlers
 
 import (
+	"encoding/json"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/scp-platform/backend/internal/models"
 	"github.com/scp-platform/backend/internal/repository"
+	"github.com/scp-platform/backend/internal/services"
 )
 
 // SupplierHandler exposes supplier-specific profile/settings endpoints.
 type SupplierHandler struct {
 	supplierRepo *repository.SupplierRepository
+	userRepo     *repository.UserRepository
 }
 
-func NewSupplierHandler(supplierRepo *repository.SupplierRepository) *SupplierHandler {
+func NewSupplierHandler(supplierRepo *repository.SupplierRepository, userRepo *repository.UserRepository) *SupplierHandler {
 	return &SupplierHandler{
 		supplierRepo: supplierRepo,
+		userRepo:     userRepo,
 	}
 }
 
@@ -36,4 +42,145 @@ func (h *SupplierHandler) GetCurrentSupplier(c *gin.Context) {
 	c.JSON(http.StatusOK, supplier)
 }
 
+// UpdateRoutingStrategy sets how new conversations are routed among the
+// supplier's sales reps: "least_loaded" or "round_robin".
+func (h *SupplierHandler) UpdateRoutingStrategy(c *gin.Context) {
+	supplierID := c.GetString("supplier_id")
+	if supplierID == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse("Supplier ID not found in token"))
+		return
+	}
+
+	var req struct {
+		Strategy string `json:"strategy" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(err.Error()))
+		return
+	}
+	if req.Strategy != models.RoutingLeastLoaded && req.Strategy != models.RoutingRoundRobin {
+		c.JSON(http.StatusBadRequest, ErrorResponse("strategy must be least_loaded or round_robin"))
+		return
+	}
+
+	if err := h.supplierRepo.UpdateRoutingStrategy(supplierID, req.Strategy); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(gin.H{"routing_strategy": req.Strategy}))
+}
+
+// GetBusinessHours returns the supplier's business hours, holidays and away
+// message, and whether it is open now.
+func (h *SupplierHandler) GetBusinessHours(c *gin.Context) {
+	supplier, err := h.supplierRepo.GetByID(c.GetString("supplier_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse("Supplier not found"))
+		return
+	}
+
+	schedule, err := services.SupplierSchedule(supplier)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(businessHoursResponse(supplier, schedule)))
+}
+
+// UpdateBusinessHours replaces the supplier's business hours with
+// {"timezone", "business_hours", "holidays", "away_message"}.
+func (h *SupplierHandler) UpdateBusinessHours(c *gin.Context) {
+	supplierID := c.GetString("supplier_id")
+	if supplierID == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse("Supplier ID not found in token"))
+		return
+	}
+
+	var req struct {
+		Timezone      string                `json:"timezone" binding:"required"`
+		BusinessHours []models.OpeningHours `json:"business_hours"`
+		Holidays      []models.Holiday      `json:"holidays"`
+		AwayMessage   *string               `json:"away_message"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(err.Error()))
+		return
+	}
+	if _, err := services.NewSchedule(req.Timezone, req.BusinessHours, req.Holidays); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(err.Error()))
+		return
+	}
+
+	// Ensure we always store arrays
+	if req.BusinessHours == nil {
+		req.BusinessHours = []models.OpeningHours{}
+	}
+	if req.Holidays == nil {
+		req.Holidays = []models.Holiday{}
+	}
+	hours, _ := json.Marshal(req.BusinessHours)
+	holidays, _ := json.Marshal(req.Holidays)
+
+	if err := h.supplierRepo.UpdateBusinessHours(supplierID, req.Timezone, hours, holidays, req.AwayMessage); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(err.Error()))
+		return
+	}
+
+	supplier, err := h.supplierRepo.GetByID(supplierID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(err.Error()))
+		return
+	}
+	schedule, err := services.SupplierSchedule(supplier)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(err.Error()))
+		return
+	}
 
+	c.JSON(http.StatusOK, SuccessResponse(businessHoursResponse(supplier, schedule)))
+}
+
+func businessHoursResponse(supplier *models.Supplier, schedule *services.Schedule) gin.H {
+	return gin.H{
+		"timezone":       supplier.Timezone,
+		"business_hours": supplier.BusinessHours,
+		"holidays":       supplier.Holidays,
+		"away_message":   supplier.AwayMessage,
+		"is_open":        schedule.IsOpen(time.Now()),
+	}
+}
+
+// SetOutOfOffice lets a staff member mark themselves out of office with
+// {"out_of_office": true, "until"}, or back with {"out_of_office": false}.
+// New conversations are not routed to them meanwhile.
+func (h *SupplierHandler) SetOutOfOffice(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req struct {
+		OutOfOffice *bool      `json:"out_of_office" binding:"required"`
+		Until       *time.Time `json:"until"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(err.Error()))
+		return
+	}
+	if !*req.OutOfOffice {
+		req.Until = nil
+	}
+	if req.Until != nil && !req.Until.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, ErrorResponse("until must be in the future"))
+		return
+	}
+
+	if err := h.userRepo.SetOutOfOffice(userID, *req.OutOfOffice, req.Until); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(gin.H{
+		"out_of_office":       *req.OutOfOffice,
+		"out_of_office_until": req.Until,
+	}))
+}
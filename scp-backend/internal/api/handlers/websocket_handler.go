@@ -1,31 +1,48 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	gorillaWS "github.com/gorilla/websocket"
+	"github.com/scp-platform/backend/internal/api/middleware"
 	"github.com/scp-platform/backend/internal/api/websocket"
+	"github.com/scp-platform/backend/internal/models"
+	"github.com/scp-platform/backend/internal/repository"
+	"github.com/scp-platform/backend/internal/services"
 )
 
-var upgrader = gorillaWS.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Configure properly for production
-	},
-}
+var errNotConversationMember = errors.New("Not a member of this conversation")
 
 type WebSocketHandler struct {
-	Hub *websocket.Hub
+	Hub         *websocket.Hub
+	chatService ChatServiceInterface
+	messageRepo MessageRepositoryInterface
+	upgrader    gorillaWS.Upgrader
 }
 
-func NewWebSocketHandler(hub *websocket.Hub) *WebSocketHandler {
+// NewWebSocketHandler accepts browser connections only from allowedOrigins,
+// the same list that governs CORS. Native clients send no Origin header and
+// are always accepted.
+func NewWebSocketHandler(hub *websocket.Hub, chatService ChatServiceInterface, messageRepo MessageRepositoryInterface, allowedOrigins []string) *WebSocketHandler {
 	return &WebSocketHandler{
-		Hub: hub,
+		Hub:         hub,
+		chatService: chatService,
+		messageRepo: messageRepo,
+		upgrader: gorillaWS.Upgrader{
+			Subprotocols: []string{websocket.Subprotocol},
+			CheckOrigin: func(r *http.Request) bool {
+				origin := r.Header.Get("Origin")
+				return origin == "" || middleware.IsOriginAllowed(origin, allowedOrigins)
+			},
+		},
 	}
 }
 
 func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		return
 	}
@@ -41,11 +58,130 @@ func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
 		Conn:       conn,
 		Send:       make(chan []byte, 256),
 		Hub:        h.Hub,
+		Handler:    h,
 	}
 
-	client.Hub.Register <- client
+	h.Hub.Register(client)
 
 	go client.WritePump()
 	client.ReadPump()
 }
 
+// GetStats reports connection metrics, including slow consumers the hub
+// has dropped.
+func (h *WebSocketHandler) GetStats(c *gin.Context) {
+	c.JSON(http.StatusOK, h.Hub.Stats())
+}
+
+// HandleClientMessage serves the conversation-scoped messages of the client
+// protocol. Every one of them is refused unless the client belongs to the
+// conversation it names.
+func (h *WebSocketHandler) HandleClientMessage(client *websocket.Client, message websocket.ClientMessage) {
+	switch message.Type {
+	case websocket.ClientMessageSubscribe, websocket.ClientMessageUnsubscribe,
+		websocket.ClientMessageTyping, websocket.ClientMessageMarkRead:
+	default:
+		h.Hub.SendToClient(client, websocket.ErrorMessage(message.Type, "Unsupported message type"))
+		return
+	}
+
+	conversation, err := h.memberConversation(client, message.Data)
+	if err != nil {
+		h.Hub.SendToClient(client, websocket.ErrorMessage(message.Type, err.Error()))
+		return
+	}
+	payload := websocket.ConversationPayload{ConversationID: conversation.ID}
+
+	switch message.Type {
+	case websocket.ClientMessageSubscribe:
+		h.Hub.Subscribe(client, conversation.ID)
+		h.Hub.SendToClient(client, websocket.Message{Type: websocket.MessageTypeSubscribed, Data: payload})
+
+	case websocket.ClientMessageUnsubscribe:
+		h.Hub.Unsubscribe(client, conversation.ID)
+		h.Hub.SendToClient(client, websocket.Message{Type: websocket.MessageTypeUnsubscribed, Data: payload})
+
+	case websocket.ClientMessageMarkRead:
+		var markRead websocket.MarkReadPayload
+		json.Unmarshal(message.Data, &markRead)
+
+		cursor, err := h.messageRepo.MarkAsRead(conversation.ID, client.ID, client.Role, markRead.MessageID)
+		if errors.Is(err, repository.ErrCursorNotFound) {
+			h.Hub.SendToClient(client, websocket.ErrorMessage(message.Type, "Message not found in conversation"))
+			return
+		}
+		if err != nil {
+			h.Hub.SendToClient(client, websocket.ErrorMessage(message.Type, "Failed to mark messages as read"))
+			return
+		}
+		publishReadReceipt(h.Hub, conversation, cursor, client.Role)
+
+	case websocket.ClientMessageTyping:
+		var typing websocket.TypingPayload
+		json.Unmarshal(message.Data, &typing)
+
+		// Typing indicators only matter to people looking at the
+		// conversation, so they go to the other side's subscribers.
+		event := websocket.Message{
+			Type: websocket.MessageTypeTyping,
+			Data: gin.H{
+				"conversation_id": conversation.ID,
+				"user_id":         client.ID,
+				"role":            client.Role,
+				"is_typing":       typing.IsTyping,
+			},
+		}
+		if client.IsConsumer() {
+			h.Hub.SendToConversationStaff(conversation.ID, event)
+		} else {
+			h.Hub.SendToConversationConsumer(conversation.ID, event)
+		}
+	}
+}
+
+// memberConversation loads the conversation named in a message payload,
+// provided the client is one of its participants.
+func (h *WebSocketHandler) memberConversation(client *websocket.Client, data json.RawMessage) (*models.Conversation, error) {
+	var payload websocket.ConversationPayload
+	if err := json.Unmarshal(data, &payload); err != nil || payload.ConversationID == "" {
+		return nil, errors.New("conversation_id is required")
+	}
+
+	// Unknown conversations get the same answer as other people's, so
+	// their IDs cannot be probed.
+	conversation, err := h.chatService.GetConversation(payload.ConversationID, services.ChatUser{
+		ID:         client.ID,
+		Role:       client.Role,
+		SupplierID: client.SupplierID,
+	})
+	if err != nil {
+		return nil, errNotConversationMember
+	}
+	return conversation, nil
+}
+
+// publishReadReceipt tells the other side of a conversation how far the
+// reader has read, and the reader's own connections so that their unread
+// counts stay in step across devices.
+func publishReadReceipt(publisher RealtimePublisher, conversation *models.Conversation, cursor *models.ReadCursor, readerRole string) {
+	if publisher == nil || cursor == nil {
+		return
+	}
+
+	event := websocket.Message{
+		Type: websocket.MessageTypeMessagesRead,
+		Data: gin.H{
+			"conversation_id":      conversation.ID,
+			"reader_id":            cursor.UserID,
+			"reader_role":          readerRole,
+			"last_read_message_id": cursor.LastReadMessageID,
+			"read_at":              cursor.UpdatedAt.UTC().Format("2006-01-02T15:04:05.000Z"),
+		},
+	}
+	if readerRole == "consumer" {
+		publisher.SendToSupplier(conversation.SupplierID, event)
+	} else {
+		publisher.SendToUser(conversation.ConsumerID, event)
+	}
+	publisher.SendToUser(cursor.UserID, event)
+}
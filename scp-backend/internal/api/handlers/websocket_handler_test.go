@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	gorillaWS "github.com/gorilla/websocket"
+	"github.com/scp-platform/backend/internal/api/websocket"
+	"github.com/scp-platform/backend/internal/models"
+	"github.com/scp-platform/backend/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newWebSocketTestHandler(t *testing.T) (*WebSocketHandler, *MockConversationRepository, *MockMessageRepository) {
+	t.Helper()
+	hub := websocket.NewHub(websocket.DefaultConfig())
+	go hub.Run()
+	t.Cleanup(hub.Stop)
+
+	convRepo := new(MockConversationRepository)
+	msgRepo := new(MockMessageRepository)
+	convRepo.On("GetByID", "conv1").Return(&models.Conversation{
+		ID:         "conv1",
+		ConsumerID: "consumer1",
+		SupplierID: "supplier1",
+	}, nil)
+	convRepo.On("GetByID", mock.Anything).Return(nil, errors.New("not found"))
+
+	chatService := services.NewChatService(convRepo, new(MockConsumerLinkRepository), msgRepo, new(MockUserRepository), nil, nil, nil, nil, nil)
+	return NewWebSocketHandler(hub, chatService, msgRepo, []string{"http://localhost:3000"}), convRepo, msgRepo
+}
+
+func newWebSocketTestClient(h *WebSocketHandler, id, role, supplierID string) *websocket.Client {
+	client := &websocket.Client{
+		ID:         id,
+		Role:       role,
+		SupplierID: supplierID,
+		Send:       make(chan []byte, 16),
+		Hub:        h.Hub,
+		Handler:    h,
+	}
+	h.Hub.Register(client)
+	return client
+}
+
+func clientMessage(t *testing.T, messageType string, data interface{}) websocket.ClientMessage {
+	t.Helper()
+	raw, err := json.Marshal(data)
+	require.NoError(t, err)
+	return websocket.ClientMessage{Type: messageType, Data: raw}
+}
+
+func nextEvent(t *testing.T, client *websocket.Client) map[string]interface{} {
+	t.Helper()
+	select {
+	case frame := <-client.Send:
+		var event map[string]interface{}
+		require.NoError(t, json.Unmarshal(frame, &event))
+		return event
+	case <-time.After(time.Second):
+		t.Fatalf("no event received by %s", client.ID)
+		return nil
+	}
+}
+
+func assertNoEvent(t *testing.T, client *websocket.Client) {
+	t.Helper()
+	select {
+	case frame := <-client.Send:
+		t.Errorf("%s received an unexpected event: %s", client.ID, frame)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestWebSocketHandler_SubscribeAndTyping(t *testing.T) {
+	handler, _, _ := newWebSocketTestHandler(t)
+	consumer := newWebSocketTestClient(handler, "consumer1", "consumer", "")
+	rep := newWebSocketTestClient(handler, "rep1", "sales_rep", "supplier1")
+
+	subscribe := clientMessage(t, websocket.ClientMessageSubscribe, gin.H{"conversation_id": "conv1"})
+	handler.HandleClientMessage(consumer, subscribe)
+	handler.HandleClientMessage(rep, subscribe)
+	assert.Equal(t, websocket.MessageTypeSubscribed, nextEvent(t, consumer)["type"])
+	assert.Equal(t, websocket.MessageTypeSubscribed, nextEvent(t, rep)["type"])
+
+	handler.HandleClientMessage(consumer, clientMessage(t, websocket.ClientMessageTyping, gin.H{
+		"conversation_id": "conv1",
+		"is_typing":       true,
+	}))
+
+	event := nextEvent(t, rep)
+	assert.Equal(t, websocket.MessageTypeTyping, event["type"])
+	data := event["data"].(map[string]interface{})
+	assert.Equal(t, "conv1", data["conversation_id"])
+	assert.Equal(t, "consumer1", data["user_id"])
+	assert.Equal(t, true, data["is_typing"])
+	assertNoEvent(t, consumer)
+}
+
+func TestWebSocketHandler_MarkReadSendsReceipt(t *testing.T) {
+	handler, _, msgRepo := newWebSocketTestHandler(t)
+	consumer := newWebSocketTestClient(handler, "consumer1", "consumer", "")
+	rep := newWebSocketTestClient(handler, "rep1", "sales_rep", "supplier1")
+	cursor := &models.ReadCursor{ConversationID: "conv1", UserID: "consumer1", LastReadMessageID: "msg1"}
+	msgRepo.On("MarkAsRead", "conv1", "consumer1", "consumer", "msg1").Return(cursor, nil)
+
+	handler.HandleClientMessage(consumer, clientMessage(t, websocket.ClientMessageMarkRead, gin.H{"conversation_id": "conv1", "message_id": "msg1"}))
+
+	event := nextEvent(t, rep)
+	assert.Equal(t, websocket.MessageTypeMessagesRead, event["type"])
+	data := event["data"].(map[string]interface{})
+	assert.Equal(t, "consumer1", data["reader_id"])
+	assert.Equal(t, "msg1", data["last_read_message_id"])
+
+	// The reader's own connections learn the new position too.
+	event = nextEvent(t, consumer)
+	assert.Equal(t, websocket.MessageTypeMessagesRead, event["type"])
+	msgRepo.AssertExpectations(t)
+}
+
+func TestWebSocketHandler_RejectsNonMembers(t *testing.T) {
+	tests := []struct {
+		name       string
+		userID     string
+		role       string
+		supplierID string
+		data       interface{}
+	}{
+		{"other consumer", "consumer2", "consumer", "", gin.H{"conversation_id": "conv1"}},
+		{"other supplier's staff", "rep2", "sales_rep", "supplier2", gin.H{"conversation_id": "conv1"}},
+		{"staff without supplier", "rep3", "sales_rep", "", gin.H{"conversation_id": "conv1"}},
+		{"unknown conversation", "consumer1", "consumer", "", gin.H{"conversation_id": "missing"}},
+		{"missing conversation id", "consumer1", "consumer", "", gin.H{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, _, msgRepo := newWebSocketTestHandler(t)
+			client := newWebSocketTestClient(handler, tt.userID, tt.role, tt.supplierID)
+
+			for _, messageType := range []string{
+				websocket.ClientMessageSubscribe,
+				websocket.ClientMessageUnsubscribe,
+				websocket.ClientMessageTyping,
+				websocket.ClientMessageMarkRead,
+			} {
+				handler.HandleClientMessage(client, clientMessage(t, messageType, tt.data))
+
+				event := nextEvent(t, client)
+				assert.Equal(t, websocket.MessageTypeError, event["type"])
+				assert.Equal(t, messageType, event["data"].(map[string]interface{})["request_type"])
+			}
+			msgRepo.AssertNotCalled(t, "MarkAsRead", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestWebSocketHandler_UnsupportedType(t *testing.T) {
+	handler, _, _ := newWebSocketTestHandler(t)
+	client := newWebSocketTestClient(handler, "consumer1", "consumer", "")
+
+	handler.HandleClientMessage(client, clientMessage(t, "shout", gin.H{"conversation_id": "conv1"}))
+
+	assert.Equal(t, websocket.MessageTypeError, nextEvent(t, client)["type"])
+}
+
+func TestWebSocketHandler_OriginPolicy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler, _, _ := newWebSocketTestHandler(t)
+
+	router := gin.New()
+	router.GET("/ws", func(c *gin.Context) {
+		c.Set("user_id", "consumer1")
+		c.Set("role", "consumer")
+	}, handler.HandleWebSocket)
+	server := httptest.NewServer(router)
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+
+	tests := []struct {
+		name     string
+		origin   string
+		accepted bool
+	}{
+		{"allowed origin", "http://localhost:3000", true},
+		{"native client without origin", "", true},
+		{"foreign origin", "https://evil.example", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.origin != "" {
+				header.Set("Origin", tt.origin)
+			}
+
+			conn, resp, err := gorillaWS.DefaultDialer.Dial(url, header)
+			if tt.accepted {
+				require.NoError(t, err)
+				conn.Close()
+				return
+			}
+			require.Error(t, err)
+			assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		})
+	}
+}
+
+func TestWebSocketHandler_GetStats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler, _, _ := newWebSocketTestHandler(t)
+	newWebSocketTestClient(handler, "consumer1", "consumer", "")
+	assert.Eventually(t, func() bool { return handler.Hub.ClientCount() == 1 }, time.Second, time.Millisecond)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/health/websocket", nil)
+
+	handler.GetStats(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"connections":1,"slow_consumers_dropped":0,"connections_rejected":0}`, w.Body.String())
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/scp-platform/backend/internal/api/websocket"
 	"github.com/scp-platform/backend/pkg/jwt"
 )
 
@@ -32,17 +33,71 @@ func AuthMiddleware(jwtService *jwt.JWTService) gin.HandlerFunc {
 			return
 		}
 
-		c.Set("user_id", claims.UserID)
-		c.Set("email", claims.Email)
-		c.Set("role", claims.Role)
-		if claims.SupplierID != nil {
-			c.Set("supplier_id", *claims.SupplierID)
+		setClaims(c, claims)
+		c.Next()
+	}
+}
+
+// WebSocketAuthMiddleware authenticates WebSocket upgrade requests. Browsers
+// cannot set an Authorization header on a WebSocket, so besides the usual
+// "Bearer" header the token is also accepted from the "token" query parameter
+// or from a "bearer.<token>" entry in the Sec-WebSocket-Protocol header.
+// The Server-Sent Events streams use it too, as EventSource has the same
+// limitation.
+func WebSocketAuthMiddleware(jwtService *jwt.JWTService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := webSocketToken(c)
+		if token == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Access token required"})
+			c.Abort()
+			return
 		}
 
+		claims, err := jwtService.ValidateToken(token)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			c.Abort()
+			return
+		}
+
+		setClaims(c, claims)
 		c.Next()
 	}
 }
 
+func webSocketToken(c *gin.Context) string {
+	if authHeader := c.GetHeader("Authorization"); authHeader != "" {
+		parts := strings.Split(authHeader, " ")
+		if len(parts) == 2 && parts[0] == "Bearer" {
+			return parts[1]
+		}
+	}
+
+	if token := c.Query("token"); token != "" {
+		return token
+	}
+
+	for _, header := range c.Request.Header.Values("Sec-WebSocket-Protocol") {
+		for _, protocol := range strings.Split(header, ",") {
+			protocol = strings.TrimSpace(protocol)
+			if strings.HasPrefix(protocol, websocket.BearerProtocolPrefix) {
+				return strings.TrimPrefix(protocol, websocket.BearerProtocolPrefix)
+			}
+		}
+	}
+
+	return ""
+}
+
+func setClaims(c *gin.Context, claims *jwt.Claims) {
+	c.Set("user_id", claims.UserID)
+	c.Set("email", claims.Email)
+	c.Set("role", claims.Role)
+	if claims.SupplierID != nil {
+		c.Set("supplier_id", *claims.SupplierID)
+	}
+}
+
 func RequireRole(roles ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userRole := c.GetString("role")
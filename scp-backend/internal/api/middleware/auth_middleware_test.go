@@ -100,6 +100,78 @@ func TestAuthMiddleware_WithSupplierID(t *testing.T) {
 	assert.Equal(t, supplierID, c.GetString("supplier_id"))
 }
 
+func TestWebSocketAuthMiddleware_MissingToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	jwtService := jwt.NewJWTService("test-secret", 60, 7)
+	middleware := WebSocketAuthMiddleware(jwtService)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/ws", nil)
+
+	middleware(c)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestWebSocketAuthMiddleware_QueryToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	jwtService := jwt.NewJWTService("test-secret", 60, 7)
+	token, _, err := jwtService.GenerateTokens("user-123", "test@example.com", "consumer", nil)
+	assert.NoError(t, err)
+
+	middleware := WebSocketAuthMiddleware(jwtService)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/ws?token="+token, nil)
+
+	middleware(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "user-123", c.GetString("user_id"))
+	assert.Equal(t, "consumer", c.GetString("role"))
+}
+
+func TestWebSocketAuthMiddleware_SubprotocolToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	jwtService := jwt.NewJWTService("test-secret", 60, 7)
+	supplierID := "supplier-123"
+	token, _, err := jwtService.GenerateTokens("user-123", "test@example.com", "sales_rep", &supplierID)
+	assert.NoError(t, err)
+
+	middleware := WebSocketAuthMiddleware(jwtService)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/ws", nil)
+	c.Request.Header.Set("Sec-WebSocket-Protocol", "scp.v1, bearer."+token)
+
+	middleware(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "user-123", c.GetString("user_id"))
+	assert.Equal(t, supplierID, c.GetString("supplier_id"))
+}
+
+func TestWebSocketAuthMiddleware_InvalidToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	jwtService := jwt.NewJWTService("test-secret", 60, 7)
+	middleware := WebSocketAuthMiddleware(jwtService)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/ws?token=invalid-token", nil)
+
+	middleware(c)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
 func TestRequireRole_Allowed(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -101,3 +101,11 @@ func TestCORSMiddleware_NoOrigin(t *testing.T) {
 	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
 }
 
+func TestIsOriginAllowed(t *testing.T) {
+	allowed := []string{"http://localhost:3000", "https://example.com"}
+
+	assert.True(t, IsOriginAllowed("https://example.com", allowed))
+	assert.False(t, IsOriginAllowed("https://example.com.evil.net", allowed))
+	assert.False(t, IsOriginAllowed("", allowed))
+	assert.True(t, IsOriginAllowed("http://any-origin.com", []string{"*"}))
+}
@@ -14,9 +14,12 @@ func SetupRoutes(
 	consumerHandler *handlers.ConsumerHandler,
 	complaintHandler *handlers.ComplaintHandler,
 	chatHandler *handlers.ChatHandler,
+	cannedReplyHandler *handlers.CannedReplyHandler,
 	notificationHandler *handlers.NotificationHandler,
 	supplierHandler *handlers.SupplierHandler,
 	uploadHandler *handlers.UploadHandler,
+	webSocketHandler *handlers.WebSocketHandler,
+	eventStreamHandler *handlers.EventStreamHandler,
 	jwtService *jwt.JWTService,
 	corsOrigins []string,
 ) *gin.Engine {
@@ -31,6 +34,8 @@ func SetupRoutes(
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "ok"})
 	})
+	// Connection metrics are for staff only
+	router.GET("/health/websocket", middleware.AuthMiddleware(jwtService), middleware.RequireRole("owner", "manager"), webSocketHandler.GetStats)
 
 	// API v1 routes
 	v1 := router.Group("/api/v1")
@@ -51,6 +56,9 @@ func SetupRoutes(
 			}
 		}
 
+		// WebSocket (token accepted from header, query or subprotocol)
+		v1.GET("/ws", middleware.WebSocketAuthMiddleware(jwtService), webSocketHandler.HandleWebSocket)
+
 		// Upload routes (protected)
 		upload := v1.Group("/upload")
 		upload.Use(middleware.AuthMiddleware(jwtService))
@@ -58,6 +66,18 @@ func SetupRoutes(
 			upload.POST("", uploadHandler.UploadFile)
 		}
 
+		// Server-Sent Events fallback for networks that block WebSockets.
+		// EventSource cannot set headers, so these accept the same token
+		// locations as /ws and sit outside the header-only groups below.
+		v1.GET("/consumer/events",
+			middleware.WebSocketAuthMiddleware(jwtService),
+			middleware.RequireRole("consumer"),
+			eventStreamHandler.Stream)
+		v1.GET("/supplier/events",
+			middleware.WebSocketAuthMiddleware(jwtService),
+			middleware.RequireRole("owner", "manager", "sales_rep"),
+			eventStreamHandler.Stream)
+
 		// Consumer routes
 		consumer := v1.Group("/consumer")
 		consumer.Use(middleware.AuthMiddleware(jwtService))
@@ -76,11 +96,21 @@ func SetupRoutes(
 			consumer.GET("/orders/current", orderHandler.GetCurrentOrders)
 			consumer.GET("/orders/:id", orderHandler.GetOrder)
 			consumer.POST("/orders/:id/cancel", orderHandler.CancelOrder)
+			consumer.POST("/orders/:id/complete", orderHandler.CompleteOrder)
+			consumer.GET("/orders/:id/timeline", orderHandler.GetOrderTimeline)
+			consumer.GET("/orders/:id/revisions", orderHandler.GetOrderRevisions)
+			consumer.POST("/orders/:id/counter-offer/accept", orderHandler.AcceptCounterOffer)
+			consumer.POST("/orders/:id/counter-offer/decline", orderHandler.DeclineCounterOffer)
+			consumer.POST("/orders/:id/conversation", chatHandler.OpenOrderConversation)
 			consumer.GET("/conversations", chatHandler.GetConversations)
+			consumer.GET("/conversations/search", chatHandler.SearchConversations)
 			consumer.POST("/conversations", chatHandler.CreateConversation)
 			consumer.GET("/conversations/:id/messages", chatHandler.GetMessages)
 			consumer.POST("/conversations/:id/messages", chatHandler.SendMessage)
 			consumer.POST("/conversations/:id/messages/read", chatHandler.MarkMessagesAsRead)
+			consumer.PUT("/conversations/:id/messages/:message_id", chatHandler.EditMessage)
+			consumer.DELETE("/conversations/:id/messages/:message_id", chatHandler.DeleteMessage)
+			consumer.GET("/unread-summary", chatHandler.GetUnreadSummary)
 			consumer.GET("/notifications", notificationHandler.GetNotifications)
 			consumer.POST("/notifications/:id/read", notificationHandler.MarkAsRead)
 			consumer.POST("/notifications/mark-all-read", notificationHandler.MarkAllAsRead)
@@ -93,6 +123,10 @@ func SetupRoutes(
 		{
 			// Supplier profile
 			supplier.GET("/me", supplierHandler.GetCurrentSupplier)
+			supplier.PUT("/me/routing", middleware.RequireRole("owner", "manager"), supplierHandler.UpdateRoutingStrategy)
+			supplier.GET("/me/business-hours", supplierHandler.GetBusinessHours)
+			supplier.PUT("/me/business-hours", middleware.RequireRole("owner", "manager"), supplierHandler.UpdateBusinessHours)
+			supplier.PUT("/out-of-office", supplierHandler.SetOutOfOffice)
 
 			// Products
 			supplier.GET("/products", productHandler.GetProducts)
@@ -106,6 +140,14 @@ func SetupRoutes(
 			supplier.GET("/orders/:id", orderHandler.GetSupplierOrder)
 			supplier.POST("/orders/:id/accept", orderHandler.AcceptOrder)
 			supplier.POST("/orders/:id/reject", orderHandler.RejectOrder)
+			supplier.POST("/orders/:id/status", orderHandler.UpdateOrderStatus)
+			supplier.GET("/orders/:id/timeline", orderHandler.GetOrderTimeline)
+			supplier.POST("/orders/:id/cancel", orderHandler.CancelOrder)
+			supplier.POST("/orders/:id/cancellation/approve", orderHandler.ApproveCancellation)
+			supplier.POST("/orders/:id/cancellation/decline", orderHandler.DeclineCancellation)
+			supplier.POST("/orders/:id/counter-offer", orderHandler.ProposeCounterOffer)
+			supplier.GET("/orders/:id/revisions", orderHandler.GetOrderRevisions)
+			supplier.POST("/orders/:id/conversation", chatHandler.OpenOrderConversation)
 
 			// Consumer links
 			supplier.GET("/consumer-links", consumerHandler.GetSupplierLinksForSupplier)
@@ -120,11 +162,33 @@ func SetupRoutes(
 			supplier.POST("/complaints/:id/escalate", complaintHandler.EscalateComplaint)
 			supplier.POST("/complaints/:id/resolve", complaintHandler.ResolveComplaint)
 
-			// Conversations (for sales reps)
+			// Conversations (?assigned=mine|unassigned|all)
 			supplier.GET("/conversations", chatHandler.GetConversations)
+			supplier.GET("/conversations/search", chatHandler.SearchConversations)
 			supplier.GET("/conversations/:id/messages", chatHandler.GetMessages)
 			supplier.POST("/conversations/:id/messages", chatHandler.SendMessage)
 			supplier.POST("/conversations/:id/messages/read", chatHandler.MarkMessagesAsRead)
+			supplier.PUT("/conversations/:id/messages/:message_id", chatHandler.EditMessage)
+			supplier.DELETE("/conversations/:id/messages/:message_id", chatHandler.DeleteMessage)
+			supplier.GET("/conversations/:id/messages/:message_id/revisions", middleware.RequireRole("owner", "manager"), chatHandler.GetMessageRevisions)
+			supplier.GET("/conversations/:id/export", middleware.RequireRole("owner", "manager"), chatHandler.ExportConversation)
+			supplier.POST("/conversations/:id/canned-replies", chatHandler.SendCannedReply)
+			supplier.PUT("/conversations/:id/assignment", middleware.RequireRole("owner", "manager"), chatHandler.AssignConversation)
+			supplier.GET("/unread-summary", chatHandler.GetUnreadSummary)
+
+			// Canned replies (any staff may use them, owner/manager maintain them)
+			cannedReplies := supplier.Group("/canned-replies")
+			{
+				cannedReplies.GET("", cannedReplyHandler.GetCannedReplies)
+
+				manageCannedReplies := cannedReplies.Group("")
+				manageCannedReplies.Use(middleware.RequireRole("owner", "manager"))
+				{
+					manageCannedReplies.POST("", cannedReplyHandler.CreateCannedReply)
+					manageCannedReplies.PUT("/:id", cannedReplyHandler.UpdateCannedReply)
+					manageCannedReplies.DELETE("/:id", cannedReplyHandler.DeleteCannedReply)
+				}
+			}
 
 			// Notifications
 			supplier.GET("/notifications", notificationHandler.GetNotifications)
@@ -0,0 +1,24 @@
+package websocket
+
+import "encoding/json"
+
+// Envelope is a hub delivery on its way between API instances.
+type Envelope struct {
+	Origin string          `json:"origin"`
+	Target string          `json:"target"`
+	ID     string          `json:"id,omitempty"`
+	IDs    []string        `json:"ids,omitempty"`
+	Seq    int64           `json:"seq,omitempty"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// Backplane fans hub deliveries out to every API instance so that a message
+// stored on one replica reaches clients connected to another.
+type Backplane interface {
+	// Publish sends an envelope to all instances, including the caller.
+	Publish(envelope Envelope) error
+	// Subscribe starts delivering envelopes published by any instance to
+	// the handler. It is called once, before the hub starts running.
+	Subscribe(handler func(Envelope)) error
+	Close() error
+}
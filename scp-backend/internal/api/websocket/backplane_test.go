@@ -0,0 +1,171 @@
+package websocket
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryBackplane links hubs in the same process the way Postgres links
+// API instances: every published envelope reaches every subscriber,
+// including the publisher.
+type memoryBackplane struct {
+	mu       sync.Mutex
+	handlers []func(Envelope)
+}
+
+type memoryBackplaneConn struct {
+	bus *memoryBackplane
+}
+
+func (b *memoryBackplane) connect() *memoryBackplaneConn {
+	return &memoryBackplaneConn{bus: b}
+}
+
+func (c *memoryBackplaneConn) Publish(envelope Envelope) error {
+	c.bus.mu.Lock()
+	handlers := append([]func(Envelope){}, c.bus.handlers...)
+	c.bus.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler(envelope)
+	}
+	return nil
+}
+
+func (c *memoryBackplaneConn) Subscribe(handler func(Envelope)) error {
+	c.bus.mu.Lock()
+	defer c.bus.mu.Unlock()
+	c.bus.handlers = append(c.bus.handlers, handler)
+	return nil
+}
+
+func (c *memoryBackplaneConn) Close() error {
+	return nil
+}
+
+func startLinkedHubs(t *testing.T) (*Hub, *Hub) {
+	t.Helper()
+	bus := &memoryBackplane{}
+
+	hubA := NewHub(DefaultConfig())
+	hubB := NewHub(DefaultConfig())
+	require.NoError(t, hubA.UseBackplane(bus.connect()))
+	require.NoError(t, hubB.UseBackplane(bus.connect()))
+
+	go hubA.Run()
+	go hubB.Run()
+	t.Cleanup(hubA.Stop)
+	t.Cleanup(hubB.Stop)
+	return hubA, hubB
+}
+
+func TestHub_Backplane_SendToUserReachesOtherInstance(t *testing.T) {
+	hubA, hubB := startLinkedHubs(t)
+	local := newTestClient(hubA, "user-1", "consumer", "", 256)
+	remote := newTestClient(hubB, "user-1", "consumer", "", 256)
+	hubA.Register(local)
+	hubB.Register(remote)
+
+	hubA.SendToUser("user-1", Message{Type: "test", Data: "hello"})
+
+	var decoded Message
+	require.NoError(t, json.Unmarshal(receive(t, remote), &decoded))
+	assert.Equal(t, "test", decoded.Type)
+
+	// The local client gets the message exactly once even though the
+	// publishing hub also sees its own envelope.
+	assert.NotEmpty(t, receive(t, local))
+	assertNothingReceived(t, local)
+}
+
+func TestHub_Backplane_SendToSupplierReachesOtherInstance(t *testing.T) {
+	hubA, hubB := startLinkedHubs(t)
+	staff := newTestClient(hubB, "user-2", "sales_rep", "supplier-1", 256)
+	other := newTestClient(hubB, "user-3", "sales_rep", "supplier-2", 256)
+	hubB.Register(staff)
+	hubB.Register(other)
+
+	hubA.SendToSupplier("supplier-1", Message{Type: "test"})
+
+	assert.NotEmpty(t, receive(t, staff))
+	assertNothingReceived(t, other)
+}
+
+func TestHub_Backplane_SendToConsumerKeepsRoleFilter(t *testing.T) {
+	hubA, hubB := startLinkedHubs(t)
+	consumer := newTestClient(hubB, "user-1", "consumer", "", 256)
+	staff := newTestClient(hubB, "user-1", "owner", "", 256)
+	hubB.Register(consumer)
+	hubB.Register(staff)
+
+	hubA.SendToConsumer("user-1", Message{Type: "test"})
+
+	assert.NotEmpty(t, receive(t, consumer))
+	assertNothingReceived(t, staff)
+}
+
+func TestHub_UseBackplaneTwice(t *testing.T) {
+	bus := &memoryBackplane{}
+	hub := NewHub(DefaultConfig())
+
+	require.NoError(t, hub.UseBackplane(bus.connect()))
+	assert.Error(t, hub.UseBackplane(bus.connect()))
+}
+
+func TestDecodeNotification(t *testing.T) {
+	envelope := Envelope{
+		Origin: "instance-1",
+		Target: string(targetUser),
+		ID:     "user-1",
+		Data:   json.RawMessage(`{"type":"test","data":null}`),
+	}
+
+	t.Run("inline envelope", func(t *testing.T) {
+		payload, err := json.Marshal(notification{Envelope: &envelope})
+		require.NoError(t, err)
+
+		n, err := decodeNotification(payload)
+		require.NoError(t, err)
+		assert.Empty(t, n.Ref)
+		assert.Equal(t, envelope.Origin, n.Envelope.Origin)
+		assert.Equal(t, envelope.ID, n.Envelope.ID)
+		assert.JSONEq(t, string(envelope.Data), string(n.Envelope.Data))
+	})
+
+	t.Run("spilled reference", func(t *testing.T) {
+		payload, err := json.Marshal(notification{Ref: "payload-1"})
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"ref":"payload-1"}`, string(payload))
+
+		n, err := decodeNotification(payload)
+		require.NoError(t, err)
+		assert.Equal(t, "payload-1", n.Ref)
+	})
+
+	t.Run("empty notification", func(t *testing.T) {
+		_, err := decodeNotification([]byte(`{}`))
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+		_, err := decodeNotification([]byte(`not json`))
+		assert.Error(t, err)
+	})
+}
+
+func TestHub_Backplane_SendToUsersReachesOtherInstance(t *testing.T) {
+	hubA, hubB := startLinkedHubs(t)
+	first := newTestClient(hubB, "user-1", "consumer", "", 256)
+	second := newTestClient(hubB, "user-2", "consumer", "", 256)
+	hubB.Register(first)
+	hubB.Register(second)
+
+	hubA.SendToUsers([]string{"user-1", "user-2"}, Message{Type: "test"})
+
+	assert.NotEmpty(t, receive(t, first))
+	assert.NotEmpty(t, receive(t, second))
+}
@@ -0,0 +1,152 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type Client struct {
+	ID         string
+	Role       string
+	SupplierID string
+	Conn       *websocket.Conn
+	Send       chan []byte
+	Hub        *Hub
+	Handler    ClientMessageHandler
+
+	// Set by the hub just before it closes Send, and read by WritePump
+	// once Send is closed.
+	closeCode int
+	closeText string
+
+	// Replay state, owned by the hub's Run goroutine. Until the client
+	// resumes, liveSeqs records the events it already got; while it is
+	// resuming, live events wait in pending behind the replay.
+	resuming bool
+	resumed  bool
+	liveSeqs map[int64]struct{}
+	pending  []delivery
+
+	// Set by the hub's Run goroutine when the client reports it is idle.
+	away bool
+}
+
+// IsConsumer reports whether the client is on the consumer side of its
+// conversations rather than the supplier's staff.
+func (c *Client) IsConsumer() bool {
+	return c.Role == "consumer"
+}
+
+func (c *Client) setCloseReason(code int, text string) {
+	c.closeCode = code
+	c.closeText = text
+}
+
+// ReadPump reads frames until the connection fails or goes silent for longer
+// than the pong timeout.
+func (c *Client) ReadPump() {
+	defer func() {
+		c.Hub.Unregister(c)
+		c.Conn.Close()
+	}()
+
+	config := c.Hub.Config()
+	c.Conn.SetReadLimit(config.MaxMessageSize)
+	c.Conn.SetReadDeadline(time.Now().Add(config.PongTimeout))
+	c.Conn.SetPongHandler(func(string) error {
+		return c.Conn.SetReadDeadline(time.Now().Add(config.PongTimeout))
+	})
+
+	for {
+		_, message, err := c.Conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				log.Printf("WebSocket error: %v", err)
+			}
+			break
+		}
+		c.Conn.SetReadDeadline(time.Now().Add(config.PongTimeout))
+
+		c.handle(message)
+	}
+}
+
+func (c *Client) handle(frame []byte) {
+	var message ClientMessage
+	if err := json.Unmarshal(frame, &message); err != nil || message.Type == "" {
+		c.Hub.SendToClient(c, ErrorMessage("", "Invalid message"))
+		return
+	}
+
+	switch message.Type {
+	case ClientMessagePing:
+		c.Hub.SendToClient(c, Message{Type: MessageTypePong, Data: message.Data})
+		return
+
+	case ClientMessageResume:
+		var payload ResumePayload
+		if len(message.Data) > 0 {
+			if err := json.Unmarshal(message.Data, &payload); err != nil {
+				c.Hub.SendToClient(c, ErrorMessage(message.Type, "Invalid last_seq"))
+				return
+			}
+		}
+		c.Hub.Resume(c, payload.LastSeq)
+		return
+
+	case ClientMessagePresence:
+		var payload PresencePayload
+		if err := json.Unmarshal(message.Data, &payload); err != nil ||
+			(payload.Status != PresenceOnline && payload.Status != PresenceAway) {
+			c.Hub.SendToClient(c, ErrorMessage(message.Type, "status must be online or away"))
+			return
+		}
+		c.Hub.SetAway(c, payload.Status == PresenceAway)
+		return
+	}
+
+	if c.Handler == nil {
+		c.Hub.SendToClient(c, ErrorMessage(message.Type, "Unsupported message type"))
+		return
+	}
+	c.Handler.HandleClientMessage(c, message)
+}
+
+// WritePump writes queued messages, one per frame, and pings the peer so
+// that half-open connections are detected by ReadPump's deadline.
+func (c *Client) WritePump() {
+	config := c.Hub.Config()
+	ticker := time.NewTicker(config.PingInterval)
+	defer func() {
+		ticker.Stop()
+		c.Conn.Close()
+	}()
+
+	for {
+		select {
+		case message, ok := <-c.Send:
+			c.Conn.SetWriteDeadline(time.Now().Add(config.WriteTimeout))
+			if !ok {
+				code, text := c.closeCode, c.closeText
+				if code == 0 {
+					code = websocket.CloseNormalClosure
+				}
+				c.Conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, text))
+				return
+			}
+
+			if err := c.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+
+		case <-ticker.C:
+			c.Conn.SetWriteDeadline(time.Now().Add(config.WriteTimeout))
+			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package websocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveClients upgrades every request into a client of hub.
+func serveClients(t *testing.T, hub *Hub) string {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		client := &Client{
+			ID:   r.URL.Query().Get("user"),
+			Role: "consumer",
+			Conn: conn,
+			Send: make(chan []byte, 16),
+			Hub:  hub,
+		}
+		hub.Register(client)
+		go client.WritePump()
+		client.ReadPump()
+	}))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func dial(t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestClient_WritesOneFramePerMessage(t *testing.T) {
+	hub := startHub(t)
+	conn := dial(t, serveClients(t, hub)+"?user=user-1")
+	waitForClientCount(t, hub, 1)
+
+	hub.SendToUser("user-1", Message{Type: "first"})
+	hub.SendToUser("user-1", Message{Type: "second"})
+
+	for _, expected := range []string{"first", "second"} {
+		var message Message
+		require.NoError(t, conn.ReadJSON(&message))
+		assert.Equal(t, expected, message.Type)
+	}
+}
+
+func TestClient_PingsAndDropsSilentConnections(t *testing.T) {
+	hub := NewHub(Config{PingInterval: 20 * time.Millisecond, PongTimeout: 100 * time.Millisecond})
+	go hub.Run()
+	t.Cleanup(hub.Stop)
+	url := serveClients(t, hub)
+
+	// A connection that keeps reading answers pings and stays up.
+	alive := dial(t, url+"?user=alive")
+	pinged := make(chan struct{}, 1)
+	alive.SetPingHandler(func(data string) error {
+		select {
+		case pinged <- struct{}{}:
+		default:
+		}
+		return alive.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+	go func() {
+		for {
+			if _, _, err := alive.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	// A connection that never reads never answers pings, like a half-open
+	// mobile connection.
+	dial(t, url+"?user=silent")
+
+	waitForClientCount(t, hub, 2)
+	select {
+	case <-pinged:
+	case <-time.After(time.Second):
+		t.Fatal("server sent no ping")
+	}
+	waitForClientCount(t, hub, 1)
+}
+
+func TestClient_ReadLimit(t *testing.T) {
+	hub := NewHub(Config{MaxMessageSize: 64})
+	go hub.Run()
+	t.Cleanup(hub.Stop)
+	conn := dial(t, serveClients(t, hub)+"?user=user-1")
+	waitForClientCount(t, hub, 1)
+
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(strings.Repeat("x", 65))))
+
+	waitForClientCount(t, hub, 0)
+	_, _, err := conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseMessageTooBig), "unexpected error: %v", err)
+}
@@ -0,0 +1,62 @@
+package websocket
+
+import "time"
+
+// Config holds the connection limits applied to every client.
+type Config struct {
+	// PingInterval is how often the server pings an idle connection.
+	PingInterval time.Duration
+	// PongTimeout is how long a connection may stay silent, pongs
+	// included, before it is considered dead. It must exceed PingInterval.
+	PongTimeout time.Duration
+	// WriteTimeout bounds a single frame write.
+	WriteTimeout time.Duration
+	// MaxMessageSize is the largest frame accepted from a client, in bytes.
+	MaxMessageSize int64
+	// MaxConnectionsPerUser caps simultaneous connections per user on one
+	// instance. Zero means unlimited.
+	MaxConnectionsPerUser int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		PingInterval:          30 * time.Second,
+		PongTimeout:           60 * time.Second,
+		WriteTimeout:          10 * time.Second,
+		MaxMessageSize:        8 * 1024,
+		MaxConnectionsPerUser: 10,
+	}
+}
+
+// withDefaults fills unset fields and keeps the ping interval below the
+// pong timeout, otherwise healthy connections would time out between pings.
+func (c Config) withDefaults() Config {
+	defaults := DefaultConfig()
+	if c.PongTimeout <= 0 {
+		c.PongTimeout = defaults.PongTimeout
+	}
+	if c.PingInterval <= 0 {
+		c.PingInterval = defaults.PingInterval
+	}
+	if c.PingInterval >= c.PongTimeout {
+		c.PingInterval = c.PongTimeout * 9 / 10
+	}
+	if c.WriteTimeout <= 0 {
+		c.WriteTimeout = defaults.WriteTimeout
+	}
+	if c.MaxMessageSize <= 0 {
+		c.MaxMessageSize = defaults.MaxMessageSize
+	}
+	if c.MaxConnectionsPerUser < 0 {
+		c.MaxConnectionsPerUser = 0
+	}
+	return c
+}
+
+// Stats is a snapshot of the hub's connection metrics. Counters are totals
+// since the hub started.
+type Stats struct {
+	Connections          int64 `json:"connections"`
+	SlowConsumersDropped int64 `json:"slow_consumers_dropped"`
+	ConnectionsRejected  int64 `json:"connections_rejected"`
+}
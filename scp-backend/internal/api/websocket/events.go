@@ -0,0 +1,275 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/scp-platform/backend/internal/models"
+)
+
+const (
+	// maxReplayEvents bounds a replay so it fits in a client's Send
+	// buffer. Clients further behind are asked to resync over REST.
+	maxReplayEvents = 200
+
+	eventPurgeInterval = time.Hour
+)
+
+// durableEventTypes are kept in the recipient's event stream and replayed
+// on resume. Everything else, such as typing indicators, is live only.
+var durableEventTypes = map[string]bool{
+	MessageTypeNewMessage:     true,
+	MessageTypeOrderStatus:    true,
+	MessageTypeLinkStatus:     true,
+	MessageTypeNotification:   true,
+	MessageTypeAssignment:     true,
+	MessageTypeMessageEdited:  true,
+	MessageTypeMessageDeleted: true,
+}
+
+// EventStore persists per-user event streams.
+type EventStore interface {
+	AppendToUser(userID, eventType string, payload []byte) (int64, error)
+	AppendToSupplier(supplierID, eventType string, payload []byte) ([]models.UserEvent, error)
+	LatestSeq(userID string) (int64, error)
+	GetSince(userID string, afterSeq int64, limit int) ([]models.UserEvent, error)
+	DeleteOlderThan(cutoff time.Time) error
+}
+
+// ResumeStatus is the data of the resumed message that ends a replay.
+type ResumeStatus struct {
+	// LastSeq is the newest event the client has now been sent.
+	LastSeq  int64 `json:"last_seq"`
+	Replayed int   `json:"replayed"`
+	// ResyncRequired means events the client missed are no longer
+	// retained; it must reload its state over REST.
+	ResyncRequired bool `json:"resync_required"`
+}
+
+type replay struct {
+	client *Client
+	start  bool
+	events []delivery
+	done   Message
+}
+
+// UseEventStore keeps durable events for retention so clients can resume
+// after a reconnect. It must be called before Run.
+func (h *Hub) UseEventStore(store EventStore, retention time.Duration) {
+	h.events = store
+	h.retention = retention
+}
+
+// enqueueDurable appends a durable event to its recipients' streams and
+// delivers it with their sequence numbers. It reports false if the event
+// could not be stored, in which case it should still be sent live.
+func (h *Hub) enqueueDurable(kind targetKind, id string, message Message) bool {
+	payload, err := json.Marshal(message.Data)
+	if err != nil {
+		log.Printf("Error marshaling message: %v", err)
+		return true
+	}
+
+	var events []models.UserEvent
+	switch kind {
+	case targetSupplier:
+		// Each staff member gets the event in their own stream, so it is
+		// delivered per user rather than to the supplier as a whole.
+		events, err = h.events.AppendToSupplier(id, message.Type, payload)
+		for i := range events {
+			events[i].Payload = payload
+		}
+	default:
+		var seq int64
+		seq, err = h.events.AppendToUser(id, message.Type, payload)
+		events = []models.UserEvent{{UserID: id, Seq: seq, Type: message.Type, Payload: payload}}
+	}
+	if err != nil {
+		log.Printf("Error storing %s event: %v", message.Type, err)
+		return false
+	}
+
+	for _, event := range events {
+		d, err := eventDelivery(event)
+		if err != nil {
+			log.Printf("Error marshaling message: %v", err)
+			continue
+		}
+		if kind == targetConsumer {
+			d.kind = targetConsumer
+		}
+		h.dispatch(d)
+	}
+	return true
+}
+
+func eventDelivery(event models.UserEvent) (delivery, error) {
+	data, err := json.Marshal(Message{
+		Type: event.Type,
+		Seq:  event.Seq,
+		Data: event.Payload,
+	})
+	if err != nil {
+		return delivery{}, err
+	}
+	return delivery{kind: targetUser, id: event.UserID, seq: event.Seq, data: data}, nil
+}
+
+// Resume replays the durable events the client missed after lastSeq, then
+// switches it to live delivery. Live events arriving meanwhile are held back
+// until the replay is sent, and none is sent twice.
+func (h *Hub) Resume(client *Client, lastSeq *int64) {
+	if h.events == nil {
+		h.SendToClient(client, ErrorMessage(ClientMessageResume, "Event replay is not available"))
+		return
+	}
+
+	h.queueReplay(replay{client: client, start: true})
+
+	events, status, err := h.loadReplay(client.ID, lastSeq)
+	if err != nil {
+		log.Printf("Error loading replay for %s: %v", client.ID, err)
+		h.queueReplay(replay{client: client, done: ErrorMessage(ClientMessageResume, "Failed to load missed events")})
+		return
+	}
+	h.queueReplay(replay{client: client, events: events, done: Message{Type: MessageTypeResumed, Data: status}})
+}
+
+func (h *Hub) loadReplay(userID string, lastSeq *int64) ([]delivery, ResumeStatus, error) {
+	head, err := h.events.LatestSeq(userID)
+	if err != nil {
+		return nil, ResumeStatus{}, err
+	}
+
+	status := ResumeStatus{LastSeq: head}
+	if lastSeq == nil || *lastSeq == head {
+		return nil, status, nil
+	}
+	if *lastSeq > head {
+		status.ResyncRequired = true
+		return nil, status, nil
+	}
+
+	events, err := h.events.GetSince(userID, *lastSeq, maxReplayEvents)
+	if err != nil {
+		return nil, ResumeStatus{}, err
+	}
+
+	// Sequence numbers have no gaps, so a missing first event means it was
+	// purged, and a short read means the client is too far behind.
+	if len(events) == 0 || events[0].Seq != *lastSeq+1 || events[len(events)-1].Seq < head {
+		status.ResyncRequired = true
+		return nil, status, nil
+	}
+
+	deliveries := make([]delivery, 0, len(events))
+	for _, event := range events {
+		d, err := eventDelivery(event)
+		if err != nil {
+			return nil, ResumeStatus{}, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	status.LastSeq = events[len(events)-1].Seq
+	status.Replayed = len(deliveries)
+	return deliveries, status, nil
+}
+
+func (h *Hub) queueReplay(r replay) {
+	select {
+	case h.replays <- r:
+	case <-h.done:
+	}
+}
+
+// deliverEvent sends a durable event to a client, holding it back while a
+// replay is in progress.
+func (h *Hub) deliverEvent(client *Client, d delivery) {
+	if client.resuming {
+		if len(client.pending) >= cap(client.Send) {
+			h.dropSlowConsumer(client)
+			return
+		}
+		client.pending = append(client.pending, d)
+		return
+	}
+
+	if !client.resumed {
+		if client.liveSeqs == nil {
+			client.liveSeqs = make(map[int64]struct{})
+		}
+		if len(client.liveSeqs) < maxReplayEvents {
+			client.liveSeqs[d.seq] = struct{}{}
+		}
+	}
+	h.send(client, d.data)
+}
+
+func (h *Hub) startReplay(client *Client) {
+	if _, ok := h.clients[client]; !ok {
+		return
+	}
+	client.resuming = true
+}
+
+func (h *Hub) finishReplay(r replay) {
+	client := r.client
+	if _, ok := h.clients[client]; !ok || !client.resuming {
+		return
+	}
+
+	replayed := make(map[int64]struct{}, len(r.events))
+	for _, d := range r.events {
+		replayed[d.seq] = struct{}{}
+		if _, seen := client.liveSeqs[d.seq]; seen {
+			continue
+		}
+		if !h.send(client, d.data) {
+			return
+		}
+	}
+
+	done, err := json.Marshal(r.done)
+	if err != nil {
+		log.Printf("Error marshaling message: %v", err)
+	} else if !h.send(client, done) {
+		return
+	}
+
+	pending := client.pending
+	client.resuming = false
+	client.pending = nil
+	if r.done.Type == MessageTypeResumed {
+		client.resumed = true
+		client.liveSeqs = nil
+	}
+
+	for _, d := range pending {
+		if _, ok := replayed[d.seq]; ok {
+			continue
+		}
+		h.deliverEvent(client, d)
+	}
+}
+
+func (h *Hub) purgeEvents() {
+	if h.retention <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(eventPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := h.events.DeleteOlderThan(time.Now().Add(-h.retention)); err != nil {
+			log.Printf("Error purging expired events: %v", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-h.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/scp-platform/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryEventStore mirrors the Postgres streams: per-user gapless sequence
+// numbers and ordered reads.
+type memoryEventStore struct {
+	mu     sync.Mutex
+	heads  map[string]int64
+	events map[string][]models.UserEvent
+	staff  map[string][]string
+
+	failAppend bool
+	// getSince, when set, is closed by the test to let GetSince return.
+	getSince chan struct{}
+}
+
+func newMemoryEventStore() *memoryEventStore {
+	return &memoryEventStore{
+		heads:  make(map[string]int64),
+		events: make(map[string][]models.UserEvent),
+		staff:  make(map[string][]string),
+	}
+}
+
+func (s *memoryEventStore) AppendToUser(userID, eventType string, payload []byte) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failAppend {
+		return 0, errors.New("database unavailable")
+	}
+	return s.append(userID, eventType, payload), nil
+}
+
+func (s *memoryEventStore) AppendToSupplier(supplierID, eventType string, payload []byte) ([]models.UserEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failAppend {
+		return nil, errors.New("database unavailable")
+	}
+
+	events := []models.UserEvent{}
+	for _, userID := range s.staff[supplierID] {
+		seq := s.append(userID, eventType, payload)
+		events = append(events, models.UserEvent{UserID: userID, Seq: seq, Type: eventType})
+	}
+	return events, nil
+}
+
+func (s *memoryEventStore) append(userID, eventType string, payload []byte) int64 {
+	s.heads[userID]++
+	seq := s.heads[userID]
+	s.events[userID] = append(s.events[userID], models.UserEvent{
+		UserID:    userID,
+		Seq:       seq,
+		Type:      eventType,
+		Payload:   payload,
+		CreatedAt: time.Now(),
+	})
+	return seq
+}
+
+func (s *memoryEventStore) LatestSeq(userID string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.heads[userID], nil
+}
+
+func (s *memoryEventStore) GetSince(userID string, afterSeq int64, limit int) ([]models.UserEvent, error) {
+	if s.getSince != nil {
+		<-s.getSince
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events := []models.UserEvent{}
+	for _, event := range s.events[userID] {
+		if event.Seq > afterSeq && len(events) < limit {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (s *memoryEventStore) DeleteOlderThan(cutoff time.Time) error {
+	return nil
+}
+
+// purge drops a user's events up to and including seq.
+func (s *memoryEventStore) purge(userID string, seq int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := []models.UserEvent{}
+	for _, event := range s.events[userID] {
+		if event.Seq > seq {
+			kept = append(kept, event)
+		}
+	}
+	s.events[userID] = kept
+}
+
+func startHubWithEvents(t *testing.T, store EventStore) *Hub {
+	t.Helper()
+	hub := NewHub(DefaultConfig())
+	hub.UseEventStore(store, time.Hour)
+	go hub.Run()
+	t.Cleanup(hub.Stop)
+	return hub
+}
+
+func receiveMessage(t *testing.T, client *Client) Message {
+	t.Helper()
+	var message Message
+	require.NoError(t, json.Unmarshal(receive(t, client), &message))
+	return message
+}
+
+func resumeStatus(t *testing.T, message Message) ResumeStatus {
+	t.Helper()
+	require.Equal(t, MessageTypeResumed, message.Type)
+	data, err := json.Marshal(message.Data)
+	require.NoError(t, err)
+	var status ResumeStatus
+	require.NoError(t, json.Unmarshal(data, &status))
+	return status
+}
+
+func seqPtr(seq int64) *int64 {
+	return &seq
+}
+
+func TestHub_DurableEventsCarrySequenceNumbers(t *testing.T) {
+	store := newMemoryEventStore()
+	hub := startHubWithEvents(t, store)
+	client := newTestClient(hub, "user-1", "consumer", "", 256)
+	hub.Register(client)
+
+	hub.SendToUser("user-1", Message{Type: MessageTypeNewMessage, Data: "first"})
+	hub.SendToUser("user-1", Message{Type: MessageTypeOrderStatus, Data: "second"})
+	hub.SendToUser("user-1", Message{Type: MessageTypeTyping, Data: "live only"})
+
+	assert.Equal(t, int64(1), receiveMessage(t, client).Seq)
+	assert.Equal(t, int64(2), receiveMessage(t, client).Seq)
+	assert.Zero(t, receiveMessage(t, client).Seq)
+
+	head, _ := store.LatestSeq("user-1")
+	assert.Equal(t, int64(2), head, "live-only events are not stored")
+}
+
+func TestHub_DurableSupplierEventsUsePerUserStreams(t *testing.T) {
+	store := newMemoryEventStore()
+	store.staff["supplier-1"] = []string{"rep-1", "rep-2"}
+	store.append("rep-2", MessageTypeNewMessage, []byte(`"earlier"`))
+	hub := startHubWithEvents(t, store)
+
+	rep1 := newTestClient(hub, "rep-1", "sales_rep", "supplier-1", 256)
+	rep2 := newTestClient(hub, "rep-2", "sales_rep", "supplier-1", 256)
+	hub.Register(rep1)
+	hub.Register(rep2)
+
+	hub.SendToSupplier("supplier-1", Message{Type: MessageTypeNewMessage, Data: "hello"})
+
+	assert.Equal(t, int64(1), receiveMessage(t, rep1).Seq)
+	assert.Equal(t, int64(2), receiveMessage(t, rep2).Seq)
+}
+
+func TestHub_DurableEventFallsBackToLiveWhenStoreFails(t *testing.T) {
+	store := newMemoryEventStore()
+	store.failAppend = true
+	hub := startHubWithEvents(t, store)
+	client := newTestClient(hub, "user-1", "consumer", "", 256)
+	hub.Register(client)
+
+	hub.SendToUser("user-1", Message{Type: MessageTypeNewMessage, Data: "hello"})
+
+	message := receiveMessage(t, client)
+	assert.Equal(t, MessageTypeNewMessage, message.Type)
+	assert.Zero(t, message.Seq)
+}
+
+func TestHub_ResumeReplaysMissedEvents(t *testing.T) {
+	store := newMemoryEventStore()
+	hub := startHubWithEvents(t, store)
+
+	// Events sent while the user was offline.
+	for i := 0; i < 3; i++ {
+		store.append("user-1", MessageTypeNewMessage, []byte(`"missed"`))
+	}
+
+	client := newTestClient(hub, "user-1", "consumer", "", 256)
+	hub.Register(client)
+	hub.Resume(client, seqPtr(1))
+
+	assert.Equal(t, int64(2), receiveMessage(t, client).Seq)
+	assert.Equal(t, int64(3), receiveMessage(t, client).Seq)
+	status := resumeStatus(t, receiveMessage(t, client))
+	assert.Equal(t, ResumeStatus{LastSeq: 3, Replayed: 2}, status)
+
+	hub.SendToUser("user-1", Message{Type: MessageTypeNewMessage, Data: "live"})
+	assert.Equal(t, int64(4), receiveMessage(t, client).Seq)
+}
+
+func TestHub_ResumeSkipsEventsAlreadyDeliveredLive(t *testing.T) {
+	store := newMemoryEventStore()
+	hub := startHubWithEvents(t, store)
+	store.append("user-1", MessageTypeNewMessage, []byte(`"missed"`))
+
+	client := newTestClient(hub, "user-1", "consumer", "", 256)
+	hub.Register(client)
+	waitForClientCount(t, hub, 1)
+
+	// Arrives live between connecting and resuming.
+	hub.SendToUser("user-1", Message{Type: MessageTypeNewMessage, Data: "live"})
+	assert.Equal(t, int64(2), receiveMessage(t, client).Seq)
+
+	hub.Resume(client, seqPtr(0))
+
+	assert.Equal(t, int64(1), receiveMessage(t, client).Seq)
+	assert.Equal(t, ResumeStatus{LastSeq: 2, Replayed: 2}, resumeStatus(t, receiveMessage(t, client)))
+	assertNothingReceived(t, client)
+}
+
+func TestHub_ResumeHoldsLiveEventsUntilReplayIsSent(t *testing.T) {
+	store := newMemoryEventStore()
+	store.getSince = make(chan struct{})
+	hub := startHubWithEvents(t, store)
+	store.append("user-1", MessageTypeNewMessage, []byte(`"missed"`))
+
+	client := newTestClient(hub, "user-1", "consumer", "", 256)
+	hub.Register(client)
+
+	resumed := make(chan struct{})
+	go func() {
+		hub.Resume(client, seqPtr(0))
+		close(resumed)
+	}()
+
+	// While the replay is being loaded, a live event must wait behind it.
+	time.Sleep(20 * time.Millisecond)
+	hub.SendToUser("user-1", Message{Type: MessageTypeNewMessage, Data: "live"})
+	assertNothingReceived(t, client)
+
+	close(store.getSince)
+	<-resumed
+
+	// The live event was stored before the replay was read, so it is part
+	// of the replay and the held-back copy is not sent again.
+	assert.Equal(t, int64(1), receiveMessage(t, client).Seq)
+	assert.Equal(t, int64(2), receiveMessage(t, client).Seq)
+	assert.Equal(t, ResumeStatus{LastSeq: 2, Replayed: 2}, resumeStatus(t, receiveMessage(t, client)))
+	assertNothingReceived(t, client)
+}
+
+func TestHub_ResumeRequiresResyncWhenEventsExpired(t *testing.T) {
+	store := newMemoryEventStore()
+	hub := startHubWithEvents(t, store)
+	for i := 0; i < 3; i++ {
+		store.append("user-1", MessageTypeNewMessage, []byte(`"missed"`))
+	}
+	store.purge("user-1", 2)
+
+	client := newTestClient(hub, "user-1", "consumer", "", 256)
+	hub.Register(client)
+	hub.Resume(client, seqPtr(1))
+
+	status := resumeStatus(t, receiveMessage(t, client))
+	assert.Equal(t, ResumeStatus{LastSeq: 3, ResyncRequired: true}, status)
+}
+
+func TestHub_ResumeWithoutLastSeqReportsPosition(t *testing.T) {
+	store := newMemoryEventStore()
+	hub := startHubWithEvents(t, store)
+	store.append("user-1", MessageTypeNewMessage, []byte(`"old"`))
+
+	client := newTestClient(hub, "user-1", "consumer", "", 256)
+	hub.Register(client)
+	hub.Resume(client, nil)
+
+	assert.Equal(t, ResumeStatus{LastSeq: 1}, resumeStatus(t, receiveMessage(t, client)))
+}
+
+func TestHub_ResumeWithoutEventStore(t *testing.T) {
+	hub := startHub(t)
+	client := newTestClient(hub, "user-1", "consumer", "", 256)
+	hub.Register(client)
+
+	client.handle([]byte(`{"type":"resume","data":{"last_seq":3}}`))
+
+	assert.Equal(t, MessageTypeError, receiveMessage(t, client).Type)
+}
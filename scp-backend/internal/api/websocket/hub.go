@@ -2,172 +2,558 @@ package websocket
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
-type Client struct {
-	ID         string
-	Role       string
-	SupplierID string
-	Conn       *websocket.Conn
-	Send       chan []byte
-	Hub        *Hub
-}
+const (
+	// Subprotocol is the application protocol negotiated on upgrade. Clients
+	// that authenticate through Sec-WebSocket-Protocol must offer it alongside
+	// the bearer entry so the server has a protocol to echo back.
+	Subprotocol = "scp.v1"
 
-type Hub struct {
-	Clients    map[*Client]bool
-	Broadcast  chan []byte
-	Register   chan *Client
-	Unregister chan *Client
-}
+	// BearerProtocolPrefix marks a Sec-WebSocket-Protocol entry that carries
+	// an access token, e.g. "bearer.<jwt>".
+	BearerProtocolPrefix = "bearer."
+)
+
+// Event types pushed to connected clients.
+const (
+	MessageTypeNewMessage     = "new_message"
+	MessageTypeOrderStatus    = "order_status"
+	MessageTypeLinkStatus     = "link_status"
+	MessageTypeNotification   = "notification"
+	MessageTypeResumed        = "resumed"
+	MessageTypeTyping         = "typing"
+	MessageTypeMessagesRead   = "messages_read"
+	MessageTypePresence       = "presence"
+	MessageTypeAssignment     = "conversation_assigned"
+	MessageTypeMessageEdited  = "message_edited"
+	MessageTypeMessageDeleted = "message_deleted"
+	MessageTypeSubscribed     = "subscribed"
+	MessageTypeUnsubscribed   = "unsubscribed"
+	MessageTypePong           = "pong"
+	MessageTypeError          = "error"
+)
+
+// deliveryQueueSize bounds how many targeted sends may be waiting for the
+// Run goroutine before callers start to block.
+const deliveryQueueSize = 1024
 
 type Message struct {
-	Type string      `json:"type"`
+	Type string `json:"type"`
+	// Seq is the event's position in the recipient's stream; only events
+	// kept for replay carry one.
+	Seq  int64       `json:"seq,omitempty"`
 	Data interface{} `json:"data"`
 }
 
-func NewHub() *Hub {
+type targetKind string
+
+const (
+	targetAll      targetKind = "all"
+	targetUser     targetKind = "user"
+	targetSupplier targetKind = "supplier"
+	targetConsumer targetKind = "consumer"
+	targetUsers    targetKind = "users"
+
+	// Clients subscribed to a conversation, split by side.
+	targetConversationConsumer targetKind = "conversation_consumer"
+	targetConversationStaff    targetKind = "conversation_staff"
+
+	// A single local connection; never published to the backplane.
+	targetClient targetKind = "client"
+)
+
+type delivery struct {
+	kind   targetKind
+	id     string
+	ids    []string
+	client *Client
+	seq    int64
+	data   []byte
+}
+
+type subscription struct {
+	client         *Client
+	conversationID string
+	subscribe      bool
+}
+
+type clientSet map[*Client]struct{}
+
+// Hub routes messages to connected clients.
+//
+// All client state (the client set, the per-user, per-supplier and
+// per-conversation indexes) is owned by the Run goroutine. Other goroutines
+// only talk to the hub through channels, so a targeted send never scans
+// every connection and a client's Send channel is closed exactly once, by
+// Run.
+//
+// With a Backplane attached, every send is also published to the other API
+// instances, which deliver it to their own local clients.
+type Hub struct {
+	instanceID string
+	backplane  Backplane
+	events     EventStore
+	retention  time.Duration
+	presence   PresenceStore
+	config     Config
+
+	clients       clientSet
+	users         map[string]clientSet
+	suppliers     map[string]clientSet
+	conversations map[string]clientSet
+	subscribed    map[*Client]map[string]struct{}
+
+	register      chan *Client
+	unregister    chan *Client
+	subscriptions chan subscription
+	replays       chan replay
+	deliveries    chan delivery
+
+	presenceUpdates   chan presenceUpdate
+	presenceChanges   chan PresenceEvent
+	presenceRefreshes chan map[string]PresenceEvent
+
+	done     chan struct{}
+	stopOnce sync.Once
+
+	connected            atomic.Int64
+	slowConsumersDropped atomic.Int64
+	connectionsRejected  atomic.Int64
+}
+
+func NewHub(config Config) *Hub {
 	return &Hub{
-		Clients:    make(map[*Client]bool),
-		Broadcast:  make(chan []byte),
-		Register:   make(chan *Client),
-		Unregister: make(chan *Client),
+		instanceID:    uuid.New().String(),
+		config:        config.withDefaults(),
+		clients:       make(clientSet),
+		users:         make(map[string]clientSet),
+		suppliers:     make(map[string]clientSet),
+		conversations: make(map[string]clientSet),
+		subscribed:    make(map[*Client]map[string]struct{}),
+		register:      make(chan *Client),
+		unregister:    make(chan *Client),
+		subscriptions: make(chan subscription),
+		replays:       make(chan replay),
+		deliveries:    make(chan delivery, deliveryQueueSize),
+		done:          make(chan struct{}),
+
+		presenceUpdates:   make(chan presenceUpdate),
+		presenceChanges:   make(chan PresenceEvent, presenceQueueSize),
+		presenceRefreshes: make(chan map[string]PresenceEvent, 1),
 	}
 }
 
+// Run owns the hub state until Stop is called. It must run in its own
+// goroutine.
 func (h *Hub) Run() {
+	if h.events != nil {
+		go h.purgeEvents()
+	}
+
+	var refreshPresence <-chan time.Time
+	if h.presence != nil {
+		go h.trackPresence()
+		ticker := time.NewTicker(presenceRefreshInterval)
+		defer ticker.Stop()
+		refreshPresence = ticker.C
+	}
+
 	for {
 		select {
-		case client := <-h.Register:
-			h.Clients[client] = true
-			log.Printf("Client connected: %s (role: %s)", client.ID, client.Role)
-
-		case client := <-h.Unregister:
-			if _, ok := h.Clients[client]; ok {
-				delete(h.Clients, client)
-				close(client.Send)
-				log.Printf("Client disconnected: %s", client.ID)
+		case client := <-h.register:
+			h.add(client)
+
+		case client := <-h.unregister:
+			h.remove(client)
+
+		case sub := <-h.subscriptions:
+			if sub.subscribe {
+				h.subscribe(sub.client, sub.conversationID)
+			} else {
+				h.unsubscribe(sub.client, sub.conversationID)
 			}
 
-		case message := <-h.Broadcast:
-			for client := range h.Clients {
-				select {
-				case client.Send <- message:
-				default:
-					close(client.Send)
-					delete(h.Clients, client)
-				}
+		case r := <-h.replays:
+			if r.start {
+				h.startReplay(r.client)
+			} else {
+				h.finishReplay(r)
 			}
+
+		case d := <-h.deliveries:
+			h.deliver(d)
+
+		case update := <-h.presenceUpdates:
+			h.setAway(update)
+
+		case <-refreshPresence:
+			h.queuePresenceRefresh()
+
+		case <-h.done:
+			for client := range h.clients {
+				client.setCloseReason(websocket.CloseGoingAway, "server shutting down")
+				h.remove(client)
+			}
+			return
 		}
 	}
 }
 
-func (c *Client) ReadPump() {
-	defer func() {
-		c.Hub.Unregister <- c
-		c.Conn.Close()
-	}()
+// UseBackplane connects the hub to other API instances. It must be called
+// before Run.
+func (h *Hub) UseBackplane(backplane Backplane) error {
+	if h.backplane != nil {
+		return errors.New("hub already has a backplane")
+	}
+	if err := backplane.Subscribe(h.receive); err != nil {
+		return err
+	}
+	h.backplane = backplane
+	return nil
+}
+
+// Stop terminates Run and disconnects every client.
+func (h *Hub) Stop() {
+	h.stopOnce.Do(func() { close(h.done) })
+}
 
-	for {
-		_, message, err := c.Conn.ReadMessage()
-		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("WebSocket error: %v", err)
-			}
-			break
-		}
+// Register hands a client to the hub. Once Register returns, messages sent
+// to the client's user or supplier reach it, unless the user was already at
+// the connection cap, in which case the client's Send channel is closed.
+func (h *Hub) Register(client *Client) {
+	select {
+	case h.register <- client:
+	case <-h.done:
+		// The hub is gone and will never own this client, so its Send
+		// channel is still ours to close.
+		close(client.Send)
+	}
+}
 
-		// Handle incoming messages if needed
-		log.Printf("Received message from %s: %s", c.ID, message)
+// Unregister removes a client and closes its Send channel. It is safe to
+// call more than once and after the hub has already dropped the client.
+func (h *Hub) Unregister(client *Client) {
+	select {
+	case h.unregister <- client:
+	case <-h.done:
 	}
 }
 
-func (c *Client) WritePump() {
-	defer c.Conn.Close()
+// Subscribe adds a registered client to a conversation's subscribers. The
+// caller is responsible for checking that the client belongs to it.
+func (h *Hub) Subscribe(client *Client, conversationID string) {
+	h.updateSubscription(subscription{client: client, conversationID: conversationID, subscribe: true})
+}
 
-	for {
-		select {
-		case message, ok := <-c.Send:
-			if !ok {
-				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
-			}
+// Unsubscribe removes a client from a conversation's subscribers.
+func (h *Hub) Unsubscribe(client *Client, conversationID string) {
+	h.updateSubscription(subscription{client: client, conversationID: conversationID})
+}
 
-			w, err := c.Conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				return
-			}
-			w.Write(message)
+func (h *Hub) updateSubscription(sub subscription) {
+	select {
+	case h.subscriptions <- sub:
+	case <-h.done:
+	}
+}
 
-			n := len(c.Send)
-			for i := 0; i < n; i++ {
-				w.Write([]byte{'\n'})
-				w.Write(<-c.Send)
-			}
+// ClientCount returns the number of registered clients.
+func (h *Hub) ClientCount() int {
+	return int(h.connected.Load())
+}
 
-			if err := w.Close(); err != nil {
-				return
-			}
-		}
+// Config returns the connection limits clients of this hub must apply.
+func (h *Hub) Config() Config {
+	return h.config
+}
+
+func (h *Hub) Stats() Stats {
+	return Stats{
+		Connections:          h.connected.Load(),
+		SlowConsumersDropped: h.slowConsumersDropped.Load(),
+		ConnectionsRejected:  h.connectionsRejected.Load(),
 	}
 }
 
+func (h *Hub) Broadcast(message Message) {
+	h.enqueue(targetAll, "", message)
+}
+
 func (h *Hub) SendToUser(userID string, message Message) {
+	h.enqueue(targetUser, userID, message)
+}
+
+func (h *Hub) SendToSupplier(supplierID string, message Message) {
+	h.enqueue(targetSupplier, supplierID, message)
+}
+
+func (h *Hub) SendToConsumer(consumerID string, message Message) {
+	h.enqueue(targetConsumer, consumerID, message)
+}
+
+// SendToUsers reaches several users as one delivery. Durable events are
+// still stored in each user's own stream.
+func (h *Hub) SendToUsers(userIDs []string, message Message) {
+	if h.events != nil && durableEventTypes[message.Type] {
+		for _, userID := range userIDs {
+			h.enqueue(targetUser, userID, message)
+		}
+		return
+	}
+
 	data, err := json.Marshal(message)
 	if err != nil {
 		log.Printf("Error marshaling message: %v", err)
 		return
 	}
 
-	for client := range h.Clients {
-		if client.ID == userID {
-			select {
-			case client.Send <- data:
-			default:
-				close(client.Send)
-				delete(h.Clients, client)
-			}
-		}
-	}
+	h.dispatch(delivery{kind: targetUsers, ids: userIDs, data: data})
 }
 
-func (h *Hub) SendToSupplier(supplierID string, message Message) {
+// SendToConversationConsumer reaches the consumer's clients that are
+// subscribed to the conversation.
+func (h *Hub) SendToConversationConsumer(conversationID string, message Message) {
+	h.enqueue(targetConversationConsumer, conversationID, message)
+}
+
+// SendToConversationStaff reaches the supplier staff clients that are
+// subscribed to the conversation.
+func (h *Hub) SendToConversationStaff(conversationID string, message Message) {
+	h.enqueue(targetConversationStaff, conversationID, message)
+}
+
+// SendToClient replies to a single connection, typically in answer to a
+// message it sent.
+func (h *Hub) SendToClient(client *Client, message Message) {
 	data, err := json.Marshal(message)
 	if err != nil {
 		log.Printf("Error marshaling message: %v", err)
 		return
 	}
+	h.queue(delivery{kind: targetClient, client: client, data: data})
+}
 
-	for client := range h.Clients {
-		if client.SupplierID == supplierID {
-			select {
-			case client.Send <- data:
-			default:
-				close(client.Send)
-				delete(h.Clients, client)
-			}
+func (h *Hub) enqueue(kind targetKind, id string, message Message) {
+	if h.events != nil && durableEventTypes[message.Type] && kind != targetAll {
+		if h.enqueueDurable(kind, id, message) {
+			return
 		}
 	}
-}
 
-func (h *Hub) SendToConsumer(consumerID string, message Message) {
 	data, err := json.Marshal(message)
 	if err != nil {
 		log.Printf("Error marshaling message: %v", err)
 		return
 	}
 
-	for client := range h.Clients {
-		if client.ID == consumerID && client.Role == "consumer" {
-			select {
-			case client.Send <- data:
-			default:
-				close(client.Send)
-				delete(h.Clients, client)
+	h.dispatch(delivery{kind: kind, id: id, data: data})
+}
+
+// dispatch delivers locally and publishes to the other instances.
+func (h *Hub) dispatch(d delivery) {
+	h.queue(d)
+
+	if h.backplane != nil {
+		envelope := Envelope{
+			Origin: h.instanceID,
+			Target: string(d.kind),
+			ID:     d.id,
+			IDs:    d.ids,
+			Seq:    d.seq,
+			Data:   d.data,
+		}
+		if err := h.backplane.Publish(envelope); err != nil {
+			log.Printf("Error publishing to backplane: %v", err)
+		}
+	}
+}
+
+// receive delivers an envelope published by another instance to the local
+// clients. Envelopes this instance published were already delivered locally.
+func (h *Hub) receive(envelope Envelope) {
+	if envelope.Origin == h.instanceID || targetKind(envelope.Target) == targetClient {
+		return
+	}
+	h.queue(delivery{
+		kind: targetKind(envelope.Target),
+		id:   envelope.ID,
+		ids:  envelope.IDs,
+		seq:  envelope.Seq,
+		data: envelope.Data,
+	})
+}
+
+func (h *Hub) queue(d delivery) {
+	select {
+	case h.deliveries <- d:
+	case <-h.done:
+	}
+}
+
+func (h *Hub) add(client *Client) {
+	if _, ok := h.clients[client]; ok {
+		return
+	}
+
+	if limit := h.config.MaxConnectionsPerUser; limit > 0 && len(h.users[client.ID]) >= limit {
+		h.connectionsRejected.Add(1)
+		log.Printf("Client rejected: %s has %d connections already", client.ID, limit)
+		client.setCloseReason(websocket.ClosePolicyViolation, "too many connections")
+		close(client.Send)
+		return
+	}
+
+	before := h.userPresence(client.ID)
+	h.clients[client] = struct{}{}
+	addToIndex(h.users, client.ID, client)
+	if client.SupplierID != "" {
+		addToIndex(h.suppliers, client.SupplierID, client)
+	}
+	h.connected.Add(1)
+	h.presenceChanged(client, before)
+
+	log.Printf("Client connected: %s (role: %s)", client.ID, client.Role)
+}
+
+func (h *Hub) remove(client *Client) {
+	if _, ok := h.clients[client]; !ok {
+		return
+	}
+
+	before := h.userPresence(client.ID)
+	delete(h.clients, client)
+	removeFromIndex(h.users, client.ID, client)
+	if client.SupplierID != "" {
+		removeFromIndex(h.suppliers, client.SupplierID, client)
+	}
+	for conversationID := range h.subscribed[client] {
+		removeFromIndex(h.conversations, conversationID, client)
+	}
+	delete(h.subscribed, client)
+	close(client.Send)
+	h.connected.Add(-1)
+	h.presenceChanged(client, before)
+
+	log.Printf("Client disconnected: %s", client.ID)
+}
+
+func (h *Hub) subscribe(client *Client, conversationID string) {
+	if _, ok := h.clients[client]; !ok {
+		return
+	}
+
+	conversations, ok := h.subscribed[client]
+	if !ok {
+		conversations = make(map[string]struct{})
+		h.subscribed[client] = conversations
+	}
+	conversations[conversationID] = struct{}{}
+	addToIndex(h.conversations, conversationID, client)
+}
+
+func (h *Hub) unsubscribe(client *Client, conversationID string) {
+	conversations, ok := h.subscribed[client]
+	if !ok {
+		return
+	}
+
+	delete(conversations, conversationID)
+	if len(conversations) == 0 {
+		delete(h.subscribed, client)
+	}
+	removeFromIndex(h.conversations, conversationID, client)
+}
+
+func (h *Hub) deliver(d delivery) {
+	var recipients clientSet
+	switch d.kind {
+	case targetAll:
+		recipients = h.clients
+	case targetUser, targetConsumer:
+		recipients = h.users[d.id]
+	case targetUsers:
+		recipients = make(clientSet)
+		for _, userID := range d.ids {
+			for client := range h.users[userID] {
+				recipients[client] = struct{}{}
+			}
+		}
+	case targetSupplier:
+		recipients = h.suppliers[d.id]
+	case targetConversationConsumer, targetConversationStaff:
+		recipients = h.conversations[d.id]
+	case targetClient:
+		if _, ok := h.clients[d.client]; ok {
+			recipients = clientSet{d.client: {}}
+		}
+	}
+
+	for client := range recipients {
+		switch d.kind {
+		case targetConsumer, targetConversationConsumer:
+			if !client.IsConsumer() {
+				continue
+			}
+		case targetConversationStaff:
+			if client.IsConsumer() {
+				continue
 			}
 		}
+
+		if d.seq > 0 {
+			h.deliverEvent(client, d)
+		} else {
+			h.send(client, d.data)
+		}
+	}
+}
+
+// send queues a frame for a client, dropping the client if its queue is
+// full. It reports whether the client is still connected.
+func (h *Hub) send(client *Client, data []byte) bool {
+	select {
+	case client.Send <- data:
+		return true
+	default:
+		// The client is not draining its queue; drop it rather than
+		// stall every other recipient.
+		h.dropSlowConsumer(client)
+		return false
 	}
 }
 
+func (h *Hub) dropSlowConsumer(client *Client) {
+	h.slowConsumersDropped.Add(1)
+	log.Printf("Dropping slow consumer: %s", client.ID)
+	client.setCloseReason(websocket.CloseTryAgainLater, "slow consumer")
+	h.remove(client)
+}
+
+func addToIndex(index map[string]clientSet, key string, client *Client) {
+	set, ok := index[key]
+	if !ok {
+		set = make(clientSet)
+		index[key] = set
+	}
+	set[client] = struct{}{}
+}
+
+func removeFromIndex(index map[string]clientSet, key string, client *Client) {
+	set, ok := index[key]
+	if !ok {
+		return
+	}
+	delete(set, client)
+	if len(set) == 0 {
+		delete(index, key)
+	}
+}
@@ -1,229 +1,422 @@
 package websocket
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+func TestMain(m *testing.M) {
+	// Connect/disconnect logging is far too chatty for thousands of clients.
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func startHub(t *testing.T) *Hub {
+	t.Helper()
+	hub := NewHub(DefaultConfig())
+	go hub.Run()
+	t.Cleanup(hub.Stop)
+	return hub
+}
+
+func newTestClient(hub *Hub, id, role, supplierID string, buffer int) *Client {
+	return &Client{
+		ID:         id,
+		Role:       role,
+		SupplierID: supplierID,
+		Hub:        hub,
+		Send:       make(chan []byte, buffer),
+	}
+}
+
+func receive(t *testing.T, client *Client) []byte {
+	t.Helper()
+	select {
+	case msg := <-client.Send:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatalf("message not received by %s", client.ID)
+		return nil
+	}
+}
+
+func assertNothingReceived(t *testing.T, client *Client) {
+	t.Helper()
+	select {
+	case <-client.Send:
+		t.Errorf("%s received an unexpected message", client.ID)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func waitForClientCount(t *testing.T, hub *Hub, expected int) {
+	t.Helper()
+	assert.Eventually(t, func() bool {
+		return hub.ClientCount() == expected
+	}, 5*time.Second, time.Millisecond)
+}
+
 func TestNewHub(t *testing.T) {
-	hub := NewHub()
+	hub := NewHub(DefaultConfig())
 	assert.NotNil(t, hub)
-	assert.NotNil(t, hub.Clients)
-	assert.NotNil(t, hub.Broadcast)
-	assert.NotNil(t, hub.Register)
-	assert.NotNil(t, hub.Unregister)
+	assert.Equal(t, 0, hub.ClientCount())
 }
 
 func TestHub_RegisterClient(t *testing.T) {
-	hub := NewHub()
-	client := &Client{
-		ID:   "client-1",
-		Role: "consumer",
-		Hub:  hub,
-	}
+	hub := startHub(t)
+	client := newTestClient(hub, "client-1", "consumer", "", 256)
 
-	// Simulate registration
-	hub.Clients[client] = true
+	hub.Register(client)
 
-	assert.True(t, hub.Clients[client])
-	assert.Len(t, hub.Clients, 1)
+	waitForClientCount(t, hub, 1)
 }
 
 func TestHub_UnregisterClient(t *testing.T) {
-	hub := NewHub()
-	client := &Client{
-		ID:   "client-1",
-		Role: "consumer",
-		Hub:  hub,
-		Send: make(chan []byte, 256),
-	}
-
-	hub.Clients[client] = true
-	assert.Len(t, hub.Clients, 1)
+	hub := startHub(t)
+	client := newTestClient(hub, "client-1", "consumer", "", 256)
 
-	// Simulate unregistration
-	delete(hub.Clients, client)
-	close(client.Send)
+	hub.Register(client)
+	hub.Unregister(client)
+	hub.Unregister(client) // a second call must not close Send twice
 
-	assert.Len(t, hub.Clients, 0)
+	waitForClientCount(t, hub, 0)
+	_, ok := <-client.Send
+	assert.False(t, ok, "Send should be closed after unregistration")
 }
 
 func TestHub_SendToUser(t *testing.T) {
-	hub := NewHub()
-	client1 := &Client{
-		ID:   "user-123",
-		Role: "consumer",
-		Hub:  hub,
-		Send: make(chan []byte, 256),
-	}
-	client2 := &Client{
-		ID:   "user-456",
-		Role: "consumer",
-		Hub:  hub,
-		Send: make(chan []byte, 256),
-	}
+	hub := startHub(t)
+	client1 := newTestClient(hub, "user-123", "consumer", "", 256)
+	client2 := newTestClient(hub, "user-456", "consumer", "", 256)
+	hub.Register(client1)
+	hub.Register(client2)
+
+	hub.SendToUser("user-123", Message{Type: "test", Data: "test data"})
+
+	var decoded Message
+	require.NoError(t, json.Unmarshal(receive(t, client1), &decoded))
+	assert.Equal(t, "test", decoded.Type)
+	assertNothingReceived(t, client2)
+}
 
-	hub.Clients[client1] = true
-	hub.Clients[client2] = true
+func TestHub_SendToSupplier(t *testing.T) {
+	hub := startHub(t)
+	client1 := newTestClient(hub, "user-1", "sales_rep", "supplier-123", 256)
+	client2 := newTestClient(hub, "user-2", "sales_rep", "supplier-456", 256)
+	hub.Register(client1)
+	hub.Register(client2)
 
-	message := Message{
-		Type: "test",
-		Data: "test data",
-	}
+	hub.SendToSupplier("supplier-123", Message{Type: "notification", Data: "test"})
 
-	// Test SendToUser
-	hub.SendToUser("user-123", message)
+	assert.NotEmpty(t, receive(t, client1))
+	assertNothingReceived(t, client2)
+}
 
-	// Verify message was sent to correct client
-	select {
-	case msg := <-client1.Send:
-		assert.NotEmpty(t, msg)
-	case <-time.After(100 * time.Millisecond):
-		t.Error("Message not received")
-	}
+func TestHub_SendToConsumer(t *testing.T) {
+	hub := startHub(t)
+	consumerClient := newTestClient(hub, "consumer-123", "consumer", "", 256)
+	supplierClient := newTestClient(hub, "consumer-123", "owner", "", 256) // Same ID but different role
+	hub.Register(consumerClient)
+	hub.Register(supplierClient)
 
-	// Verify other client didn't receive message
-	select {
-	case <-client2.Send:
-		t.Error("Wrong client received message")
-	case <-time.After(50 * time.Millisecond):
-		// Expected - client2 should not receive message
-	}
+	hub.SendToConsumer("consumer-123", Message{Type: "message", Data: "test"})
+
+	assert.NotEmpty(t, receive(t, consumerClient))
+	assertNothingReceived(t, supplierClient)
 }
 
-func TestHub_SendToSupplier(t *testing.T) {
-	hub := NewHub()
-	client1 := &Client{
-		ID:         "user-1",
-		Role:       "sales_rep",
-		SupplierID: "supplier-123",
-		Hub:        hub,
-		Send:       make(chan []byte, 256),
-	}
-	client2 := &Client{
-		ID:         "user-2",
-		Role:       "sales_rep",
-		SupplierID: "supplier-456",
-		Hub:        hub,
-		Send:       make(chan []byte, 256),
-	}
+func TestHub_Broadcast(t *testing.T) {
+	hub := startHub(t)
+	client1 := newTestClient(hub, "client-1", "consumer", "", 256)
+	client2 := newTestClient(hub, "client-2", "sales_rep", "supplier-1", 256)
+	hub.Register(client1)
+	hub.Register(client2)
 
-	hub.Clients[client1] = true
-	hub.Clients[client2] = true
+	hub.Broadcast(Message{Type: "broadcast", Data: "hello"})
 
-	message := Message{
-		Type: "notification",
-		Data: "test",
-	}
+	assert.NotEmpty(t, receive(t, client1))
+	assert.NotEmpty(t, receive(t, client2))
+}
 
-	hub.SendToSupplier("supplier-123", message)
+func TestHub_SlowConsumerIsDropped(t *testing.T) {
+	hub := startHub(t)
+	slow := newTestClient(hub, "user-1", "consumer", "", 1)
+	hub.Register(slow)
 
-	select {
-	case msg := <-client1.Send:
-		assert.NotEmpty(t, msg)
-	case <-time.After(100 * time.Millisecond):
-		t.Error("Message not received")
-	}
+	hub.SendToUser("user-1", Message{Type: "first"})
+	hub.SendToUser("user-1", Message{Type: "second"})
+
+	waitForClientCount(t, hub, 0)
+
+	// The first message is still buffered, then the channel is closed.
+	assert.NotEmpty(t, <-slow.Send)
+	_, ok := <-slow.Send
+	assert.False(t, ok)
+
+	// Unregistering after the hub already dropped the client is a no-op.
+	hub.Unregister(slow)
 }
 
-func TestHub_SendToConsumer(t *testing.T) {
-	hub := NewHub()
-	consumerClient := &Client{
-		ID:   "consumer-123",
-		Role: "consumer",
-		Hub:  hub,
-		Send: make(chan []byte, 256),
-	}
-	supplierClient := &Client{
-		ID:   "consumer-123",
-		Role: "owner", // Same ID but different role
-		Hub:  hub,
-		Send: make(chan []byte, 256),
-	}
+func TestHub_StopClosesClients(t *testing.T) {
+	hub := NewHub(DefaultConfig())
+	go hub.Run()
+	client := newTestClient(hub, "user-1", "consumer", "", 1)
+	hub.Register(client)
+
+	hub.Stop()
 
-	hub.Clients[consumerClient] = true
-	hub.Clients[supplierClient] = true
+	_, ok := <-client.Send
+	assert.False(t, ok)
 
+	// Registering with a stopped hub hands the client straight back.
+	late := newTestClient(hub, "user-2", "consumer", "", 1)
+	hub.Register(late)
+	_, ok = <-late.Send
+	assert.False(t, ok)
+}
+
+func TestMessage_Marshal(t *testing.T) {
 	message := Message{
-		Type: "message",
-		Data: "test",
+		Type: "test",
+		Data: map[string]interface{}{
+			"key": "value",
+		},
 	}
 
-	hub.SendToConsumer("consumer-123", message)
+	data, err := json.Marshal(message)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":"test","data":{"key":"value"}}`, string(data))
+}
 
-	select {
-	case msg := <-consumerClient.Send:
-		assert.NotEmpty(t, msg)
-	case <-time.After(100 * time.Millisecond):
-		t.Error("Message not received")
+// TestHub_ConcurrentClients registers, targets and unregisters thousands of
+// simulated clients from many goroutines at once. Run it with -race.
+func TestHub_ConcurrentClients(t *testing.T) {
+	const (
+		users            = 1000
+		clientsPerUser   = 3
+		suppliers        = 50
+		totalClients     = users * clientsPerUser
+		expectedMessages = 2 // one to the user, one to the user's supplier
+	)
+
+	hub := startHub(t)
+
+	clients := make([]*Client, 0, totalClients)
+	for u := 0; u < users; u++ {
+		userID := fmt.Sprintf("user-%d", u)
+		supplierID := fmt.Sprintf("supplier-%d", u%suppliers)
+		for i := 0; i < clientsPerUser; i++ {
+			clients = append(clients, newTestClient(hub, userID, "sales_rep", supplierID, 16))
+		}
 	}
 
-	// Supplier client should not receive (different role)
-	select {
-	case <-supplierClient.Send:
-		t.Error("Wrong client received message")
-	case <-time.After(50 * time.Millisecond):
-		// Expected
+	var wg sync.WaitGroup
+	for _, client := range clients {
+		wg.Add(1)
+		go func(c *Client) {
+			defer wg.Done()
+			hub.Register(c)
+		}(client)
 	}
-}
-
-func TestHub_Broadcast(t *testing.T) {
-	hub := NewHub()
-	client1 := &Client{
-		ID:   "client-1",
-		Hub:  hub,
-		Send: make(chan []byte, 256),
+	wg.Wait()
+	waitForClientCount(t, hub, totalClients)
+
+	for u := 0; u < users; u++ {
+		wg.Add(1)
+		go func(u int) {
+			defer wg.Done()
+			hub.SendToUser(fmt.Sprintf("user-%d", u), Message{Type: "user"})
+		}(u)
 	}
-	client2 := &Client{
-		ID:   "client-2",
-		Hub:  hub,
-		Send: make(chan []byte, 256),
+	for s := 0; s < suppliers; s++ {
+		wg.Add(1)
+		go func(s int) {
+			defer wg.Done()
+			hub.SendToSupplier(fmt.Sprintf("supplier-%d", s), Message{Type: "supplier"})
+		}(s)
 	}
+	wg.Wait()
 
-	hub.Clients[client1] = true
-	hub.Clients[client2] = true
+	for _, client := range clients {
+		for i := 0; i < expectedMessages; i++ {
+			receive(t, client)
+		}
+	}
 
-	message := []byte("broadcast message")
+	// Unregister everyone twice, concurrently with a fresh round of sends,
+	// to exercise the close-once guarantee.
+	for _, client := range clients {
+		wg.Add(2)
+		go func(c *Client) {
+			defer wg.Done()
+			hub.Unregister(c)
+		}(client)
+		go func(c *Client) {
+			defer wg.Done()
+			hub.SendToSupplier(c.SupplierID, Message{Type: "late"})
+			hub.Unregister(c)
+		}(client)
+	}
+	wg.Wait()
+	waitForClientCount(t, hub, 0)
 
-	// Simulate broadcast
-	for client := range hub.Clients {
-		select {
-		case client.Send <- message:
-		default:
-			close(client.Send)
-			delete(hub.Clients, client)
+	for _, client := range clients {
+		for range client.Send {
+			// Drain late deliveries; the loop ends once Run closed Send.
 		}
 	}
+}
 
-	select {
-	case msg := <-client1.Send:
-		assert.Equal(t, message, msg)
-	case <-time.After(100 * time.Millisecond):
-		t.Error("Message not received by client1")
+func TestHub_ConversationSubscriptions(t *testing.T) {
+	hub := startHub(t)
+	consumer := newTestClient(hub, "consumer-1", "consumer", "", 256)
+	staff := newTestClient(hub, "rep-1", "sales_rep", "supplier-1", 256)
+	bystander := newTestClient(hub, "rep-2", "sales_rep", "supplier-1", 256)
+	hub.Register(consumer)
+	hub.Register(staff)
+	hub.Register(bystander)
+
+	hub.Subscribe(consumer, "conv-1")
+	hub.Subscribe(staff, "conv-1")
+
+	hub.SendToConversationStaff("conv-1", Message{Type: "typing"})
+	assert.NotEmpty(t, receive(t, staff))
+	assertNothingReceived(t, consumer)
+	assertNothingReceived(t, bystander)
+
+	hub.SendToConversationConsumer("conv-1", Message{Type: "typing"})
+	assert.NotEmpty(t, receive(t, consumer))
+	assertNothingReceived(t, staff)
+
+	hub.Unsubscribe(staff, "conv-1")
+	hub.SendToConversationStaff("conv-1", Message{Type: "typing"})
+	assertNothingReceived(t, staff)
+}
+
+func TestHub_UnregisterDropsSubscriptions(t *testing.T) {
+	hub := startHub(t)
+	client := newTestClient(hub, "rep-1", "sales_rep", "supplier-1", 256)
+	hub.Register(client)
+	hub.Subscribe(client, "conv-1")
+
+	hub.Unregister(client)
+	waitForClientCount(t, hub, 0)
+
+	// Delivering to the stale subscription must not touch the closed channel.
+	hub.SendToConversationStaff("conv-1", Message{Type: "typing"})
+	hub.Subscribe(client, "conv-1")
+	hub.SendToConversationStaff("conv-1", Message{Type: "typing"})
+
+	_, ok := <-client.Send
+	assert.False(t, ok)
+}
+
+func TestHub_SendToClient(t *testing.T) {
+	hub := startHub(t)
+	client := newTestClient(hub, "user-1", "consumer", "", 256)
+	sibling := newTestClient(hub, "user-1", "consumer", "", 256)
+	hub.Register(client)
+	hub.Register(sibling)
+
+	hub.SendToClient(client, Message{Type: MessageTypePong})
+
+	var decoded Message
+	require.NoError(t, json.Unmarshal(receive(t, client), &decoded))
+	assert.Equal(t, MessageTypePong, decoded.Type)
+	assertNothingReceived(t, sibling)
+}
+
+func TestClient_Handle(t *testing.T) {
+	hub := startHub(t)
+	client := newTestClient(hub, "user-1", "consumer", "", 256)
+	hub.Register(client)
+
+	tests := []struct {
+		name         string
+		frame        string
+		expectedType string
+	}{
+		{"ping is answered with pong", `{"type":"ping","data":{"nonce":1}}`, MessageTypePong},
+		{"invalid json", `not json`, MessageTypeError},
+		{"missing type", `{"data":{}}`, MessageTypeError},
+		{"no handler configured", `{"type":"subscribe","data":{}}`, MessageTypeError},
 	}
 
-	select {
-	case msg := <-client2.Send:
-		assert.Equal(t, message, msg)
-	case <-time.After(100 * time.Millisecond):
-		t.Error("Message not received by client2")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client.handle([]byte(tt.frame))
+
+			var decoded Message
+			require.NoError(t, json.Unmarshal(receive(t, client), &decoded))
+			assert.Equal(t, tt.expectedType, decoded.Type)
+		})
 	}
 }
 
-func TestMessage_Marshal(t *testing.T) {
-	message := Message{
-		Type: "test",
-		Data: map[string]interface{}{
-			"key": "value",
-		},
-	}
+func TestHub_ConnectionCapPerUser(t *testing.T) {
+	config := DefaultConfig()
+	config.MaxConnectionsPerUser = 2
+	hub := NewHub(config)
+	go hub.Run()
+	t.Cleanup(hub.Stop)
+
+	first := newTestClient(hub, "user-1", "consumer", "", 1)
+	second := newTestClient(hub, "user-1", "consumer", "", 1)
+	third := newTestClient(hub, "user-1", "consumer", "", 1)
+	other := newTestClient(hub, "user-2", "consumer", "", 1)
+	hub.Register(first)
+	hub.Register(second)
+	hub.Register(third)
+	hub.Register(other)
+
+	_, ok := <-third.Send
+	assert.False(t, ok, "connection over the cap should be closed")
+	assert.Equal(t, websocket.ClosePolicyViolation, third.closeCode)
+
+	waitForClientCount(t, hub, 3)
+	assert.Equal(t, int64(1), hub.Stats().ConnectionsRejected)
+
+	// A freed slot can be taken again.
+	hub.Unregister(first)
+	fourth := newTestClient(hub, "user-1", "consumer", "", 1)
+	hub.Register(fourth)
+	waitForClientCount(t, hub, 3)
+}
+
+func TestHub_SlowConsumerMetrics(t *testing.T) {
+	hub := startHub(t)
+	slow := newTestClient(hub, "user-1", "consumer", "", 0)
+	hub.Register(slow)
+
+	hub.SendToUser("user-1", Message{Type: "test"})
 
-	// Test that message can be marshaled via json.Marshal
-	hub := NewHub()
-	hub.SendToUser("test-user", message)
-	// This tests the marshaling inside SendToUser
-	assert.NotNil(t, message)
+	waitForClientCount(t, hub, 0)
+	assert.Equal(t, int64(1), hub.Stats().SlowConsumersDropped)
+	_, ok := <-slow.Send
+	assert.False(t, ok)
+	assert.Equal(t, websocket.CloseTryAgainLater, slow.closeCode)
 }
 
+func TestConfig_WithDefaults(t *testing.T) {
+	config := Config{PingInterval: time.Minute, PongTimeout: 30 * time.Second}.withDefaults()
+
+	assert.Equal(t, 30*time.Second, config.PongTimeout)
+	assert.Less(t, config.PingInterval, config.PongTimeout)
+	assert.Equal(t, DefaultConfig().WriteTimeout, config.WriteTimeout)
+	assert.Equal(t, DefaultConfig().MaxMessageSize, config.MaxMessageSize)
+
+	unset := Config{}.withDefaults()
+	assert.Equal(t, DefaultConfig().PingInterval, unset.PingInterval)
+	assert.Equal(t, DefaultConfig().PongTimeout, unset.PongTimeout)
+	assert.Zero(t, unset.MaxConnectionsPerUser, "an unset cap means unlimited")
+}
@@ -0,0 +1,185 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const (
+	// PostgresChannel is the LISTEN/NOTIFY channel shared by all instances.
+	PostgresChannel = "scp_ws_events"
+
+	// Postgres rejects NOTIFY payloads of 8000 bytes or more. Larger
+	// envelopes are stored in ws_backplane_payloads and only their row ID
+	// is sent through the channel.
+	maxNotifyPayload = 7900
+
+	listenerPingInterval = 90 * time.Second
+)
+
+// notification is the NOTIFY payload: either an inline envelope or a
+// reference to a spilled one.
+type notification struct {
+	*Envelope
+	Ref string `json:"ref,omitempty"`
+}
+
+// PostgresBackplane relays hub deliveries between instances with Postgres
+// LISTEN/NOTIFY, so no infrastructure beyond the main database is needed.
+type PostgresBackplane struct {
+	db       *sqlx.DB
+	dsn      string
+	listener *pq.Listener
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewPostgresBackplane(db *sqlx.DB, dsn string) *PostgresBackplane {
+	return &PostgresBackplane{
+		db:   db,
+		dsn:  dsn,
+		done: make(chan struct{}),
+	}
+}
+
+func (b *PostgresBackplane) Publish(envelope Envelope) error {
+	payload, err := json.Marshal(notification{Envelope: &envelope})
+	if err != nil {
+		return err
+	}
+
+	if len(payload) > maxNotifyPayload {
+		var ref string
+		err := b.db.Get(&ref, `
+			INSERT INTO ws_backplane_payloads (payload)
+			VALUES ($1)
+			RETURNING id
+		`, payload)
+		if err != nil {
+			return err
+		}
+
+		payload, err = json.Marshal(notification{Ref: ref})
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = b.db.Exec("SELECT pg_notify($1, $2)", PostgresChannel, string(payload))
+	return err
+}
+
+func (b *PostgresBackplane) Subscribe(handler func(Envelope)) error {
+	if b.listener != nil {
+		return errors.New("backplane already subscribed")
+	}
+
+	b.listener = pq.NewListener(b.dsn, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Backplane listener event %d: %v", event, err)
+		}
+	})
+	if err := b.listener.Listen(PostgresChannel); err != nil {
+		b.listener.Close()
+		b.listener = nil
+		return err
+	}
+
+	go b.listen(handler)
+	return nil
+}
+
+func (b *PostgresBackplane) Close() error {
+	var err error
+	b.closeOnce.Do(func() {
+		close(b.done)
+		if b.listener != nil {
+			err = b.listener.Close()
+		}
+	})
+	return err
+}
+
+func (b *PostgresBackplane) listen(handler func(Envelope)) {
+	ticker := time.NewTicker(listenerPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case n := <-b.listener.Notify:
+			if n == nil {
+				// pq sends nil after re-establishing a lost connection.
+				log.Printf("Backplane reconnected; notifications sent while disconnected were missed")
+				continue
+			}
+
+			envelope, err := b.decode(n.Extra)
+			if err != nil {
+				log.Printf("Error decoding backplane notification: %v", err)
+				continue
+			}
+			handler(envelope)
+
+		case <-ticker.C:
+			go b.listener.Ping()
+			b.purgeSpilled()
+
+		case <-b.done:
+			return
+		}
+	}
+}
+
+func (b *PostgresBackplane) decode(payload string) (Envelope, error) {
+	n, err := decodeNotification([]byte(payload))
+	if err != nil {
+		return Envelope{}, err
+	}
+	if n.Ref == "" {
+		return *n.Envelope, nil
+	}
+
+	var spilled []byte
+	if err := b.db.Get(&spilled, "SELECT payload FROM ws_backplane_payloads WHERE id = $1", n.Ref); err != nil {
+		return Envelope{}, err
+	}
+
+	n, err = decodeNotification(spilled)
+	if err != nil {
+		return Envelope{}, err
+	}
+	if n.Ref != "" {
+		return Envelope{}, errors.New("spilled payload refers to another payload")
+	}
+	return *n.Envelope, nil
+}
+
+func (b *PostgresBackplane) purgeSpilled() {
+	// Spilled payloads only need to live long enough for every listener to
+	// fetch them.
+	_, err := b.db.Exec(`
+		DELETE FROM ws_backplane_payloads
+		WHERE created_at < NOW() - INTERVAL '5 minutes'
+	`)
+	if err != nil {
+		log.Printf("Error purging spilled backplane payloads: %v", err)
+	}
+}
+
+func decodeNotification(payload []byte) (notification, error) {
+	n := notification{Envelope: &Envelope{}}
+	if err := json.Unmarshal(payload, &n); err != nil {
+		return notification{}, err
+	}
+	if n.Ref == "" && n.Envelope.Target == "" {
+		return notification{}, errors.New("notification has neither envelope nor reference")
+	}
+	return n, nil
+}
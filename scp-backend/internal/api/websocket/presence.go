@@ -0,0 +1,188 @@
+package websocket
+
+import (
+	"log"
+	"time"
+)
+
+// Presence states.
+const (
+	PresenceOnline  = "online"
+	PresenceAway    = "away"
+	PresenceOffline = "offline"
+)
+
+const (
+	// presenceRefreshInterval is how often the presence of connected users
+	// is written again, keeping it from going stale in the store.
+	presenceRefreshInterval = time.Minute
+
+	presenceQueueSize = 256
+)
+
+// PresenceStore persists presence and knows who should hear about it.
+type PresenceStore interface {
+	SetPresence(userID, status string, at time.Time) error
+	// RefreshPresence records the presence of users connected to this
+	// instance and returns those whose stored presence was different.
+	RefreshPresence(statuses map[string]string, at time.Time) ([]string, error)
+	// PresenceAudience returns the suppliers and consumers whose clients are
+	// told about the user's presence changes.
+	PresenceAudience(userID string) (supplierIDs, consumerIDs []string, err error)
+}
+
+// PresenceEvent is the data of a presence message.
+type PresenceEvent struct {
+	UserID string `json:"user_id"`
+	// SupplierID is set for staff, so consumers can tell whose team changed.
+	SupplierID string    `json:"supplier_id,omitempty"`
+	Status     string    `json:"status"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+}
+
+type presenceUpdate struct {
+	client *Client
+	away   bool
+}
+
+// UsePresence tracks which users are online and announces changes to their
+// counterparties. It must be called before Run.
+func (h *Hub) UsePresence(store PresenceStore) {
+	h.presence = store
+}
+
+// SetAway marks one of a user's connections as idle or active again. The
+// user is away once all of their connections are.
+func (h *Hub) SetAway(client *Client, away bool) {
+	select {
+	case h.presenceUpdates <- presenceUpdate{client: client, away: away}:
+	case <-h.done:
+	}
+}
+
+// userPresence derives a user's presence from their local connections.
+func (h *Hub) userPresence(userID string) string {
+	clients, ok := h.users[userID]
+	if !ok {
+		return PresenceOffline
+	}
+	for client := range clients {
+		if !client.away {
+			return PresenceOnline
+		}
+	}
+	return PresenceAway
+}
+
+func (h *Hub) setAway(update presenceUpdate) {
+	client := update.client
+	if _, ok := h.clients[client]; !ok || client.away == update.away {
+		return
+	}
+
+	before := h.userPresence(client.ID)
+	client.away = update.away
+	h.presenceChanged(client, before)
+}
+
+// presenceChanged hands a user's presence to the presence worker if it
+// differs from before. Run never waits on the store; if the worker falls
+// behind, the next refresh repairs what was dropped.
+func (h *Hub) presenceChanged(client *Client, before string) {
+	if h.presence == nil {
+		return
+	}
+	status := h.userPresence(client.ID)
+	if status == before {
+		return
+	}
+
+	select {
+	case h.presenceChanges <- newPresenceEvent(client, status):
+	default:
+		log.Printf("Presence queue full; dropping %s change for %s", status, client.ID)
+	}
+}
+
+// queuePresenceRefresh snapshots the presence of every local user for the
+// presence worker.
+func (h *Hub) queuePresenceRefresh() {
+	if len(h.users) == 0 {
+		return
+	}
+
+	snapshot := make(map[string]PresenceEvent, len(h.users))
+	for userID, clients := range h.users {
+		for client := range clients {
+			snapshot[userID] = newPresenceEvent(client, h.userPresence(userID))
+			break
+		}
+	}
+
+	select {
+	case h.presenceRefreshes <- snapshot:
+	default:
+		// The previous refresh is still waiting; it will do.
+	}
+}
+
+func newPresenceEvent(client *Client, status string) PresenceEvent {
+	return PresenceEvent{
+		UserID:     client.ID,
+		SupplierID: client.SupplierID,
+		Status:     status,
+		LastSeenAt: time.Now(),
+	}
+}
+
+// trackPresence writes presence to the store and announces it, off the Run
+// goroutine.
+func (h *Hub) trackPresence() {
+	for {
+		select {
+		case change := <-h.presenceChanges:
+			if err := h.presence.SetPresence(change.UserID, change.Status, change.LastSeenAt); err != nil {
+				log.Printf("Error storing presence for %s: %v", change.UserID, err)
+				continue
+			}
+			h.announcePresence(change)
+
+		case snapshot := <-h.presenceRefreshes:
+			now := time.Now()
+			statuses := make(map[string]string, len(snapshot))
+			for userID, change := range snapshot {
+				statuses[userID] = change.Status
+			}
+
+			changed, err := h.presence.RefreshPresence(statuses, now)
+			if err != nil {
+				log.Printf("Error refreshing presence: %v", err)
+				continue
+			}
+			for _, userID := range changed {
+				change := snapshot[userID]
+				change.LastSeenAt = now
+				h.announcePresence(change)
+			}
+
+		case <-h.done:
+			return
+		}
+	}
+}
+
+func (h *Hub) announcePresence(change PresenceEvent) {
+	supplierIDs, consumerIDs, err := h.presence.PresenceAudience(change.UserID)
+	if err != nil {
+		log.Printf("Error loading presence audience for %s: %v", change.UserID, err)
+		return
+	}
+
+	message := Message{Type: MessageTypePresence, Data: change}
+	for _, supplierID := range supplierIDs {
+		h.SendToSupplier(supplierID, message)
+	}
+	if len(consumerIDs) > 0 {
+		h.SendToUsers(consumerIDs, message)
+	}
+}
@@ -0,0 +1,196 @@
+package websocket
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type presenceAudience struct {
+	suppliers []string
+	consumers []string
+}
+
+type memoryPresenceStore struct {
+	mu       sync.Mutex
+	statuses map[string]string
+	audience map[string]presenceAudience
+}
+
+func newMemoryPresenceStore() *memoryPresenceStore {
+	return &memoryPresenceStore{
+		statuses: make(map[string]string),
+		audience: make(map[string]presenceAudience),
+	}
+}
+
+func (s *memoryPresenceStore) SetPresence(userID, status string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statuses[userID] = status
+	return nil
+}
+
+func (s *memoryPresenceStore) RefreshPresence(statuses map[string]string, at time.Time) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed := []string{}
+	for userID, status := range statuses {
+		if s.statuses[userID] != status {
+			changed = append(changed, userID)
+		}
+		s.statuses[userID] = status
+	}
+	return changed, nil
+}
+
+func (s *memoryPresenceStore) PresenceAudience(userID string) ([]string, []string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	audience := s.audience[userID]
+	return audience.suppliers, audience.consumers, nil
+}
+
+func (s *memoryPresenceStore) status(userID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.statuses[userID]
+}
+
+func startHubWithPresence(t *testing.T, store PresenceStore) *Hub {
+	t.Helper()
+	hub := NewHub(DefaultConfig())
+	hub.UsePresence(store)
+	go hub.Run()
+	t.Cleanup(hub.Stop)
+	return hub
+}
+
+func receivePresence(t *testing.T, client *Client) PresenceEvent {
+	t.Helper()
+	message := receiveMessage(t, client)
+	require.Equal(t, MessageTypePresence, message.Type)
+	data, err := json.Marshal(message.Data)
+	require.NoError(t, err)
+	var event PresenceEvent
+	require.NoError(t, json.Unmarshal(data, &event))
+	return event
+}
+
+func TestHub_PresenceFollowsConsumerConnections(t *testing.T) {
+	store := newMemoryPresenceStore()
+	store.audience["consumer-1"] = presenceAudience{suppliers: []string{"supplier-1"}}
+	hub := startHubWithPresence(t, store)
+
+	staff := newTestClient(hub, "staff-1", "sales_rep", "supplier-1", 256)
+	hub.Register(staff)
+
+	phone := newTestClient(hub, "consumer-1", "consumer", "", 256)
+	tablet := newTestClient(hub, "consumer-1", "consumer", "", 256)
+
+	hub.Register(phone)
+	event := receivePresence(t, staff)
+	assert.Equal(t, "consumer-1", event.UserID)
+	assert.Equal(t, PresenceOnline, event.Status)
+	assert.Equal(t, PresenceOnline, store.status("consumer-1"))
+
+	// A second connection or one idle connection does not change anything.
+	hub.Register(tablet)
+	hub.SetAway(phone, true)
+	assertNothingReceived(t, staff)
+
+	hub.SetAway(tablet, true)
+	assert.Equal(t, PresenceAway, receivePresence(t, staff).Status)
+
+	hub.SetAway(tablet, false)
+	assert.Equal(t, PresenceOnline, receivePresence(t, staff).Status)
+
+	hub.Unregister(tablet)
+	assert.Equal(t, PresenceAway, receivePresence(t, staff).Status, "only the idle connection is left")
+
+	hub.Unregister(phone)
+	event = receivePresence(t, staff)
+	assert.Equal(t, PresenceOffline, event.Status)
+	assert.WithinDuration(t, time.Now(), event.LastSeenAt, time.Minute)
+	assert.Equal(t, PresenceOffline, store.status("consumer-1"))
+}
+
+func TestHub_StaffPresenceReachesConsumersAndColleagues(t *testing.T) {
+	store := newMemoryPresenceStore()
+	store.audience["staff-1"] = presenceAudience{
+		suppliers: []string{"supplier-1"},
+		consumers: []string{"consumer-1", "consumer-2"},
+	}
+	hub := startHubWithPresence(t, store)
+
+	colleague := newTestClient(hub, "staff-2", "manager", "supplier-1", 256)
+	consumer1 := newTestClient(hub, "consumer-1", "consumer", "", 256)
+	consumer2 := newTestClient(hub, "consumer-2", "consumer", "", 256)
+	stranger := newTestClient(hub, "consumer-3", "consumer", "", 256)
+	hub.Register(colleague)
+	hub.Register(consumer1)
+	hub.Register(consumer2)
+	hub.Register(stranger)
+
+	hub.Register(newTestClient(hub, "staff-1", "sales_rep", "supplier-1", 256))
+
+	for _, client := range []*Client{colleague, consumer1, consumer2} {
+		event := receivePresence(t, client)
+		assert.Equal(t, "staff-1", event.UserID)
+		assert.Equal(t, "supplier-1", event.SupplierID)
+		assert.Equal(t, PresenceOnline, event.Status)
+	}
+	assertNothingReceived(t, stranger)
+}
+
+func TestHub_PresenceRefreshAnnouncesRepairedUsers(t *testing.T) {
+	store := newMemoryPresenceStore()
+	store.audience["consumer-1"] = presenceAudience{suppliers: []string{"supplier-1"}}
+	hub := startHubWithPresence(t, store)
+
+	staff := newTestClient(hub, "staff-1", "sales_rep", "supplier-1", 256)
+	hub.Register(staff)
+	hub.Register(newTestClient(hub, "consumer-1", "consumer", "", 256))
+	receivePresence(t, staff)
+
+	// Another instance marked the user offline when its own connection
+	// closed; the refresh puts the stored presence right again.
+	require.NoError(t, store.SetPresence("consumer-1", PresenceOffline, time.Now()))
+	hub.presenceRefreshes <- map[string]PresenceEvent{
+		"consumer-1": {UserID: "consumer-1", Status: PresenceOnline},
+	}
+
+	assert.Equal(t, PresenceOnline, receivePresence(t, staff).Status)
+	assert.Equal(t, PresenceOnline, store.status("consumer-1"))
+}
+
+func TestHub_SendToUsers(t *testing.T) {
+	hub := startHub(t)
+	first := newTestClient(hub, "user-1", "consumer", "", 256)
+	second := newTestClient(hub, "user-2", "consumer", "", 256)
+	other := newTestClient(hub, "user-3", "consumer", "", 256)
+	hub.Register(first)
+	hub.Register(second)
+	hub.Register(other)
+
+	hub.SendToUsers([]string{"user-1", "user-2"}, Message{Type: "test"})
+
+	assert.NotEmpty(t, receive(t, first))
+	assert.NotEmpty(t, receive(t, second))
+	assertNothingReceived(t, other)
+}
+
+func TestClient_HandlePresence(t *testing.T) {
+	hub := startHub(t)
+	client := newTestClient(hub, "user-1", "consumer", "", 256)
+	hub.Register(client)
+
+	client.handle([]byte(`{"type":"presence","data":{"status":"offline"}}`))
+
+	message := receiveMessage(t, client)
+	assert.Equal(t, MessageTypeError, message.Type)
+}
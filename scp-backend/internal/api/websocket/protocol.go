@@ -0,0 +1,70 @@
+package websocket
+
+import "encoding/json"
+
+// Message types a client may send.
+const (
+	ClientMessageSubscribe   = "subscribe"
+	ClientMessageUnsubscribe = "unsubscribe"
+	ClientMessageTyping      = "typing"
+	ClientMessageMarkRead    = "mark_read"
+	ClientMessagePing        = "ping"
+	ClientMessageResume      = "resume"
+	ClientMessagePresence    = "presence"
+)
+
+// ClientMessage is a frame received from a client. It uses the same
+// {"type", "data"} envelope as Message, with the payload left undecoded until
+// the type is known.
+type ClientMessage struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// ConversationPayload is the data of subscribe and unsubscribe.
+type ConversationPayload struct {
+	ConversationID string `json:"conversation_id"`
+}
+
+// TypingPayload is the data of a typing message.
+type TypingPayload struct {
+	ConversationPayload
+	IsTyping bool `json:"is_typing"`
+}
+
+// MarkReadPayload is the data of a mark_read message. Without MessageID
+// everything up to the newest message is marked read.
+type MarkReadPayload struct {
+	ConversationPayload
+	MessageID string `json:"message_id,omitempty"`
+}
+
+// ResumePayload is the data of a resume message. Without LastSeq the server
+// only reports the current position of the stream.
+type ResumePayload struct {
+	LastSeq *int64 `json:"last_seq"`
+}
+
+// PresencePayload is the data of a presence message, sent when the app goes
+// idle ("away") or becomes active again ("online").
+type PresencePayload struct {
+	Status string `json:"status"`
+}
+
+// ClientMessageHandler processes the messages that need application state,
+// such as conversation membership. Ping, resume and presence are served by
+// the client and hub themselves.
+type ClientMessageHandler interface {
+	HandleClientMessage(client *Client, message ClientMessage)
+}
+
+// ErrorMessage builds the reply sent when a client message is rejected.
+func ErrorMessage(requestType, reason string) Message {
+	return Message{
+		Type: MessageTypeError,
+		Data: map[string]string{
+			"request_type": requestType,
+			"message":      reason,
+		},
+	}
+}
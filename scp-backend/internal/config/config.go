@@ -7,17 +7,22 @@ import (
 )
 
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	JWT      JWTConfig
-	Redis    RedisConfig
-	Storage  StorageConfig
+	Server    ServerConfig
+	Database  DatabaseConfig
+	JWT       JWTConfig
+	Redis     RedisConfig
+	Storage   StorageConfig
+	WebSocket WebSocketConfig
+	Chat      ChatConfig
+	Orders    OrdersConfig
 }
 
 type ServerConfig struct {
 	Port        string
 	Environment string
 	CORSOrigins []string
+	// PublicURL is where clients reach the API, e.g. behind a proxy
+	PublicURL string
 }
 
 type DatabaseConfig struct {
@@ -47,6 +52,23 @@ type StorageConfig struct {
 	AWSRegion string
 }
 
+type WebSocketConfig struct {
+	Backplane             string // postgres or none
+	PingInterval          int    // seconds
+	PongTimeout           int    // seconds
+	MaxMessageSize        int    // bytes
+	MaxConnectionsPerUser int
+	EventRetention        int // hours
+}
+
+type ChatConfig struct {
+	EditWindow int // minutes
+}
+
+type OrdersConfig struct {
+	StockReservation int // minutes, 0 disables
+}
+
 func Load() *Config {
 	corsOrigins := getEnv("CORS_ORIGINS", "http://localhost:3000,http://localhost:3001,http://localhost:8080")
 	
@@ -55,6 +77,7 @@ func Load() *Config {
 			Port:        getEnv("PORT", "3000"),
 			Environment: getEnv("ENV", "development"),
 			CORSOrigins: strings.Split(corsOrigins, ","),
+			PublicURL:   strings.TrimSuffix(getEnv("PUBLIC_URL", ""), "/"),
 		},
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
@@ -79,6 +102,20 @@ func Load() *Config {
 			S3Bucket:  getEnv("S3_BUCKET", ""),
 			AWSRegion: getEnv("AWS_REGION", "us-east-1"),
 		},
+		WebSocket: WebSocketConfig{
+			Backplane:             getEnv("WS_BACKPLANE", "postgres"),
+			PingInterval:          getIntEnv("WS_PING_INTERVAL", 30),
+			PongTimeout:           getIntEnv("WS_PONG_TIMEOUT", 60),
+			MaxMessageSize:        getIntEnv("WS_MAX_MESSAGE_SIZE", 8192),
+			MaxConnectionsPerUser: getIntEnv("WS_MAX_CONNECTIONS_PER_USER", 10),
+			EventRetention:        getIntEnv("WS_EVENT_RETENTION_HOURS", 72),
+		},
+		Chat: ChatConfig{
+			EditWindow: getIntEnv("CHAT_EDIT_WINDOW_MINUTES", 15),
+		},
+		Orders: OrdersConfig{
+			StockReservation: getIntEnv("ORDER_STOCK_RESERVATION_MINUTES", 0),
+		},
 	}
 }
 
@@ -7,6 +7,8 @@ type CannedReply struct {
 	SupplierID  string     `json:"supplier_id" db:"supplier_id"`
 	Title       string     `json:"title" db:"title"`
 	Content     string     `json:"content" db:"content"`
+	UsageCount  int        `json:"usage_count" db:"usage_count"`
+	LastUsedAt  *time.Time `json:"last_used_at" db:"last_used_at"`
 	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt   *time.Time `json:"updated_at" db:"updated_at"`
 }
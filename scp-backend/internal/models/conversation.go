@@ -1,29 +1,119 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type Conversation struct {
 	ID           string     `json:"id" db:"id"`
 	ConsumerID   string     `json:"consumer_id" db:"consumer_id"`
 	SupplierID   string     `json:"supplier_id" db:"supplier_id"`
 	SupplierName string     `json:"supplier_name" db:"supplier_name"`
+	// ConsumerName is set on a supplier's listings.
+	ConsumerName *string    `json:"consumer_name,omitempty" db:"consumer_name"`
+	// Topic says what the thread is about; order and complaint threads
+	// carry the ID of theirs.
+	Topic        string     `json:"topic" db:"topic"`
+	Subject      *string    `json:"subject" db:"subject"`
+	OrderID      *string    `json:"order_id" db:"order_id"`
+	ComplaintID  *string    `json:"complaint_id" db:"complaint_id"`
 	LastMessageAt *time.Time `json:"last_message_at" db:"last_message_at"`
 	UnreadCount  int        `json:"unread_count" db:"unread_count"`
+	// AssignedUserID is the staff member handling the conversation, if any.
+	AssignedUserID   *string    `json:"assigned_user_id" db:"assigned_user_id"`
+	AssignedAt       *time.Time `json:"assigned_at" db:"assigned_at"`
+	AssignedUserName *string    `json:"assigned_user_name,omitempty" db:"assigned_user_name"`
+	// AwayRepliedAt is when the supplier's away message was last posted.
+	AwayRepliedAt    *time.Time `json:"-" db:"away_replied_at"`
 	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt    *time.Time `json:"updated_at" db:"updated_at"`
+	// Presence of the other side, set on listings: the consumer's for a
+	// supplier, and the best of the supplier's staff for a consumer.
+	ConsumerPresence   *string    `json:"consumer_presence,omitempty" db:"consumer_presence"`
+	ConsumerLastSeenAt *time.Time `json:"consumer_last_seen_at,omitempty" db:"consumer_last_seen_at"`
+	SupplierPresence   *string    `json:"supplier_presence,omitempty" db:"supplier_presence"`
+	SupplierLastSeenAt *time.Time `json:"supplier_last_seen_at,omitempty" db:"supplier_last_seen_at"`
 	Consumer     *User      `json:"consumer,omitempty"`
 	Supplier     *Supplier  `json:"supplier,omitempty"`
 }
 
+// Conversation topics. Each consumer and supplier share one general thread
+// and at most one thread per order and per complaint.
+const (
+	TopicGeneral   = "general"
+	TopicOrder     = "order"
+	TopicComplaint = "complaint"
+)
+
+// ThreadSubject selects a thread between a consumer and a supplier: the
+// thread of an order, of a complaint, or, for the zero value, the general
+// one. Title becomes the subject of a newly created thread.
+type ThreadSubject struct {
+	OrderID     string
+	ComplaintID string
+	Title       string
+}
+
+// Topic is the topic of the thread the subject selects.
+func (s ThreadSubject) Topic() string {
+	switch {
+	case s.OrderID != "":
+		return TopicOrder
+	case s.ComplaintID != "":
+		return TopicComplaint
+	}
+	return TopicGeneral
+}
+
+// ConversationGroup gathers a listing's threads with one counterparty, most
+// recently active first.
+type ConversationGroup struct {
+	CounterpartyID   string         `json:"counterparty_id"`
+	CounterpartyName string         `json:"counterparty_name"`
+	UnreadCount      int            `json:"unread_count"`
+	LastMessageAt    *time.Time     `json:"last_message_at"`
+	Threads          []Conversation `json:"threads"`
+}
+
+// Assignment filters for a supplier's conversation listing.
+const (
+	AssignmentAll        = "all"
+	AssignmentMine       = "mine"
+	AssignmentUnassigned = "unassigned"
+)
+
+// SenderRoleSystem marks messages posted by the platform itself, such as
+// assignment changes.
+const SenderRoleSystem = "system"
+
 type Message struct {
-	ID             string     `json:"id" db:"id"`
-	ConversationID string     `json:"conversation_id" db:"conversation_id"`
-	SenderID       string     `json:"sender_id" db:"sender_id"`
-	SenderRole     string     `json:"sender_role" db:"sender_role"`
-	Content        string     `json:"content" db:"content"`
-	AttachmentURL  *string    `json:"attachment_url" db:"attachment_url"`
-	IsRead         bool       `json:"is_read" db:"is_read"`
-	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
-	Sender         *User      `json:"sender,omitempty"`
+	ID             string `json:"id" db:"id"`
+	ConversationID string `json:"conversation_id" db:"conversation_id"`
+	// SenderID is empty once the sender's account has been deleted.
+	SenderID   string `json:"sender_id" db:"sender_id"`
+	SenderRole string `json:"sender_role" db:"sender_role"`
+	// Kind is one of the MessageKind constants and Payload holds the
+	// kind's payload, such as a ProductRefPayload.
+	Kind          string          `json:"kind" db:"kind"`
+	Payload       json.RawMessage `json:"payload" db:"payload"`
+	Content       string          `json:"content" db:"content"`
+	AttachmentURL *string         `json:"attachment_url" db:"attachment_url"`
+	IsRead        bool            `json:"is_read" db:"is_read"`
+	CreatedAt     time.Time       `json:"created_at" db:"created_at"`
+	EditedAt      *time.Time      `json:"edited_at" db:"edited_at"`
+	DeletedAt     *time.Time      `json:"deleted_at" db:"deleted_at"`
+	Sender        *User           `json:"sender,omitempty"`
 }
 
+// MessagePage selects a page of a conversation's history by keyset: the
+// newest messages by default, the ones older than Before, or the ones newer
+// than After. Before and After are message IDs; pages run newest first
+// except when paging forward with After.
+type MessagePage struct {
+	Before string
+	After  string
+	Limit  int
+	// Internal includes staff-only notes, for readers on the supplier's side.
+	Internal bool
+}
@@ -0,0 +1,157 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Message kinds. Users send text, attachments and product or order cards,
+// and staff leave internal notes that consumers never see; only the platform
+// posts system messages.
+const (
+	MessageKindText         = "text"
+	MessageKindAttachment   = "attachment"
+	MessageKindProductRef   = "product_ref"
+	MessageKindOrderRef     = "order_ref"
+	MessageKindSystem       = "system"
+	MessageKindInternalNote = "internal_note"
+)
+
+// Media types of an attachment.
+const (
+	MediaTypeImage = "image"
+	MediaTypeAudio = "audio"
+	MediaTypeFile  = "file"
+)
+
+// System events announced in a thread.
+const (
+	SystemEventAssigned           = "conversation_assigned"
+	SystemEventUnassigned         = "conversation_unassigned"
+	SystemEventComplaintEscalated = "complaint_escalated"
+	SystemEventAwayReply          = "away_reply"
+)
+
+// AttachmentPayload is the payload of an attachment message.
+type AttachmentPayload struct {
+	URL       string `json:"url"`
+	FileName  string `json:"file_name,omitempty"`
+	MediaType string `json:"media_type"`
+}
+
+// ProductRefPayload is the payload of a product card. Product is taken when
+// the message is sent, so the card shows what the sender saw.
+type ProductRefPayload struct {
+	ProductID string           `json:"product_id"`
+	Product   *ProductSnapshot `json:"product,omitempty"`
+}
+
+type ProductSnapshot struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	ImageURL   *string  `json:"image_url"`
+	Unit       string   `json:"unit"`
+	Price      float64  `json:"price"`
+	Discount   *float64 `json:"discount"`
+	Category   *string  `json:"category"`
+	SupplierID string   `json:"supplier_id"`
+}
+
+// OrderRefPayload is the payload of an order card, with the order as it was
+// when the message was sent.
+type OrderRefPayload struct {
+	OrderID string         `json:"order_id"`
+	Order   *OrderSnapshot `json:"order,omitempty"`
+}
+
+type OrderSnapshot struct {
+	ID           string     `json:"id"`
+	Status       string     `json:"status"`
+	Total        float64    `json:"total"`
+	ItemCount    int        `json:"item_count"`
+	DeliveryDate *time.Time `json:"delivery_date"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// InternalNotePayload is the payload of an internal note: the staff members
+// it mentions, who are notified.
+type InternalNotePayload struct {
+	Mentions []string `json:"mentions"`
+}
+
+// SystemPayload is the payload of a system message.
+type SystemPayload struct {
+	Event          string  `json:"event"`
+	ActorID        string  `json:"actor_id,omitempty"`
+	AssignedUserID *string `json:"assigned_user_id,omitempty"`
+	ComplaintID    string  `json:"complaint_id,omitempty"`
+}
+
+// SnapshotProduct returns the parts of a product a card shows.
+func SnapshotProduct(product *Product) *ProductSnapshot {
+	return &ProductSnapshot{
+		ID:         product.ID,
+		Name:       product.Name,
+		ImageURL:   product.ImageURL,
+		Unit:       product.Unit,
+		Price:      product.Price,
+		Discount:   product.Discount,
+		Category:   product.Category,
+		SupplierID: product.SupplierID,
+	}
+}
+
+// SnapshotOrder returns the parts of an order a card shows.
+func SnapshotOrder(order *Order) *OrderSnapshot {
+	return &OrderSnapshot{
+		ID:           order.ID,
+		Status:       order.Status,
+		Total:        order.Total,
+		ItemCount:    len(order.Items),
+		DeliveryDate: order.DeliveryDate,
+		CreatedAt:    order.CreatedAt,
+	}
+}
+
+// Revision actions.
+const (
+	RevisionEdit   = "edit"
+	RevisionDelete = "delete"
+)
+
+// MessageRevision is what a message said before it was edited or deleted.
+type MessageRevision struct {
+	ID            string          `json:"id" db:"id"`
+	MessageID     string          `json:"message_id" db:"message_id"`
+	Action        string          `json:"action" db:"action"`
+	Content       string          `json:"content" db:"content"`
+	Payload       json.RawMessage `json:"payload" db:"payload"`
+	AttachmentURL *string         `json:"attachment_url" db:"attachment_url"`
+	RevisedBy     *string         `json:"revised_by" db:"revised_by"`
+	CreatedAt     time.Time       `json:"created_at" db:"created_at"`
+}
+
+// MessageSearch finds messages matching Query in the conversations of a
+// consumer, or of a supplier when ConsumerID is empty.
+type MessageSearch struct {
+	Query      string
+	ConsumerID string
+	SupplierID string
+	Page       int
+	PageSize   int
+}
+
+// MessageSearchResult is a message matching a search, with the matched
+// words of its content wrapped in <mark> in Snippet.
+type MessageSearchResult struct {
+	ConversationID   string    `json:"conversation_id" db:"conversation_id"`
+	MessageID        string    `json:"message_id" db:"message_id"`
+	SenderID         string    `json:"sender_id" db:"sender_id"`
+	SenderRole       string    `json:"sender_role" db:"sender_role"`
+	Snippet          string    `json:"snippet" db:"snippet"`
+	Topic            string    `json:"topic" db:"topic"`
+	Subject          *string   `json:"subject" db:"subject"`
+	CounterpartyName string    `json:"counterparty_name" db:"counterparty_name"`
+	Rank             float64   `json:"rank" db:"rank"`
+	CreatedAt        time.Time `json:"created_at" db:"created_at"`
+}
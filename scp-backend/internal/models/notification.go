@@ -2,6 +2,14 @@ package models
 
 import "time"
 
+// NotificationTypeMention is the type of notifications about being
+// mentioned in an internal note.
+const NotificationTypeMention = "mention"
+
+// NotificationTypeOrder is the type of notifications about an order, such
+// as its cancellation.
+const NotificationTypeOrder = "order"
+
 type Notification struct {
 	ID        string     `json:"id" db:"id"`
 	UserID    string     `json:"user_id" db:"user_id"`
@@ -2,6 +2,19 @@ package models
 
 import "time"
 
+// Order statuses. An order moves from pending through the fulfilment stages
+// to completed, unless it is rejected or cancelled on the way.
+const (
+	OrderStatusPending        = "pending"
+	OrderStatusAccepted       = "accepted"
+	OrderStatusPreparing      = "preparing"
+	OrderStatusOutForDelivery = "out_for_delivery"
+	OrderStatusDelivered      = "delivered"
+	OrderStatusCompleted      = "completed"
+	OrderStatusRejected       = "rejected"
+	OrderStatusCancelled      = "cancelled"
+)
+
 type Order struct {
 	ID                  string      `json:"id" db:"id"`
 	ConsumerID          string      `json:"consumer_id" db:"consumer_id"`
@@ -18,11 +31,29 @@ type Order struct {
 	DeliveryEndTime     *time.Time  `json:"delivery_end_time" db:"delivery_end_time"`
 	Notes               *string     `json:"notes" db:"notes"`
 	PreferredSettlement *string     `json:"preferred_settlement" db:"preferred_settlement"`
+	// StockReservedUntil is when stock held for a pending order is released.
+	StockReservedUntil  *time.Time  `json:"stock_reserved_until" db:"stock_reserved_until"`
+	// CancellationRequestedAt is set while the consumer waits for the
+	// supplier to approve or decline cancelling an accepted order.
+	CancellationRequestedAt *time.Time `json:"cancellation_requested_at" db:"cancellation_requested_at"`
+	CancellationReason      *string    `json:"cancellation_reason" db:"cancellation_reason"`
+	// CounterOffer is the supplier's open counter-offer on a pending order.
+	CounterOffer        *OrderRevision `json:"counter_offer,omitempty" db:"-"`
 	Items               []OrderItem `json:"items,omitempty"`
 	CreatedAt           time.Time   `json:"created_at" db:"created_at"`
 	UpdatedAt           *time.Time  `json:"updated_at" db:"updated_at"`
 }
 
+// IsCurrent reports whether the order is still under way: placed but not
+// yet completed, rejected or cancelled.
+func (o *Order) IsCurrent() bool {
+	switch o.Status {
+	case OrderStatusCompleted, OrderStatusRejected, OrderStatusCancelled:
+		return false
+	}
+	return true
+}
+
 type OrderItem struct {
 	ID         string  `json:"id" db:"id"`
 	OrderID    string  `json:"order_id" db:"order_id"`
@@ -34,3 +65,71 @@ type OrderItem struct {
 	CreatedAt  time.Time `json:"created_at" db:"created_at"`
 }
 
+// Order event kinds. Cancellation requests and declines leave the status
+// as it is.
+const (
+	OrderEventStatusChanged         = "status_changed"
+	OrderEventCancellationRequested = "cancellation_requested"
+	OrderEventCancellationDeclined  = "cancellation_declined"
+	OrderEventCounterOffered        = "counter_offered"
+	OrderEventCounterOfferAccepted  = "counter_offer_accepted"
+	OrderEventCounterOfferDeclined  = "counter_offer_declined"
+)
+
+// OrderEvent is a change of an order. The first event of an order, when it
+// was placed, has no FromStatus.
+type OrderEvent struct {
+	ID         string    `json:"id" db:"id"`
+	OrderID    string    `json:"order_id" db:"order_id"`
+	Kind       string    `json:"kind" db:"kind"`
+	FromStatus *string   `json:"from_status" db:"from_status"`
+	ToStatus   string    `json:"to_status" db:"to_status"`
+	ActorID    *string   `json:"actor_id" db:"actor_id"`
+	ActorRole  string    `json:"actor_role" db:"actor_role"`
+	ActorName  *string   `json:"actor_name,omitempty" db:"actor_name"`
+	Reason     *string   `json:"reason" db:"reason"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
+// Order revision statuses. The first revision of an order is its lines as
+// placed; later ones are counter-offers, proposed until the consumer
+// accepts or declines them, or the supplier withdraws them by making
+// another or by settling the order some other way.
+const (
+	OrderRevisionPlaced    = "placed"
+	OrderRevisionProposed  = "proposed"
+	OrderRevisionAccepted  = "accepted"
+	OrderRevisionDeclined  = "declined"
+	OrderRevisionWithdrawn = "withdrawn"
+)
+
+// OrderRevision is one version of an order's lines and totals.
+type OrderRevision struct {
+	ID             string              `json:"id" db:"id"`
+	OrderID        string              `json:"order_id" db:"order_id"`
+	Version        int                 `json:"version" db:"version"`
+	Status         string              `json:"status" db:"status"`
+	ProposedBy     *string             `json:"proposed_by" db:"proposed_by"`
+	ProposedByRole string              `json:"proposed_by_role" db:"proposed_by_role"`
+	Reason         *string             `json:"reason" db:"reason"`
+	Subtotal       float64             `json:"subtotal" db:"subtotal"`
+	Tax            float64             `json:"tax" db:"tax"`
+	ShippingFee    float64             `json:"shipping_fee" db:"shipping_fee"`
+	Total          float64             `json:"total" db:"total"`
+	DecidedBy      *string             `json:"decided_by" db:"decided_by"`
+	DecidedAt      *time.Time          `json:"decided_at" db:"decided_at"`
+	Items          []OrderRevisionItem `json:"items" db:"-"`
+	CreatedAt      time.Time           `json:"created_at" db:"created_at"`
+}
+
+// OrderRevisionItem is a line of an order revision.
+type OrderRevisionItem struct {
+	ID         string    `json:"id" db:"id"`
+	RevisionID string    `json:"revision_id" db:"revision_id"`
+	ProductID  string    `json:"product_id" db:"product_id"`
+	Quantity   int       `json:"quantity" db:"quantity"`
+	UnitPrice  float64   `json:"unit_price" db:"unit_price"`
+	Subtotal   float64   `json:"subtotal" db:"subtotal"`
+	Product    *Product  `json:"product,omitempty"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
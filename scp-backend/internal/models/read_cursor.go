@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// ReadCursor is how far a participant has read a conversation.
+type ReadCursor struct {
+	ConversationID    string    `json:"conversation_id" db:"conversation_id"`
+	UserID            string    `json:"user_id" db:"user_id"`
+	LastReadMessageID string    `json:"last_read_message_id" db:"last_read_message_id"`
+	LastReadAt        time.Time `json:"last_read_at" db:"last_read_at"`
+	UpdatedAt         time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// UnreadConversation is one entry of a user's unread summary.
+type UnreadConversation struct {
+	ConversationID    string     `json:"conversation_id" db:"conversation_id"`
+	UnreadCount       int        `json:"unread_count" db:"unread_count"`
+	LastReadMessageID *string    `json:"last_read_message_id" db:"last_read_message_id"`
+	LastReadAt        *time.Time `json:"last_read_at" db:"last_read_at"`
+}
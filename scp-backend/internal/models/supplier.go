@@ -1,6 +1,15 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
+
+// Ways of routing new conversations among a supplier's sales reps.
+const (
+	RoutingRoundRobin  = "round_robin"
+	RoutingLeastLoaded = "least_loaded"
+)
 
 type Supplier struct {
 	ID                string     `json:"id" db:"id"`
@@ -13,7 +22,30 @@ type Supplier struct {
 	Headquarters      *string    `json:"headquarters" db:"headquarters"`
 	RegisteredAddress *string    `json:"registered_address" db:"registered_address"`
 	BankingCurrency   *string    `json:"banking_currency" db:"banking_currency"`
+	RoutingStrategy   string     `json:"routing_strategy" db:"routing_strategy"`
+	// Timezone is the IANA time zone of BusinessHours and Holidays.
+	Timezone          string          `json:"timezone" db:"timezone"`
+	BusinessHours     json.RawMessage `json:"business_hours" db:"business_hours"`
+	Holidays          json.RawMessage `json:"holidays" db:"holidays"`
+	AwayMessage       *string         `json:"away_message" db:"away_message"`
 	CreatedAt         time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt         *time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// OpeningHours is a period a supplier is open on a day of the week, from
+// Open to Close as "15:04" in the supplier's time zone. Close may be
+// "24:00".
+type OpeningHours struct {
+	Day   string `json:"day"`
+	Open  string `json:"open"`
+	Close string `json:"close"`
+}
+
+// Holiday is a date ("2006-01-02") on which the supplier keeps other hours
+// than usual: closed all day, or open from Open to Close.
+type Holiday struct {
+	Date  string `json:"date"`
+	Name  string `json:"name,omitempty"`
+	Open  string `json:"open,omitempty"`
+	Close string `json:"close,omitempty"`
+}
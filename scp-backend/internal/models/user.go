@@ -13,6 +13,14 @@ type User struct {
 	Role          string     `json:"role" db:"role"`
 	ProfileImageURL *string  `json:"profile_image_url" db:"profile_image_url"`
 	SupplierID    *string    `json:"supplier_id" db:"supplier_id"`
+	Presence      string     `json:"presence" db:"presence"`
+	LastSeenAt    *time.Time `json:"last_seen_at" db:"last_seen_at"`
+	// OutOfOffice staff are not routed new conversations until
+	// OutOfOfficeUntil, or until they return when it is nil.
+	OutOfOffice      bool       `json:"out_of_office" db:"out_of_office"`
+	OutOfOfficeUntil *time.Time `json:"out_of_office_until" db:"out_of_office_until"`
+	// LastRoutedAt is when a sales rep was last routed a new conversation.
+	LastRoutedAt     *time.Time `json:"-" db:"last_routed_at"`
 	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt     *time.Time `json:"updated_at" db:"updated_at"`
 }
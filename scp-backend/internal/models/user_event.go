@@ -0,0 +1,16 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// UserEvent is a realtime event kept so that a reconnecting client can
+// replay what it missed. Seq increases by one per event for each user.
+type UserEvent struct {
+	UserID    string          `json:"user_id" db:"user_id"`
+	Seq       int64           `json:"seq" db:"seq"`
+	Type      string          `json:"type" db:"type"`
+	Payload   json.RawMessage `json:"payload" db:"payload"`
+	CreatedAt time.Time       `json:"created_at" db:"created_at"`
+}
@@ -32,7 +32,14 @@ func (r *CannedReplyRepository) GetBySupplierID(supplierID string) ([]models.Can
 		WHERE supplier_id = $1
 		ORDER BY created_at DESC
 	`, supplierID)
-	return replies, err
+	if err != nil {
+		return nil, err
+	}
+	// Ensure we always return a non-nil slice
+	if replies == nil {
+		replies = []models.CannedReply{}
+	}
+	return replies, nil
 }
 
 func (r *CannedReplyRepository) Create(reply *models.CannedReply) error {
@@ -63,3 +70,13 @@ func (r *CannedReplyRepository) Delete(id string) error {
 	return err
 }
 
+// RecordUsage counts one more send of a canned reply.
+func (r *CannedReplyRepository) RecordUsage(id string) error {
+	_, err := r.db.Exec(`
+		UPDATE canned_replies SET
+			usage_count = usage_count + 1,
+			last_used_at = NOW()
+		WHERE id = $1
+	`, id)
+	return err
+}
@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"database/sql"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
@@ -25,12 +27,26 @@ func (r *ConversationRepository) GetByID(id string) (*models.Conversation, error
 	return &conv, nil
 }
 
-func (r *ConversationRepository) GetOrCreate(consumerID, supplierID string) (*models.Conversation, error) {
-	var conv models.Conversation
-	err := r.db.Get(&conv, `
+// GetOrCreate returns the thread between a consumer and a supplier that the
+// subject selects, creating it if needed.
+func (r *ConversationRepository) GetOrCreate(consumerID, supplierID string, subject models.ThreadSubject) (*models.Conversation, error) {
+	topic := subject.Topic()
+	query := `
 		SELECT * FROM conversations 
-		WHERE consumer_id = $1 AND supplier_id = $2
-	`, consumerID, supplierID)
+		WHERE consumer_id = $1 AND supplier_id = $2 AND topic = $3
+	`
+	args := []interface{}{consumerID, supplierID, topic}
+	switch topic {
+	case models.TopicOrder:
+		query += "AND order_id = $4"
+		args = append(args, subject.OrderID)
+	case models.TopicComplaint:
+		query += "AND complaint_id = $4"
+		args = append(args, subject.ComplaintID)
+	}
+
+	var conv models.Conversation
+	err := r.db.Get(&conv, query, args...)
 
 	if err == nil {
 		return &conv, nil
@@ -40,13 +56,24 @@ func (r *ConversationRepository) GetOrCreate(consumerID, supplierID string) (*mo
 	conv.ID = uuid.New().String()
 	conv.ConsumerID = consumerID
 	conv.SupplierID = supplierID
-	conv.UnreadCount = 0
+	conv.Topic = topic
 	conv.CreatedAt = time.Now()
+	if subject.Title != "" {
+		conv.Subject = &subject.Title
+	}
+	if subject.OrderID != "" {
+		conv.OrderID = &subject.OrderID
+	}
+	if subject.ComplaintID != "" {
+		conv.ComplaintID = &subject.ComplaintID
+	}
 
+	// Another request may create the same thread meanwhile; the unique
+	// thread indexes turn that into a no-op
 	_, err = r.db.NamedExec(`
-		INSERT INTO conversations (id, consumer_id, supplier_id, unread_count, created_at)
-		VALUES (:id, :consumer_id, :supplier_id, :unread_count, :created_at)
-		ON CONFLICT (consumer_id, supplier_id) DO NOTHING
+		INSERT INTO conversations (id, consumer_id, supplier_id, topic, subject, order_id, complaint_id, created_at)
+		VALUES (:id, :consumer_id, :supplier_id, :topic, :subject, :order_id, :complaint_id, :created_at)
+		ON CONFLICT DO NOTHING
 	`, conv)
 
 	if err != nil {
@@ -54,10 +81,7 @@ func (r *ConversationRepository) GetOrCreate(consumerID, supplierID string) (*mo
 	}
 
 	// Retry getting it
-	err = r.db.Get(&conv, `
-		SELECT * FROM conversations 
-		WHERE consumer_id = $1 AND supplier_id = $2
-	`, consumerID, supplierID)
+	err = r.db.Get(&conv, query, args...)
 
 	return &conv, err
 }
@@ -66,12 +90,28 @@ func (r *ConversationRepository) GetByConsumerID(consumerID string) ([]models.Co
 	var convs []models.Conversation
 	err := r.db.Select(&convs, `
 		SELECT c.*,
-			COALESCE(s.name, '') as supplier_name
+			COALESCE(s.name, '') as supplier_name,
+			unread.unread_count,
+			staff.presence as supplier_presence,
+			staff.last_seen_at as supplier_last_seen_at
 		FROM conversations c
 		LEFT JOIN suppliers s ON c.supplier_id = s.id
+		`+unreadCountJoin("$1", "'consumer'")+`
+		LEFT JOIN LATERAL (
+			-- The supplier is as present as its most present staff member
+			SELECT
+				CASE
+					WHEN bool_or(u.presence = 'online' AND u.last_seen_at >= $2) THEN 'online'
+					WHEN bool_or(u.presence = 'away' AND u.last_seen_at >= $2) THEN 'away'
+					ELSE 'offline'
+				END as presence,
+				MAX(u.last_seen_at) as last_seen_at
+			FROM users u
+			WHERE u.supplier_id = c.supplier_id AND u.role IN ('owner', 'manager', 'sales_rep')
+		) staff ON true
 		WHERE c.consumer_id = $1
 		ORDER BY c.last_message_at DESC NULLS LAST, c.created_at DESC
-	`, consumerID)
+	`, consumerID, time.Now().Add(-PresenceStaleAfter))
 	
 	// Ensure we always return a non-nil slice
 	if convs == nil {
@@ -81,18 +121,38 @@ func (r *ConversationRepository) GetByConsumerID(consumerID string) ([]models.Co
 	return convs, err
 }
 
-func (r *ConversationRepository) GetBySupplierID(supplierID string) ([]models.Conversation, error) {
+// GetBySupplierID lists a supplier's conversations with the unread counts of
+// the staff member viewing them. assignment narrows the list to the ones
+// assigned to that staff member (models.AssignmentMine), to nobody
+// (models.AssignmentUnassigned), or not at all.
+func (r *ConversationRepository) GetBySupplierID(supplierID, staffID, assignment string) ([]models.Conversation, error) {
+	filter := ""
+	switch assignment {
+	case models.AssignmentMine:
+		filter = "AND c.assigned_user_id = $3"
+	case models.AssignmentUnassigned:
+		filter = "AND c.assigned_user_id IS NULL"
+	}
+
 	var convs []models.Conversation
 	// For supplier view, we can get supplier_name from the same supplier
 	// but we'll populate it via JOIN for consistency
 	err := r.db.Select(&convs, `
 		SELECT c.*,
-			COALESCE(s.name, '') as supplier_name
+			COALESCE(s.name, '') as supplier_name,
+			unread.unread_count,
+			CASE WHEN u.last_seen_at >= $2 THEN u.presence ELSE 'offline' END as consumer_presence,
+			u.last_seen_at as consumer_last_seen_at,
+			COALESCE(NULLIF(u.company_name, ''), NULLIF(CONCAT_WS(' ', u.first_name, u.last_name), ''), u.email) as consumer_name,
+			COALESCE(NULLIF(CONCAT_WS(' ', au.first_name, au.last_name), ''), au.email) as assigned_user_name
 		FROM conversations c
 		LEFT JOIN suppliers s ON c.supplier_id = s.id
-		WHERE c.supplier_id = $1
+		LEFT JOIN users u ON c.consumer_id = u.id
+		LEFT JOIN users au ON c.assigned_user_id = au.id
+		`+unreadCountJoin("$3", "'sales_rep'")+`
+		WHERE c.supplier_id = $1 `+filter+`
 		ORDER BY c.last_message_at DESC NULLS LAST, c.created_at DESC
-	`, supplierID)
+	`, supplierID, time.Now().Add(-PresenceStaleAfter), staffID)
 	
 	// Ensure we always return a non-nil slice
 	if convs == nil {
@@ -102,6 +162,98 @@ func (r *ConversationRepository) GetBySupplierID(supplierID string) ([]models.Co
 	return convs, err
 }
 
+// RoutingActiveWindow is how recently a conversation must have had a
+// message to count towards its sales rep's load when routing.
+const RoutingActiveWindow = 7 * 24 * time.Hour
+
+// Route assigns a conversation that has never been assigned to one of its
+// supplier's sales reps, and returns who that is. Reps who are online or away
+// come first; among them the supplier's routing strategy picks the rep with
+// the fewest conversations active within RoutingActiveWindow (least_loaded)
+// or the one routed a conversation longest ago (round_robin). Reps who are
+// out of office are skipped. It returns nil if the conversation was already
+// routed or no sales rep is available.
+func (r *ConversationRepository) Route(conversationID string) (*string, error) {
+	var assigneeID string
+	now := time.Now()
+	err := r.db.Get(&assigneeID, `
+		WITH pick AS (
+			SELECT u.id
+			FROM users u
+			JOIN suppliers s ON s.id = u.supplier_id
+			LEFT JOIN LATERAL (
+				SELECT COUNT(*) as active_count
+				FROM conversations a
+				WHERE a.assigned_user_id = u.id
+					AND COALESCE(a.last_message_at, a.created_at) >= $3
+			) load ON true
+			WHERE u.supplier_id = (SELECT supplier_id FROM conversations WHERE id = $1)
+				AND u.role = 'sales_rep'
+				AND NOT (u.out_of_office AND (u.out_of_office_until IS NULL OR u.out_of_office_until > NOW()))
+			ORDER BY
+				COALESCE(u.presence <> 'offline' AND u.last_seen_at >= $2, false) DESC,
+				CASE WHEN s.routing_strategy = 'least_loaded' THEN load.active_count ELSE 0 END,
+				u.last_routed_at NULLS FIRST,
+				u.id
+			LIMIT 1
+		), routed AS (
+			UPDATE conversations c
+			SET assigned_user_id = pick.id, assigned_at = NOW(), updated_at = NOW()
+			FROM pick
+			WHERE c.id = $1 AND c.assigned_at IS NULL
+			RETURNING c.assigned_user_id
+		), rep AS (
+			UPDATE users SET last_routed_at = NOW()
+			WHERE id IN (SELECT assigned_user_id FROM routed)
+		)
+		SELECT assigned_user_id FROM routed
+	`, conversationID, now.Add(-PresenceStaleAfter), now.Add(-RoutingActiveWindow))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &assigneeID, nil
+}
+
+// Assign hands a conversation to a staff member, or to nobody when
+// assigneeID is nil. It reports whether the assignment changed.
+func (r *ConversationRepository) Assign(conversationID string, assigneeID *string) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE conversations
+		SET assigned_user_id = $2, assigned_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND assigned_user_id IS DISTINCT FROM $2
+	`, conversationID, assigneeID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// ClaimAwayReply records that the away message is being posted in a
+// conversation, unless it already was after closedSince. It reports whether
+// the caller should post it.
+func (r *ConversationRepository) ClaimAwayReply(conversationID string, closedSince time.Time) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE conversations
+		SET away_replied_at = NOW()
+		WHERE id = $1 AND (away_replied_at IS NULL OR away_replied_at < $2)
+	`, conversationID, closedSince)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
 func (r *ConversationRepository) UpdateLastMessage(conversationID string) error {
 	_, err := r.db.Exec(`
 		UPDATE conversations 
@@ -111,30 +263,50 @@ func (r *ConversationRepository) UpdateLastMessage(conversationID string) error
 	return err
 }
 
-func (r *ConversationRepository) IncrementUnreadCount(conversationID string, senderRole string) error {
-	if senderRole == "consumer" {
-		// Increment unread for supplier
-		_, err := r.db.Exec(`
-			UPDATE conversations 
-			SET unread_count = unread_count + 1
-			WHERE id = $1
-		`, conversationID)
-		return err
-	}
-	// For sales_rep, we might track separately
-	return nil
-}
+// GetUnreadSummary returns the conversations in which the user has unread
+// messages: a consumer's own, or any of their supplier's for staff.
+func (r *ConversationRepository) GetUnreadSummary(userID, role, supplierID string) ([]models.UnreadConversation, error) {
+	owner := "c.consumer_id = $1"
+	ownerID := userID
+	if role != "consumer" {
+		owner = "c.supplier_id = $1"
+		ownerID = supplierID
+	}
+
+	var summary []models.UnreadConversation
+	err := r.db.Select(&summary, `
+		SELECT c.id as conversation_id,
+			unread.unread_count,
+			rc.last_read_message_id,
+			rc.last_read_at
+		FROM conversations c
+		LEFT JOIN conversation_read_cursors rc ON rc.conversation_id = c.id AND rc.user_id = $2
+		`+unreadCountJoin("$2", "$3")+`
+		WHERE `+owner+` AND unread.unread_count > 0
+		ORDER BY c.last_message_at DESC NULLS LAST, c.created_at DESC
+	`, ownerID, userID, MessageSenderRole(role))
 
-func (r *ConversationRepository) ResetUnreadCount(conversationID string, userRole string) error {
-	if userRole == "consumer" {
-		// Consumer reads messages, reset count
-		_, err := r.db.Exec(`
-			UPDATE conversations 
-			SET unread_count = 0
-			WHERE id = $1
-		`, conversationID)
-		return err
-	}
-	return nil
+	// Ensure we always return a non-nil slice
+	if summary == nil {
+		summary = []models.UnreadConversation{}
+	}
+
+	return summary, err
 }
 
+// unreadCountJoin adds unread.unread_count for conversation c: the messages
+// sent by the other side, not the reader's (senderRole) or the system, that
+// come after the reader's read cursor. Internal notes are never unread.
+// Both arguments are SQL expressions, usually placeholders.
+func unreadCountJoin(readerID, senderRole string) string {
+	return `LEFT JOIN LATERAL (
+			SELECT COUNT(*) as unread_count
+			FROM messages m
+			LEFT JOIN conversation_read_cursors reader_cursor
+				ON reader_cursor.conversation_id = m.conversation_id AND reader_cursor.user_id = ` + readerID + `
+			WHERE m.conversation_id = c.id AND m.sender_role NOT IN (` + senderRole + `, 'system')
+				AND m.kind <> 'internal_note'
+				AND (reader_cursor.user_id IS NULL
+					OR (m.created_at, m.id) > (reader_cursor.last_read_at, reader_cursor.last_read_message_id))
+		) unread ON true`
+}
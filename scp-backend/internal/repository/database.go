@@ -9,6 +9,9 @@ import (
 
 type Database struct {
 	DB *sqlx.DB
+	// DSN is kept for components that need their own connection, such as
+	// LISTEN/NOTIFY listeners.
+	DSN string
 }
 
 func NewDatabase(host string, port int, user, password, dbname, sslmode string) (*Database, error) {
@@ -24,7 +27,7 @@ func NewDatabase(host string, port int, user, password, dbname, sslmode string)
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	return &Database{DB: db}, nil
+	return &Database{DB: db, DSN: dsn}, nil
 }
 
 func (d *Database) Close() error {
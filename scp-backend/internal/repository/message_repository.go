@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"database/sql"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
@@ -19,46 +21,353 @@ func NewMessageRepository(db *sqlx.DB) *MessageRepository {
 func (r *MessageRepository) Create(message *models.Message) error {
 	message.ID = uuid.New().String()
 	message.CreatedAt = time.Now()
-	_, err := r.db.NamedExec(`
-		INSERT INTO messages (id, conversation_id, sender_id, sender_role, content, attachment_url, is_read, created_at)
-		VALUES (:id, :conversation_id, :sender_id, :sender_role, :content, :attachment_url, :is_read, :created_at)
-	`, message)
+	if message.Kind == "" {
+		message.Kind = models.MessageKindText
+	}
+	if len(message.Payload) == 0 {
+		message.Payload = []byte("{}")
+	}
+	_, err := r.db.Exec(`
+		INSERT INTO messages (id, conversation_id, sender_id, sender_role, kind, payload, content, attachment_url, is_read, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6::jsonb, $7, $8, $9, $10)
+	`, message.ID, message.ConversationID, message.SenderID, message.SenderRole, message.Kind, string(message.Payload),
+		message.Content, message.AttachmentURL, message.IsRead, message.CreatedAt)
 	return err
 }
 
-func (r *MessageRepository) GetByConversationID(conversationID string, page, pageSize int) ([]models.Message, error) {
+// ErrCursorNotFound is returned when a pagination cursor does not name a
+// message of the conversation.
+var ErrCursorNotFound = errors.New("cursor message not found")
+
+// messageSelect loads messages along with their sender. The sender of a
+// message whose author was deleted is empty.
+const messageSelect = `
+	SELECT m.id, m.conversation_id, COALESCE(m.sender_id::text, '') as sender_id, m.sender_role,
+		m.kind, m.payload, m.content, m.attachment_url, m.is_read, m.created_at, m.edited_at, m.deleted_at,
+		COALESCE(u.id::text, '') as "sender.id",
+		COALESCE(u.email, '') as "sender.email",
+		u.first_name as "sender.first_name",
+		u.last_name as "sender.last_name",
+		u.company_name as "sender.company_name",
+		u.profile_image_url as "sender.profile_image_url",
+		COALESCE(u.role, '') as "sender.role"
+	FROM messages m
+	LEFT JOIN users u ON m.sender_id = u.id
+`
+
+func (r *MessageRepository) GetByID(id string) (*models.Message, error) {
+	var message models.Message
+	err := r.db.Get(&message, messageSelect+"WHERE m.id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// GetByConversationID returns one page of a conversation's history, ordered
+// by (created_at, id) so that messages sharing a timestamp are neither
+// skipped nor repeated. It also reports whether more messages lie beyond the
+// page in the same direction. Internal notes are left out unless the page
+// asks for them.
+func (r *MessageRepository) GetByConversationID(conversationID string, page models.MessagePage) ([]models.Message, bool, error) {
+	condition := ""
+	if !page.Internal {
+		condition = "AND m.kind <> 'internal_note'"
+	}
+	order := "DESC"
+	args := []interface{}{conversationID, page.Limit + 1}
+
+	cursorID := page.Before
+	if page.After != "" {
+		cursorID = page.After
+	}
+	if cursorID != "" {
+		var cursor struct {
+			ID        string    `db:"id"`
+			CreatedAt time.Time `db:"created_at"`
+		}
+		err := r.db.Get(&cursor, `
+			SELECT id, created_at FROM messages
+			WHERE id = $1 AND conversation_id = $2 AND ($3 OR kind <> 'internal_note')
+		`, cursorID, conversationID, page.Internal)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, ErrCursorNotFound
+		}
+		if err != nil {
+			return nil, false, err
+		}
+
+		args = append(args, cursor.CreatedAt, cursor.ID)
+		if page.After != "" {
+			condition += " AND (m.created_at, m.id) > ($3, $4)"
+			order = "ASC"
+		} else {
+			condition += " AND (m.created_at, m.id) < ($3, $4)"
+		}
+	}
+
 	var messages []models.Message
-	offset := (page - 1) * pageSize
-	err := r.db.Select(&messages, `
-		SELECT m.*,
-			u.id as "sender.id",
-			u.email as "sender.email",
-			u.first_name as "sender.first_name",
-			u.last_name as "sender.last_name",
-			u.company_name as "sender.company_name",
-			u.profile_image_url as "sender.profile_image_url",
-			u.role as "sender.role"
-		FROM messages m
-		LEFT JOIN users u ON m.sender_id = u.id
-		WHERE m.conversation_id = $1
-		ORDER BY m.created_at ASC
-		LIMIT $2 OFFSET $3
-	`, conversationID, pageSize, offset)
-	
+	err := r.db.Select(&messages, messageSelect+`
+		WHERE m.conversation_id = $1 `+condition+`
+		ORDER BY m.created_at `+order+`, m.id `+order+`
+		LIMIT $2
+	`, args...)
+
+	hasMore := len(messages) > page.Limit
+	if hasMore {
+		messages = messages[:page.Limit]
+	}
+
 	// Ensure we always return a non-nil slice
 	if messages == nil {
 		messages = []models.Message{}
 	}
-	
+
+	return messages, hasMore, err
+}
+
+// GetTranscript returns the whole history of a conversation the consumer
+// sees, oldest first, including deleted messages.
+func (r *MessageRepository) GetTranscript(conversationID string) ([]models.Message, error) {
+	var messages []models.Message
+	err := r.db.Select(&messages, messageSelect+`
+		WHERE m.conversation_id = $1 AND m.kind <> 'internal_note'
+		ORDER BY m.created_at, m.id
+	`, conversationID)
+
+	// Ensure we always return a non-nil slice
+	if messages == nil {
+		messages = []models.Message{}
+	}
+
 	return messages, err
 }
 
-func (r *MessageRepository) MarkAsRead(conversationID string, userID string) error {
-	_, err := r.db.Exec(`
-		UPDATE messages 
-		SET is_read = true
-		WHERE conversation_id = $1 AND sender_id != $2 AND is_read = false
+// MarkAsRead moves the user's read cursor up to a message, or to the newest
+// message when upToMessageID is empty, and flags the other side's messages
+// up to it as read. The cursor never moves backwards. It returns the
+// resulting cursor, or nil if the conversation has no messages yet.
+func (r *MessageRepository) MarkAsRead(conversationID, userID, userRole, upToMessageID string) (*models.ReadCursor, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var target struct {
+		ID        string    `db:"id"`
+		CreatedAt time.Time `db:"created_at"`
+	}
+	if upToMessageID != "" {
+		err = tx.Get(&target, `
+			SELECT id, created_at FROM messages
+			WHERE id = $1 AND conversation_id = $2 AND kind <> 'internal_note'
+		`, upToMessageID, conversationID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrCursorNotFound
+		}
+	} else {
+		err = tx.Get(&target, `
+			SELECT id, created_at FROM messages
+			WHERE conversation_id = $1 AND kind <> 'internal_note'
+			ORDER BY created_at DESC, id DESC
+			LIMIT 1
+		`, conversationID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO conversation_read_cursors (conversation_id, user_id, last_read_message_id, last_read_at, updated_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (conversation_id, user_id) DO UPDATE SET
+			last_read_message_id = EXCLUDED.last_read_message_id,
+			last_read_at = EXCLUDED.last_read_at,
+			updated_at = EXCLUDED.updated_at
+		WHERE (conversation_read_cursors.last_read_at, conversation_read_cursors.last_read_message_id)
+			< (EXCLUDED.last_read_at, EXCLUDED.last_read_message_id)
+	`, conversationID, userID, target.ID, target.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	var cursor models.ReadCursor
+	err = tx.Get(&cursor, `
+		SELECT * FROM conversation_read_cursors
+		WHERE conversation_id = $1 AND user_id = $2
 	`, conversationID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE messages
+		SET is_read = true
+		WHERE conversation_id = $1 AND sender_role <> $2 AND is_read = false
+			AND (created_at, id) <= ($3, $4)
+	`, conversationID, MessageSenderRole(userRole), cursor.LastReadAt, cursor.LastReadMessageID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+// MessageSenderRole maps a user role to the side stored in
+// messages.sender_role: the consumer, or 'sales_rep' for all supplier staff.
+func MessageSenderRole(role string) string {
+	if role == "consumer" {
+		return "consumer"
+	}
+	return "sales_rep"
+}
+
+// Edit replaces a message's content, keeping what it said before as a
+// revision by editorID.
+func (r *MessageRepository) Edit(message *models.Message, editorID, content string) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertRevision(tx, message, models.RevisionEdit, editorID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	_, err = tx.Exec(`
+		UPDATE messages SET content = $2, edited_at = $3
+		WHERE id = $1
+	`, message.ID, content, now)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	message.Content = content
+	message.EditedAt = &now
+	return nil
+}
+
+// SoftDelete blanks a message, keeping what it said as a revision by
+// deleterID. The message stays in the history as deleted.
+func (r *MessageRepository) SoftDelete(message *models.Message, deleterID string) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertRevision(tx, message, models.RevisionDelete, deleterID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	_, err = tx.Exec(`
+		UPDATE messages SET content = '', payload = '{}', attachment_url = NULL, deleted_at = $2
+		WHERE id = $1
+	`, message.ID, now)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	message.Content = ""
+	message.Payload = []byte("{}")
+	message.AttachmentURL = nil
+	message.DeletedAt = &now
+	return nil
+}
+
+func insertRevision(tx *sqlx.Tx, message *models.Message, action, revisedBy string) error {
+	payload := message.Payload
+	if len(payload) == 0 {
+		payload = []byte("{}")
+	}
+	_, err := tx.Exec(`
+		INSERT INTO message_revisions (id, message_id, action, content, payload, attachment_url, revised_by, created_at)
+		VALUES ($1, $2, $3, $4, $5::jsonb, $6, $7, $8)
+	`, uuid.New().String(), message.ID, action, message.Content, string(payload), message.AttachmentURL, revisedBy, time.Now())
 	return err
 }
 
+// GetRevisions returns what a message said before each edit and its
+// deletion, oldest first.
+func (r *MessageRepository) GetRevisions(messageID string) ([]models.MessageRevision, error) {
+	var revisions []models.MessageRevision
+	err := r.db.Select(&revisions, `
+		SELECT * FROM message_revisions
+		WHERE message_id = $1
+		ORDER BY created_at, id
+	`, messageID)
+
+	// Ensure we always return a non-nil slice
+	if revisions == nil {
+		revisions = []models.MessageRevision{}
+	}
+
+	return revisions, err
+}
+
+// Search returns a page of the messages matching a web-search style query
+// in the caller's conversations, best matches first, and the total number
+// of matches. Consumers do not find internal notes. Content is HTML-escaped
+// before matched words are marked, so snippets are safe to render.
+func (r *MessageRepository) Search(search models.MessageSearch) ([]models.MessageSearchResult, int, error) {
+	membership := "c.supplier_id = $2"
+	member := search.SupplierID
+	counterpartyName := `COALESCE(NULLIF(cu.company_name, ''), NULLIF(TRIM(CONCAT_WS(' ', cu.first_name, cu.last_name)), ''), cu.email)`
+	if search.ConsumerID != "" {
+		membership = "c.consumer_id = $2 AND m.kind <> 'internal_note'"
+		member = search.ConsumerID
+		counterpartyName = "s.name"
+	}
+
+	from := `
+		FROM messages m
+		JOIN conversations c ON c.id = m.conversation_id
+		JOIN suppliers s ON s.id = c.supplier_id
+		JOIN users cu ON cu.id = c.consumer_id
+		WHERE m.search_vector @@ websearch_to_tsquery('english', $1)
+			AND m.deleted_at IS NULL
+			AND ` + membership
+
+	var total int
+	if err := r.db.Get(&total, "SELECT COUNT(*)"+from, search.Query, member); err != nil {
+		return []models.MessageSearchResult{}, 0, err
+	}
+
+	var results []models.MessageSearchResult
+	err := r.db.Select(&results, `
+		SELECT m.id as message_id, m.conversation_id, COALESCE(m.sender_id::text, '') as sender_id,
+			m.sender_role, m.created_at, c.topic, c.subject,
+			`+counterpartyName+` as counterparty_name,
+			ts_rank(m.search_vector, websearch_to_tsquery('english', $1)) as rank,
+			ts_headline('english',
+				replace(replace(replace(m.content, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'),
+				websearch_to_tsquery('english', $1),
+				'StartSel=<mark>, StopSel=</mark>, MaxWords=30, MinWords=10, MaxFragments=2') as snippet
+		`+from+`
+		ORDER BY rank DESC, m.created_at DESC, m.id
+		LIMIT $3 OFFSET $4
+	`, search.Query, member, search.PageSize, (search.Page-1)*search.PageSize)
+
+	// Ensure we always return a non-nil slice
+	if results == nil {
+		results = []models.MessageSearchResult{}
+	}
+
+	return results, total, err
+}
@@ -1,13 +1,22 @@
 package repository
 
 import (
+	"errors"
+	"fmt"
+	"sort"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/scp-platform/backend/internal/models"
 )
 
+var (
+	ErrInsufficientStock  = errors.New("insufficient stock")
+	ErrOrderStatusChanged = errors.New("order status changed")
+)
+
 type OrderRepository struct {
 	db *sqlx.DB
 }
@@ -35,6 +44,7 @@ func (r *OrderRepository) GetByID(id string) (*models.Order, error) {
 	items, err := r.getOrderItems(id)
 	if err == nil {
 		order.Items = items
+		order.CounterOffer, err = r.getCounterOffer(id)
 	}
 
 	return &order, err
@@ -78,14 +88,14 @@ func (r *OrderRepository) Create(order *models.Order) error {
 			id, consumer_id, supplier_id, status,
 			subtotal, tax, shipping_fee, total,
 			delivery_date, delivery_start_time, delivery_end_time,
-			notes, preferred_settlement,
+			notes, preferred_settlement, stock_reserved_until,
 			created_at
 		)
 		VALUES (
 			:id, :consumer_id, :supplier_id, :status,
 			:subtotal, :tax, :shipping_fee, :total,
 			:delivery_date, :delivery_start_time, :delivery_end_time,
-			:notes, :preferred_settlement,
+			:notes, :preferred_settlement, :stock_reserved_until,
 			:created_at
 		)
 	`, order)
@@ -93,19 +103,49 @@ func (r *OrderRepository) Create(order *models.Order) error {
 		return err
 	}
 
+	// Hold the stock for the order until it is accepted or the hold expires
+	if order.StockReservedUntil != nil {
+		if err := takeStock(tx, order.Items); err != nil {
+			return err
+		}
+	}
+
 	for _, item := range order.Items {
-		item.ID = uuid.New().String()
 		item.OrderID = order.ID
-		item.CreatedAt = time.Now()
-		_, err = tx.NamedExec(`
-			INSERT INTO order_items (id, order_id, product_id, quantity, unit_price, subtotal, created_at)
-			VALUES (:id, :order_id, :product_id, :quantity, :unit_price, :subtotal, :created_at)
-		`, item)
-		if err != nil {
+		if err := insertOrderItem(tx, &item); err != nil {
 			return err
 		}
 	}
 
+	// The lines as placed are the first revision of the order
+	err = insertOrderRevision(tx, &models.OrderRevision{
+		OrderID:        order.ID,
+		Version:        1,
+		Status:         models.OrderRevisionPlaced,
+		ProposedBy:     &order.ConsumerID,
+		ProposedByRole: "consumer",
+		Subtotal:       order.Subtotal,
+		Tax:            order.Tax,
+		ShippingFee:    order.ShippingFee,
+		Total:          order.Total,
+		Items:          revisionItems(order.Items),
+		CreatedAt:      order.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = insertOrderEvent(tx, &models.OrderEvent{
+		OrderID:   order.ID,
+		ToStatus:  order.Status,
+		ActorID:   &order.ConsumerID,
+		ActorRole: "consumer",
+		CreatedAt: order.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+
 	if err := tx.Commit(); err != nil {
 		return err
 	}
@@ -150,6 +190,7 @@ func (r *OrderRepository) GetByConsumerID(consumerID string, page, pageSize int)
 	for i := range orders {
 		items, _ := r.getOrderItems(orders[i].ID)
 		orders[i].Items = items
+		orders[i].CounterOffer, _ = r.getCounterOffer(orders[i].ID)
 	}
 
 	return orders, total, nil
@@ -189,6 +230,7 @@ func (r *OrderRepository) GetBySupplierID(supplierID string, page, pageSize int)
 	for i := range orders {
 		items, _ := r.getOrderItems(orders[i].ID)
 		orders[i].Items = items
+		orders[i].CounterOffer, _ = r.getCounterOffer(orders[i].ID)
 	}
 
 	return orders, total, nil
@@ -211,3 +253,629 @@ func (r *OrderRepository) Update(order *models.Order) error {
 	return err
 }
 
+// UpdateStatus saves an order's new status together with the event
+// recording the change, in one transaction that locks the order. It fails
+// with ErrOrderStatusChanged if the order is no longer in the event's
+// FromStatus. Accepting an order takes its items out of stock, failing
+// with ErrInsufficientStock if any is short, unless stock was reserved for
+// it; rejecting or cancelling an order puts back whatever stock it held. Any
+// cancellation request is settled by the change, and any open counter-offer
+// withdrawn.
+func (r *OrderRepository) UpdateStatus(order *models.Order, event *models.OrderEvent) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var current struct {
+		Status             string     `db:"status"`
+		StockReservedUntil *time.Time `db:"stock_reserved_until"`
+	}
+	err = tx.Get(&current, `SELECT status, stock_reserved_until FROM orders WHERE id = $1 FOR UPDATE`, order.ID)
+	if err != nil {
+		return err
+	}
+	if event.FromStatus != nil && current.Status != *event.FromStatus {
+		return fmt.Errorf("%w: order is now %s", ErrOrderStatusChanged, current.Status)
+	}
+
+	// The items are read under the lock, so they are the ones whose stock
+	// moves
+	var items []models.OrderItem
+	if err := tx.Select(&items, `SELECT * FROM order_items WHERE order_id = $1`, order.ID); err != nil {
+		return err
+	}
+	// Stock is out for an order while it is reserved and from acceptance
+	// on, until the order is rejected or cancelled
+	stockOut := current.StockReservedUntil != nil || current.Status != models.OrderStatusPending
+	keepOut := order.Status != models.OrderStatusRejected && order.Status != models.OrderStatusCancelled
+	switch {
+	case keepOut && !stockOut:
+		err = takeStock(tx, items)
+	case !keepOut && stockOut:
+		err = returnStock(tx, items)
+	}
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	_, err = tx.Exec(`
+		UPDATE orders SET
+			status = $2,
+			stock_reserved_until = NULL,
+			cancellation_requested_at = NULL,
+			cancellation_reason = NULL,
+			updated_at = $3
+		WHERE id = $1
+	`, order.ID, order.Status, now)
+	if err != nil {
+		return err
+	}
+	if err := withdrawRevisions(tx, order.ID, event.ActorID, now); err != nil {
+		return err
+	}
+
+	event.OrderID = order.ID
+	event.CreatedAt = now
+	if err := insertOrderEvent(tx, event); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	order.StockReservedUntil = nil
+	order.CancellationRequestedAt = nil
+	order.CancellationReason = nil
+	order.CounterOffer = nil
+	order.UpdatedAt = &now
+	return nil
+}
+
+// SetCancellationRequest saves the consumer's request to cancel an order,
+// or its removal when the supplier declines it, together with the event
+// recording it. It fails with ErrOrderStatusChanged if the order is no
+// longer in the event's FromStatus or a request was made or settled
+// meanwhile.
+func (r *OrderRepository) SetCancellationRequest(order *models.Order, event *models.OrderEvent) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var current struct {
+		Status                  string     `db:"status"`
+		CancellationRequestedAt *time.Time `db:"cancellation_requested_at"`
+	}
+	err = tx.Get(&current, `SELECT status, cancellation_requested_at FROM orders WHERE id = $1 FOR UPDATE`, order.ID)
+	if err != nil {
+		return err
+	}
+	if event.FromStatus != nil && current.Status != *event.FromStatus {
+		return fmt.Errorf("%w: order is now %s", ErrOrderStatusChanged, current.Status)
+	}
+	if (current.CancellationRequestedAt == nil) != (order.CancellationRequestedAt != nil) {
+		return fmt.Errorf("%w: the cancellation request changed", ErrOrderStatusChanged)
+	}
+
+	now := time.Now()
+	_, err = tx.Exec(`
+		UPDATE orders SET cancellation_requested_at = $2, cancellation_reason = $3, updated_at = $4
+		WHERE id = $1
+	`, order.ID, order.CancellationRequestedAt, order.CancellationReason, now)
+	if err != nil {
+		return err
+	}
+
+	event.OrderID = order.ID
+	event.CreatedAt = now
+	if err := insertOrderEvent(tx, event); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	order.UpdatedAt = &now
+	return nil
+}
+
+// ProposeRevision saves a supplier's counter-offer on a pending order as its
+// next revision, together with the event recording it, withdrawing any
+// counter-offer still open. It fails with ErrOrderStatusChanged if the order
+// is no longer pending.
+func (r *OrderRepository) ProposeRevision(order *models.Order, revision *models.OrderRevision, event *models.OrderEvent) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := lockPendingOrder(tx, order.ID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if err := withdrawRevisions(tx, order.ID, revision.ProposedBy, now); err != nil {
+		return err
+	}
+	err = tx.Get(&revision.Version, `SELECT COALESCE(MAX(version), 0) + 1 FROM order_revisions WHERE order_id = $1`, order.ID)
+	if err != nil {
+		return err
+	}
+	revision.OrderID = order.ID
+	revision.CreatedAt = now
+	if err := insertOrderRevision(tx, revision); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`UPDATE orders SET updated_at = $2 WHERE id = $1`, order.ID, now); err != nil {
+		return err
+	}
+	event.OrderID = order.ID
+	event.CreatedAt = now
+	if err := insertOrderEvent(tx, event); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	order.UpdatedAt = &now
+	return nil
+}
+
+// AcceptRevision makes a counter-offer the lines and totals of its order
+// and accepts the order, together with the event recording it, in one
+// transaction that locks the order. Stock held for the old lines goes back
+// and the new lines are taken out of stock, failing with
+// ErrInsufficientStock if any is short. It fails with ErrOrderStatusChanged
+// if the order is no longer pending or the counter-offer no longer open.
+func (r *OrderRepository) AcceptRevision(order *models.Order, revision *models.OrderRevision, event *models.OrderEvent) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	reservedUntil, err := lockPendingOrder(tx, order.ID)
+	if err != nil {
+		return err
+	}
+	if err := checkRevisionProposed(tx, revision.ID); err != nil {
+		return err
+	}
+
+	if reservedUntil != nil {
+		var held []models.OrderItem
+		if err := tx.Select(&held, `SELECT * FROM order_items WHERE order_id = $1`, order.ID); err != nil {
+			return err
+		}
+		if err := returnStock(tx, held); err != nil {
+			return err
+		}
+	}
+	items := make([]models.OrderItem, len(revision.Items))
+	for i, line := range revision.Items {
+		items[i] = models.OrderItem{
+			OrderID:   order.ID,
+			ProductID: line.ProductID,
+			Quantity:  line.Quantity,
+			UnitPrice: line.UnitPrice,
+			Subtotal:  line.Subtotal,
+		}
+	}
+	if err := takeStock(tx, items); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM order_items WHERE order_id = $1`, order.ID); err != nil {
+		return err
+	}
+	for i := range items {
+		if err := insertOrderItem(tx, &items[i]); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	_, err = tx.Exec(`
+		UPDATE orders SET
+			status = $2,
+			subtotal = $3,
+			tax = $4,
+			shipping_fee = $5,
+			total = $6,
+			stock_reserved_until = NULL,
+			updated_at = $7
+		WHERE id = $1
+	`, order.ID, order.Status, order.Subtotal, order.Tax, order.ShippingFee, order.Total, now)
+	if err != nil {
+		return err
+	}
+	if err := decideRevision(tx, revision, now); err != nil {
+		return err
+	}
+
+	event.OrderID = order.ID
+	event.CreatedAt = now
+	if err := insertOrderEvent(tx, event); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	order.StockReservedUntil = nil
+	order.CounterOffer = nil
+	order.UpdatedAt = &now
+	order.Items, _ = r.getOrderItems(order.ID)
+	return nil
+}
+
+// DeclineRevision saves the consumer turning down a counter-offer, together
+// with the event recording it. The order stays pending with its lines as
+// they were. It fails with ErrOrderStatusChanged if the order is no longer
+// pending or the counter-offer no longer open.
+func (r *OrderRepository) DeclineRevision(order *models.Order, revision *models.OrderRevision, event *models.OrderEvent) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := lockPendingOrder(tx, order.ID); err != nil {
+		return err
+	}
+	if err := checkRevisionProposed(tx, revision.ID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if err := decideRevision(tx, revision, now); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE orders SET updated_at = $2 WHERE id = $1`, order.ID, now); err != nil {
+		return err
+	}
+	event.OrderID = order.ID
+	event.CreatedAt = now
+	if err := insertOrderEvent(tx, event); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	order.CounterOffer = nil
+	order.UpdatedAt = &now
+	return nil
+}
+
+// GetRevisions returns every version of an order's lines, oldest first.
+func (r *OrderRepository) GetRevisions(orderID string) ([]models.OrderRevision, error) {
+	var revisions []models.OrderRevision
+	err := r.db.Select(&revisions, `
+		SELECT * FROM order_revisions WHERE order_id = $1 ORDER BY version
+	`, orderID)
+	if err == nil {
+		err = r.loadRevisionItems(revisions)
+	}
+
+	// Ensure we always return a non-nil slice
+	if revisions == nil {
+		revisions = []models.OrderRevision{}
+	}
+
+	return revisions, err
+}
+
+// getCounterOffer returns the open counter-offer on an order, or nil.
+func (r *OrderRepository) getCounterOffer(orderID string) (*models.OrderRevision, error) {
+	var revisions []models.OrderRevision
+	err := r.db.Select(&revisions, `
+		SELECT * FROM order_revisions WHERE order_id = $1 AND status = 'proposed'
+	`, orderID)
+	if err != nil || len(revisions) == 0 {
+		return nil, err
+	}
+	if err := r.loadRevisionItems(revisions); err != nil {
+		return nil, err
+	}
+	return &revisions[0], nil
+}
+
+func (r *OrderRepository) loadRevisionItems(revisions []models.OrderRevision) error {
+	if len(revisions) == 0 {
+		return nil
+	}
+	revisionIDs := make([]string, len(revisions))
+	for i := range revisions {
+		revisionIDs[i] = revisions[i].ID
+	}
+
+	var items []models.OrderRevisionItem
+	err := r.db.Select(&items, `
+		SELECT ri.*,
+			p.id as "product.id",
+			COALESCE(p.name, '') as "product.name",
+			p.image_url as "product.image_url",
+			COALESCE(p.unit, 'unit') as "product.unit"
+		FROM order_revision_items ri
+		LEFT JOIN products p ON ri.product_id = p.id
+		WHERE ri.revision_id = ANY($1)
+		ORDER BY ri.created_at, ri.id
+	`, pq.Array(revisionIDs))
+	if err != nil {
+		return err
+	}
+
+	byRevision := map[string][]models.OrderRevisionItem{}
+	for _, item := range items {
+		byRevision[item.RevisionID] = append(byRevision[item.RevisionID], item)
+	}
+	for i := range revisions {
+		revisions[i].Items = byRevision[revisions[i].ID]
+		if revisions[i].Items == nil {
+			revisions[i].Items = []models.OrderRevisionItem{}
+		}
+	}
+	return nil
+}
+
+// lockPendingOrder locks an order and returns until when stock is held for
+// it, failing with ErrOrderStatusChanged unless it is still pending.
+func lockPendingOrder(tx *sqlx.Tx, orderID string) (*time.Time, error) {
+	var current struct {
+		Status             string     `db:"status"`
+		StockReservedUntil *time.Time `db:"stock_reserved_until"`
+	}
+	err := tx.Get(&current, `SELECT status, stock_reserved_until FROM orders WHERE id = $1 FOR UPDATE`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if current.Status != models.OrderStatusPending {
+		return nil, fmt.Errorf("%w: order is now %s", ErrOrderStatusChanged, current.Status)
+	}
+	return current.StockReservedUntil, nil
+}
+
+// checkRevisionProposed fails with ErrOrderStatusChanged unless a
+// counter-offer is still open. Its order must be locked.
+func checkRevisionProposed(tx *sqlx.Tx, revisionID string) error {
+	var status string
+	if err := tx.Get(&status, `SELECT status FROM order_revisions WHERE id = $1`, revisionID); err != nil {
+		return err
+	}
+	if status != models.OrderRevisionProposed {
+		return fmt.Errorf("%w: the counter-offer was %s", ErrOrderStatusChanged, status)
+	}
+	return nil
+}
+
+// decideRevision saves the consumer's answer to a counter-offer.
+func decideRevision(tx *sqlx.Tx, revision *models.OrderRevision, now time.Time) error {
+	revision.DecidedAt = &now
+	_, err := tx.Exec(`
+		UPDATE order_revisions SET status = $2, decided_by = $3, decided_at = $4
+		WHERE id = $1
+	`, revision.ID, revision.Status, revision.DecidedBy, now)
+	return err
+}
+
+// withdrawRevisions withdraws the open counter-offer on an order, if any.
+func withdrawRevisions(tx *sqlx.Tx, orderID string, actorID *string, now time.Time) error {
+	_, err := tx.Exec(`
+		UPDATE order_revisions SET status = 'withdrawn', decided_by = $2, decided_at = $3
+		WHERE order_id = $1 AND status = 'proposed'
+	`, orderID, actorID, now)
+	return err
+}
+
+func insertOrderRevision(tx *sqlx.Tx, revision *models.OrderRevision) error {
+	revision.ID = uuid.New().String()
+	_, err := tx.NamedExec(`
+		INSERT INTO order_revisions (
+			id, order_id, version, status, proposed_by, proposed_by_role, reason,
+			subtotal, tax, shipping_fee, total, created_at
+		)
+		VALUES (
+			:id, :order_id, :version, :status, :proposed_by, :proposed_by_role, :reason,
+			:subtotal, :tax, :shipping_fee, :total, :created_at
+		)
+	`, revision)
+	if err != nil {
+		return err
+	}
+
+	for i := range revision.Items {
+		item := &revision.Items[i]
+		item.ID = uuid.New().String()
+		item.RevisionID = revision.ID
+		item.CreatedAt = revision.CreatedAt
+		_, err = tx.NamedExec(`
+			INSERT INTO order_revision_items (id, revision_id, product_id, quantity, unit_price, subtotal, created_at)
+			VALUES (:id, :revision_id, :product_id, :quantity, :unit_price, :subtotal, :created_at)
+		`, item)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// revisionItems copies order lines into revision lines.
+func revisionItems(items []models.OrderItem) []models.OrderRevisionItem {
+	lines := make([]models.OrderRevisionItem, len(items))
+	for i, item := range items {
+		lines[i] = models.OrderRevisionItem{
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+			UnitPrice: item.UnitPrice,
+			Subtotal:  item.Subtotal,
+		}
+	}
+	return lines
+}
+
+func insertOrderItem(tx *sqlx.Tx, item *models.OrderItem) error {
+	item.ID = uuid.New().String()
+	item.CreatedAt = time.Now()
+	_, err := tx.NamedExec(`
+		INSERT INTO order_items (id, order_id, product_id, quantity, unit_price, subtotal, created_at)
+		VALUES (:id, :order_id, :product_id, :quantity, :unit_price, :subtotal, :created_at)
+	`, item)
+	return err
+}
+
+// ReleaseExpiredReservations returns the stock held for pending orders
+// whose reservation ended before now, and returns how many orders it
+// released. Orders another transaction is working on are left for later.
+func (r *OrderRepository) ReleaseExpiredReservations(now time.Time) (int, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var orderIDs []string
+	err = tx.Select(&orderIDs, `
+		SELECT id FROM orders
+		WHERE status = 'pending' AND stock_reserved_until <= $1
+		ORDER BY id
+		FOR UPDATE SKIP LOCKED
+	`, now)
+	if err != nil || len(orderIDs) == 0 {
+		return 0, err
+	}
+
+	var items []models.OrderItem
+	err = tx.Select(&items, `
+		SELECT * FROM order_items WHERE order_id = ANY($1)
+	`, pq.Array(orderIDs))
+	if err != nil {
+		return 0, err
+	}
+	if err := returnStock(tx, items); err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE orders SET stock_reserved_until = NULL
+		WHERE id = ANY($1)
+	`, pq.Array(orderIDs))
+	if err != nil {
+		return 0, err
+	}
+
+	return len(orderIDs), tx.Commit()
+}
+
+// stockByProduct adds up the quantities of items per product, in product
+// order so that concurrent transactions lock products in the same order.
+func stockByProduct(items []models.OrderItem) ([]string, map[string]int) {
+	quantities := map[string]int{}
+	for _, item := range items {
+		quantities[item.ProductID] += item.Quantity
+	}
+	productIDs := make([]string, 0, len(quantities))
+	for productID := range quantities {
+		productIDs = append(productIDs, productID)
+	}
+	sort.Strings(productIDs)
+	return productIDs, quantities
+}
+
+// takeStock locks the products of items and takes the items out of stock,
+// or fails with ErrInsufficientStock without taking any.
+func takeStock(tx *sqlx.Tx, items []models.OrderItem) error {
+	productIDs, quantities := stockByProduct(items)
+	if len(productIDs) == 0 {
+		return nil
+	}
+
+	var products []struct {
+		ID         string `db:"id"`
+		Name       string `db:"name"`
+		StockLevel int    `db:"stock_level"`
+	}
+	err := tx.Select(&products, `
+		SELECT id, name, stock_level FROM products
+		WHERE id = ANY($1)
+		ORDER BY id
+		FOR UPDATE
+	`, pq.Array(productIDs))
+	if err != nil {
+		return err
+	}
+	if len(products) != len(productIDs) {
+		return fmt.Errorf("%w: a product of the order no longer exists", ErrInsufficientStock)
+	}
+	for _, product := range products {
+		if product.StockLevel < quantities[product.ID] {
+			return fmt.Errorf("%w for product %s", ErrInsufficientStock, product.Name)
+		}
+	}
+
+	for _, productID := range productIDs {
+		_, err := tx.Exec(`
+			UPDATE products SET stock_level = stock_level - $2, updated_at = NOW()
+			WHERE id = $1
+		`, productID, quantities[productID])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// returnStock puts items back into stock.
+func returnStock(tx *sqlx.Tx, items []models.OrderItem) error {
+	productIDs, quantities := stockByProduct(items)
+	for _, productID := range productIDs {
+		_, err := tx.Exec(`
+			UPDATE products SET stock_level = stock_level + $2, updated_at = NOW()
+			WHERE id = $1
+		`, productID, quantities[productID])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func insertOrderEvent(tx *sqlx.Tx, event *models.OrderEvent) error {
+	event.ID = uuid.New().String()
+	if event.Kind == "" {
+		event.Kind = models.OrderEventStatusChanged
+	}
+	_, err := tx.NamedExec(`
+		INSERT INTO order_events (id, order_id, kind, from_status, to_status, actor_id, actor_role, reason, created_at)
+		VALUES (:id, :order_id, :kind, :from_status, :to_status, :actor_id, :actor_role, :reason, :created_at)
+	`, event)
+	return err
+}
+
+// GetEvents returns the status changes of an order, oldest first, with the
+// name of who made each.
+func (r *OrderRepository) GetEvents(orderID string) ([]models.OrderEvent, error) {
+	var events []models.OrderEvent
+	err := r.db.Select(&events, `
+		SELECT e.*,
+			COALESCE(NULLIF(TRIM(CONCAT_WS(' ', u.first_name, u.last_name)), ''), u.company_name, u.email) as actor_name
+		FROM order_events e
+		LEFT JOIN users u ON e.actor_id = u.id
+		WHERE e.order_id = $1
+		ORDER BY e.created_at, e.id
+	`, orderID)
+
+	// Ensure we always return a non-nil slice
+	if events == nil {
+		events = []models.OrderEvent{}
+	}
+
+	return events, err
+}
@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// PresenceStaleAfter is how long a stored presence stays valid without a
+// refresh. Connected users are refreshed well within it, so an older value
+// means the instance holding the connection went away without recording the
+// disconnect, and the user is shown as offline.
+const PresenceStaleAfter = 3 * time.Minute
+
+type PresenceRepository struct {
+	db *sqlx.DB
+}
+
+func NewPresenceRepository(db *sqlx.DB) *PresenceRepository {
+	return &PresenceRepository{db: db}
+}
+
+// SetPresence records a presence change.
+func (r *PresenceRepository) SetPresence(userID, status string, at time.Time) error {
+	_, err := r.db.Exec(`
+		UPDATE users SET presence = $2, last_seen_at = $3
+		WHERE id = $1
+	`, userID, status, at)
+	return err
+}
+
+// RefreshPresence records the presence of connected users and returns the
+// ones whose effective presence changed, e.g. because another instance had
+// marked them offline when one of their other connections closed.
+func (r *PresenceRepository) RefreshPresence(statuses map[string]string, at time.Time) ([]string, error) {
+	userIDs := make([]string, 0, len(statuses))
+	values := make([]string, 0, len(statuses))
+	for userID, status := range statuses {
+		userIDs = append(userIDs, userID)
+		values = append(values, status)
+	}
+
+	var changed []string
+	err := r.db.Select(&changed, `
+		WITH incoming AS (
+			SELECT unnest($1::uuid[]) AS id, unnest($2::varchar[]) AS presence
+		), previous AS (
+			SELECT u.id,
+				CASE WHEN u.last_seen_at >= $4 THEN u.presence ELSE 'offline' END AS presence
+			FROM users u
+			JOIN incoming i ON i.id = u.id
+		), updated AS (
+			UPDATE users u SET presence = i.presence, last_seen_at = $3
+			FROM incoming i
+			JOIN previous p ON p.id = i.id
+			WHERE u.id = i.id
+			RETURNING u.id, p.presence <> i.presence AS changed
+		)
+		SELECT id FROM updated WHERE changed
+	`, pq.Array(userIDs), pq.Array(values), at, at.Add(-PresenceStaleAfter))
+
+	// Ensure we always return a non-nil slice
+	if changed == nil {
+		changed = []string{}
+	}
+
+	return changed, err
+}
+
+// PresenceAudience returns who shares a conversation with the user: the
+// suppliers a consumer talks to, or the consumers talking to a staff
+// member's supplier along with the supplier itself, so colleagues hear too.
+func (r *PresenceRepository) PresenceAudience(userID string) ([]string, []string, error) {
+	var user struct {
+		Role       string  `db:"role"`
+		SupplierID *string `db:"supplier_id"`
+	}
+	if err := r.db.Get(&user, "SELECT role, supplier_id FROM users WHERE id = $1", userID); err != nil {
+		return nil, nil, err
+	}
+
+	supplierIDs := []string{}
+	consumerIDs := []string{}
+
+	if user.Role == "consumer" {
+		err := r.db.Select(&supplierIDs, `
+			SELECT DISTINCT supplier_id FROM conversations WHERE consumer_id = $1
+		`, userID)
+		return supplierIDs, consumerIDs, err
+	}
+
+	if user.SupplierID == nil {
+		return supplierIDs, consumerIDs, nil
+	}
+	supplierIDs = append(supplierIDs, *user.SupplierID)
+	err := r.db.Select(&consumerIDs, `
+		SELECT DISTINCT consumer_id FROM conversations WHERE supplier_id = $1
+	`, *user.SupplierID)
+	return supplierIDs, consumerIDs, err
+}
+
+// effectivePresence applies PresenceStaleAfter to a stored presence.
+func effectivePresence(status string, lastSeenAt *time.Time, now time.Time) string {
+	if lastSeenAt == nil || lastSeenAt.Before(now.Add(-PresenceStaleAfter)) {
+		return "offline"
+	}
+	return status
+}
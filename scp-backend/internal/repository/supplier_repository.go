@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -35,6 +36,25 @@ func (r *SupplierRepository) Create(supplier *models.Supplier) error {
 	return err
 }
 
+func (r *SupplierRepository) UpdateRoutingStrategy(supplierID, strategy string) error {
+	_, err := r.db.Exec(`
+		UPDATE suppliers SET routing_strategy = $2, updated_at = NOW()
+		WHERE id = $1
+	`, supplierID, strategy)
+	return err
+}
+
+// UpdateBusinessHours replaces the supplier's time zone, weekly hours,
+// holidays and away message.
+func (r *SupplierRepository) UpdateBusinessHours(supplierID, timezone string, hours, holidays json.RawMessage, awayMessage *string) error {
+	_, err := r.db.Exec(`
+		UPDATE suppliers
+		SET timezone = $2, business_hours = $3::jsonb, holidays = $4::jsonb, away_message = $5, updated_at = NOW()
+		WHERE id = $1
+	`, supplierID, timezone, string(hours), string(holidays), awayMessage)
+	return err
+}
+
 func (r *SupplierRepository) GetAll(page, pageSize int) ([]models.Supplier, int, error) {
 	var suppliers []models.Supplier
 	var total int
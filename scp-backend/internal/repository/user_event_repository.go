@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/scp-platform/backend/internal/models"
+)
+
+type UserEventRepository struct {
+	db *sqlx.DB
+}
+
+func NewUserEventRepository(db *sqlx.DB) *UserEventRepository {
+	return &UserEventRepository{db: db}
+}
+
+// AppendToUser stores an event in the user's stream and returns its
+// sequence number.
+func (r *UserEventRepository) AppendToUser(userID, eventType string, payload []byte) (int64, error) {
+	var seq int64
+	err := r.db.Get(&seq, `
+		WITH stream AS (
+			INSERT INTO user_event_streams (user_id, last_seq)
+			VALUES ($1, 1)
+			ON CONFLICT (user_id) DO UPDATE SET last_seq = user_event_streams.last_seq + 1
+			RETURNING user_id, last_seq
+		)
+		INSERT INTO user_events (user_id, seq, type, payload, created_at)
+		SELECT user_id, last_seq, $2, $3::jsonb, $4 FROM stream
+		RETURNING seq
+	`, userID, eventType, string(payload), time.Now())
+	return seq, err
+}
+
+// AppendToSupplier stores an event in the stream of every staff member of
+// the supplier and returns one entry per recipient.
+func (r *UserEventRepository) AppendToSupplier(supplierID, eventType string, payload []byte) ([]models.UserEvent, error) {
+	var events []models.UserEvent
+	err := r.db.Select(&events, `
+		WITH stream AS (
+			INSERT INTO user_event_streams (user_id, last_seq)
+			SELECT id, 1 FROM users
+			WHERE supplier_id = $1 AND role IN ('owner', 'manager', 'sales_rep')
+			ON CONFLICT (user_id) DO UPDATE SET last_seq = user_event_streams.last_seq + 1
+			RETURNING user_id, last_seq
+		)
+		INSERT INTO user_events (user_id, seq, type, payload, created_at)
+		SELECT user_id, last_seq, $2, $3::jsonb, $4 FROM stream
+		RETURNING user_id, seq, type, created_at
+	`, supplierID, eventType, string(payload), time.Now())
+
+	// Ensure we always return a non-nil slice
+	if events == nil {
+		events = []models.UserEvent{}
+	}
+
+	return events, err
+}
+
+// LatestSeq returns the sequence number of the user's newest event, or 0 if
+// the user has none.
+func (r *UserEventRepository) LatestSeq(userID string) (int64, error) {
+	var seq int64
+	err := r.db.Get(&seq, `
+		SELECT COALESCE(MAX(last_seq), 0) FROM user_event_streams WHERE user_id = $1
+	`, userID)
+	return seq, err
+}
+
+// GetSince returns up to limit of the user's retained events after afterSeq,
+// oldest first.
+func (r *UserEventRepository) GetSince(userID string, afterSeq int64, limit int) ([]models.UserEvent, error) {
+	var events []models.UserEvent
+	err := r.db.Select(&events, `
+		SELECT * FROM user_events
+		WHERE user_id = $1 AND seq > $2
+		ORDER BY seq ASC
+		LIMIT $3
+	`, userID, afterSeq, limit)
+
+	// Ensure we always return a non-nil slice
+	if events == nil {
+		events = []models.UserEvent{}
+	}
+
+	return events, err
+}
+
+// DeleteOlderThan drops events past the retention window. Stream counters
+// are kept so sequence numbers never go backwards.
+func (r *UserEventRepository) DeleteOlderThan(cutoff time.Time) error {
+	_, err := r.db.Exec("DELETE FROM user_events WHERE created_at < $1", cutoff)
+	return err
+}
@@ -22,6 +22,7 @@ func (r *UserRepository) GetByID(id string) (*models.User, error) {
 	if err != nil {
 		return nil, err
 	}
+	user.Presence = effectivePresence(user.Presence, user.LastSeenAt, time.Now())
 	return &user, nil
 }
 
@@ -31,6 +32,7 @@ func (r *UserRepository) GetByEmail(email string) (*models.User, error) {
 	if err != nil {
 		return nil, err
 	}
+	user.Presence = effectivePresence(user.Presence, user.LastSeenAt, time.Now())
 	return &user, nil
 }
 
@@ -63,9 +65,23 @@ func (r *UserRepository) Update(user *models.User) error {
 	return err
 }
 
+// SetOutOfOffice marks a staff member out of office, until a time or until
+// they return, or back in.
+func (r *UserRepository) SetOutOfOffice(userID string, outOfOffice bool, until *time.Time) error {
+	_, err := r.db.Exec(`
+		UPDATE users SET out_of_office = $2, out_of_office_until = $3, updated_at = NOW()
+		WHERE id = $1
+	`, userID, outOfOffice, until)
+	return err
+}
+
 func (r *UserRepository) GetBySupplierID(supplierID string) ([]models.User, error) {
 	var users []models.User
 	err := r.db.Select(&users, "SELECT * FROM users WHERE supplier_id = $1 ORDER BY created_at DESC", supplierID)
+	now := time.Now()
+	for i := range users {
+		users[i].Presence = effectivePresence(users[i].Presence, users[i].LastSeenAt, now)
+	}
 	return users, err
 }
 
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/scp-platform/backend/internal/models"
+)
+
+var ErrInvalidBusinessHours = errors.New("invalid business hours")
+
+// DefaultAwayMessage is posted outside business hours when a supplier has
+// not written their own.
+const DefaultAwayMessage = "Thanks for your message! We're closed right now and will get back to you when we reopen."
+
+// awayLookback is how far back ClosedSince looks for the last closing time.
+const awayLookback = 14
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// openPeriod is a period of a day, in minutes since midnight.
+type openPeriod struct {
+	open, close int
+}
+
+// Schedule tells when a supplier is open. A schedule without weekly hours
+// is always open.
+type Schedule struct {
+	location *time.Location
+	weekly   map[time.Weekday][]openPeriod
+	holidays map[string][]openPeriod
+}
+
+// NewSchedule validates a supplier's time zone, weekly hours and holidays.
+func NewSchedule(timezone string, hours []models.OpeningHours, holidays []models.Holiday) (*Schedule, error) {
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unknown time zone %q", ErrInvalidBusinessHours, timezone)
+	}
+
+	schedule := &Schedule{
+		location: location,
+		weekly:   map[time.Weekday][]openPeriod{},
+		holidays: map[string][]openPeriod{},
+	}
+	for _, entry := range hours {
+		day, ok := weekdays[strings.ToLower(entry.Day)]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown day %q", ErrInvalidBusinessHours, entry.Day)
+		}
+		period, err := parsePeriod(entry.Open, entry.Close)
+		if err != nil {
+			return nil, err
+		}
+		schedule.weekly[day] = append(schedule.weekly[day], period)
+	}
+	for _, holiday := range holidays {
+		if _, err := time.Parse("2006-01-02", holiday.Date); err != nil {
+			return nil, fmt.Errorf("%w: holiday date %q must be YYYY-MM-DD", ErrInvalidBusinessHours, holiday.Date)
+		}
+		if _, ok := schedule.holidays[holiday.Date]; ok {
+			return nil, fmt.Errorf("%w: holiday %s is listed twice", ErrInvalidBusinessHours, holiday.Date)
+		}
+		schedule.holidays[holiday.Date] = []openPeriod{}
+		if holiday.Open == "" && holiday.Close == "" {
+			continue
+		}
+		period, err := parsePeriod(holiday.Open, holiday.Close)
+		if err != nil {
+			return nil, err
+		}
+		schedule.holidays[holiday.Date] = []openPeriod{period}
+	}
+	return schedule, nil
+}
+
+// SupplierSchedule is the schedule a supplier has stored.
+func SupplierSchedule(supplier *models.Supplier) (*Schedule, error) {
+	var hours []models.OpeningHours
+	var holidays []models.Holiday
+	if len(supplier.BusinessHours) > 0 {
+		if err := json.Unmarshal(supplier.BusinessHours, &hours); err != nil {
+			return nil, err
+		}
+	}
+	if len(supplier.Holidays) > 0 {
+		if err := json.Unmarshal(supplier.Holidays, &holidays); err != nil {
+			return nil, err
+		}
+	}
+	return NewSchedule(supplier.Timezone, hours, holidays)
+}
+
+// HasHours reports whether the schedule has weekly hours at all.
+func (s *Schedule) HasHours() bool {
+	return len(s.weekly) > 0
+}
+
+// IsOpen reports whether the supplier is open at t.
+func (s *Schedule) IsOpen(t time.Time) bool {
+	if !s.HasHours() {
+		return true
+	}
+	local := t.In(s.location)
+	for _, period := range s.periodsOn(local) {
+		open, close := s.bounds(local, period)
+		if !local.Before(open) && local.Before(close) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClosedSince returns when the supplier last closed before t, which starts
+// the off-hours window t falls in. If the supplier has not been open for
+// awayLookback days, e.g. over a long holiday, it returns the start of the
+// first of those days, so a long closure counts as a new window every
+// awayLookback days.
+func (s *Schedule) ClosedSince(t time.Time) time.Time {
+	local := t.In(s.location)
+	var last time.Time
+	for i := 0; i <= awayLookback; i++ {
+		day := local.AddDate(0, 0, -i)
+		for _, period := range s.periodsOn(day) {
+			_, close := s.bounds(day, period)
+			if !close.After(local) && close.After(last) {
+				last = close
+			}
+		}
+		if !last.IsZero() {
+			return last
+		}
+	}
+	first := local.AddDate(0, 0, -awayLookback)
+	return time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, s.location)
+}
+
+// periodsOn returns the periods the supplier is open on the date of day.
+func (s *Schedule) periodsOn(day time.Time) []openPeriod {
+	if periods, ok := s.holidays[day.Format("2006-01-02")]; ok {
+		return periods
+	}
+	return s.weekly[day.Weekday()]
+}
+
+// bounds returns when a period opens and closes on the date of day.
+func (s *Schedule) bounds(day time.Time, period openPeriod) (time.Time, time.Time) {
+	midnight := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, s.location)
+	open := time.Date(day.Year(), day.Month(), day.Day(), period.open/60, period.open%60, 0, 0, s.location)
+	close := midnight.AddDate(0, 0, 1)
+	if period.close < 24*60 {
+		close = time.Date(day.Year(), day.Month(), day.Day(), period.close/60, period.close%60, 0, 0, s.location)
+	}
+	return open, close
+}
+
+func parsePeriod(open, close string) (openPeriod, error) {
+	start, err := parseClock(open)
+	if err != nil {
+		return openPeriod{}, err
+	}
+	end, err := parseClock(close)
+	if err != nil {
+		return openPeriod{}, err
+	}
+	if end <= start {
+		return openPeriod{}, fmt.Errorf("%w: %s-%s closes before it opens", ErrInvalidBusinessHours, open, close)
+	}
+	return openPeriod{open: start, close: end}, nil
+}
+
+// parseClock parses "15:04", or "24:00" for the end of the day, into
+// minutes since midnight.
+func parseClock(clock string) (int, error) {
+	if clock == "24:00" {
+		return 24 * 60, nil
+	}
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("%w: time %q must be HH:MM", ErrInvalidBusinessHours, clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/scp-platform/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestSchedule(t *testing.T) *Schedule {
+	schedule, err := NewSchedule("Europe/Berlin", []models.OpeningHours{
+		{Day: "monday", Open: "08:00", Close: "12:00"},
+		{Day: "monday", Open: "13:00", Close: "17:00"},
+		{Day: "tuesday", Open: "08:00", Close: "17:00"},
+		{Day: "Saturday", Open: "10:00", Close: "24:00"},
+	}, []models.Holiday{
+		{Date: "2026-12-29", Name: "Inventory", Open: "10:00", Close: "12:00"},
+		{Date: "2026-12-22", Name: "Christmas closure"},
+	})
+	assert.NoError(t, err)
+	return schedule
+}
+
+func TestSchedule_IsOpen(t *testing.T) {
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	schedule := newTestSchedule(t)
+
+	tests := []struct {
+		name     string
+		at       time.Time
+		expected bool
+	}{
+		{"monday morning", time.Date(2026, 12, 14, 9, 0, 0, 0, berlin), true},
+		{"monday lunch break", time.Date(2026, 12, 14, 12, 30, 0, 0, berlin), false},
+		{"monday at closing time", time.Date(2026, 12, 14, 17, 0, 0, 0, berlin), false},
+		{"5 a.m.", time.Date(2026, 12, 15, 5, 0, 0, 0, berlin), false},
+		{"in UTC", time.Date(2026, 12, 15, 7, 30, 0, 0, time.UTC), true},
+		{"sunday", time.Date(2026, 12, 20, 11, 0, 0, 0, berlin), false},
+		{"saturday until midnight", time.Date(2026, 12, 19, 23, 59, 0, 0, berlin), true},
+		{"closed on a holiday", time.Date(2026, 12, 22, 9, 0, 0, 0, berlin), false},
+		{"holiday hours", time.Date(2026, 12, 29, 11, 0, 0, 0, berlin), true},
+		{"outside holiday hours", time.Date(2026, 12, 29, 9, 0, 0, 0, berlin), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, schedule.IsOpen(tt.at))
+		})
+	}
+}
+
+func TestSchedule_ClosedSince(t *testing.T) {
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	schedule := newTestSchedule(t)
+
+	// Tuesday 5 a.m. falls in the window that began when Monday closed
+	assert.True(t, time.Date(2026, 12, 14, 17, 0, 0, 0, berlin).Equal(schedule.ClosedSince(time.Date(2026, 12, 15, 5, 0, 0, 0, berlin))))
+	// The lunch break is a window of its own
+	assert.True(t, time.Date(2026, 12, 14, 12, 0, 0, 0, berlin).Equal(schedule.ClosedSince(time.Date(2026, 12, 14, 12, 30, 0, 0, berlin))))
+	// The holiday extends the window from Monday evening
+	assert.True(t, time.Date(2026, 12, 21, 17, 0, 0, 0, berlin).Equal(schedule.ClosedSince(time.Date(2026, 12, 22, 15, 0, 0, 0, berlin))))
+}
+
+func TestSchedule_ClosedSince_LongClosure(t *testing.T) {
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	holidays := []models.Holiday{}
+	for day := time.Date(2027, 1, 1, 0, 0, 0, 0, berlin); day.Before(time.Date(2027, 2, 1, 0, 0, 0, 0, berlin)); day = day.AddDate(0, 0, 1) {
+		holidays = append(holidays, models.Holiday{Date: day.Format("2006-01-02"), Name: "Winter closure"})
+	}
+	schedule, err := NewSchedule("Europe/Berlin", []models.OpeningHours{{Day: "monday", Open: "08:00", Close: "17:00"}}, holidays)
+	assert.NoError(t, err)
+
+	// Closed for three weeks: the window starts awayLookback days back, so
+	// it is never the zero time and moves on as the closure goes on
+	since := schedule.ClosedSince(time.Date(2027, 1, 22, 10, 0, 0, 0, berlin))
+	assert.True(t, time.Date(2027, 1, 8, 0, 0, 0, 0, berlin).Equal(since))
+	later := schedule.ClosedSince(time.Date(2027, 1, 29, 10, 0, 0, 0, berlin))
+	assert.True(t, later.After(since))
+}
+
+func TestSchedule_WithoutHoursIsAlwaysOpen(t *testing.T) {
+	schedule, err := NewSchedule("", nil, nil)
+
+	assert.NoError(t, err)
+	assert.False(t, schedule.HasHours())
+	assert.True(t, schedule.IsOpen(time.Date(2026, 12, 20, 3, 0, 0, 0, time.UTC)))
+}
+
+func TestNewSchedule_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		timezone string
+		hours    []models.OpeningHours
+		holidays []models.Holiday
+	}{
+		{"unknown time zone", "Mars/Olympus", nil, nil},
+		{"unknown day", "UTC", []models.OpeningHours{{Day: "funday", Open: "08:00", Close: "17:00"}}, nil},
+		{"malformed time", "UTC", []models.OpeningHours{{Day: "monday", Open: "8am", Close: "17:00"}}, nil},
+		{"closes before opening", "UTC", []models.OpeningHours{{Day: "monday", Open: "17:00", Close: "08:00"}}, nil},
+		{"malformed holiday", "UTC", nil, []models.Holiday{{Date: "25/12/2026"}}},
+		{"holiday twice", "UTC", nil, []models.Holiday{{Date: "2026-12-25"}, {Date: "2026-12-25"}}},
+		{"holiday without closing time", "UTC", nil, []models.Holiday{{Date: "2026-12-24", Open: "08:00"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewSchedule(tt.timezone, tt.hours, tt.holidays)
+
+			assert.ErrorIs(t, err, ErrInvalidBusinessHours)
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/scp-platform/backend/internal/models"
+)
+
+var (
+	ErrCannedReplyNotFound    = errors.New("canned reply not found")
+	ErrOrderNotInConversation = errors.New("order does not belong to this conversation")
+	ErrOrderRequired          = errors.New("canned reply needs an order")
+)
+
+// Placeholders a canned reply may contain.
+const (
+	PlaceholderConsumerName = "consumer_name"
+	PlaceholderSupplierName = "supplier_name"
+	PlaceholderOrderID      = "order_id"
+	PlaceholderOrderTotal   = "order_total"
+)
+
+var placeholderPattern = regexp.MustCompile(`{{\s*(\w+)\s*}}`)
+
+// CannedReplyStore is the part of CannedReplyRepository the canned reply
+// service needs.
+type CannedReplyStore interface {
+	GetByID(id string) (*models.CannedReply, error)
+	RecordUsage(id string) error
+}
+
+// UserStore is the part of UserRepository the services need to address
+// users by name.
+type UserStore interface {
+	GetByID(id string) (*models.User, error)
+}
+
+// SupplierStore is the part of SupplierRepository the canned reply service
+// needs.
+type SupplierStore interface {
+	GetByID(id string) (*models.Supplier, error)
+}
+
+// OrderStore is the part of OrderRepository the canned reply service needs.
+type OrderStore interface {
+	GetByID(id string) (*models.Order, error)
+}
+
+// CannedReplyService turns a supplier's canned replies into messages for a
+// particular conversation.
+type CannedReplyService struct {
+	replyRepo    CannedReplyStore
+	userRepo     UserStore
+	supplierRepo SupplierStore
+	orderRepo    OrderStore
+}
+
+func NewCannedReplyService(replyRepo CannedReplyStore, userRepo UserStore, supplierRepo SupplierStore, orderRepo OrderStore) *CannedReplyService {
+	return &CannedReplyService{
+		replyRepo:    replyRepo,
+		userRepo:     userRepo,
+		supplierRepo: supplierRepo,
+		orderRepo:    orderRepo,
+	}
+}
+
+// Render fills a canned reply of the conversation's supplier with the
+// conversation's consumer and supplier and, if orderID is set, one of their
+// orders. Replies that mention the order need one.
+func (s *CannedReplyService) Render(replyID string, conversation *models.Conversation, orderID string) (string, error) {
+	reply, err := s.replyRepo.GetByID(replyID)
+	if err != nil || reply == nil || reply.SupplierID != conversation.SupplierID {
+		return "", ErrCannedReplyNotFound
+	}
+
+	values := map[string]string{}
+
+	consumer, err := s.userRepo.GetByID(conversation.ConsumerID)
+	if err != nil {
+		return "", fmt.Errorf("failed to load consumer: %w", err)
+	}
+	values[PlaceholderConsumerName] = displayName(consumer)
+
+	supplier, err := s.supplierRepo.GetByID(conversation.SupplierID)
+	if err != nil {
+		return "", fmt.Errorf("failed to load supplier: %w", err)
+	}
+	values[PlaceholderSupplierName] = supplier.Name
+
+	if orderID != "" {
+		order, err := s.orderRepo.GetByID(orderID)
+		if err != nil || order == nil || order.ConsumerID != conversation.ConsumerID || order.SupplierID != conversation.SupplierID {
+			return "", ErrOrderNotInConversation
+		}
+		values[PlaceholderOrderID] = order.ID
+		values[PlaceholderOrderTotal] = fmt.Sprintf("%.2f", order.Total)
+	} else if mentionsOrder(reply.Content) {
+		return "", ErrOrderRequired
+	}
+
+	return FillPlaceholders(reply.Content, values), nil
+}
+
+// RecordUsage counts a send of the canned reply.
+func (s *CannedReplyService) RecordUsage(replyID string) error {
+	return s.replyRepo.RecordUsage(replyID)
+}
+
+// FillPlaceholders replaces each {{name}} in content with its value.
+// Placeholders without a value are left as written.
+func FillPlaceholders(content string, values map[string]string) string {
+	return placeholderPattern.ReplaceAllStringFunc(content, func(placeholder string) string {
+		name := placeholderPattern.FindStringSubmatch(placeholder)[1]
+		if value, ok := values[name]; ok {
+			return value
+		}
+		return placeholder
+	})
+}
+
+func mentionsOrder(content string) bool {
+	for _, match := range placeholderPattern.FindAllStringSubmatch(content, -1) {
+		if match[1] == PlaceholderOrderID || match[1] == PlaceholderOrderTotal {
+			return true
+		}
+	}
+	return false
+}
+
+// displayName is how a consumer is addressed: their company, their name, or
+// failing both their email.
+func displayName(user *models.User) string {
+	if user.CompanyName != nil && *user.CompanyName != "" {
+		return *user.CompanyName
+	}
+	return personName(user)
+}
+
+// personName is a user's first and last name, or their email.
+func personName(user *models.User) string {
+	var parts []string
+	if user.FirstName != nil && *user.FirstName != "" {
+		parts = append(parts, *user.FirstName)
+	}
+	if user.LastName != nil && *user.LastName != "" {
+		parts = append(parts, *user.LastName)
+	}
+	if len(parts) > 0 {
+		return strings.Join(parts, " ")
+	}
+	return user.Email
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/scp-platform/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockCannedReplyStore struct {
+	mock.Mock
+}
+
+func (m *MockCannedReplyStore) GetByID(id string) (*models.CannedReply, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.CannedReply), args.Error(1)
+}
+
+func (m *MockCannedReplyStore) RecordUsage(id string) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+type MockSupplierStore struct {
+	mock.Mock
+}
+
+func (m *MockSupplierStore) GetByID(id string) (*models.Supplier, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Supplier), args.Error(1)
+}
+
+func newTestCannedReplyService(content string) (*CannedReplyService, *MockOrderRepository) {
+	replies := new(MockCannedReplyStore)
+	replies.On("GetByID", "reply1").Return(&models.CannedReply{ID: "reply1", SupplierID: "supplier1", Content: content}, nil)
+	replies.On("GetByID", mock.Anything).Return(nil, errors.New("not found"))
+
+	company := "Green Grocer"
+	users := new(MockUserRepository)
+	users.On("GetByID", "consumer1").Return(&models.User{ID: "consumer1", CompanyName: &company}, nil)
+
+	suppliers := new(MockSupplierStore)
+	suppliers.On("GetByID", "supplier1").Return(&models.Supplier{ID: "supplier1", Name: "Fresh Farms"}, nil)
+
+	orders := new(MockOrderRepository)
+	return NewCannedReplyService(replies, users, suppliers, orders), orders
+}
+
+var testConversation = &models.Conversation{ID: "conv1", ConsumerID: "consumer1", SupplierID: "supplier1"}
+
+func TestCannedReplyService_Render(t *testing.T) {
+	service, orders := newTestCannedReplyService("Hi {{consumer_name}}, {{ supplier_name }} received order {{order_id}} ({{order_total}}). {{unknown}}")
+	orders.On("GetByID", "order1").Return(&models.Order{ID: "order1", ConsumerID: "consumer1", SupplierID: "supplier1", Total: 42.5}, nil)
+
+	content, err := service.Render("reply1", testConversation, "order1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Hi Green Grocer, Fresh Farms received order order1 (42.50). {{unknown}}", content)
+}
+
+func TestCannedReplyService_Render_WithoutOrder(t *testing.T) {
+	service, _ := newTestCannedReplyService("Thanks, {{consumer_name}}!")
+
+	content, err := service.Render("reply1", testConversation, "")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Thanks, Green Grocer!", content)
+}
+
+func TestCannedReplyService_Render_Errors(t *testing.T) {
+	tests := []struct {
+		name          string
+		replyID       string
+		conversation  *models.Conversation
+		orderID       string
+		expectedError error
+	}{
+		{"unknown reply", "reply2", testConversation, "", ErrCannedReplyNotFound},
+		{"other supplier's reply", "reply1", &models.Conversation{ConsumerID: "consumer1", SupplierID: "supplier2"}, "", ErrCannedReplyNotFound},
+		{"order of another consumer", "reply1", testConversation, "order2", ErrOrderNotInConversation},
+		{"unknown order", "reply1", testConversation, "order3", ErrOrderNotInConversation},
+		{"order placeholder without order", "reply1", testConversation, "", ErrOrderRequired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, orders := newTestCannedReplyService("Order {{order_id}} is on its way")
+			orders.On("GetByID", "order2").Return(&models.Order{ID: "order2", ConsumerID: "consumer2", SupplierID: "supplier1"}, nil)
+			orders.On("GetByID", "order3").Return(nil, errors.New("not found"))
+
+			_, err := service.Render(tt.replyID, tt.conversation, tt.orderID)
+
+			assert.ErrorIs(t, err, tt.expectedError)
+		})
+	}
+}
+
+func TestFillPlaceholders(t *testing.T) {
+	values := map[string]string{"consumer_name": "Ada"}
+
+	assert.Equal(t, "Hello Ada", FillPlaceholders("Hello {{consumer_name}}", values))
+	assert.Equal(t, "Hello Ada, Ada", FillPlaceholders("Hello {{ consumer_name }}, {{consumer_name}}", values))
+	assert.Equal(t, "Hello {{name}}", FillPlaceholders("Hello {{name}}", values))
+	assert.Equal(t, "No placeholders", FillPlaceholders("No placeholders", values))
+}
+
+func TestDisplayName(t *testing.T) {
+	first, last, company := "Ada", "Lovelace", "Analytical Ltd"
+
+	assert.Equal(t, "Analytical Ltd", displayName(&models.User{CompanyName: &company, FirstName: &first}))
+	assert.Equal(t, "Ada Lovelace", displayName(&models.User{FirstName: &first, LastName: &last}))
+	assert.Equal(t, "ada@example.com", displayName(&models.User{Email: "ada@example.com"}))
+}
@@ -0,0 +1,426 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/scp-platform/backend/internal/models"
+)
+
+var (
+	ErrConversationNotFound  = errors.New("conversation not found")
+	ErrNotConversationMember = errors.New("not a member of this conversation")
+	ErrNotLinked             = errors.New("consumer and supplier are not linked")
+	ErrInvalidAssignee       = errors.New("assignee is not staff of the conversation's supplier")
+	ErrSubjectNotFound       = errors.New("order or complaint not found between this consumer and supplier")
+	ErrInvalidMessage        = errors.New("invalid message")
+	ErrMessageNotFound       = errors.New("message not found")
+	ErrNotMessageSender      = errors.New("only the sender may change a message")
+	ErrEditWindowClosed      = errors.New("message can no longer be changed")
+)
+
+// ChatUser is the caller of a chat action, as identified by their token.
+type ChatUser struct {
+	ID         string
+	Role       string
+	SupplierID string
+}
+
+// IsStaff reports whether the role belongs to a supplier's staff.
+func IsStaff(role string) bool {
+	return role == "owner" || role == "manager" || role == "sales_rep"
+}
+
+// IsConsumer reports whether the user is on the consumer side of their
+// conversations rather than the supplier's staff.
+func (u ChatUser) IsConsumer() bool {
+	return u.Role == "consumer"
+}
+
+// ConversationStore is the part of ConversationRepository the chat service
+// needs.
+type ConversationStore interface {
+	GetByID(id string) (*models.Conversation, error)
+	GetOrCreate(consumerID, supplierID string, subject models.ThreadSubject) (*models.Conversation, error)
+	Route(conversationID string) (*string, error)
+	Assign(conversationID string, assigneeID *string) (bool, error)
+	UpdateLastMessage(conversationID string) error
+	ClaimAwayReply(conversationID string, closedSince time.Time) (bool, error)
+}
+
+// MessageStore is the part of MessageRepository the chat service needs.
+type MessageStore interface {
+	Create(message *models.Message) error
+	GetByID(id string) (*models.Message, error)
+	Edit(message *models.Message, editorID, content string) error
+	SoftDelete(message *models.Message, deleterID string) error
+}
+
+// DefaultEditWindow is how long after sending a message its sender may edit
+// or delete it, unless SetEditWindow says otherwise.
+const DefaultEditWindow = 15 * time.Minute
+
+// ComplaintStore is the part of ComplaintRepository the chat service needs.
+type ComplaintStore interface {
+	GetByID(id string) (*models.Complaint, error)
+}
+
+// ProductStore is the part of ProductRepository the chat service needs.
+type ProductStore interface {
+	GetByID(id string) (*models.Product, error)
+}
+
+// NotificationStore is the part of NotificationRepository the chat service
+// needs.
+type NotificationStore interface {
+	Create(notification *models.Notification) error
+}
+
+// ConsumerLinkStore is the part of ConsumerLinkRepository the chat service
+// needs.
+type ConsumerLinkStore interface {
+	GetByConsumerAndSupplier(consumerID, supplierID string) (*models.ConsumerLink, error)
+}
+
+// ChatService decides who may see and act in a conversation, and who on the
+// supplier's side handles it. Every chat route and WebSocket message goes
+// through it before touching one.
+type ChatService struct {
+	conversationRepo ConversationStore
+	linkRepo         ConsumerLinkStore
+	messageRepo      MessageStore
+	userRepo         UserStore
+	orderRepo        OrderStore
+	complaintRepo    ComplaintStore
+	productRepo      ProductStore
+	notificationRepo NotificationStore
+	supplierRepo     SupplierStore
+	editWindow       time.Duration
+}
+
+func NewChatService(conversationRepo ConversationStore, linkRepo ConsumerLinkStore, messageRepo MessageStore, userRepo UserStore, orderRepo OrderStore, complaintRepo ComplaintStore, productRepo ProductStore, notificationRepo NotificationStore, supplierRepo SupplierStore) *ChatService {
+	return &ChatService{
+		conversationRepo: conversationRepo,
+		linkRepo:         linkRepo,
+		messageRepo:      messageRepo,
+		userRepo:         userRepo,
+		orderRepo:        orderRepo,
+		complaintRepo:    complaintRepo,
+		productRepo:      productRepo,
+		notificationRepo: notificationRepo,
+		supplierRepo:     supplierRepo,
+		editWindow:       DefaultEditWindow,
+	}
+}
+
+// SetEditWindow sets how long after sending a message its sender may edit
+// or delete it.
+func (s *ChatService) SetEditWindow(window time.Duration) {
+	s.editWindow = window
+}
+
+// GetConversation loads a conversation the user belongs to: the consumer it
+// is with, or staff of its supplier.
+func (s *ChatService) GetConversation(conversationID string, user ChatUser) (*models.Conversation, error) {
+	conversation, err := s.conversationRepo.GetByID(conversationID)
+	if err != nil || conversation == nil {
+		return nil, ErrConversationNotFound
+	}
+	if !IsConversationMember(conversation, user) {
+		return nil, ErrNotConversationMember
+	}
+	return conversation, nil
+}
+
+// OpenConversation returns the user's thread with a counterpart that the
+// subject selects, creating it if needed. For a consumer the counterpart is
+// a supplier ID; for staff it is a consumer ID, and the supplier is always
+// their own. Only linked consumers and suppliers may talk, and only about
+// their own orders and complaints.
+func (s *ChatService) OpenConversation(user ChatUser, counterpartID string, subject models.ThreadSubject) (*models.Conversation, error) {
+	consumerID, supplierID := user.ID, counterpartID
+	if !user.IsConsumer() {
+		if user.SupplierID == "" {
+			return nil, ErrNotConversationMember
+		}
+		consumerID, supplierID = counterpartID, user.SupplierID
+	}
+
+	link, err := s.linkRepo.GetByConsumerAndSupplier(consumerID, supplierID)
+	if err != nil || link == nil || link.Status != "accepted" {
+		return nil, ErrNotLinked
+	}
+
+	subject, err = s.titleSubject(consumerID, supplierID, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.conversationRepo.GetOrCreate(consumerID, supplierID, subject)
+}
+
+// OpenOrderConversation returns the thread about one of the user's orders,
+// creating it if needed.
+func (s *ChatService) OpenOrderConversation(user ChatUser, orderID string) (*models.Conversation, error) {
+	order, err := s.orderRepo.GetByID(orderID)
+	if err != nil || order == nil {
+		return nil, ErrSubjectNotFound
+	}
+
+	counterpartID := order.ConsumerID
+	if user.IsConsumer() {
+		counterpartID = order.SupplierID
+	}
+	// Orders of others are not found rather than forbidden.
+	if !IsConversationMember(&models.Conversation{ConsumerID: order.ConsumerID, SupplierID: order.SupplierID}, user) {
+		return nil, ErrSubjectNotFound
+	}
+	return s.OpenConversation(user, counterpartID, models.ThreadSubject{OrderID: order.ID})
+}
+
+// titleSubject checks that the subject's order or complaint is between the
+// consumer and the supplier, and names the thread after it.
+func (s *ChatService) titleSubject(consumerID, supplierID string, subject models.ThreadSubject) (models.ThreadSubject, error) {
+	switch subject.Topic() {
+	case models.TopicOrder:
+		order, err := s.orderRepo.GetByID(subject.OrderID)
+		if err != nil || order == nil || order.ConsumerID != consumerID || order.SupplierID != supplierID {
+			return subject, ErrSubjectNotFound
+		}
+		subject.Title = orderLabel(order.ID)
+
+	case models.TopicComplaint:
+		complaint, err := s.complaintRepo.GetByID(subject.ComplaintID)
+		if err != nil || complaint == nil || complaint.ConsumerID != consumerID || complaint.SupplierID != supplierID {
+			return subject, ErrSubjectNotFound
+		}
+		subject.Title = complaint.Title
+	}
+	return subject, nil
+}
+
+// RouteConversation assigns a conversation that has never been assigned to
+// one of the supplier's sales reps and announces it in the thread. It returns
+// the system message, or nil if nothing changed.
+func (s *ChatService) RouteConversation(conversation *models.Conversation) (*models.Message, error) {
+	if conversation.AssignedAt != nil {
+		return nil, nil
+	}
+
+	assigneeID, err := s.conversationRepo.Route(conversation.ID)
+	if err != nil || assigneeID == nil {
+		return nil, err
+	}
+	now := time.Now()
+	conversation.AssignedUserID = assigneeID
+	conversation.AssignedAt = &now
+
+	return s.postSystemMessage(conversation, *assigneeID,
+		models.SystemPayload{Event: models.SystemEventAssigned, AssignedUserID: assigneeID},
+		fmt.Sprintf("Conversation assigned to %s", s.userName(*assigneeID)))
+}
+
+// AssignConversation hands a conversation to a member of its supplier's
+// staff, or to nobody when assigneeID is nil, and announces the change in
+// the thread. It returns the system message, or nil if nothing changed.
+func (s *ChatService) AssignConversation(conversation *models.Conversation, assigneeID *string, actor ChatUser) (*models.Message, error) {
+	if assigneeID != nil {
+		assignee, err := s.userRepo.GetByID(*assigneeID)
+		if err != nil || assignee == nil || !IsStaff(assignee.Role) ||
+			assignee.SupplierID == nil || *assignee.SupplierID != conversation.SupplierID {
+			return nil, ErrInvalidAssignee
+		}
+	}
+
+	changed, err := s.conversationRepo.Assign(conversation.ID, assigneeID)
+	if err != nil || !changed {
+		return nil, err
+	}
+	now := time.Now()
+	conversation.AssignedUserID = assigneeID
+	conversation.AssignedAt = &now
+
+	event := models.SystemPayload{Event: models.SystemEventUnassigned, ActorID: actor.ID}
+	content := fmt.Sprintf("%s unassigned this conversation", s.userName(actor.ID))
+	if assigneeID != nil {
+		event = models.SystemPayload{Event: models.SystemEventAssigned, ActorID: actor.ID, AssignedUserID: assigneeID}
+		content = fmt.Sprintf("%s assigned this conversation to %s", s.userName(actor.ID), s.userName(*assigneeID))
+	}
+	return s.postSystemMessage(conversation, actor.ID, event, content)
+}
+
+// AnnounceEscalation posts the escalation of a complaint into the
+// conversation it was raised in. It returns the conversation along with the
+// system message.
+func (s *ChatService) AnnounceEscalation(complaint *models.Complaint, actor ChatUser) (*models.Conversation, *models.Message, error) {
+	conversation, err := s.GetConversation(complaint.ConversationID, actor)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	message, err := s.postSystemMessage(conversation, actor.ID,
+		models.SystemPayload{Event: models.SystemEventComplaintEscalated, ActorID: actor.ID, ComplaintID: complaint.ID},
+		fmt.Sprintf("%s escalated the complaint \"%s\" to a manager", s.userName(actor.ID), complaint.Title))
+	return conversation, message, err
+}
+
+// AwayReply posts the supplier's away message when a consumer writes
+// outside its business hours, once per conversation in each off-hours
+// window. It returns nil if the supplier is open or has already replied.
+func (s *ChatService) AwayReply(conversation *models.Conversation, sender ChatUser, now time.Time) (*models.Message, error) {
+	if !sender.IsConsumer() {
+		return nil, nil
+	}
+	supplier, err := s.supplierRepo.GetByID(conversation.SupplierID)
+	if err != nil || supplier == nil {
+		return nil, err
+	}
+	schedule, err := SupplierSchedule(supplier)
+	if err != nil || schedule.IsOpen(now) {
+		return nil, err
+	}
+
+	claimed, err := s.conversationRepo.ClaimAwayReply(conversation.ID, schedule.ClosedSince(now))
+	if err != nil || !claimed {
+		return nil, err
+	}
+	content := DefaultAwayMessage
+	if supplier.AwayMessage != nil && strings.TrimSpace(*supplier.AwayMessage) != "" {
+		content = *supplier.AwayMessage
+	}
+	return s.postSystemMessage(conversation, sender.ID, models.SystemPayload{Event: models.SystemEventAwayReply}, content)
+}
+
+// postSystemMessage records an event in the thread. The message is sent by
+// the system on behalf of senderID, the user who caused it.
+func (s *ChatService) postSystemMessage(conversation *models.Conversation, senderID string, event models.SystemPayload, content string) (*models.Message, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	message := &models.Message{
+		ConversationID: conversation.ID,
+		SenderID:       senderID,
+		SenderRole:     models.SenderRoleSystem,
+		Kind:           models.MessageKindSystem,
+		Payload:        payload,
+		Content:        content,
+		IsRead:         true,
+	}
+	if err := s.messageRepo.Create(message); err != nil {
+		return nil, err
+	}
+	s.conversationRepo.UpdateLastMessage(conversation.ID)
+	return message, nil
+}
+
+// EditMessage replaces the text of one of the user's messages in the
+// conversation. The previous text is kept as a revision.
+func (s *ChatService) EditMessage(conversation *models.Conversation, messageID string, user ChatUser, content string) (*models.Message, error) {
+	message, err := s.changeableMessage(conversation, messageID, user)
+	if err != nil {
+		return nil, err
+	}
+	if message.Kind != models.MessageKindText && message.Kind != models.MessageKindInternalNote && message.Kind != "" {
+		return nil, fmt.Errorf("%w: only text messages and notes can be edited", ErrInvalidMessage)
+	}
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return nil, fmt.Errorf("%w: content is required", ErrInvalidMessage)
+	}
+
+	if err := s.messageRepo.Edit(message, user.ID, content); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// DeleteMessage removes one of the user's messages from the conversation.
+// It stays in the history as deleted and its content is kept as a revision.
+func (s *ChatService) DeleteMessage(conversation *models.Conversation, messageID string, user ChatUser) (*models.Message, error) {
+	message, err := s.changeableMessage(conversation, messageID, user)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.messageRepo.SoftDelete(message, user.ID); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// changeableMessage loads a message of the conversation that the user sent
+// within the edit window and has not deleted.
+func (s *ChatService) changeableMessage(conversation *models.Conversation, messageID string, user ChatUser) (*models.Message, error) {
+	message, err := s.messageRepo.GetByID(messageID)
+	if err != nil || message == nil || message.ConversationID != conversation.ID || message.DeletedAt != nil {
+		return nil, ErrMessageNotFound
+	}
+	if message.SenderID != user.ID || message.SenderRole == models.SenderRoleSystem {
+		return nil, ErrNotMessageSender
+	}
+	if time.Since(message.CreatedAt) > s.editWindow {
+		return nil, ErrEditWindowClosed
+	}
+	return message, nil
+}
+
+// NotifyMentions notifies the teammates an internal note mentions, other
+// than its author, and returns the notifications created.
+func (s *ChatService) NotifyMentions(conversation *models.Conversation, message *models.Message) ([]models.Notification, error) {
+	if message.Kind != models.MessageKindInternalNote {
+		return nil, nil
+	}
+	var note models.InternalNotePayload
+	if err := json.Unmarshal(message.Payload, &note); err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(map[string]string{
+		"conversation_id": conversation.ID,
+		"message_id":      message.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	encoded := string(data)
+	title := fmt.Sprintf("%s mentioned you", s.userName(message.SenderID))
+
+	notifications := []models.Notification{}
+	for _, userID := range note.Mentions {
+		if userID == message.SenderID {
+			continue
+		}
+		notification := models.Notification{
+			UserID:  userID,
+			Type:    models.NotificationTypeMention,
+			Title:   title,
+			Message: message.Content,
+			Data:    &encoded,
+		}
+		if err := s.notificationRepo.Create(&notification); err != nil {
+			return notifications, err
+		}
+		notifications = append(notifications, notification)
+	}
+	return notifications, nil
+}
+
+func (s *ChatService) userName(userID string) string {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil || user == nil {
+		return "a team member"
+	}
+	return personName(user)
+}
+
+// IsConversationMember reports whether a user may act in a conversation.
+func IsConversationMember(conversation *models.Conversation, user ChatUser) bool {
+	if user.IsConsumer() {
+		return conversation.ConsumerID == user.ID
+	}
+	return user.SupplierID != "" && conversation.SupplierID == user.SupplierID
+}
@@ -0,0 +1,621 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/scp-platform/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockConversationStore struct {
+	mock.Mock
+}
+
+func (m *MockConversationStore) GetByID(id string) (*models.Conversation, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Conversation), args.Error(1)
+}
+
+func (m *MockConversationStore) GetOrCreate(consumerID, supplierID string, subject models.ThreadSubject) (*models.Conversation, error) {
+	args := m.Called(consumerID, supplierID, subject)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Conversation), args.Error(1)
+}
+
+func (m *MockConversationStore) Route(conversationID string) (*string, error) {
+	args := m.Called(conversationID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*string), args.Error(1)
+}
+
+func (m *MockConversationStore) Assign(conversationID string, assigneeID *string) (bool, error) {
+	args := m.Called(conversationID, assigneeID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockConversationStore) UpdateLastMessage(conversationID string) error {
+	args := m.Called(conversationID)
+	return args.Error(0)
+}
+
+func (m *MockConversationStore) ClaimAwayReply(conversationID string, closedSince time.Time) (bool, error) {
+	args := m.Called(conversationID, closedSince)
+	return args.Bool(0), args.Error(1)
+}
+
+type MockMessageStore struct {
+	mock.Mock
+}
+
+func (m *MockMessageStore) Create(message *models.Message) error {
+	args := m.Called(message)
+	return args.Error(0)
+}
+
+func (m *MockMessageStore) GetByID(id string) (*models.Message, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Message), args.Error(1)
+}
+
+func (m *MockMessageStore) Edit(message *models.Message, editorID, content string) error {
+	args := m.Called(message, editorID, content)
+	return args.Error(0)
+}
+
+func (m *MockMessageStore) SoftDelete(message *models.Message, deleterID string) error {
+	args := m.Called(message, deleterID)
+	return args.Error(0)
+}
+
+type MockNotificationStore struct {
+	mock.Mock
+}
+
+func (m *MockNotificationStore) Create(notification *models.Notification) error {
+	args := m.Called(notification)
+	return args.Error(0)
+}
+
+type MockConsumerLinkStore struct {
+	mock.Mock
+}
+
+func (m *MockConsumerLinkStore) GetByConsumerAndSupplier(consumerID, supplierID string) (*models.ConsumerLink, error) {
+	args := m.Called(consumerID, supplierID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ConsumerLink), args.Error(1)
+}
+
+func TestChatService_GetConversation(t *testing.T) {
+	conversation := &models.Conversation{ID: "conv1", ConsumerID: "consumer1", SupplierID: "supplier1"}
+
+	tests := []struct {
+		name          string
+		user          ChatUser
+		expectedError error
+	}{
+		{"own consumer", ChatUser{ID: "consumer1", Role: "consumer"}, nil},
+		{"supplier staff", ChatUser{ID: "rep1", Role: "sales_rep", SupplierID: "supplier1"}, nil},
+		{"supplier owner", ChatUser{ID: "owner1", Role: "owner", SupplierID: "supplier1"}, nil},
+		{"other consumer", ChatUser{ID: "consumer2", Role: "consumer"}, ErrNotConversationMember},
+		{"other supplier's staff", ChatUser{ID: "rep2", Role: "sales_rep", SupplierID: "supplier2"}, ErrNotConversationMember},
+		{"staff without supplier", ChatUser{ID: "rep3", Role: "manager"}, ErrNotConversationMember},
+		// A consumer ID that happens to equal the supplier ID grants nothing.
+		{"consumer posing as supplier", ChatUser{ID: "supplier1", Role: "consumer", SupplierID: "supplier1"}, ErrNotConversationMember},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := new(MockConversationStore)
+			store.On("GetByID", "conv1").Return(conversation, nil)
+			service := NewChatService(store, new(MockConsumerLinkStore), new(MockMessageStore), new(MockUserRepository), nil, nil, nil, nil, nil)
+
+			result, err := service.GetConversation("conv1", tt.user)
+
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+				assert.Nil(t, result)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, conversation, result)
+			}
+		})
+	}
+}
+
+func TestChatService_GetConversation_NotFound(t *testing.T) {
+	store := new(MockConversationStore)
+	store.On("GetByID", "missing").Return(nil, errors.New("sql: no rows in result set"))
+	service := NewChatService(store, new(MockConsumerLinkStore), new(MockMessageStore), new(MockUserRepository), nil, nil, nil, nil, nil)
+
+	_, err := service.GetConversation("missing", ChatUser{ID: "consumer1", Role: "consumer"})
+
+	assert.ErrorIs(t, err, ErrConversationNotFound)
+}
+
+func TestChatService_OpenConversation(t *testing.T) {
+	tests := []struct {
+		name          string
+		user          ChatUser
+		counterpartID string
+		consumerID    string
+		supplierID    string
+		link          *models.ConsumerLink
+		expectedError error
+	}{
+		{
+			name:          "consumer with accepted link",
+			user:          ChatUser{ID: "consumer1", Role: "consumer"},
+			counterpartID: "supplier1",
+			consumerID:    "consumer1",
+			supplierID:    "supplier1",
+			link:          &models.ConsumerLink{Status: "accepted"},
+		},
+		{
+			name:          "staff opens with consumer of own supplier",
+			user:          ChatUser{ID: "rep1", Role: "sales_rep", SupplierID: "supplier1"},
+			counterpartID: "consumer1",
+			consumerID:    "consumer1",
+			supplierID:    "supplier1",
+			link:          &models.ConsumerLink{Status: "accepted"},
+		},
+		{
+			name:          "pending link",
+			user:          ChatUser{ID: "consumer1", Role: "consumer"},
+			counterpartID: "supplier1",
+			consumerID:    "consumer1",
+			supplierID:    "supplier1",
+			link:          &models.ConsumerLink{Status: "pending"},
+			expectedError: ErrNotLinked,
+		},
+		{
+			name:          "no link",
+			user:          ChatUser{ID: "consumer1", Role: "consumer"},
+			counterpartID: "supplier2",
+			consumerID:    "consumer1",
+			supplierID:    "supplier2",
+			expectedError: ErrNotLinked,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := new(MockConversationStore)
+			links := new(MockConsumerLinkStore)
+			if tt.link != nil {
+				links.On("GetByConsumerAndSupplier", tt.consumerID, tt.supplierID).Return(tt.link, nil)
+			} else {
+				links.On("GetByConsumerAndSupplier", tt.consumerID, tt.supplierID).Return(nil, errors.New("not found"))
+			}
+			conversation := &models.Conversation{ID: "conv1", ConsumerID: tt.consumerID, SupplierID: tt.supplierID}
+			store.On("GetOrCreate", tt.consumerID, tt.supplierID, models.ThreadSubject{}).Return(conversation, nil)
+			service := NewChatService(store, links, new(MockMessageStore), new(MockUserRepository), nil, nil, nil, nil, nil)
+
+			result, err := service.OpenConversation(tt.user, tt.counterpartID, models.ThreadSubject{})
+
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+				store.AssertNotCalled(t, "GetOrCreate", mock.Anything, mock.Anything, mock.Anything)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, conversation, result)
+			}
+		})
+	}
+}
+
+func TestChatService_OpenConversation_StaffWithoutSupplier(t *testing.T) {
+	store := new(MockConversationStore)
+	links := new(MockConsumerLinkStore)
+	service := NewChatService(store, links, new(MockMessageStore), new(MockUserRepository), nil, nil, nil, nil, nil)
+
+	_, err := service.OpenConversation(ChatUser{ID: "rep1", Role: "sales_rep"}, "consumer1", models.ThreadSubject{})
+
+	assert.ErrorIs(t, err, ErrNotConversationMember)
+	links.AssertNotCalled(t, "GetByConsumerAndSupplier", mock.Anything, mock.Anything)
+}
+
+func newAssignmentTestUsers() *MockUserRepository {
+	supplierID, otherSupplierID := "supplier1", "supplier2"
+	ada, rep, max, manager := "Ada", "Rep", "Max", "Manager"
+	users := new(MockUserRepository)
+	users.On("GetByID", "rep1").Return(&models.User{ID: "rep1", Role: "sales_rep", FirstName: &ada, LastName: &rep, SupplierID: &supplierID}, nil)
+	users.On("GetByID", "manager1").Return(&models.User{ID: "manager1", Role: "manager", FirstName: &max, LastName: &manager, SupplierID: &supplierID}, nil)
+	users.On("GetByID", "rep2").Return(&models.User{ID: "rep2", Role: "sales_rep", SupplierID: &otherSupplierID}, nil)
+	users.On("GetByID", "consumer1").Return(&models.User{ID: "consumer1", Role: "consumer"}, nil)
+	users.On("GetByID", mock.Anything).Return(nil, errors.New("not found"))
+	return users
+}
+
+func TestChatService_RouteConversation(t *testing.T) {
+	store := new(MockConversationStore)
+	assignee := "rep1"
+	store.On("Route", "conv1").Return(&assignee, nil)
+	store.On("UpdateLastMessage", "conv1").Return(nil)
+	messages := new(MockMessageStore)
+	messages.On("Create", mock.MatchedBy(func(m *models.Message) bool {
+		return m.ConversationID == "conv1" && m.SenderID == "rep1" &&
+			m.SenderRole == models.SenderRoleSystem && m.Kind == models.MessageKindSystem &&
+			m.Content == "Conversation assigned to Ada Rep"
+	})).Return(nil)
+	service := NewChatService(store, new(MockConsumerLinkStore), messages, newAssignmentTestUsers(), nil, nil, nil, nil, nil)
+
+	conversation := &models.Conversation{ID: "conv1", ConsumerID: "consumer1", SupplierID: "supplier1"}
+	message, err := service.RouteConversation(conversation)
+
+	assert.NoError(t, err)
+	assert.NotNil(t, message)
+	assert.Equal(t, &assignee, conversation.AssignedUserID)
+	assert.NotNil(t, conversation.AssignedAt)
+	messages.AssertExpectations(t)
+}
+
+func TestChatService_RouteConversation_NothingToDo(t *testing.T) {
+	t.Run("already routed", func(t *testing.T) {
+		store := new(MockConversationStore)
+		service := NewChatService(store, new(MockConsumerLinkStore), new(MockMessageStore), newAssignmentTestUsers(), nil, nil, nil, nil, nil)
+		now := time.Now()
+
+		message, err := service.RouteConversation(&models.Conversation{ID: "conv1", AssignedAt: &now})
+
+		assert.NoError(t, err)
+		assert.Nil(t, message)
+		store.AssertNotCalled(t, "Route", mock.Anything)
+	})
+
+	t.Run("no sales reps", func(t *testing.T) {
+		store := new(MockConversationStore)
+		store.On("Route", "conv1").Return(nil, nil)
+		messages := new(MockMessageStore)
+		service := NewChatService(store, new(MockConsumerLinkStore), messages, newAssignmentTestUsers(), nil, nil, nil, nil, nil)
+
+		message, err := service.RouteConversation(&models.Conversation{ID: "conv1"})
+
+		assert.NoError(t, err)
+		assert.Nil(t, message)
+		messages.AssertNotCalled(t, "Create", mock.Anything)
+	})
+}
+
+func TestChatService_AssignConversation(t *testing.T) {
+	rep1 := "rep1"
+	manager := ChatUser{ID: "manager1", Role: "manager", SupplierID: "supplier1"}
+
+	tests := []struct {
+		name            string
+		assigneeID      *string
+		expectedContent string
+	}{
+		{"assign", &rep1, "Max Manager assigned this conversation to Ada Rep"},
+		{"unassign", nil, "Max Manager unassigned this conversation"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := new(MockConversationStore)
+			store.On("Assign", "conv1", tt.assigneeID).Return(true, nil)
+			store.On("UpdateLastMessage", "conv1").Return(nil)
+			messages := new(MockMessageStore)
+			messages.On("Create", mock.MatchedBy(func(m *models.Message) bool {
+				return m.SenderID == "manager1" && m.SenderRole == models.SenderRoleSystem && m.Content == tt.expectedContent
+			})).Return(nil)
+			service := NewChatService(store, new(MockConsumerLinkStore), messages, newAssignmentTestUsers(), nil, nil, nil, nil, nil)
+
+			conversation := &models.Conversation{ID: "conv1", SupplierID: "supplier1"}
+			message, err := service.AssignConversation(conversation, tt.assigneeID, manager)
+
+			assert.NoError(t, err)
+			assert.NotNil(t, message)
+			assert.Equal(t, tt.assigneeID, conversation.AssignedUserID)
+			messages.AssertExpectations(t)
+		})
+	}
+}
+
+func TestChatService_AssignConversation_InvalidAssignee(t *testing.T) {
+	manager := ChatUser{ID: "manager1", Role: "manager", SupplierID: "supplier1"}
+
+	for _, assigneeID := range []string{"rep2", "consumer1", "unknown"} {
+		t.Run(assigneeID, func(t *testing.T) {
+			store := new(MockConversationStore)
+			service := NewChatService(store, new(MockConsumerLinkStore), new(MockMessageStore), newAssignmentTestUsers(), nil, nil, nil, nil, nil)
+
+			_, err := service.AssignConversation(&models.Conversation{ID: "conv1", SupplierID: "supplier1"}, &assigneeID, manager)
+
+			assert.ErrorIs(t, err, ErrInvalidAssignee)
+			store.AssertNotCalled(t, "Assign", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestChatService_AssignConversation_Unchanged(t *testing.T) {
+	rep1 := "rep1"
+	store := new(MockConversationStore)
+	store.On("Assign", "conv1", &rep1).Return(false, nil)
+	messages := new(MockMessageStore)
+	service := NewChatService(store, new(MockConsumerLinkStore), messages, newAssignmentTestUsers(), nil, nil, nil, nil, nil)
+
+	message, err := service.AssignConversation(&models.Conversation{ID: "conv1", SupplierID: "supplier1"}, &rep1, ChatUser{ID: "manager1", Role: "manager", SupplierID: "supplier1"})
+
+	assert.NoError(t, err)
+	assert.Nil(t, message)
+	messages.AssertNotCalled(t, "Create", mock.Anything)
+}
+
+type MockComplaintStore struct {
+	mock.Mock
+}
+
+func (m *MockComplaintStore) GetByID(id string) (*models.Complaint, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Complaint), args.Error(1)
+}
+
+func newThreadTestService(store *MockConversationStore) *ChatService {
+	links := new(MockConsumerLinkStore)
+	links.On("GetByConsumerAndSupplier", "consumer1", "supplier1").Return(&models.ConsumerLink{Status: "accepted"}, nil)
+
+	orders := new(MockOrderRepository)
+	orders.On("GetByID", "order-1234567890").Return(&models.Order{ID: "order-1234567890", ConsumerID: "consumer1", SupplierID: "supplier1"}, nil)
+	orders.On("GetByID", "order2").Return(&models.Order{ID: "order2", ConsumerID: "consumer2", SupplierID: "supplier1"}, nil)
+	orders.On("GetByID", mock.Anything).Return(nil, errors.New("not found"))
+
+	complaints := new(MockComplaintStore)
+	complaints.On("GetByID", "complaint1").Return(&models.Complaint{ID: "complaint1", ConsumerID: "consumer1", SupplierID: "supplier1", Title: "Wilted lettuce"}, nil)
+	complaints.On("GetByID", mock.Anything).Return(nil, errors.New("not found"))
+
+	return NewChatService(store, links, new(MockMessageStore), new(MockUserRepository), orders, complaints, nil, nil, nil)
+}
+
+func TestChatService_OpenConversation_Threads(t *testing.T) {
+	consumer := ChatUser{ID: "consumer1", Role: "consumer"}
+
+	tests := []struct {
+		name     string
+		subject  models.ThreadSubject
+		expected models.ThreadSubject
+	}{
+		{"general", models.ThreadSubject{}, models.ThreadSubject{}},
+		{"order", models.ThreadSubject{OrderID: "order-1234567890"}, models.ThreadSubject{OrderID: "order-1234567890", Title: "Order #order-12"}},
+		{"complaint", models.ThreadSubject{ComplaintID: "complaint1"}, models.ThreadSubject{ComplaintID: "complaint1", Title: "Wilted lettuce"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := new(MockConversationStore)
+			store.On("GetOrCreate", "consumer1", "supplier1", tt.expected).Return(&models.Conversation{ID: "conv1"}, nil)
+			service := newThreadTestService(store)
+
+			_, err := service.OpenConversation(consumer, "supplier1", tt.subject)
+
+			assert.NoError(t, err)
+			store.AssertExpectations(t)
+		})
+	}
+}
+
+func TestChatService_OpenConversation_ForeignSubject(t *testing.T) {
+	for _, subject := range []models.ThreadSubject{
+		{OrderID: "order2"},
+		{OrderID: "missing"},
+		{ComplaintID: "missing"},
+	} {
+		store := new(MockConversationStore)
+		service := newThreadTestService(store)
+
+		_, err := service.OpenConversation(ChatUser{ID: "consumer1", Role: "consumer"}, "supplier1", subject)
+
+		assert.ErrorIs(t, err, ErrSubjectNotFound)
+		store.AssertNotCalled(t, "GetOrCreate", mock.Anything, mock.Anything, mock.Anything)
+	}
+}
+
+func TestChatService_OpenOrderConversation(t *testing.T) {
+	tests := []struct {
+		name string
+		user ChatUser
+	}{
+		{"consumer", ChatUser{ID: "consumer1", Role: "consumer"}},
+		{"supplier staff", ChatUser{ID: "rep1", Role: "sales_rep", SupplierID: "supplier1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := new(MockConversationStore)
+			store.On("GetOrCreate", "consumer1", "supplier1", mock.MatchedBy(func(s models.ThreadSubject) bool {
+				return s.OrderID == "order-1234567890"
+			})).Return(&models.Conversation{ID: "conv2", Topic: models.TopicOrder}, nil)
+			service := newThreadTestService(store)
+
+			conversation, err := service.OpenOrderConversation(tt.user, "order-1234567890")
+
+			assert.NoError(t, err)
+			assert.Equal(t, "conv2", conversation.ID)
+		})
+	}
+}
+
+func TestChatService_OpenOrderConversation_NotParty(t *testing.T) {
+	store := new(MockConversationStore)
+	service := newThreadTestService(store)
+
+	_, err := service.OpenOrderConversation(ChatUser{ID: "rep9", Role: "sales_rep", SupplierID: "supplier9"}, "order-1234567890")
+
+	assert.ErrorIs(t, err, ErrSubjectNotFound)
+	store.AssertNotCalled(t, "GetOrCreate", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestChatService_AnnounceEscalation(t *testing.T) {
+	store := new(MockConversationStore)
+	store.On("GetByID", "conv1").Return(&models.Conversation{ID: "conv1", ConsumerID: "consumer1", SupplierID: "supplier1"}, nil)
+	store.On("UpdateLastMessage", "conv1").Return(nil)
+	messages := new(MockMessageStore)
+	messages.On("Create", mock.MatchedBy(func(m *models.Message) bool {
+		var payload models.SystemPayload
+		json.Unmarshal(m.Payload, &payload)
+		return m.SenderRole == models.SenderRoleSystem && m.Kind == models.MessageKindSystem &&
+			payload.Event == models.SystemEventComplaintEscalated && payload.ComplaintID == "complaint1" &&
+			m.Content == `Ada Rep escalated the complaint "Wilted lettuce" to a manager`
+	})).Return(nil)
+	service := NewChatService(store, new(MockConsumerLinkStore), messages, newAssignmentTestUsers(), nil, nil, nil, nil, nil)
+
+	complaint := &models.Complaint{ID: "complaint1", ConversationID: "conv1", Title: "Wilted lettuce"}
+	conversation, message, err := service.AnnounceEscalation(complaint, ChatUser{ID: "rep1", Role: "sales_rep", SupplierID: "supplier1"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "conv1", conversation.ID)
+	assert.True(t, message.IsRead)
+	messages.AssertExpectations(t)
+}
+
+func TestChatService_EditMessage(t *testing.T) {
+	conversation := &models.Conversation{ID: "conv1", ConsumerID: "consumer1", SupplierID: "supplier1"}
+	consumer := ChatUser{ID: "consumer1", Role: "consumer"}
+	deleted := time.Now()
+
+	tests := []struct {
+		name        string
+		message     *models.Message
+		user        ChatUser
+		content     string
+		expectedErr error
+	}{
+		{"own recent text", &models.Message{ID: "msg1", ConversationID: "conv1", SenderID: "consumer1", SenderRole: "consumer", Kind: "text", CreatedAt: time.Now()}, consumer, "5 crates, not 50", nil},
+		{"someone else's", &models.Message{ID: "msg1", ConversationID: "conv1", SenderID: "rep1", SenderRole: "sales_rep", Kind: "text", CreatedAt: time.Now()}, consumer, "changed", ErrNotMessageSender},
+		{"system message", &models.Message{ID: "msg1", ConversationID: "conv1", SenderID: "consumer1", SenderRole: "system", Kind: "system", CreatedAt: time.Now()}, consumer, "changed", ErrNotMessageSender},
+		{"past the window", &models.Message{ID: "msg1", ConversationID: "conv1", SenderID: "consumer1", SenderRole: "consumer", Kind: "text", CreatedAt: time.Now().Add(-time.Hour)}, consumer, "changed", ErrEditWindowClosed},
+		{"other conversation", &models.Message{ID: "msg1", ConversationID: "conv2", SenderID: "consumer1", SenderRole: "consumer", Kind: "text", CreatedAt: time.Now()}, consumer, "changed", ErrMessageNotFound},
+		{"deleted", &models.Message{ID: "msg1", ConversationID: "conv1", SenderID: "consumer1", SenderRole: "consumer", Kind: "text", CreatedAt: time.Now(), DeletedAt: &deleted}, consumer, "changed", ErrMessageNotFound},
+		{"card", &models.Message{ID: "msg1", ConversationID: "conv1", SenderID: "consumer1", SenderRole: "consumer", Kind: "order_ref", CreatedAt: time.Now()}, consumer, "changed", ErrInvalidMessage},
+		{"blank", &models.Message{ID: "msg1", ConversationID: "conv1", SenderID: "consumer1", SenderRole: "consumer", Kind: "text", CreatedAt: time.Now()}, consumer, "  ", ErrInvalidMessage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages := new(MockMessageStore)
+			messages.On("GetByID", "msg1").Return(tt.message, nil)
+			messages.On("Edit", tt.message, tt.user.ID, tt.content).Return(nil)
+			service := NewChatService(new(MockConversationStore), new(MockConsumerLinkStore), messages, new(MockUserRepository), nil, nil, nil, nil, nil)
+			service.SetEditWindow(15 * time.Minute)
+
+			_, err := service.EditMessage(conversation, "msg1", tt.user, tt.content)
+
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				messages.AssertNotCalled(t, "Edit", mock.Anything, mock.Anything, mock.Anything)
+			} else {
+				assert.NoError(t, err)
+				messages.AssertExpectations(t)
+			}
+		})
+	}
+}
+
+func TestChatService_DeleteMessage(t *testing.T) {
+	conversation := &models.Conversation{ID: "conv1", ConsumerID: "consumer1", SupplierID: "supplier1"}
+	rep := ChatUser{ID: "rep1", Role: "sales_rep", SupplierID: "supplier1"}
+	message := &models.Message{ID: "msg1", ConversationID: "conv1", SenderID: "rep1", SenderRole: "sales_rep", Kind: "product_ref", CreatedAt: time.Now()}
+
+	messages := new(MockMessageStore)
+	messages.On("GetByID", "msg1").Return(message, nil)
+	messages.On("SoftDelete", message, "rep1").Return(nil)
+	service := NewChatService(new(MockConversationStore), new(MockConsumerLinkStore), messages, new(MockUserRepository), nil, nil, nil, nil, nil)
+
+	_, err := service.DeleteMessage(conversation, "msg1", rep)
+
+	assert.NoError(t, err)
+	messages.AssertExpectations(t)
+
+	_, err = service.DeleteMessage(conversation, "msg1", ChatUser{ID: "rep2", Role: "sales_rep", SupplierID: "supplier1"})
+	assert.ErrorIs(t, err, ErrNotMessageSender)
+}
+
+func TestChatService_NotifyMentions(t *testing.T) {
+	conversation := &models.Conversation{ID: "conv1", ConsumerID: "consumer1", SupplierID: "supplier1"}
+	note := &models.Message{
+		ID: "msg1", ConversationID: "conv1", SenderID: "rep1", SenderRole: "sales_rep",
+		Kind: models.MessageKindInternalNote, Content: "Can you approve the discount?",
+		Payload: json.RawMessage(`{"mentions":["rep1","manager1"]}`),
+	}
+
+	notifications := new(MockNotificationStore)
+	notifications.On("Create", mock.MatchedBy(func(n *models.Notification) bool {
+		return n.UserID == "manager1" && n.Type == models.NotificationTypeMention &&
+			n.Title == "Ada Rep mentioned you" && n.Data != nil &&
+			*n.Data == `{"conversation_id":"conv1","message_id":"msg1"}`
+	})).Return(nil)
+	service := NewChatService(new(MockConversationStore), new(MockConsumerLinkStore), new(MockMessageStore), newAssignmentTestUsers(), nil, nil, nil, notifications, nil)
+
+	created, err := service.NotifyMentions(conversation, note)
+
+	assert.NoError(t, err)
+	assert.Len(t, created, 1)
+	notifications.AssertNumberOfCalls(t, "Create", 1)
+}
+
+func TestChatService_AwayReply(t *testing.T) {
+	conversation := &models.Conversation{ID: "conv1", ConsumerID: "consumer1", SupplierID: "supplier1"}
+	consumer := ChatUser{ID: "consumer1", Role: "consumer"}
+	awayMessage := "We open at 8, talk soon!"
+	// Monday, December 14th 2026 at 5 a.m. in Berlin
+	now := time.Date(2026, 12, 14, 4, 0, 0, 0, time.UTC)
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+
+	suppliers := new(MockSupplierStore)
+	suppliers.On("GetByID", "supplier1").Return(&models.Supplier{
+		ID:            "supplier1",
+		Timezone:      "Europe/Berlin",
+		BusinessHours: json.RawMessage(`[{"day":"monday","open":"08:00","close":"17:00"},{"day":"friday","open":"08:00","close":"17:00"}]`),
+		AwayMessage:   &awayMessage,
+	}, nil)
+	store := new(MockConversationStore)
+	store.On("ClaimAwayReply", "conv1", mock.MatchedBy(func(closedSince time.Time) bool {
+		return closedSince.Equal(time.Date(2026, 12, 11, 17, 0, 0, 0, berlin))
+	})).Return(true, nil).Once()
+	store.On("ClaimAwayReply", "conv1", mock.Anything).Return(false, nil)
+	store.On("UpdateLastMessage", "conv1").Return(nil)
+	messages := new(MockMessageStore)
+	messages.On("Create", mock.MatchedBy(func(m *models.Message) bool {
+		return m.Kind == models.MessageKindSystem && m.Content == awayMessage &&
+			string(m.Payload) == `{"event":"away_reply"}`
+	})).Return(nil).Once()
+	service := NewChatService(store, new(MockConsumerLinkStore), messages, new(MockUserRepository), nil, nil, nil, nil, suppliers)
+
+	message, err := service.AwayReply(conversation, consumer, now)
+	assert.NoError(t, err)
+	assert.NotNil(t, message)
+
+	// Only once per off-hours window
+	message, err = service.AwayReply(conversation, consumer, now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Nil(t, message)
+
+	// Not during business hours, nor for staff
+	message, err = service.AwayReply(conversation, consumer, now.Add(5*time.Hour))
+	assert.NoError(t, err)
+	assert.Nil(t, message)
+	message, err = service.AwayReply(conversation, ChatUser{ID: "rep1", Role: "sales_rep", SupplierID: "supplier1"}, now)
+	assert.NoError(t, err)
+	assert.Nil(t, message)
+
+	messages.AssertExpectations(t)
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/scp-platform/backend/internal/models"
+)
+
+// MessageDraft is a message as a client sent it, before it is validated.
+type MessageDraft struct {
+	Kind    string
+	Content string
+	Payload json.RawMessage
+}
+
+// ComposeMessage validates a user's draft for the conversation and returns
+// the message to store. Product and order cards must refer to the
+// conversation's supplier and, for orders, its consumer; their payload gets
+// a snapshot of what they refer to. Only staff may leave internal notes, and
+// only mention their own teammates in them. Users cannot send system
+// messages.
+func (s *ChatService) ComposeMessage(conversation *models.Conversation, sender ChatUser, draft MessageDraft) (*models.Message, error) {
+	message := &models.Message{
+		ConversationID: conversation.ID,
+		SenderID:       sender.ID,
+		Kind:           draft.Kind,
+		Content:        strings.TrimSpace(draft.Content),
+	}
+	if message.Kind == "" {
+		message.Kind = models.MessageKindText
+	}
+
+	var payload interface{}
+	switch message.Kind {
+	case models.MessageKindText:
+		if message.Content == "" {
+			return nil, fmt.Errorf("%w: content is required", ErrInvalidMessage)
+		}
+		payload = struct{}{}
+
+	case models.MessageKindAttachment:
+		var attachment models.AttachmentPayload
+		if err := decodePayload(draft.Payload, &attachment); err != nil {
+			return nil, err
+		}
+		if attachment.URL == "" {
+			return nil, fmt.Errorf("%w: payload.url is required", ErrInvalidMessage)
+		}
+		if !strings.HasPrefix(attachment.URL, "/uploads/") && !strings.HasPrefix(attachment.URL, "https://") {
+			return nil, fmt.Errorf("%w: payload.url must be an upload or https URL", ErrInvalidMessage)
+		}
+		switch attachment.MediaType {
+		case "":
+			attachment.MediaType = MediaTypeOf(attachment.URL)
+		case models.MediaTypeImage, models.MediaTypeAudio, models.MediaTypeFile:
+		default:
+			return nil, fmt.Errorf("%w: payload.media_type must be image, audio or file", ErrInvalidMessage)
+		}
+		if message.Content == "" {
+			message.Content = attachment.FileName
+		}
+		if message.Content == "" {
+			message.Content = path.Base(attachment.URL)
+		}
+		message.AttachmentURL = &attachment.URL
+		payload = attachment
+
+	case models.MessageKindProductRef:
+		var ref models.ProductRefPayload
+		if err := decodePayload(draft.Payload, &ref); err != nil {
+			return nil, err
+		}
+		if ref.ProductID == "" {
+			return nil, fmt.Errorf("%w: payload.product_id is required", ErrInvalidMessage)
+		}
+		product, err := s.productRepo.GetByID(ref.ProductID)
+		if err != nil || product == nil || product.SupplierID != conversation.SupplierID {
+			return nil, fmt.Errorf("%w: product not found for this supplier", ErrInvalidMessage)
+		}
+		ref.Product = models.SnapshotProduct(product)
+		if message.Content == "" {
+			message.Content = product.Name
+		}
+		payload = ref
+
+	case models.MessageKindOrderRef:
+		var ref models.OrderRefPayload
+		if err := decodePayload(draft.Payload, &ref); err != nil {
+			return nil, err
+		}
+		if ref.OrderID == "" {
+			return nil, fmt.Errorf("%w: payload.order_id is required", ErrInvalidMessage)
+		}
+		order, err := s.orderRepo.GetByID(ref.OrderID)
+		if err != nil || order == nil || order.ConsumerID != conversation.ConsumerID || order.SupplierID != conversation.SupplierID {
+			return nil, fmt.Errorf("%w: order not found in this conversation", ErrInvalidMessage)
+		}
+		ref.Order = models.SnapshotOrder(order)
+		if message.Content == "" {
+			message.Content = orderLabel(order.ID)
+		}
+		payload = ref
+
+	case models.MessageKindInternalNote:
+		if sender.IsConsumer() {
+			return nil, fmt.Errorf("%w: only staff can post internal notes", ErrInvalidMessage)
+		}
+		if message.Content == "" {
+			return nil, fmt.Errorf("%w: content is required", ErrInvalidMessage)
+		}
+		var note models.InternalNotePayload
+		if err := decodePayload(draft.Payload, &note); err != nil {
+			return nil, err
+		}
+		mentions := []string{}
+		seen := map[string]bool{}
+		for _, userID := range note.Mentions {
+			if seen[userID] {
+				continue
+			}
+			seen[userID] = true
+			user, err := s.userRepo.GetByID(userID)
+			if err != nil || user == nil || !IsStaff(user.Role) || user.SupplierID == nil || *user.SupplierID != conversation.SupplierID {
+				return nil, fmt.Errorf("%w: mentioned user %q is not on this supplier's team", ErrInvalidMessage, userID)
+			}
+			mentions = append(mentions, userID)
+		}
+		note.Mentions = mentions
+		payload = note
+
+	case models.MessageKindSystem:
+		return nil, fmt.Errorf("%w: system messages are posted by the platform", ErrInvalidMessage)
+
+	default:
+		return nil, fmt.Errorf("%w: unknown kind %q", ErrInvalidMessage, message.Kind)
+	}
+
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	message.Payload = encoded
+	return message, nil
+}
+
+// MediaTypeOf guesses whether an attachment is an image, audio or another
+// file from its extension.
+func MediaTypeOf(url string) string {
+	switch strings.ToLower(path.Ext(url)) {
+	case ".jpg", ".jpeg", ".png", ".gif", ".webp":
+		return models.MediaTypeImage
+	case ".mp3", ".wav", ".m4a", ".aac", ".ogg":
+		return models.MediaTypeAudio
+	default:
+		return models.MediaTypeFile
+	}
+}
+
+func decodePayload(raw json.RawMessage, v interface{}) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("%w: payload does not match its kind", ErrInvalidMessage)
+	}
+	return nil
+}
+
+// orderLabel is how an order is referred to in chat.
+func orderLabel(orderID string) string {
+	shortID := orderID
+	if len(shortID) > 8 {
+		shortID = shortID[:8]
+	}
+	return "Order #" + shortID
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/scp-platform/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newComposerTestService() *ChatService {
+	products := new(MockProductRepository)
+	products.On("GetByID", "product1").Return(&models.Product{ID: "product1", Name: "Tomatoes", Unit: "kg", Price: 3.5, SupplierID: "supplier1"}, nil)
+	products.On("GetByID", "product2").Return(&models.Product{ID: "product2", Name: "Flour", SupplierID: "supplier2"}, nil)
+	products.On("GetByID", mock.Anything).Return(nil, errors.New("not found"))
+
+	orders := new(MockOrderRepository)
+	orders.On("GetByID", "order-1234567890").Return(&models.Order{
+		ID: "order-1234567890", ConsumerID: "consumer1", SupplierID: "supplier1", Status: "pending", Total: 42,
+		Items: []models.OrderItem{{ID: "item1"}, {ID: "item2"}},
+	}, nil)
+	orders.On("GetByID", "order2").Return(&models.Order{ID: "order2", ConsumerID: "consumer2", SupplierID: "supplier1"}, nil)
+	orders.On("GetByID", mock.Anything).Return(nil, errors.New("not found"))
+
+	return NewChatService(new(MockConversationStore), new(MockConsumerLinkStore), new(MockMessageStore), newAssignmentTestUsers(), orders, nil, products, nil, nil)
+}
+
+func TestChatService_ComposeMessage(t *testing.T) {
+	conversation := &models.Conversation{ID: "conv1", ConsumerID: "consumer1", SupplierID: "supplier1"}
+	sender := ChatUser{ID: "consumer1", Role: "consumer"}
+
+	tests := []struct {
+		name            string
+		draft           MessageDraft
+		expectedKind    string
+		expectedContent string
+		check           func(t *testing.T, message *models.Message)
+	}{
+		{
+			name:            "text by default",
+			draft:           MessageDraft{Content: " Hello "},
+			expectedKind:    models.MessageKindText,
+			expectedContent: "Hello",
+		},
+		{
+			name:            "attachment",
+			draft:           MessageDraft{Kind: "attachment", Payload: json.RawMessage(`{"url":"/uploads/abc.png","file_name":"menu.png"}`)},
+			expectedKind:    models.MessageKindAttachment,
+			expectedContent: "menu.png",
+			check: func(t *testing.T, message *models.Message) {
+				var payload models.AttachmentPayload
+				assert.NoError(t, json.Unmarshal(message.Payload, &payload))
+				assert.Equal(t, models.MediaTypeImage, payload.MediaType)
+				assert.Equal(t, "/uploads/abc.png", *message.AttachmentURL)
+			},
+		},
+		{
+			name:            "product card",
+			draft:           MessageDraft{Kind: "product_ref", Payload: json.RawMessage(`{"product_id":"product1"}`)},
+			expectedKind:    models.MessageKindProductRef,
+			expectedContent: "Tomatoes",
+			check: func(t *testing.T, message *models.Message) {
+				var payload models.ProductRefPayload
+				assert.NoError(t, json.Unmarshal(message.Payload, &payload))
+				assert.Equal(t, "Tomatoes", payload.Product.Name)
+				assert.Equal(t, 3.5, payload.Product.Price)
+			},
+		},
+		{
+			name:            "order card",
+			draft:           MessageDraft{Kind: "order_ref", Content: "Where is it?", Payload: json.RawMessage(`{"order_id":"order-1234567890"}`)},
+			expectedKind:    models.MessageKindOrderRef,
+			expectedContent: "Where is it?",
+			check: func(t *testing.T, message *models.Message) {
+				var payload models.OrderRefPayload
+				assert.NoError(t, json.Unmarshal(message.Payload, &payload))
+				assert.Equal(t, "pending", payload.Order.Status)
+				assert.Equal(t, 2, payload.Order.ItemCount)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message, err := newComposerTestService().ComposeMessage(conversation, sender, tt.draft)
+
+			assert.NoError(t, err)
+			assert.Equal(t, "conv1", message.ConversationID)
+			assert.Equal(t, "consumer1", message.SenderID)
+			assert.Equal(t, tt.expectedKind, message.Kind)
+			assert.Equal(t, tt.expectedContent, message.Content)
+			if tt.check != nil {
+				tt.check(t, message)
+			}
+		})
+	}
+}
+
+func TestChatService_ComposeMessage_Invalid(t *testing.T) {
+	conversation := &models.Conversation{ID: "conv1", ConsumerID: "consumer1", SupplierID: "supplier1"}
+	sender := ChatUser{ID: "rep1", Role: "sales_rep", SupplierID: "supplier1"}
+
+	tests := []struct {
+		name  string
+		draft MessageDraft
+	}{
+		{"empty text", MessageDraft{Content: "  "}},
+		{"system", MessageDraft{Kind: "system", Content: "Conversation closed"}},
+		{"unknown kind", MessageDraft{Kind: "sticker", Content: "hi"}},
+		{"attachment without url", MessageDraft{Kind: "attachment", Payload: json.RawMessage(`{}`)}},
+		{"attachment elsewhere", MessageDraft{Kind: "attachment", Payload: json.RawMessage(`{"url":"ftp://example.com/a.png"}`)}},
+		{"attachment media type", MessageDraft{Kind: "attachment", Payload: json.RawMessage(`{"url":"/uploads/a.png","media_type":"video"}`)}},
+		{"malformed payload", MessageDraft{Kind: "product_ref", Payload: json.RawMessage(`{"product_id":1}`)}},
+		{"other supplier's product", MessageDraft{Kind: "product_ref", Payload: json.RawMessage(`{"product_id":"product2"}`)}},
+		{"unknown product", MessageDraft{Kind: "product_ref", Payload: json.RawMessage(`{"product_id":"missing"}`)}},
+		{"other consumer's order", MessageDraft{Kind: "order_ref", Payload: json.RawMessage(`{"order_id":"order2"}`)}},
+		{"order without id", MessageDraft{Kind: "order_ref"}},
+		{"empty note", MessageDraft{Kind: "internal_note", Content: " "}},
+		{"note mentioning another supplier's staff", MessageDraft{Kind: "internal_note", Content: "FYI", Payload: json.RawMessage(`{"mentions":["rep2"]}`)}},
+		{"note mentioning the consumer", MessageDraft{Kind: "internal_note", Content: "FYI", Payload: json.RawMessage(`{"mentions":["consumer1"]}`)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newComposerTestService().ComposeMessage(conversation, sender, tt.draft)
+
+			assert.ErrorIs(t, err, ErrInvalidMessage)
+		})
+	}
+}
+
+func TestChatService_ComposeMessage_InternalNote(t *testing.T) {
+	conversation := &models.Conversation{ID: "conv1", ConsumerID: "consumer1", SupplierID: "supplier1"}
+	sender := ChatUser{ID: "rep1", Role: "sales_rep", SupplierID: "supplier1"}
+	draft := MessageDraft{Kind: "internal_note", Content: "Check their last invoice", Payload: json.RawMessage(`{"mentions":["manager1","manager1"]}`)}
+
+	message, err := newComposerTestService().ComposeMessage(conversation, sender, draft)
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.MessageKindInternalNote, message.Kind)
+	var payload models.InternalNotePayload
+	assert.NoError(t, json.Unmarshal(message.Payload, &payload))
+	assert.Equal(t, []string{"manager1"}, payload.Mentions)
+}
+
+func TestChatService_ComposeMessage_InternalNoteByConsumer(t *testing.T) {
+	conversation := &models.Conversation{ID: "conv1", ConsumerID: "consumer1", SupplierID: "supplier1"}
+	sender := ChatUser{ID: "consumer1", Role: "consumer"}
+
+	_, err := newComposerTestService().ComposeMessage(conversation, sender, MessageDraft{Kind: "internal_note", Content: "Hi"})
+
+	assert.ErrorIs(t, err, ErrInvalidMessage)
+}
@@ -0,0 +1,193 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/scp-platform/backend/internal/models"
+)
+
+// CancelOrder cancels an order and returns the event recording it. Consumers
+// cancel pending orders outright; for orders the supplier has accepted they
+// can only ask, and the supplier approves or declines with
+// ApproveCancellation or DeclineCancellation. Cancelling puts back any stock
+// the order held.
+func (s *OrderService) CancelOrder(orderID string, actor OrderActor, reason string) (*models.Order, *models.OrderEvent, error) {
+	order, err := s.getOrder(orderID, actor)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = checkOrderTransition(order.Status, models.OrderStatusCancelled, actor.Role)
+	if actor.Role == "consumer" && errors.Is(err, ErrOrderTransitionForbidden) {
+		event, err := s.requestCancellation(order, actor, reason)
+		if err != nil {
+			return nil, nil, err
+		}
+		return order, event, nil
+	}
+
+	event, err := s.transition(order, actor, models.OrderStatusCancelled, reason)
+	if err != nil {
+		return nil, nil, err
+	}
+	return order, event, nil
+}
+
+func (s *OrderService) requestCancellation(order *models.Order, actor OrderActor, reason string) (*models.OrderEvent, error) {
+	if order.CancellationRequestedAt != nil {
+		return nil, ErrCancellationRequested
+	}
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, ErrOrderReasonRequired
+	}
+
+	now := time.Now()
+	status := order.Status
+	order.CancellationRequestedAt = &now
+	order.CancellationReason = &reason
+	event := &models.OrderEvent{
+		Kind:       models.OrderEventCancellationRequested,
+		FromStatus: &status,
+		ToStatus:   order.Status,
+		ActorID:    &actor.ID,
+		ActorRole:  actor.Role,
+		Reason:     &reason,
+	}
+	if err := s.orderRepo.SetCancellationRequest(order, event); err != nil {
+		order.CancellationRequestedAt = nil
+		order.CancellationReason = nil
+		return nil, orderChangedError(err)
+	}
+	return event, nil
+}
+
+// ApproveCancellation cancels an order whose consumer asked to cancel it,
+// for the reason they gave.
+func (s *OrderService) ApproveCancellation(orderID string, actor OrderActor) (*models.Order, *models.OrderEvent, error) {
+	order, err := s.getOrder(orderID, actor)
+	if err != nil {
+		return nil, nil, err
+	}
+	if order.CancellationRequestedAt == nil {
+		return nil, nil, ErrNoCancellationRequest
+	}
+
+	reason := ""
+	if order.CancellationReason != nil {
+		reason = *order.CancellationReason
+	}
+	event, err := s.transition(order, actor, models.OrderStatusCancelled, reason)
+	if err != nil {
+		return nil, nil, err
+	}
+	return order, event, nil
+}
+
+// DeclineCancellation turns down the consumer's request to cancel an order,
+// telling them why. Only those who may cancel the order may decline.
+func (s *OrderService) DeclineCancellation(orderID string, actor OrderActor, reason string) (*models.Order, *models.OrderEvent, error) {
+	order, err := s.getOrder(orderID, actor)
+	if err != nil {
+		return nil, nil, err
+	}
+	if order.CancellationRequestedAt == nil {
+		return nil, nil, ErrNoCancellationRequest
+	}
+	if err := checkOrderTransition(order.Status, models.OrderStatusCancelled, actor.Role); err != nil {
+		return nil, nil, err
+	}
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, nil, ErrOrderReasonRequired
+	}
+
+	status := order.Status
+	requestedAt, requestReason := order.CancellationRequestedAt, order.CancellationReason
+	order.CancellationRequestedAt = nil
+	order.CancellationReason = nil
+	event := &models.OrderEvent{
+		Kind:       models.OrderEventCancellationDeclined,
+		FromStatus: &status,
+		ToStatus:   order.Status,
+		ActorID:    &actor.ID,
+		ActorRole:  actor.Role,
+		Reason:     &reason,
+	}
+	if err := s.orderRepo.SetCancellationRequest(order, event); err != nil {
+		order.CancellationRequestedAt, order.CancellationReason = requestedAt, requestReason
+		return nil, nil, orderChangedError(err)
+	}
+	return order, event, nil
+}
+
+// NotifyOrderEvent notifies the consumer and the supplier's owners and
+// managers, except whoever made it, of a cancellation, a request to cancel
+// or a declined request, and of a counter-offer and the consumer's answer.
+// Other events notify nobody.
+func (s *OrderService) NotifyOrderEvent(order *models.Order, event *models.OrderEvent) ([]models.Notification, error) {
+	var title string
+	switch {
+	case event.Kind == models.OrderEventCancellationRequested:
+		title = fmt.Sprintf("Cancellation of %s requested", orderLabel(order.ID))
+	case event.Kind == models.OrderEventCancellationDeclined:
+		title = fmt.Sprintf("Cancellation of %s declined", orderLabel(order.ID))
+	case event.Kind == models.OrderEventCounterOffered:
+		title = fmt.Sprintf("Counter-offer for %s", orderLabel(order.ID))
+	case event.Kind == models.OrderEventCounterOfferAccepted:
+		title = fmt.Sprintf("Counter-offer for %s accepted", orderLabel(order.ID))
+	case event.Kind == models.OrderEventCounterOfferDeclined:
+		title = fmt.Sprintf("Counter-offer for %s declined", orderLabel(order.ID))
+	case event.ToStatus == models.OrderStatusCancelled:
+		title = fmt.Sprintf("%s cancelled", orderLabel(order.ID))
+	default:
+		return nil, nil
+	}
+	message := title
+	if event.Reason != nil {
+		message = *event.Reason
+	}
+
+	data, err := json.Marshal(map[string]string{
+		"order_id": order.ID,
+		"event_id": event.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	encoded := string(data)
+
+	recipients := []string{order.ConsumerID}
+	staff, err := s.userRepo.GetBySupplierID(order.SupplierID)
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range staff {
+		if user.Role == "owner" || user.Role == "manager" {
+			recipients = append(recipients, user.ID)
+		}
+	}
+
+	notifications := []models.Notification{}
+	for _, userID := range recipients {
+		if event.ActorID != nil && userID == *event.ActorID {
+			continue
+		}
+		notification := models.Notification{
+			UserID:  userID,
+			Type:    models.NotificationTypeOrder,
+			Title:   title,
+			Message: message,
+			Data:    &encoded,
+		}
+		if err := s.notificationRepo.Create(&notification); err != nil {
+			return notifications, err
+		}
+		notifications = append(notifications, notification)
+	}
+	return notifications, nil
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/scp-platform/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newCancellationTestService() (*OrderService, *MockOrderRepository, *MockNotificationStore, *MockUserRepository) {
+	orderRepo := new(MockOrderRepository)
+	notificationRepo := new(MockNotificationStore)
+	userRepo := new(MockUserRepository)
+	service := NewOrderService(orderRepo, new(MockProductRepository), nil, notificationRepo, userRepo)
+	return service, orderRepo, notificationRepo, userRepo
+}
+
+func TestOrderService_CancelOrder_ConsumerCancelsPending(t *testing.T) {
+	service, orderRepo, _, _ := newCancellationTestService()
+
+	order := &models.Order{ID: "order-1", ConsumerID: "consumer-1", SupplierID: "supplier-1", Status: models.OrderStatusPending}
+	orderRepo.On("GetByID", "order-1").Return(order, nil)
+	orderRepo.On("UpdateStatus", order, mock.Anything).Return(nil)
+
+	updated, event, err := service.CancelOrder("order-1", OrderActor{ID: "consumer-1", Role: "consumer"}, "Ordered twice")
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.OrderStatusCancelled, updated.Status)
+	assert.Equal(t, models.OrderStatusCancelled, event.ToStatus)
+}
+
+func TestOrderService_CancelOrder_ConsumerRequestsForAccepted(t *testing.T) {
+	service, orderRepo, _, _ := newCancellationTestService()
+
+	order := &models.Order{ID: "order-1", ConsumerID: "consumer-1", SupplierID: "supplier-1", Status: models.OrderStatusAccepted}
+	orderRepo.On("GetByID", "order-1").Return(order, nil)
+	isRequest := mock.MatchedBy(func(event *models.OrderEvent) bool {
+		return event.Kind == models.OrderEventCancellationRequested && event.ToStatus == models.OrderStatusAccepted
+	})
+	orderRepo.On("SetCancellationRequest", order, isRequest).Return(nil)
+
+	updated, event, err := service.CancelOrder("order-1", OrderActor{ID: "consumer-1", Role: "consumer"}, "Event was called off")
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.OrderStatusAccepted, updated.Status)
+	assert.NotNil(t, updated.CancellationRequestedAt)
+	assert.Equal(t, "Event was called off", *updated.CancellationReason)
+	assert.Equal(t, models.OrderEventCancellationRequested, event.Kind)
+	orderRepo.AssertNotCalled(t, "UpdateStatus", mock.Anything, mock.Anything)
+}
+
+func TestOrderService_CancelOrder_RequestTwice(t *testing.T) {
+	service, orderRepo, _, _ := newCancellationTestService()
+
+	requestedAt := time.Now()
+	order := &models.Order{ID: "order-1", ConsumerID: "consumer-1", SupplierID: "supplier-1", Status: models.OrderStatusPreparing, CancellationRequestedAt: &requestedAt}
+	orderRepo.On("GetByID", "order-1").Return(order, nil)
+
+	_, _, err := service.CancelOrder("order-1", OrderActor{ID: "consumer-1", Role: "consumer"}, "Please")
+
+	assert.ErrorIs(t, err, ErrCancellationRequested)
+}
+
+func TestOrderService_CancelOrder_SupplierCancelsAccepted(t *testing.T) {
+	service, orderRepo, _, _ := newCancellationTestService()
+
+	order := &models.Order{ID: "order-1", ConsumerID: "consumer-1", SupplierID: "supplier-1", Status: models.OrderStatusAccepted}
+	orderRepo.On("GetByID", "order-1").Return(order, nil)
+	orderRepo.On("UpdateStatus", order, mock.Anything).Return(nil)
+
+	updated, _, err := service.CancelOrder("order-1", OrderActor{ID: "manager-1", Role: "manager", SupplierID: "supplier-1"}, "Truck broke down")
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.OrderStatusCancelled, updated.Status)
+}
+
+func TestOrderService_ApproveCancellation(t *testing.T) {
+	service, orderRepo, _, _ := newCancellationTestService()
+
+	requestedAt := time.Now()
+	reason := "Event was called off"
+	order := &models.Order{ID: "order-1", ConsumerID: "consumer-1", SupplierID: "supplier-1", Status: models.OrderStatusAccepted, CancellationRequestedAt: &requestedAt, CancellationReason: &reason}
+	orderRepo.On("GetByID", "order-1").Return(order, nil)
+	hasConsumerReason := mock.MatchedBy(func(event *models.OrderEvent) bool {
+		return event.ToStatus == models.OrderStatusCancelled && *event.Reason == reason
+	})
+	orderRepo.On("UpdateStatus", order, hasConsumerReason).Return(nil)
+
+	updated, _, err := service.ApproveCancellation("order-1", OrderActor{ID: "owner-1", Role: "owner", SupplierID: "supplier-1"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.OrderStatusCancelled, updated.Status)
+	orderRepo.AssertExpectations(t)
+}
+
+func TestOrderService_DeclineCancellation(t *testing.T) {
+	service, orderRepo, _, _ := newCancellationTestService()
+
+	requestedAt := time.Now()
+	order := &models.Order{ID: "order-1", ConsumerID: "consumer-1", SupplierID: "supplier-1", Status: models.OrderStatusPreparing, CancellationRequestedAt: &requestedAt}
+	orderRepo.On("GetByID", "order-1").Return(order, nil)
+	isDecline := mock.MatchedBy(func(event *models.OrderEvent) bool {
+		return event.Kind == models.OrderEventCancellationDeclined && *event.Reason == "Already packed"
+	})
+	orderRepo.On("SetCancellationRequest", order, isDecline).Return(nil)
+
+	updated, _, err := service.DeclineCancellation("order-1", OrderActor{ID: "manager-1", Role: "manager", SupplierID: "supplier-1"}, "Already packed")
+
+	assert.NoError(t, err)
+	assert.Nil(t, updated.CancellationRequestedAt)
+	assert.Equal(t, models.OrderStatusPreparing, updated.Status)
+}
+
+func TestOrderService_DeclineCancellation_SalesRep(t *testing.T) {
+	service, orderRepo, _, _ := newCancellationTestService()
+
+	requestedAt := time.Now()
+	order := &models.Order{ID: "order-1", ConsumerID: "consumer-1", SupplierID: "supplier-1", Status: models.OrderStatusAccepted, CancellationRequestedAt: &requestedAt}
+	orderRepo.On("GetByID", "order-1").Return(order, nil)
+
+	_, _, err := service.DeclineCancellation("order-1", OrderActor{ID: "rep-1", Role: "sales_rep", SupplierID: "supplier-1"}, "No")
+
+	assert.ErrorIs(t, err, ErrOrderTransitionForbidden)
+}
+
+func TestOrderService_NotifyOrderEvent(t *testing.T) {
+	service, _, notificationRepo, userRepo := newCancellationTestService()
+
+	order := &models.Order{ID: "order-1", ConsumerID: "consumer-1", SupplierID: "supplier-1", Status: models.OrderStatusCancelled}
+	managerID := "manager-1"
+	reason := "Truck broke down"
+	event := &models.OrderEvent{ID: "event-1", ToStatus: models.OrderStatusCancelled, ActorID: &managerID, ActorRole: "manager", Reason: &reason}
+
+	userRepo.On("GetBySupplierID", "supplier-1").Return([]models.User{
+		{ID: "owner-1", Role: "owner"},
+		{ID: "manager-1", Role: "manager"},
+		{ID: "rep-1", Role: "sales_rep"},
+	}, nil)
+	notificationRepo.On("Create", mock.Anything).Return(nil)
+
+	notifications, err := service.NotifyOrderEvent(order, event)
+
+	assert.NoError(t, err)
+	recipients := []string{}
+	for _, notification := range notifications {
+		recipients = append(recipients, notification.UserID)
+		assert.Equal(t, models.NotificationTypeOrder, notification.Type)
+		assert.Equal(t, "Order #order-1 cancelled", notification.Title)
+		assert.Equal(t, reason, notification.Message)
+	}
+	assert.Equal(t, []string{"consumer-1", "owner-1"}, recipients)
+}
+
+func TestOrderService_NotifyOrderEvent_OtherChanges(t *testing.T) {
+	service, _, notificationRepo, _ := newCancellationTestService()
+
+	order := &models.Order{ID: "order-1", Status: models.OrderStatusPreparing}
+	notifications, err := service.NotifyOrderEvent(order, &models.OrderEvent{ToStatus: models.OrderStatusPreparing})
+
+	assert.NoError(t, err)
+	assert.Empty(t, notifications)
+	notificationRepo.AssertNotCalled(t, "Create", mock.Anything)
+}
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/scp-platform/backend/internal/models"
+)
+
+var (
+	ErrInvalidCounterOffer = errors.New("invalid counter-offer")
+	ErrNoCounterOffer      = errors.New("this order has no open counter-offer")
+)
+
+// CounterOfferLine is a line of a counter-offer. Without a UnitPrice the
+// product sells at its current price.
+type CounterOfferLine struct {
+	ProductID string
+	Quantity  int
+	UnitPrice *float64
+}
+
+// ProposeCounterOffer offers the consumer of a pending order other lines
+// than they ordered: less or more of a product, another price, or another of
+// the supplier's products instead. Whoever may accept the order may make a
+// counter-offer, and a new one replaces any still open. The order stays
+// pending until the consumer answers with AcceptCounterOffer or
+// DeclineCounterOffer.
+func (s *OrderService) ProposeCounterOffer(orderID string, actor OrderActor, lines []CounterOfferLine, reason string) (*models.Order, *models.OrderEvent, error) {
+	order, err := s.getOrder(orderID, actor)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkOrderTransition(order.Status, models.OrderStatusAccepted, actor.Role); err != nil {
+		return nil, nil, err
+	}
+
+	revision, err := s.counterOfferRevision(order, lines)
+	if err != nil {
+		return nil, nil, err
+	}
+	revision.ProposedBy = &actor.ID
+	revision.ProposedByRole = actor.Role
+
+	status := order.Status
+	event := &models.OrderEvent{
+		Kind:       models.OrderEventCounterOffered,
+		FromStatus: &status,
+		ToStatus:   order.Status,
+		ActorID:    &actor.ID,
+		ActorRole:  actor.Role,
+	}
+	if reason = strings.TrimSpace(reason); reason != "" {
+		revision.Reason = &reason
+		event.Reason = &reason
+	}
+	if err := s.orderRepo.ProposeRevision(order, revision, event); err != nil {
+		return nil, nil, orderChangedError(err)
+	}
+	order.CounterOffer = revision
+	return order, event, nil
+}
+
+// counterOfferRevision prices the lines of a counter-offer on an order. The
+// order's shipping fee stays as it is.
+func (s *OrderService) counterOfferRevision(order *models.Order, lines []CounterOfferLine) (*models.OrderRevision, error) {
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("%w: it needs at least one line", ErrInvalidCounterOffer)
+	}
+
+	revision := &models.OrderRevision{
+		Status:      models.OrderRevisionProposed,
+		ShippingFee: order.ShippingFee,
+		Items:       make([]models.OrderRevisionItem, 0, len(lines)),
+	}
+	seen := map[string]bool{}
+	for _, line := range lines {
+		if line.Quantity <= 0 {
+			return nil, fmt.Errorf("%w: quantities must be greater than 0", ErrInvalidCounterOffer)
+		}
+		if seen[line.ProductID] {
+			return nil, fmt.Errorf("%w: product %s is listed twice", ErrInvalidCounterOffer, line.ProductID)
+		}
+		seen[line.ProductID] = true
+
+		product, err := s.productRepo.GetByID(line.ProductID)
+		if err != nil || product.SupplierID != order.SupplierID {
+			return nil, fmt.Errorf("%w: product %s is not one of the supplier's", ErrInvalidCounterOffer, line.ProductID)
+		}
+		price := productPrice(product)
+		if line.UnitPrice != nil {
+			if *line.UnitPrice < 0 {
+				return nil, fmt.Errorf("%w: prices cannot be negative", ErrInvalidCounterOffer)
+			}
+			price = *line.UnitPrice
+		}
+
+		itemSubtotal := price * float64(line.Quantity)
+		revision.Subtotal += itemSubtotal
+		revision.Items = append(revision.Items, models.OrderRevisionItem{
+			ProductID: product.ID,
+			Quantity:  line.Quantity,
+			UnitPrice: price,
+			Subtotal:  itemSubtotal,
+		})
+	}
+
+	if revision.Subtotal <= 0 {
+		return nil, fmt.Errorf("%w: order total must be greater than 0", ErrInvalidCounterOffer)
+	}
+	revision.Tax = revision.Subtotal * orderTaxRate
+	revision.Total = revision.Subtotal + revision.Tax + revision.ShippingFee
+	return revision, nil
+}
+
+// AcceptCounterOffer makes the open counter-offer on an order its lines and
+// totals and, as the supplier has already agreed to them, accepts the
+// order, taking the new lines out of stock.
+func (s *OrderService) AcceptCounterOffer(orderID string, actor OrderActor) (*models.Order, *models.OrderEvent, error) {
+	order, offer, err := s.getCounterOffer(orderID, actor)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	from := order.Status
+	event := &models.OrderEvent{
+		Kind:       models.OrderEventCounterOfferAccepted,
+		FromStatus: &from,
+		ToStatus:   models.OrderStatusAccepted,
+		ActorID:    &actor.ID,
+		ActorRole:  actor.Role,
+	}
+	previous := *order
+	order.Status = models.OrderStatusAccepted
+	order.Subtotal = offer.Subtotal
+	order.Tax = offer.Tax
+	order.ShippingFee = offer.ShippingFee
+	order.Total = offer.Total
+	offer.Status = models.OrderRevisionAccepted
+	offer.DecidedBy = &actor.ID
+	if err := s.orderRepo.AcceptRevision(order, offer, event); err != nil {
+		*order = previous
+		offer.Status, offer.DecidedBy = models.OrderRevisionProposed, nil
+		return nil, nil, orderChangedError(err)
+	}
+	return order, event, nil
+}
+
+// DeclineCounterOffer turns down the open counter-offer on an order, with an
+// optional reason. The order stays pending as it was placed, for the
+// supplier to accept, reject or make another counter-offer.
+func (s *OrderService) DeclineCounterOffer(orderID string, actor OrderActor, reason string) (*models.Order, *models.OrderEvent, error) {
+	order, offer, err := s.getCounterOffer(orderID, actor)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	status := order.Status
+	event := &models.OrderEvent{
+		Kind:       models.OrderEventCounterOfferDeclined,
+		FromStatus: &status,
+		ToStatus:   order.Status,
+		ActorID:    &actor.ID,
+		ActorRole:  actor.Role,
+	}
+	if reason = strings.TrimSpace(reason); reason != "" {
+		event.Reason = &reason
+	}
+	offer.Status = models.OrderRevisionDeclined
+	offer.DecidedBy = &actor.ID
+	if err := s.orderRepo.DeclineRevision(order, offer, event); err != nil {
+		offer.Status, offer.DecidedBy = models.OrderRevisionProposed, nil
+		return nil, nil, orderChangedError(err)
+	}
+	return order, event, nil
+}
+
+// Revisions returns every version of an order's lines, oldest first, to its
+// consumer or its supplier's staff.
+func (s *OrderService) Revisions(orderID string, actor OrderActor) ([]models.OrderRevision, error) {
+	if _, err := s.getOrder(orderID, actor); err != nil {
+		return nil, err
+	}
+	return s.orderRepo.GetRevisions(orderID)
+}
+
+// getCounterOffer returns an order and its open counter-offer for its
+// consumer to answer.
+func (s *OrderService) getCounterOffer(orderID string, actor OrderActor) (*models.Order, *models.OrderRevision, error) {
+	order, err := s.getOrder(orderID, actor)
+	if err != nil {
+		return nil, nil, err
+	}
+	if actor.Role != "consumer" {
+		return nil, nil, fmt.Errorf("%w: only the consumer answers a counter-offer", ErrOrderTransitionForbidden)
+	}
+	if order.CounterOffer == nil {
+		return nil, nil, ErrNoCounterOffer
+	}
+	return order, order.CounterOffer, nil
+}
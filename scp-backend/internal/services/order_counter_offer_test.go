@@ -0,0 +1,164 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/scp-platform/backend/internal/models"
+	"github.com/scp-platform/backend/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newCounterOfferTestService() (*OrderService, *MockOrderRepository) {
+	orderRepo := new(MockOrderRepository)
+	productRepo := new(MockProductRepository)
+	discount := 10.0
+	productRepo.On("GetByID", "product-1").Return(&models.Product{ID: "product-1", Name: "Tomatoes", Price: 20, Discount: &discount, SupplierID: "supplier-1"}, nil)
+	productRepo.On("GetByID", "product-2").Return(&models.Product{ID: "product-2", Name: "Cherry tomatoes", Price: 25, SupplierID: "supplier-1"}, nil)
+	productRepo.On("GetByID", "product-3").Return(&models.Product{ID: "product-3", Name: "Salmon", Price: 30, SupplierID: "supplier-2"}, nil)
+	productRepo.On("GetByID", mock.Anything).Return(nil, errors.New("not found"))
+	return NewOrderService(orderRepo, productRepo, nil, nil, nil), orderRepo
+}
+
+func TestOrderService_ProposeCounterOffer(t *testing.T) {
+	service, orderRepo := newCounterOfferTestService()
+
+	order := &models.Order{ID: "order-1", ConsumerID: "consumer-1", SupplierID: "supplier-1", Status: models.OrderStatusPending, ShippingFee: 5}
+	orderRepo.On("GetByID", "order-1").Return(order, nil)
+	orderRepo.On("ProposeRevision", order, mock.Anything, mock.Anything).Return(nil)
+
+	price := 22.0
+	updated, event, err := service.ProposeCounterOffer("order-1", OrderActor{ID: "rep-1", Role: "sales_rep", SupplierID: "supplier-1"}, []CounterOfferLine{
+		{ProductID: "product-1", Quantity: 15},
+		{ProductID: "product-2", Quantity: 5, UnitPrice: &price},
+	}, " Only 15 cases left ")
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.OrderStatusPending, updated.Status)
+	offer := updated.CounterOffer
+	assert.Equal(t, models.OrderRevisionProposed, offer.Status)
+	assert.Equal(t, "sales_rep", offer.ProposedByRole)
+	assert.Len(t, offer.Items, 2)
+	assert.InDelta(t, 18.0, offer.Items[0].UnitPrice, 0.001)
+	assert.InDelta(t, 270.0, offer.Items[0].Subtotal, 0.001)
+	assert.InDelta(t, 110.0, offer.Items[1].Subtotal, 0.001)
+	assert.InDelta(t, 380.0, offer.Subtotal, 0.001)
+	assert.InDelta(t, 38.0, offer.Tax, 0.001)
+	assert.InDelta(t, 423.0, offer.Total, 0.001)
+	assert.Equal(t, models.OrderEventCounterOffered, event.Kind)
+	assert.Equal(t, "Only 15 cases left", *event.Reason)
+}
+
+func TestOrderService_ProposeCounterOffer_Invalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []CounterOfferLine
+	}{
+		{"no lines", nil},
+		{"zero quantity", []CounterOfferLine{{ProductID: "product-1", Quantity: 0}}},
+		{"product twice", []CounterOfferLine{{ProductID: "product-1", Quantity: 1}, {ProductID: "product-1", Quantity: 2}}},
+		{"another supplier's product", []CounterOfferLine{{ProductID: "product-3", Quantity: 1}}},
+		{"unknown product", []CounterOfferLine{{ProductID: "missing", Quantity: 1}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, orderRepo := newCounterOfferTestService()
+			order := &models.Order{ID: "order-1", ConsumerID: "consumer-1", SupplierID: "supplier-1", Status: models.OrderStatusPending}
+			orderRepo.On("GetByID", "order-1").Return(order, nil)
+
+			_, _, err := service.ProposeCounterOffer("order-1", OrderActor{ID: "owner-1", Role: "owner", SupplierID: "supplier-1"}, tt.lines, "")
+
+			assert.ErrorIs(t, err, ErrInvalidCounterOffer)
+			orderRepo.AssertNotCalled(t, "ProposeRevision", mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestOrderService_ProposeCounterOffer_NotPending(t *testing.T) {
+	service, orderRepo := newCounterOfferTestService()
+
+	order := &models.Order{ID: "order-1", ConsumerID: "consumer-1", SupplierID: "supplier-1", Status: models.OrderStatusAccepted}
+	orderRepo.On("GetByID", "order-1").Return(order, nil)
+
+	_, _, err := service.ProposeCounterOffer("order-1", OrderActor{ID: "owner-1", Role: "owner", SupplierID: "supplier-1"}, []CounterOfferLine{{ProductID: "product-1", Quantity: 1}}, "")
+
+	assert.ErrorIs(t, err, ErrIllegalOrderTransition)
+}
+
+func TestOrderService_AcceptCounterOffer(t *testing.T) {
+	service, orderRepo := newCounterOfferTestService()
+
+	offer := &models.OrderRevision{ID: "revision-2", Version: 2, Status: models.OrderRevisionProposed, Subtotal: 270, Tax: 27, ShippingFee: 5, Total: 302}
+	order := &models.Order{ID: "order-1", ConsumerID: "consumer-1", SupplierID: "supplier-1", Status: models.OrderStatusPending, Subtotal: 360, Total: 401, CounterOffer: offer}
+	orderRepo.On("GetByID", "order-1").Return(order, nil)
+	isAcceptance := mock.MatchedBy(func(event *models.OrderEvent) bool {
+		return event.Kind == models.OrderEventCounterOfferAccepted && event.ToStatus == models.OrderStatusAccepted
+	})
+	orderRepo.On("AcceptRevision", order, offer, isAcceptance).Return(nil)
+
+	updated, _, err := service.AcceptCounterOffer("order-1", OrderActor{ID: "consumer-1", Role: "consumer"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.OrderStatusAccepted, updated.Status)
+	assert.Equal(t, 270.0, updated.Subtotal)
+	assert.Equal(t, 302.0, updated.Total)
+	assert.Equal(t, models.OrderRevisionAccepted, offer.Status)
+	orderRepo.AssertExpectations(t)
+}
+
+func TestOrderService_AcceptCounterOffer_OutOfStock(t *testing.T) {
+	service, orderRepo := newCounterOfferTestService()
+
+	offer := &models.OrderRevision{ID: "revision-2", Status: models.OrderRevisionProposed, Subtotal: 270, Total: 302}
+	order := &models.Order{ID: "order-1", ConsumerID: "consumer-1", SupplierID: "supplier-1", Status: models.OrderStatusPending, Subtotal: 360, Total: 401, CounterOffer: offer}
+	orderRepo.On("GetByID", "order-1").Return(order, nil)
+	orderRepo.On("AcceptRevision", order, offer, mock.Anything).Return(repository.ErrInsufficientStock)
+
+	_, _, err := service.AcceptCounterOffer("order-1", OrderActor{ID: "consumer-1", Role: "consumer"})
+
+	assert.ErrorIs(t, err, repository.ErrInsufficientStock)
+	assert.Equal(t, models.OrderStatusPending, order.Status)
+	assert.Equal(t, 360.0, order.Subtotal)
+	assert.Equal(t, models.OrderRevisionProposed, offer.Status)
+}
+
+func TestOrderService_AcceptCounterOffer_Supplier(t *testing.T) {
+	service, orderRepo := newCounterOfferTestService()
+
+	order := &models.Order{ID: "order-1", ConsumerID: "consumer-1", SupplierID: "supplier-1", Status: models.OrderStatusPending, CounterOffer: &models.OrderRevision{ID: "revision-2"}}
+	orderRepo.On("GetByID", "order-1").Return(order, nil)
+
+	_, _, err := service.AcceptCounterOffer("order-1", OrderActor{ID: "owner-1", Role: "owner", SupplierID: "supplier-1"})
+
+	assert.ErrorIs(t, err, ErrOrderTransitionForbidden)
+}
+
+func TestOrderService_DeclineCounterOffer(t *testing.T) {
+	service, orderRepo := newCounterOfferTestService()
+
+	offer := &models.OrderRevision{ID: "revision-2", Status: models.OrderRevisionProposed}
+	order := &models.Order{ID: "order-1", ConsumerID: "consumer-1", SupplierID: "supplier-1", Status: models.OrderStatusPending, CounterOffer: offer}
+	orderRepo.On("GetByID", "order-1").Return(order, nil)
+	orderRepo.On("DeclineRevision", order, offer, mock.Anything).Return(nil)
+
+	updated, event, err := service.DeclineCounterOffer("order-1", OrderActor{ID: "consumer-1", Role: "consumer"}, "")
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.OrderStatusPending, updated.Status)
+	assert.Equal(t, models.OrderRevisionDeclined, offer.Status)
+	assert.Equal(t, models.OrderEventCounterOfferDeclined, event.Kind)
+	assert.Nil(t, event.Reason)
+}
+
+func TestOrderService_DeclineCounterOffer_NoOffer(t *testing.T) {
+	service, orderRepo := newCounterOfferTestService()
+
+	order := &models.Order{ID: "order-1", ConsumerID: "consumer-1", SupplierID: "supplier-1", Status: models.OrderStatusPending}
+	orderRepo.On("GetByID", "order-1").Return(order, nil)
+
+	_, _, err := service.DeclineCounterOffer("order-1", OrderActor{ID: "consumer-1", Role: "consumer"}, "")
+
+	assert.ErrorIs(t, err, ErrNoCounterOffer)
+}
@@ -1,26 +1,124 @@
 package services
 
 import (
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/scp-platform/backend/internal/models"
 	"github.com/scp-platform/backend/internal/repository"
 )
 
+var (
+	ErrOrderNotFound            = errors.New("order not found")
+	ErrNotOrderParty            = errors.New("order belongs to another consumer or supplier")
+	ErrIllegalOrderTransition   = errors.New("illegal order status change")
+	ErrOrderTransitionForbidden = errors.New("not allowed to make this order status change")
+	ErrOrderReasonRequired      = errors.New("a reason is required to reject or cancel an order")
+	ErrCancellationRequested    = errors.New("cancellation of this order has already been requested")
+	ErrNoCancellationRequest    = errors.New("cancellation of this order has not been requested")
+)
+
+// OrderActor is the user changing an order, as identified by their token.
+type OrderActor struct {
+	ID         string
+	Role       string
+	SupplierID string
+}
+
+// orderTransition is a change from one order status to another.
+type orderTransition struct {
+	from, to string
+}
+
+// orderTransitions lists every status change an order may go through and
+// the roles allowed to make it. Anything not listed is illegal. Consumers
+// ask to cancel orders they may no longer cancel themselves; see
+// CancelOrder.
+var orderTransitions = map[orderTransition][]string{
+	{models.OrderStatusPending, models.OrderStatusAccepted}:         {"owner", "manager", "sales_rep"},
+	{models.OrderStatusPending, models.OrderStatusRejected}:         {"owner", "manager", "sales_rep"},
+	{models.OrderStatusPending, models.OrderStatusCancelled}:        {"consumer"},
+	{models.OrderStatusAccepted, models.OrderStatusPreparing}:       {"owner", "manager", "sales_rep"},
+	{models.OrderStatusAccepted, models.OrderStatusCancelled}:       {"owner", "manager"},
+	{models.OrderStatusPreparing, models.OrderStatusCancelled}:      {"owner", "manager"},
+	{models.OrderStatusPreparing, models.OrderStatusOutForDelivery}: {"owner", "manager", "sales_rep"},
+	{models.OrderStatusOutForDelivery, models.OrderStatusDelivered}: {"owner", "manager", "sales_rep"},
+	{models.OrderStatusDelivered, models.OrderStatusCompleted}:      {"consumer", "owner", "manager"},
+}
+
+// checkOrderTransition reports whether a user with role may move an order
+// from one status to another.
+func checkOrderTransition(from, to, role string) error {
+	roles, ok := orderTransitions[orderTransition{from, to}]
+	if !ok {
+		return fmt.Errorf("%w: %s orders cannot become %s", ErrIllegalOrderTransition, from, to)
+	}
+	for _, allowed := range roles {
+		if allowed == role {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s may not move orders from %s to %s", ErrOrderTransitionForbidden, role, from, to)
+}
+
+// OrderRecordStore is the part of OrderRepository the order service needs.
+type OrderRecordStore interface {
+	GetByID(id string) (*models.Order, error)
+	Create(order *models.Order) error
+	UpdateStatus(order *models.Order, event *models.OrderEvent) error
+	GetEvents(orderID string) ([]models.OrderEvent, error)
+	ReleaseExpiredReservations(now time.Time) (int, error)
+	SetCancellationRequest(order *models.Order, event *models.OrderEvent) error
+	ProposeRevision(order *models.Order, revision *models.OrderRevision, event *models.OrderEvent) error
+	AcceptRevision(order *models.Order, revision *models.OrderRevision, event *models.OrderEvent) error
+	DeclineRevision(order *models.Order, revision *models.OrderRevision, event *models.OrderEvent) error
+	GetRevisions(orderID string) ([]models.OrderRevision, error)
+}
+
+// StaffStore is the part of UserRepository the order service needs.
+type StaffStore interface {
+	GetBySupplierID(supplierID string) ([]models.User, error)
+}
+
 type OrderService struct {
-	orderRepo   *repository.OrderRepository
-	productRepo *repository.ProductRepository
-	linkRepo    *repository.ConsumerLinkRepository
+	orderRepo        OrderRecordStore
+	productRepo      ProductStore
+	linkRepo         ConsumerLinkStore
+	notificationRepo NotificationStore
+	userRepo         StaffStore
+	stockReservation time.Duration
 }
 
-func NewOrderService(orderRepo *repository.OrderRepository, productRepo *repository.ProductRepository, linkRepo *repository.ConsumerLinkRepository) *OrderService {
+func NewOrderService(orderRepo OrderRecordStore, productRepo ProductStore, linkRepo ConsumerLinkStore, notificationRepo NotificationStore, userRepo StaffStore) *OrderService {
 	return &OrderService{
-		orderRepo:   orderRepo,
-		productRepo: productRepo,
-		linkRepo:    linkRepo,
+		orderRepo:        orderRepo,
+		productRepo:      productRepo,
+		linkRepo:         linkRepo,
+		notificationRepo: notificationRepo,
+		userRepo:         userRepo,
 	}
 }
 
+// SetStockReservation sets how long stock is held for a new order while it
+// waits to be accepted. Without it, stock is only taken on acceptance.
+func (s *OrderService) SetStockReservation(d time.Duration) {
+	s.stockReservation = d
+}
+
+// orderTaxRate is the tax charged on an order's subtotal.
+const orderTaxRate = 0.1 // 10% tax
+
+// productPrice is what a product sells for per unit, after its discount.
+func productPrice(product *models.Product) float64 {
+	price := product.Price
+	if product.Discount != nil {
+		price = price * (1 - *product.Discount/100)
+	}
+	return price
+}
+
 type CreateOrderRequest struct {
 	SupplierID string
 	Items      []OrderItemRequest
@@ -54,11 +152,7 @@ func (s *OrderService) CreateOrder(consumerID string, req CreateOrderRequest) (*
 			return nil, fmt.Errorf("quantity must be at least %d for product %s", product.MinOrderQuantity, product.Name)
 		}
 
-		price := product.Price
-		if product.Discount != nil {
-			price = price * (1 - *product.Discount/100)
-		}
-
+		price := productPrice(product)
 		itemSubtotal := price * float64(itemReq.Quantity)
 		subtotal += itemSubtotal
 
@@ -74,20 +168,24 @@ func (s *OrderService) CreateOrder(consumerID string, req CreateOrderRequest) (*
 		return nil, fmt.Errorf("order total must be greater than 0")
 	}
 
-	tax := subtotal * 0.1 // 10% tax
+	tax := subtotal * orderTaxRate
 	shippingFee := 0.0    // Can be calculated based on rules
 	total := subtotal + tax + shippingFee
 
 	order := &models.Order{
 		ConsumerID:  consumerID,
 		SupplierID:  req.SupplierID,
-		Status:      "pending",
+		Status:      models.OrderStatusPending,
 		Subtotal:    subtotal,
 		Tax:         tax,
 		ShippingFee: shippingFee,
 		Total:       total,
 		Items:       orderItems,
 	}
+	if s.stockReservation > 0 {
+		reservedUntil := time.Now().Add(s.stockReservation)
+		order.StockReservedUntil = &reservedUntil
+	}
 
 	if err := s.orderRepo.Create(order); err != nil {
 		return nil, err
@@ -96,46 +194,99 @@ func (s *OrderService) CreateOrder(consumerID string, req CreateOrderRequest) (*
 	return order, nil
 }
 
-func (s *OrderService) AcceptOrder(orderID string, supplierID string) error {
-	order, err := s.orderRepo.GetByID(orderID)
+// AcceptOrder accepts a pending order, taking its items out of stock in the
+// same transaction unless they are already held for it.
+func (s *OrderService) AcceptOrder(orderID string, actor OrderActor) (*models.Order, error) {
+	return s.TransitionOrder(orderID, actor, models.OrderStatusAccepted, "")
+}
+
+// RejectOrder rejects a pending order, telling the consumer why.
+func (s *OrderService) RejectOrder(orderID string, actor OrderActor, reason string) (*models.Order, error) {
+	return s.TransitionOrder(orderID, actor, models.OrderStatusRejected, reason)
+}
+
+// TransitionOrder moves an order to another status on behalf of its
+// consumer or one of its supplier's staff, if orderTransitions allows it,
+// and records the change with reason in the order's timeline. Rejections
+// and cancellations need a reason; for other changes it is an optional
+// note.
+func (s *OrderService) TransitionOrder(orderID string, actor OrderActor, to, reason string) (*models.Order, error) {
+	order, err := s.getOrder(orderID, actor)
 	if err != nil {
-		return fmt.Errorf("order not found")
+		return nil, err
 	}
 
-	if order.SupplierID != supplierID {
-		return fmt.Errorf("unauthorized")
+	if _, err := s.transition(order, actor, to, reason); err != nil {
+		return nil, err
 	}
+	return order, nil
+}
 
-	if order.Status != "pending" {
-		return fmt.Errorf("order cannot be accepted")
+// transition moves an order the actor may act on to another status and
+// returns the event recording it.
+func (s *OrderService) transition(order *models.Order, actor OrderActor, to, reason string) (*models.OrderEvent, error) {
+	if err := checkOrderTransition(order.Status, to, actor.Role); err != nil {
+		return nil, err
 	}
 
-	// Update stock levels
-	for _, item := range order.Items {
-		if err := s.productRepo.DecrementStock(item.ProductID, item.Quantity); err != nil {
-			return fmt.Errorf("insufficient stock for product")
-		}
+	reason = strings.TrimSpace(reason)
+	if reason == "" && (to == models.OrderStatusRejected || to == models.OrderStatusCancelled) {
+		return nil, ErrOrderReasonRequired
 	}
 
-	order.Status = "accepted"
-	return s.orderRepo.Update(order)
+	from := order.Status
+	event := &models.OrderEvent{
+		FromStatus: &from,
+		ToStatus:   to,
+		ActorID:    &actor.ID,
+		ActorRole:  actor.Role,
+	}
+	if reason != "" {
+		event.Reason = &reason
+	}
+	order.Status = to
+	if err := s.orderRepo.UpdateStatus(order, event); err != nil {
+		order.Status = from
+		return nil, orderChangedError(err)
+	}
+	return event, nil
 }
 
-func (s *OrderService) RejectOrder(orderID string, supplierID string) error {
-	order, err := s.orderRepo.GetByID(orderID)
-	if err != nil {
-		return fmt.Errorf("order not found")
+// orderChangedError tells the caller to reload an order someone else
+// changed while they were changing it.
+func orderChangedError(err error) error {
+	if errors.Is(err, repository.ErrOrderStatusChanged) {
+		return fmt.Errorf("%w: the order changed meanwhile, reload it and try again", ErrIllegalOrderTransition)
 	}
+	return err
+}
 
-	if order.SupplierID != supplierID {
-		return fmt.Errorf("unauthorized")
+// ReleaseExpiredReservations returns to stock what was held for pending
+// orders whose reservation has ended, and reports for how many orders.
+func (s *OrderService) ReleaseExpiredReservations(now time.Time) (int, error) {
+	return s.orderRepo.ReleaseExpiredReservations(now)
+}
+
+// Timeline returns every status change of an order, oldest first, to its
+// consumer or its supplier's staff.
+func (s *OrderService) Timeline(orderID string, actor OrderActor) ([]models.OrderEvent, error) {
+	if _, err := s.getOrder(orderID, actor); err != nil {
+		return nil, err
 	}
+	return s.orderRepo.GetEvents(orderID)
+}
 
-	if order.Status != "pending" {
-		return fmt.Errorf("order cannot be rejected")
+// getOrder returns an order if actor is its consumer or one of its
+// supplier's staff.
+func (s *OrderService) getOrder(orderID string, actor OrderActor) (*models.Order, error) {
+	order, err := s.orderRepo.GetByID(orderID)
+	if err != nil {
+		return nil, ErrOrderNotFound
 	}
 
-	order.Status = "rejected"
-	return s.orderRepo.Update(order)
+	if actor.Role == "consumer" && order.ConsumerID != actor.ID ||
+		actor.Role != "consumer" && order.SupplierID != actor.SupplierID {
+		return nil, ErrNotOrderParty
+	}
+	return order, nil
 }
-
@@ -2,11 +2,14 @@ package services
 
 import (
 	"errors"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/scp-platform/backend/internal/models"
+	"github.com/scp-platform/backend/internal/repository"
 )
 
 type MockOrderRepository struct {
@@ -31,6 +34,52 @@ func (m *MockOrderRepository) Update(order *models.Order) error {
 	return args.Error(0)
 }
 
+func (m *MockOrderRepository) UpdateStatus(order *models.Order, event *models.OrderEvent) error {
+	args := m.Called(order, event)
+	return args.Error(0)
+}
+
+func (m *MockOrderRepository) GetEvents(orderID string) ([]models.OrderEvent, error) {
+	args := m.Called(orderID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.OrderEvent), args.Error(1)
+}
+
+func (m *MockOrderRepository) SetCancellationRequest(order *models.Order, event *models.OrderEvent) error {
+	args := m.Called(order, event)
+	return args.Error(0)
+}
+
+func (m *MockOrderRepository) ProposeRevision(order *models.Order, revision *models.OrderRevision, event *models.OrderEvent) error {
+	args := m.Called(order, revision, event)
+	return args.Error(0)
+}
+
+func (m *MockOrderRepository) AcceptRevision(order *models.Order, revision *models.OrderRevision, event *models.OrderEvent) error {
+	args := m.Called(order, revision, event)
+	return args.Error(0)
+}
+
+func (m *MockOrderRepository) DeclineRevision(order *models.Order, revision *models.OrderRevision, event *models.OrderEvent) error {
+	args := m.Called(order, revision, event)
+	return args.Error(0)
+}
+
+func (m *MockOrderRepository) GetRevisions(orderID string) ([]models.OrderRevision, error) {
+	args := m.Called(orderID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.OrderRevision), args.Error(1)
+}
+
+func (m *MockOrderRepository) ReleaseExpiredReservations(now time.Time) (int, error) {
+	args := m.Called(now)
+	return args.Int(0), args.Error(1)
+}
+
 func (m *MockOrderRepository) GetByConsumerID(consumerID string, page, pageSize int) ([]models.Order, int, error) {
 	args := m.Called(consumerID, page, pageSize)
 	return args.Get(0).([]models.Order), args.Int(1), args.Error(2)
@@ -253,3 +302,216 @@ func TestOrderService_CreateOrder_ProductNotFound(t *testing.T) {
 	assert.Contains(t, err.Error(), "not found")
 }
 
+func TestCheckOrderTransition(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		role     string
+		expected error
+	}{
+		{"supplier accepts", models.OrderStatusPending, models.OrderStatusAccepted, "sales_rep", nil},
+		{"consumer cancels pending", models.OrderStatusPending, models.OrderStatusCancelled, "consumer", nil},
+		{"supplier prepares", models.OrderStatusAccepted, models.OrderStatusPreparing, "manager", nil},
+		{"consumer confirms delivery", models.OrderStatusDelivered, models.OrderStatusCompleted, "consumer", nil},
+		{"consumer may not accept", models.OrderStatusPending, models.OrderStatusAccepted, "consumer", ErrOrderTransitionForbidden},
+		{"supplier may not cancel pending", models.OrderStatusPending, models.OrderStatusCancelled, "owner", ErrOrderTransitionForbidden},
+		{"sales rep may not complete", models.OrderStatusDelivered, models.OrderStatusCompleted, "sales_rep", ErrOrderTransitionForbidden},
+		{"stages are not skipped", models.OrderStatusAccepted, models.OrderStatusDelivered, "owner", ErrIllegalOrderTransition},
+		{"no going back", models.OrderStatusPreparing, models.OrderStatusAccepted, "owner", ErrIllegalOrderTransition},
+		{"supplier cancels accepted", models.OrderStatusAccepted, models.OrderStatusCancelled, "manager", nil},
+		{"consumer may not cancel accepted", models.OrderStatusAccepted, models.OrderStatusCancelled, "consumer", ErrOrderTransitionForbidden},
+		{"sales rep may not cancel accepted", models.OrderStatusPreparing, models.OrderStatusCancelled, "sales_rep", ErrOrderTransitionForbidden},
+		{"orders on the road are not cancelled", models.OrderStatusOutForDelivery, models.OrderStatusCancelled, "owner", ErrIllegalOrderTransition},
+		{"rejected is final", models.OrderStatusRejected, models.OrderStatusAccepted, "owner", ErrIllegalOrderTransition},
+		{"unknown status", models.OrderStatusPending, "shipped", "owner", ErrIllegalOrderTransition},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkOrderTransition(tt.from, tt.to, tt.role)
+
+			if tt.expected == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestOrderService_AcceptOrder_RecordsEvent(t *testing.T) {
+	orderRepo := new(MockOrderRepository)
+	service := NewOrderService(orderRepo, new(MockProductRepository), nil, nil, nil)
+
+	order := &models.Order{
+		ID:         "order-1",
+		ConsumerID: "consumer-1",
+		SupplierID: "supplier-1",
+		Status:     models.OrderStatusPending,
+		Items:      []models.OrderItem{{ProductID: "product-1", Quantity: 5}},
+	}
+	orderRepo.On("GetByID", "order-1").Return(order, nil)
+	isAcceptance := mock.MatchedBy(func(event *models.OrderEvent) bool {
+		return *event.FromStatus == models.OrderStatusPending && event.ToStatus == models.OrderStatusAccepted &&
+			*event.ActorID == "rep-1" && event.ActorRole == "sales_rep" && event.Reason == nil
+	})
+	orderRepo.On("UpdateStatus", order, isAcceptance).Return(nil)
+
+	updated, err := service.AcceptOrder("order-1", OrderActor{ID: "rep-1", Role: "sales_rep", SupplierID: "supplier-1"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.OrderStatusAccepted, updated.Status)
+	orderRepo.AssertExpectations(t)
+}
+
+func TestOrderService_TransitionOrder_OtherSupplier(t *testing.T) {
+	orderRepo := new(MockOrderRepository)
+	service := NewOrderService(orderRepo, new(MockProductRepository), nil, nil, nil)
+
+	order := &models.Order{ID: "order-1", ConsumerID: "consumer-1", SupplierID: "supplier-1", Status: models.OrderStatusAccepted}
+	orderRepo.On("GetByID", "order-1").Return(order, nil)
+
+	_, err := service.TransitionOrder("order-1", OrderActor{ID: "rep-2", Role: "sales_rep", SupplierID: "supplier-2"}, models.OrderStatusPreparing, "")
+
+	assert.ErrorIs(t, err, ErrNotOrderParty)
+	orderRepo.AssertNotCalled(t, "UpdateStatus", mock.Anything, mock.Anything)
+}
+
+func TestOrderService_TransitionOrder_Illegal(t *testing.T) {
+	orderRepo := new(MockOrderRepository)
+	service := NewOrderService(orderRepo, new(MockProductRepository), nil, nil, nil)
+
+	order := &models.Order{ID: "order-1", ConsumerID: "consumer-1", SupplierID: "supplier-1", Status: models.OrderStatusPreparing}
+	orderRepo.On("GetByID", "order-1").Return(order, nil)
+
+	_, err := service.TransitionOrder("order-1", OrderActor{ID: "rep-1", Role: "sales_rep", SupplierID: "supplier-1"}, models.OrderStatusDelivered, "")
+
+	assert.ErrorIs(t, err, ErrIllegalOrderTransition)
+	assert.Equal(t, models.OrderStatusPreparing, order.Status)
+	orderRepo.AssertNotCalled(t, "UpdateStatus", mock.Anything, mock.Anything)
+}
+
+func TestOrderService_TransitionOrder_NotFound(t *testing.T) {
+	orderRepo := new(MockOrderRepository)
+	service := NewOrderService(orderRepo, new(MockProductRepository), nil, nil, nil)
+
+	orderRepo.On("GetByID", "missing").Return(nil, errors.New("sql: no rows in result set"))
+
+	_, err := service.TransitionOrder("missing", OrderActor{ID: "consumer-1", Role: "consumer"}, models.OrderStatusCancelled, "Changed my mind")
+
+	assert.ErrorIs(t, err, ErrOrderNotFound)
+}
+
+func TestOrderService_TransitionOrder_CancelRequiresReason(t *testing.T) {
+	orderRepo := new(MockOrderRepository)
+	service := NewOrderService(orderRepo, new(MockProductRepository), nil, nil, nil)
+
+	order := &models.Order{ID: "order-1", ConsumerID: "consumer-1", SupplierID: "supplier-1", Status: models.OrderStatusPending}
+	orderRepo.On("GetByID", "order-1").Return(order, nil)
+
+	_, err := service.TransitionOrder("order-1", OrderActor{ID: "consumer-1", Role: "consumer"}, models.OrderStatusCancelled, "  ")
+
+	assert.ErrorIs(t, err, ErrOrderReasonRequired)
+	orderRepo.AssertNotCalled(t, "UpdateStatus", mock.Anything, mock.Anything)
+}
+
+func TestOrderService_RejectOrder_RecordsReason(t *testing.T) {
+	orderRepo := new(MockOrderRepository)
+	service := NewOrderService(orderRepo, new(MockProductRepository), nil, nil, nil)
+
+	order := &models.Order{ID: "order-1", ConsumerID: "consumer-1", SupplierID: "supplier-1", Status: models.OrderStatusPending}
+	orderRepo.On("GetByID", "order-1").Return(order, nil)
+	hasReason := mock.MatchedBy(func(event *models.OrderEvent) bool {
+		return event.ToStatus == models.OrderStatusRejected && event.Reason != nil && *event.Reason == "Out of season"
+	})
+	orderRepo.On("UpdateStatus", order, hasReason).Return(nil)
+
+	_, err := service.RejectOrder("order-1", OrderActor{ID: "owner-1", Role: "owner", SupplierID: "supplier-1"}, " Out of season ")
+
+	assert.NoError(t, err)
+	orderRepo.AssertExpectations(t)
+}
+
+func TestOrderService_Timeline(t *testing.T) {
+	orderRepo := new(MockOrderRepository)
+	service := NewOrderService(orderRepo, new(MockProductRepository), nil, nil, nil)
+
+	order := &models.Order{ID: "order-1", ConsumerID: "consumer-1", SupplierID: "supplier-1"}
+	orderRepo.On("GetByID", "order-1").Return(order, nil)
+	orderRepo.On("GetEvents", "order-1").Return([]models.OrderEvent{{ID: "event-1", ToStatus: models.OrderStatusPending}}, nil)
+
+	events, err := service.Timeline("order-1", OrderActor{ID: "consumer-1", Role: "consumer"})
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+
+	_, err = service.Timeline("order-1", OrderActor{ID: "consumer-2", Role: "consumer"})
+	assert.ErrorIs(t, err, ErrNotOrderParty)
+}
+
+func TestOrderService_AcceptOrder_InsufficientStock(t *testing.T) {
+	orderRepo := new(MockOrderRepository)
+	service := NewOrderService(orderRepo, new(MockProductRepository), nil, nil, nil)
+
+	order := &models.Order{ID: "order-1", ConsumerID: "consumer-1", SupplierID: "supplier-1", Status: models.OrderStatusPending}
+	orderRepo.On("GetByID", "order-1").Return(order, nil)
+	orderRepo.On("UpdateStatus", order, mock.Anything).Return(fmt.Errorf("%w for product Tomatoes", repository.ErrInsufficientStock))
+
+	_, err := service.AcceptOrder("order-1", OrderActor{ID: "rep-1", Role: "sales_rep", SupplierID: "supplier-1"})
+
+	assert.ErrorIs(t, err, repository.ErrInsufficientStock)
+	assert.Equal(t, models.OrderStatusPending, order.Status)
+}
+
+func TestOrderService_AcceptOrder_ChangedMeanwhile(t *testing.T) {
+	orderRepo := new(MockOrderRepository)
+	service := NewOrderService(orderRepo, new(MockProductRepository), nil, nil, nil)
+
+	order := &models.Order{ID: "order-1", ConsumerID: "consumer-1", SupplierID: "supplier-1", Status: models.OrderStatusPending}
+	orderRepo.On("GetByID", "order-1").Return(order, nil)
+	orderRepo.On("UpdateStatus", order, mock.Anything).Return(fmt.Errorf("%w: order is now cancelled", repository.ErrOrderStatusChanged))
+
+	_, err := service.AcceptOrder("order-1", OrderActor{ID: "rep-1", Role: "sales_rep", SupplierID: "supplier-1"})
+
+	assert.ErrorIs(t, err, ErrIllegalOrderTransition)
+}
+
+func TestOrderService_CreateOrder_ReservesStock(t *testing.T) {
+	orderRepo := new(MockOrderRepository)
+	productRepo := new(MockProductRepository)
+	service := NewOrderService(orderRepo, productRepo, nil, nil, nil)
+	service.SetStockReservation(30 * time.Minute)
+
+	productRepo.On("GetByID", "product-1").Return(&models.Product{ID: "product-1", SupplierID: "supplier-1", Price: 10, StockLevel: 50, MinOrderQuantity: 1}, nil)
+	isReserved := mock.MatchedBy(func(order *models.Order) bool {
+		return order.StockReservedUntil != nil && time.Until(*order.StockReservedUntil) > 29*time.Minute
+	})
+	orderRepo.On("Create", isReserved).Return(nil)
+
+	order, err := service.CreateOrder("consumer-1", CreateOrderRequest{
+		SupplierID: "supplier-1",
+		Items:      []OrderItemRequest{{ProductID: "product-1", Quantity: 5}},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 50.0, order.Subtotal)
+	orderRepo.AssertExpectations(t)
+}
+
+func TestOrderService_CreateOrder_WithoutReservation(t *testing.T) {
+	orderRepo := new(MockOrderRepository)
+	productRepo := new(MockProductRepository)
+	service := NewOrderService(orderRepo, productRepo, nil, nil, nil)
+
+	productRepo.On("GetByID", "product-1").Return(&models.Product{ID: "product-1", SupplierID: "supplier-1", Price: 10, StockLevel: 50, MinOrderQuantity: 1}, nil)
+	orderRepo.On("Create", mock.MatchedBy(func(order *models.Order) bool {
+		return order.StockReservedUntil == nil
+	})).Return(nil)
+
+	_, err := service.CreateOrder("consumer-1", CreateOrderRequest{
+		SupplierID: "supplier-1",
+		Items:      []OrderItemRequest{{ProductID: "product-1", Quantity: 5}},
+	})
+
+	assert.NoError(t, err)
+	orderRepo.AssertExpectations(t)
+}
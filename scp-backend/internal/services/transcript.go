@@ -0,0 +1,252 @@
+package services
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scp-platform/backend/internal/models"
+	"github.com/scp-platform/backend/pkg/pdf"
+)
+
+// Transcript formats.
+const (
+	TranscriptJSON = "json"
+	TranscriptCSV  = "csv"
+	TranscriptHTML = "html"
+	TranscriptPDF  = "pdf"
+)
+
+var ErrUnknownTranscriptFormat = errors.New("format must be json, csv, html or pdf")
+
+// transcriptTimeFormat is how HTML and PDF transcripts show times.
+const transcriptTimeFormat = "2006-01-02 15:04:05 MST"
+
+// Transcript is the record of a conversation as its consumer saw it, with
+// times in the supplier's time zone.
+type Transcript struct {
+	ConversationID string            `json:"conversation_id"`
+	Subject        string            `json:"subject"`
+	SupplierName   string            `json:"supplier_name"`
+	ConsumerName   string            `json:"consumer_name"`
+	Timezone       string            `json:"timezone"`
+	ExportedAt     time.Time         `json:"exported_at"`
+	Messages       []TranscriptEntry `json:"messages"`
+}
+
+// TranscriptEntry is one message of a transcript.
+type TranscriptEntry struct {
+	ID            string     `json:"id"`
+	SentAt        time.Time  `json:"sent_at"`
+	SenderName    string     `json:"sender_name"`
+	SenderRole    string     `json:"sender_role"`
+	Kind          string     `json:"kind"`
+	Content       string     `json:"content"`
+	AttachmentURL string     `json:"attachment_url,omitempty"`
+	EditedAt      *time.Time `json:"edited_at,omitempty"`
+	Deleted       bool       `json:"deleted"`
+}
+
+// Transcript builds the transcript of a conversation from its messages,
+// oldest first. Attachment links stored relative to the API are made
+// absolute with baseURL.
+func (s *ChatService) Transcript(conversation *models.Conversation, messages []models.Message, baseURL string, now time.Time) (*Transcript, error) {
+	supplier, err := s.supplierRepo.GetByID(conversation.SupplierID)
+	if err != nil {
+		return nil, err
+	}
+	location := time.UTC
+	if supplier.Timezone != "" {
+		if loaded, err := time.LoadLocation(supplier.Timezone); err == nil {
+			location = loaded
+		}
+	}
+
+	transcript := &Transcript{
+		ConversationID: conversation.ID,
+		Subject:        "General",
+		SupplierName:   supplier.Name,
+		ConsumerName:   "Consumer",
+		Timezone:       location.String(),
+		ExportedAt:     now.In(location),
+		Messages:       make([]TranscriptEntry, 0, len(messages)),
+	}
+	if conversation.Subject != nil && *conversation.Subject != "" {
+		transcript.Subject = *conversation.Subject
+	}
+	if consumer, err := s.userRepo.GetByID(conversation.ConsumerID); err == nil && consumer != nil {
+		transcript.ConsumerName = displayName(consumer)
+	}
+
+	for _, message := range messages {
+		entry := TranscriptEntry{
+			ID:         message.ID,
+			SentAt:     message.CreatedAt.In(location),
+			SenderName: transcriptSender(&message),
+			SenderRole: message.SenderRole,
+			Kind:       message.Kind,
+			Content:    message.Content,
+			Deleted:    message.DeletedAt != nil,
+		}
+		if message.Sender != nil && message.Sender.Role != "" && message.SenderRole != models.SenderRoleSystem {
+			entry.SenderRole = message.Sender.Role
+		}
+		if entry.Kind == "" {
+			entry.Kind = models.MessageKindText
+		}
+		if message.EditedAt != nil {
+			editedAt := message.EditedAt.In(location)
+			entry.EditedAt = &editedAt
+		}
+		if message.AttachmentURL != nil && *message.AttachmentURL != "" {
+			entry.AttachmentURL = *message.AttachmentURL
+			if strings.HasPrefix(entry.AttachmentURL, "/") {
+				entry.AttachmentURL = strings.TrimSuffix(baseURL, "/") + entry.AttachmentURL
+			}
+		}
+		transcript.Messages = append(transcript.Messages, entry)
+	}
+	return transcript, nil
+}
+
+func transcriptSender(message *models.Message) string {
+	switch {
+	case message.SenderRole == models.SenderRoleSystem:
+		return "System"
+	case message.SenderID == "":
+		return "Deleted user"
+	case message.Sender == nil:
+		return "User " + message.SenderID
+	case message.Sender.Role == "consumer":
+		return displayName(message.Sender)
+	default:
+		return personName(message.Sender)
+	}
+}
+
+// Write writes the transcript in a format: JSON, CSV, a self-contained
+// HTML page or a PDF.
+func (t *Transcript) Write(w io.Writer, format string) error {
+	switch format {
+	case TranscriptJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(t)
+	case TranscriptCSV:
+		return t.writeCSV(w)
+	case TranscriptHTML:
+		return transcriptTemplate.Execute(w, t)
+	case TranscriptPDF:
+		return t.writePDF(w)
+	default:
+		return ErrUnknownTranscriptFormat
+	}
+}
+
+func (t *Transcript) writeCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"sent_at", "sender_name", "sender_role", "kind", "content", "attachment_url", "edited_at", "deleted"})
+	for _, entry := range t.Messages {
+		editedAt := ""
+		if entry.EditedAt != nil {
+			editedAt = entry.EditedAt.Format(time.RFC3339)
+		}
+		writer.Write([]string{
+			entry.SentAt.Format(time.RFC3339),
+			csvText(entry.SenderName),
+			entry.SenderRole,
+			entry.Kind,
+			csvText(entry.Content),
+			csvText(entry.AttachmentURL),
+			editedAt,
+			strconv.FormatBool(entry.Deleted),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// csvText keeps text users wrote from being read as a formula when the CSV
+// is opened in a spreadsheet, by starting it with a quote if it begins with
+// a character spreadsheets take to start one.
+func csvText(text string) string {
+	if text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
+
+func (t *Transcript) writePDF(w io.Writer) error {
+	doc := pdf.New(t.Subject)
+	doc.Text(pdf.StyleHeading, fmt.Sprintf("%s – %s", t.SupplierName, t.ConsumerName))
+	doc.Text(pdf.StyleBody, t.Subject)
+	doc.Text(pdf.StyleMuted, fmt.Sprintf("Conversation %s, exported %s. Times are in %s.", t.ConversationID, t.ExportedAt.Format(transcriptTimeFormat), t.Timezone))
+	doc.Space(12)
+
+	for _, entry := range t.Messages {
+		doc.Text(pdf.StyleLabel, fmt.Sprintf("%s (%s)", entry.SenderName, entry.SenderRole))
+		doc.Text(pdf.StyleMuted, entry.Meta())
+		switch {
+		case entry.Deleted:
+			doc.Text(pdf.StyleMuted, "This message was deleted.")
+		case entry.Content != "":
+			doc.Text(pdf.StyleBody, entry.Content)
+		}
+		if entry.AttachmentURL != "" {
+			doc.Text(pdf.StyleBody, "Attachment: "+entry.AttachmentURL)
+		}
+		doc.Space(8)
+	}
+
+	_, err := doc.WriteTo(w)
+	return err
+}
+
+// Meta is the line under the sender in HTML and PDF transcripts: when the
+// message was sent and, if so, edited, and its kind unless it is text.
+func (e TranscriptEntry) Meta() string {
+	meta := e.SentAt.Format(transcriptTimeFormat)
+	if e.Kind != models.MessageKindText {
+		meta += " · " + e.Kind
+	}
+	if e.EditedAt != nil {
+		meta += " · edited " + e.EditedAt.Format(transcriptTimeFormat)
+	}
+	return meta
+}
+
+var transcriptTemplate = template.Must(template.New("transcript").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Subject}} – {{.SupplierName}} and {{.ConsumerName}}</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; max-width: 760px; margin: 2em auto; color: #222; }
+header { border-bottom: 1px solid #ccc; margin-bottom: 1.5em; }
+.muted { color: #777; font-size: 0.85em; }
+.message { margin-bottom: 1.2em; }
+.sender { font-weight: bold; }
+.content { white-space: pre-wrap; margin-top: 0.3em; }
+.system .content, .deleted .content { font-style: italic; color: #555; }
+</style>
+</head>
+<body>
+<header>
+<h1>{{.SupplierName}} – {{.ConsumerName}}</h1>
+<p>{{.Subject}}</p>
+<p class="muted">Conversation {{.ConversationID}}, exported {{.ExportedAt.Format "2006-01-02 15:04:05 MST"}}. Times are in {{.Timezone}}.</p>
+</header>
+{{range .Messages}}<div class="message {{.Kind}}{{if .Deleted}} deleted{{end}}" id="message-{{.ID}}">
+<div><span class="sender">{{.SenderName}}</span> <span class="muted">({{.SenderRole}}) {{.Meta}}</span></div>
+<div class="content">{{if .Deleted}}This message was deleted.{{else}}{{.Content}}{{end}}</div>
+{{if .AttachmentURL}}<div><a href="{{.AttachmentURL}}">{{.AttachmentURL}}</a></div>
+{{end}}</div>
+{{end}}</body>
+</html>
+`))
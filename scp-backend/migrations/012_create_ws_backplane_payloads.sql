@@ -0,0 +1,11 @@
+-- Create ws_backplane_payloads table
+-- Holds WebSocket events too large for a Postgres NOTIFY payload (8000 bytes).
+-- Rows are short-lived: instances fetch them by ID and purge old ones.
+CREATE TABLE IF NOT EXISTS ws_backplane_payloads (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    payload BYTEA NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_ws_backplane_payloads_created_at ON ws_backplane_payloads(created_at);
+
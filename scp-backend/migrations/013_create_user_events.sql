@@ -0,0 +1,20 @@
+-- Create user event stream tables
+-- user_event_streams holds each user's latest sequence number; bumping it
+-- locks the row, so a user's events commit in sequence order.
+CREATE TABLE IF NOT EXISTS user_event_streams (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    last_seq BIGINT NOT NULL DEFAULT 0
+);
+
+-- user_events keeps recent realtime events for replay after a reconnect.
+CREATE TABLE IF NOT EXISTS user_events (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    seq BIGINT NOT NULL,
+    type VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, seq)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_events_created_at ON user_events(created_at);
+
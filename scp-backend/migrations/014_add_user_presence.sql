@@ -0,0 +1,6 @@
+-- Add presence tracking to users
+-- last_seen_at is bumped about once a minute while a user is connected, so a
+-- presence that has not been refreshed for a few minutes is read as offline.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS presence VARCHAR(10) NOT NULL DEFAULT 'offline'
+    CHECK (presence IN ('online', 'away', 'offline'));
+ALTER TABLE users ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMP;
@@ -0,0 +1,2 @@
+-- Index conversation history by (created_at, id) for keyset pagination
+CREATE INDEX IF NOT EXISTS idx_messages_conversation_created_id ON messages(conversation_id, created_at, id);
@@ -0,0 +1,35 @@
+-- Create conversation_read_cursors table
+-- Each participant's read position: the newest message they have read,
+-- ordered like message history by (created_at, id). Unread counts are the
+-- other side's messages past the cursor, so reps sharing a supplier inbox
+-- each keep their own.
+CREATE TABLE IF NOT EXISTS conversation_read_cursors (
+    conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    last_read_message_id UUID NOT NULL,
+    last_read_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (conversation_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_conversation_read_cursors_user_id ON conversation_read_cursors(user_id);
+
+-- Start consumers at the newest staff message already marked read
+INSERT INTO conversation_read_cursors (conversation_id, user_id, last_read_message_id, last_read_at)
+SELECT DISTINCT ON (c.id) c.id, c.consumer_id, m.id, m.created_at
+FROM conversations c
+JOIN messages m ON m.conversation_id = c.id AND m.sender_role = 'sales_rep' AND m.is_read = true
+ORDER BY c.id, m.created_at DESC, m.id DESC
+ON CONFLICT (conversation_id, user_id) DO NOTHING;
+
+-- ...and every staff member at the newest consumer message already marked read
+INSERT INTO conversation_read_cursors (conversation_id, user_id, last_read_message_id, last_read_at)
+SELECT DISTINCT ON (c.id, u.id) c.id, u.id, m.id, m.created_at
+FROM conversations c
+JOIN users u ON u.supplier_id = c.supplier_id AND u.role IN ('owner', 'manager', 'sales_rep')
+JOIN messages m ON m.conversation_id = c.id AND m.sender_role = 'consumer' AND m.is_read = true
+ORDER BY c.id, u.id, m.created_at DESC, m.id DESC
+ON CONFLICT (conversation_id, user_id) DO NOTHING;
+
+-- Unread counts are now derived from the cursors
+ALTER TABLE conversations DROP COLUMN IF EXISTS unread_count;
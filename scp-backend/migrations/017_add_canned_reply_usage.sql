@@ -0,0 +1,4 @@
+-- Count how often each canned reply is sent, so managers can see which
+-- templates their team relies on
+ALTER TABLE canned_replies ADD COLUMN IF NOT EXISTS usage_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE canned_replies ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMP;
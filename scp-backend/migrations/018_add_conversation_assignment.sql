@@ -0,0 +1,16 @@
+-- Assign each conversation to a member of the supplier's staff
+-- assigned_at is set when a conversation is routed or reassigned and stays
+-- set when a manager unassigns it, so it is only routed automatically once.
+ALTER TABLE conversations ADD COLUMN IF NOT EXISTS assigned_user_id UUID REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE conversations ADD COLUMN IF NOT EXISTS assigned_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_conversations_assigned_user_id ON conversations(assigned_user_id);
+
+-- How new conversations are routed among the supplier's sales reps
+ALTER TABLE suppliers ADD COLUMN IF NOT EXISTS routing_strategy VARCHAR(20) NOT NULL DEFAULT 'least_loaded'
+    CHECK (routing_strategy IN ('round_robin', 'least_loaded'));
+
+-- Assignment changes are announced in the thread by system messages
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS messages_sender_role_check;
+ALTER TABLE messages ADD CONSTRAINT messages_sender_role_check
+    CHECK (sender_role IN ('consumer', 'sales_rep', 'system'));
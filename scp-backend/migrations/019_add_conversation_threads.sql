@@ -0,0 +1,17 @@
+-- Allow several threads per consumer and supplier
+-- Every pair keeps one general thread (existing conversations become it) and
+-- may open one thread per order and per complaint.
+ALTER TABLE conversations ADD COLUMN IF NOT EXISTS topic VARCHAR(20) NOT NULL DEFAULT 'general'
+    CHECK (topic IN ('general', 'order', 'complaint'));
+ALTER TABLE conversations ADD COLUMN IF NOT EXISTS subject VARCHAR(255);
+ALTER TABLE conversations ADD COLUMN IF NOT EXISTS order_id UUID REFERENCES orders(id) ON DELETE SET NULL;
+ALTER TABLE conversations ADD COLUMN IF NOT EXISTS complaint_id UUID REFERENCES complaints(id) ON DELETE SET NULL;
+
+ALTER TABLE conversations DROP CONSTRAINT IF EXISTS conversations_consumer_id_supplier_id_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_conversations_general_thread
+    ON conversations(consumer_id, supplier_id) WHERE topic = 'general';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_conversations_order_thread
+    ON conversations(order_id) WHERE topic = 'order';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_conversations_complaint_thread
+    ON conversations(complaint_id) WHERE topic = 'complaint';
@@ -0,0 +1,18 @@
+-- Typed messages: each kind carries its own JSON payload
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS kind VARCHAR(20) NOT NULL DEFAULT 'text'
+    CHECK (kind IN ('text', 'attachment', 'product_ref', 'order_ref', 'system'));
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS payload JSONB NOT NULL DEFAULT '{}';
+
+UPDATE messages SET kind = 'system' WHERE sender_role = 'system' AND kind = 'text';
+UPDATE messages SET kind = 'attachment', payload = jsonb_build_object('url', attachment_url)
+WHERE attachment_url IS NOT NULL AND attachment_url <> '' AND kind = 'text';
+
+-- Escalations used to be posted as if the rep had written them
+UPDATE messages SET kind = 'system', sender_role = 'system', is_read = true,
+    payload = jsonb_build_object('event', 'complaint_escalated')
+WHERE content = 'this problem escalated to manager' AND kind = 'text';
+
+-- Only the platform posts system messages, and everything it posts is one
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS messages_system_kind_check;
+ALTER TABLE messages ADD CONSTRAINT messages_system_kind_check
+    CHECK ((kind = 'system') = (sender_role = 'system'));
@@ -0,0 +1,6 @@
+-- Staff-only notes in the conversation timeline
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS messages_kind_check;
+ALTER TABLE messages ADD CONSTRAINT messages_kind_check
+    CHECK (kind IN ('text', 'attachment', 'product_ref', 'order_ref', 'system', 'internal_note'));
+
+CREATE INDEX IF NOT EXISTS idx_messages_internal_notes ON messages(conversation_id) WHERE kind = 'internal_note';
@@ -0,0 +1,17 @@
+-- Supplier business hours and away replies
+-- business_hours holds the weekly opening hours as [{"day", "open", "close"}]
+-- in the supplier's time zone, and holidays the dates that differ from them
+-- as [{"date", "name", "open", "close"}]. Without business hours a supplier
+-- is always open.
+ALTER TABLE suppliers ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) NOT NULL DEFAULT 'UTC';
+ALTER TABLE suppliers ADD COLUMN IF NOT EXISTS business_hours JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE suppliers ADD COLUMN IF NOT EXISTS holidays JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE suppliers ADD COLUMN IF NOT EXISTS away_message TEXT;
+
+-- When the away message was last posted, so it is posted once per
+-- conversation in each off-hours window
+ALTER TABLE conversations ADD COLUMN IF NOT EXISTS away_replied_at TIMESTAMP;
+
+-- Staff out of office are not routed new conversations
+ALTER TABLE users ADD COLUMN IF NOT EXISTS out_of_office BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS out_of_office_until TIMESTAMP;
@@ -0,0 +1,6 @@
+-- Fulfilment stages between acceptance and completion:
+-- pending -> accepted -> preparing -> out_for_delivery -> delivered -> completed,
+-- with rejected and cancelled as the other ends
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_status_check;
+ALTER TABLE orders ADD CONSTRAINT orders_status_check
+    CHECK (status IN ('pending', 'accepted', 'preparing', 'out_for_delivery', 'delivered', 'completed', 'rejected', 'cancelled'));
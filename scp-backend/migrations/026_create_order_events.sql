@@ -0,0 +1,20 @@
+-- Every status change of an order: who made it, in which role, and why
+CREATE TABLE IF NOT EXISTS order_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    from_status VARCHAR(20),
+    to_status VARCHAR(20) NOT NULL,
+    actor_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    actor_role VARCHAR(20) NOT NULL,
+    reason TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_events_order_id ON order_events(order_id, created_at);
+
+-- Orders placed before events were recorded start their timeline when
+-- they were placed
+INSERT INTO order_events (order_id, from_status, to_status, actor_id, actor_role, created_at)
+SELECT o.id, NULL, 'pending', o.consumer_id, 'consumer', o.created_at
+FROM orders o
+WHERE NOT EXISTS (SELECT 1 FROM order_events e WHERE e.order_id = o.id);
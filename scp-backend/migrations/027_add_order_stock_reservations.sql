@@ -0,0 +1,7 @@
+-- Stock can be held for a pending order from the moment it is placed. While
+-- stock_reserved_until is set, the order's quantities have been taken out of
+-- products.stock_level; they go back when the hold expires or the order is
+-- rejected or cancelled, and stay out when it is accepted.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS stock_reserved_until TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_orders_stock_reserved_until ON orders(stock_reserved_until) WHERE stock_reserved_until IS NOT NULL;
@@ -0,0 +1,11 @@
+-- Consumers ask to cancel orders the supplier has already accepted; the
+-- supplier approves or declines
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS cancellation_requested_at TIMESTAMP;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS cancellation_reason TEXT;
+
+-- Order timelines also show cancellation requests and declines, which do
+-- not change the status
+ALTER TABLE order_events ADD COLUMN IF NOT EXISTS kind VARCHAR(30) NOT NULL DEFAULT 'status_changed';
+ALTER TABLE order_events DROP CONSTRAINT IF EXISTS order_events_kind_check;
+ALTER TABLE order_events ADD CONSTRAINT order_events_kind_check
+    CHECK (kind IN ('status_changed', 'cancellation_requested', 'cancellation_declined'));
@@ -0,0 +1,53 @@
+-- Every version of an order's lines: the order as placed, then each
+-- counter-offer a supplier makes while the order is pending
+CREATE TABLE IF NOT EXISTS order_revisions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    status VARCHAR(20) NOT NULL CHECK (status IN ('placed', 'proposed', 'accepted', 'declined', 'withdrawn')),
+    proposed_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    proposed_by_role VARCHAR(20) NOT NULL,
+    reason TEXT,
+    subtotal DECIMAL(10, 2) NOT NULL,
+    tax DECIMAL(10, 2) NOT NULL,
+    shipping_fee DECIMAL(10, 2) NOT NULL,
+    total DECIMAL(10, 2) NOT NULL,
+    decided_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    decided_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (order_id, version)
+);
+
+-- At most one counter-offer is open per order
+CREATE UNIQUE INDEX IF NOT EXISTS idx_order_revisions_proposed ON order_revisions(order_id) WHERE status = 'proposed';
+
+CREATE TABLE IF NOT EXISTS order_revision_items (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    revision_id UUID NOT NULL REFERENCES order_revisions(id) ON DELETE CASCADE,
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    unit_price DECIMAL(10, 2) NOT NULL,
+    subtotal DECIMAL(10, 2) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_revision_items_revision_id ON order_revision_items(revision_id);
+
+-- Orders placed before revisions were kept start with their current lines
+INSERT INTO order_revisions (order_id, version, status, proposed_by, proposed_by_role, subtotal, tax, shipping_fee, total, created_at)
+SELECT o.id, 1, 'placed', o.consumer_id, 'consumer', o.subtotal, o.tax, o.shipping_fee, o.total, o.created_at
+FROM orders o
+WHERE NOT EXISTS (SELECT 1 FROM order_revisions r WHERE r.order_id = o.id);
+
+INSERT INTO order_revision_items (revision_id, product_id, quantity, unit_price, subtotal, created_at)
+SELECT r.id, oi.product_id, oi.quantity, oi.unit_price, oi.subtotal, oi.created_at
+FROM order_revisions r
+JOIN order_items oi ON oi.order_id = r.order_id
+WHERE r.version = 1
+  AND NOT EXISTS (SELECT 1 FROM order_revision_items ri WHERE ri.revision_id = r.id);
+
+-- Order timelines also show counter-offers and the consumer's answer
+ALTER TABLE order_events DROP CONSTRAINT IF EXISTS order_events_kind_check;
+ALTER TABLE order_events ADD CONSTRAINT order_events_kind_check
+    CHECK (kind IN ('status_changed', 'cancellation_requested', 'cancellation_declined',
+                    'counter_offered', 'counter_offer_accepted', 'counter_offer_declined'));
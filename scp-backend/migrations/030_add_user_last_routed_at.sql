@@ -0,0 +1,17 @@
+-- When a sales rep was last routed a conversation, for round-robin routing.
+-- Kept on the rep so that handing a conversation off does not put them back
+-- at the front of the queue.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS last_routed_at TIMESTAMP;
+
+UPDATE users u
+SET last_routed_at = sq.last_assigned_at
+FROM (
+  SELECT assigned_user_id, MAX(assigned_at) AS last_assigned_at
+  FROM conversations
+  WHERE assigned_user_id IS NOT NULL
+  GROUP BY assigned_user_id
+) sq
+WHERE u.id = sq.assigned_user_id AND u.last_routed_at IS NULL;
+
+-- Routing counts each rep's recently active conversations
+CREATE INDEX IF NOT EXISTS idx_conversations_assigned_activity ON conversations(assigned_user_id, last_message_at);
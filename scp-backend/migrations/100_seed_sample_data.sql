@@ -54,11 +54,11 @@ VALUES
   ('b1111115-1111-1111-1111-111111111111', 'f1111111-1111-1111-1111-111111111111', '22222222-2222-2222-2222-222222222222', 'cancelled', now() - INTERVAL '20 days', now() - INTERVAL '19 days')
 ON CONFLICT (consumer_id, supplier_id) DO NOTHING;
 
--- Conversations (single conversation for chat/complaints)
-INSERT INTO conversations (id, consumer_id, supplier_id, last_message_at, unread_count, created_at)
+-- Conversations (the general thread for chat/complaints)
+INSERT INTO conversations (id, consumer_id, supplier_id, last_message_at, created_at)
 VALUES
-  ('c1111111-1111-1111-1111-111111111111', 'f1111111-1111-1111-1111-111111111111', '11111111-1111-1111-1111-111111111111', now() - INTERVAL '1 hour', 0, now() - INTERVAL '10 days')
-ON CONFLICT (consumer_id, supplier_id) DO NOTHING;
+  ('c1111111-1111-1111-1111-111111111111', 'f1111111-1111-1111-1111-111111111111', '11111111-1111-1111-1111-111111111111', now() - INTERVAL '1 hour', now() - INTERVAL '10 days')
+ON CONFLICT (consumer_id, supplier_id) WHERE topic = 'general' DO NOTHING;
 
 -- Messages (minimal chat history)
 INSERT INTO messages (id, conversation_id, sender_id, sender_role, content, is_read, created_at)
@@ -98,6 +98,20 @@ VALUES
   ('e1111115-1111-1111-1111-111111111111', 'd1111115-1111-1111-1111-111111111115', 'a1111111-1111-1111-1111-111111111111', 4, 24.99, 99.96, now() - INTERVAL '1 day')
 ON CONFLICT (id) DO NOTHING;
 
+-- Order timelines (placed, then each status change)
+INSERT INTO order_events (id, order_id, from_status, to_status, actor_id, actor_role, reason, created_at)
+VALUES
+  ('0e111111-1111-1111-1111-111111111111', 'd1111111-1111-1111-1111-111111111111', NULL, 'pending', 'f1111111-1111-1111-1111-111111111111', 'consumer', NULL, now() - INTERVAL '1 day'),
+  ('0e111112-1111-1111-1111-111111111111', 'd1111112-1111-1111-1111-111111111112', NULL, 'pending', 'f1111111-1111-1111-1111-111111111111', 'consumer', NULL, now() - INTERVAL '2 days'),
+  ('0e111112-2222-1111-1111-111111111111', 'd1111112-1111-1111-1111-111111111112', 'pending', 'accepted', 'a2222222-2222-2222-2222-222222222222', 'manager', NULL, now() - INTERVAL '1 day'),
+  ('0e111113-1111-1111-1111-111111111111', 'd1111113-1111-1111-1111-111111111113', NULL, 'pending', 'f1111111-1111-1111-1111-111111111111', 'consumer', NULL, now() - INTERVAL '8 days'),
+  ('0e111113-2222-1111-1111-111111111111', 'd1111113-1111-1111-1111-111111111113', 'delivered', 'completed', 'f1111111-1111-1111-1111-111111111111', 'consumer', 'Delivered and signed off without issues.', now() - INTERVAL '7 days'),
+  ('0e111114-1111-1111-1111-111111111111', 'd1111114-1111-1111-1111-111111111114', NULL, 'pending', 'f1111111-1111-1111-1111-111111111111', 'consumer', NULL, now() - INTERVAL '4 days'),
+  ('0e111114-2222-1111-1111-111111111111', 'd1111114-1111-1111-1111-111111111114', 'pending', 'rejected', NULL, 'owner', 'Quantity mismatch with what we can deliver.', now() - INTERVAL '3 days'),
+  ('0e111115-1111-1111-1111-111111111111', 'd1111115-1111-1111-1111-111111111115', NULL, 'pending', 'f1111111-1111-1111-1111-111111111111', 'consumer', NULL, now() - INTERVAL '1 day'),
+  ('0e111115-2222-1111-1111-111111111111', 'd1111115-1111-1111-1111-111111111115', 'pending', 'cancelled', 'f1111111-1111-1111-1111-111111111111', 'consumer', 'Cancelled prior to shipment.', now())
+ON CONFLICT (id) DO NOTHING;
+
 -- Complaints (single complaint for escalation/resolution testing)
 INSERT INTO complaints (id, conversation_id, consumer_id, supplier_id, order_id, title, description, priority, status, created_at)
 VALUES
@@ -129,6 +143,19 @@ FROM (
 ) sq
 WHERE o.id = sq.order_id;
 
+-- Each order's lines as placed start its revision history
+INSERT INTO order_revisions (order_id, version, status, proposed_by, proposed_by_role, subtotal, tax, shipping_fee, total, created_at)
+SELECT o.id, 1, 'placed', o.consumer_id, 'consumer', o.subtotal, o.tax, o.shipping_fee, o.total, o.created_at
+FROM orders o
+WHERE NOT EXISTS (SELECT 1 FROM order_revisions r WHERE r.order_id = o.id);
+
+INSERT INTO order_revision_items (revision_id, product_id, quantity, unit_price, subtotal, created_at)
+SELECT r.id, oi.product_id, oi.quantity, oi.unit_price, oi.subtotal, oi.created_at
+FROM order_revisions r
+JOIN order_items oi ON oi.order_id = r.order_id
+WHERE r.version = 1
+  AND NOT EXISTS (SELECT 1 FROM order_revision_items ri WHERE ri.revision_id = r.id);
+
 -- Mark last_message_at on conversations (set to the latest message created_at per conversation)
 UPDATE conversations c
 SET last_message_at = sub.max_created_at
@@ -139,15 +166,12 @@ FROM (
 ) sub
 WHERE c.id = sub.conversation_id;
 
--- Update unread_count in conversations
-UPDATE conversations c
-SET unread_count = sub.unread_count
-FROM (
-  SELECT conversation_id, COUNT(*) AS unread_count
-  FROM messages
-  WHERE is_read = false
-  GROUP BY conversation_id
-) sub
-WHERE c.id = sub.conversation_id;
+-- Read cursors: both sides have read the seeded conversation
+INSERT INTO conversation_read_cursors (conversation_id, user_id, last_read_message_id, last_read_at)
+SELECT m.conversation_id, u.id, m.id, m.created_at
+FROM messages m
+JOIN users u ON u.id = 'f1111111-1111-1111-1111-111111111111' OR u.supplier_id = '11111111-1111-1111-1111-111111111111'
+WHERE m.id = 'c2111113-1111-1111-1111-111111111111'
+ON CONFLICT (conversation_id, user_id) DO NOTHING;
 
 -- End of seed
@@ -0,0 +1,259 @@
+// Package pdf writes plain text documents as PDF. It only uses the standard
+// Helvetica fonts, which every PDF reader has, so nothing is embedded and
+// text outside Windows-1252 is replaced with "?".
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A4 page size and layout, in points.
+const (
+	pageWidth    = 595.0
+	pageHeight   = 842.0
+	margin       = 50.0
+	contentWidth = pageWidth - 2*margin
+)
+
+// Text styles.
+const (
+	StyleBody    = iota // 10pt Helvetica
+	StyleHeading        // 14pt Helvetica-Bold
+	StyleLabel          // 10pt Helvetica-Bold
+	StyleMuted          // 8pt grey Helvetica
+)
+
+type style struct {
+	font    string
+	size    float64
+	leading float64
+	grey    bool
+	bold    bool
+}
+
+var styles = map[int]style{
+	StyleBody:    {font: "F1", size: 10, leading: 13},
+	StyleHeading: {font: "F2", size: 14, leading: 20, bold: true},
+	StyleLabel:   {font: "F2", size: 10, leading: 13, bold: true},
+	StyleMuted:   {font: "F1", size: 8, leading: 11, grey: true},
+}
+
+type line struct {
+	text  []byte
+	style style
+	y     float64
+}
+
+// Document is a PDF being laid out, top to bottom, page after page.
+type Document struct {
+	title string
+	pages [][]line
+	y     float64
+}
+
+// New starts a document with the given title.
+func New(title string) *Document {
+	d := &Document{title: title}
+	d.newPage()
+	return d
+}
+
+// Text adds text in a style, wrapped to the page width. Newlines start new
+// lines.
+func (d *Document) Text(textStyle int, text string) {
+	st := styles[textStyle]
+	for _, paragraph := range strings.Split(text, "\n") {
+		for _, wrapped := range wrap(encode(paragraph), st) {
+			d.addLine(wrapped, st)
+		}
+	}
+}
+
+// Space adds vertical space.
+func (d *Document) Space(points float64) {
+	d.y -= points
+}
+
+// PageCount returns the number of pages laid out so far.
+func (d *Document) PageCount() int {
+	return len(d.pages)
+}
+
+func (d *Document) newPage() {
+	d.pages = append(d.pages, nil)
+	d.y = pageHeight - margin
+}
+
+func (d *Document) addLine(text []byte, st style) {
+	if d.y-st.leading < margin {
+		d.newPage()
+	}
+	d.y -= st.leading
+	page := len(d.pages) - 1
+	d.pages[page] = append(d.pages[page], line{text: text, style: st, y: d.y})
+}
+
+// WriteTo writes the document as a PDF file.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	// Objects 1-5 are the catalog, page tree, fonts and document info; each
+	// page is followed by its content stream.
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 6+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	object(fmt.Sprintf("<< /Title (%s) /Producer (SCP) >>", escape(encode(d.title))))
+
+	for i, page := range d.pages {
+		var content bytes.Buffer
+		for _, l := range page {
+			grey := "0 g"
+			if l.style.grey {
+				grey = "0.4 g"
+			}
+			fmt.Fprintf(&content, "BT %s /%s %.0f Tf %.2f %.2f Td (%s) Tj ET\n", grey, l.style.font, l.style.size, margin, l.y, escape(l.text))
+		}
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, 7+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	n, err := w.Write(buf.Bytes())
+	return int64(n), err
+}
+
+// wrap breaks text into lines that fit the content width, between words
+// where it can.
+func wrap(text []byte, st style) [][]byte {
+	maxWidth := contentWidth * 1000 / st.size
+	var lines [][]byte
+	var current []byte
+	currentWidth := 0.0
+	for _, word := range bytes.Split(text, []byte(" ")) {
+		wordWidth := width(word, st)
+		spaceWidth := width([]byte(" "), st)
+		if len(current) > 0 && currentWidth+spaceWidth+wordWidth <= maxWidth {
+			current = append(append(current, ' '), word...)
+			currentWidth += spaceWidth + wordWidth
+			continue
+		}
+		if len(current) > 0 {
+			lines = append(lines, current)
+		}
+		current, currentWidth = nil, 0
+		// Words wider than a line are broken anywhere
+		for wordWidth > maxWidth {
+			cut, cutWidth := 0, 0.0
+			for cut < len(word) && cutWidth+charWidth(word[cut], st) <= maxWidth {
+				cutWidth += charWidth(word[cut], st)
+				cut++
+			}
+			if cut == 0 {
+				cut = 1
+			}
+			lines = append(lines, word[:cut])
+			word = word[cut:]
+			wordWidth = width(word, st)
+		}
+		current = append([]byte{}, word...)
+		currentWidth = wordWidth
+	}
+	return append(lines, current)
+}
+
+func width(text []byte, st style) float64 {
+	total := 0.0
+	for _, c := range text {
+		total += charWidth(c, st)
+	}
+	return total
+}
+
+// charWidth is the width of a character in thousandths of the font size.
+// Bold text is taken to be a tenth wider, which is close enough to wrap.
+func charWidth(c byte, st style) float64 {
+	w := 556.0
+	if c >= 32 && c < 127 {
+		w = float64(helveticaWidths[c-32])
+	}
+	if st.bold {
+		w *= 1.1
+	}
+	return w
+}
+
+// helveticaWidths are the widths of the printable ASCII characters in
+// Helvetica.
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// encode converts text to Windows-1252, which WinAnsiEncoding follows.
+func encode(text string) []byte {
+	out := make([]byte, 0, len(text))
+	for _, r := range text {
+		switch {
+		case r == '\t':
+			out = append(out, ' ')
+		case r < 32 || r == 127:
+			// Drop other control characters
+		case r < 128 || (r >= 0xA0 && r <= 0xFF):
+			out = append(out, byte(r))
+		case r == '€':
+			out = append(out, 0x80)
+		case r == '‘':
+			out = append(out, 0x91)
+		case r == '’':
+			out = append(out, 0x92)
+		case r == '“':
+			out = append(out, 0x93)
+		case r == '”':
+			out = append(out, 0x94)
+		case r == '–':
+			out = append(out, 0x96)
+		case r == '—':
+			out = append(out, 0x97)
+		default:
+			out = append(out, '?')
+		}
+	}
+	return out
+}
+
+// escape escapes text for a PDF string literal.
+func escape(text []byte) string {
+	var out strings.Builder
+	for _, c := range text {
+		if c == '\\' || c == '(' || c == ')' {
+			out.WriteByte('\\')
+		}
+		out.WriteByte(c)
+	}
+	return out.String()
+}
@@ -0,0 +1,64 @@
+package pdf
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDocument_WriteTo(t *testing.T) {
+	doc := New("Transcript")
+	doc.Text(StyleHeading, "Conversation with Café Blanc")
+	doc.Text(StyleBody, "Price (per crate) is 12€ \\ 10 crates")
+
+	var buf bytes.Buffer
+	_, err := doc.WriteTo(&buf)
+	out := buf.Bytes()
+
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(out, []byte("%PDF-1.4\n")))
+	assert.True(t, bytes.HasSuffix(out, []byte("%%EOF\n")))
+	assert.Contains(t, string(out), "(Conversation with Caf\xe9 Blanc) Tj")
+	assert.Contains(t, string(out), `(Price \(per crate\) is 12`+"\x80"+` \\ 10 crates) Tj`)
+
+	// startxref points at the cross-reference table
+	match := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(out)
+	assert.NotNil(t, match)
+	offset, _ := strconv.Atoi(string(match[1]))
+	assert.True(t, bytes.HasPrefix(out[offset:], []byte("xref\n")))
+}
+
+func TestDocument_BreaksPages(t *testing.T) {
+	doc := New("Long")
+	for i := 0; i < 100; i++ {
+		doc.Text(StyleBody, "Line "+strconv.Itoa(i))
+	}
+
+	var buf bytes.Buffer
+	doc.WriteTo(&buf)
+
+	assert.Equal(t, 2, doc.PageCount())
+	assert.Contains(t, buf.String(), "/Count 2")
+}
+
+func TestWrap(t *testing.T) {
+	body := styles[StyleBody]
+
+	lines := wrap(encode(strings.Repeat("word ", 40)), body)
+	assert.Greater(t, len(lines), 1)
+	for _, l := range lines {
+		assert.LessOrEqual(t, width(l, body)*body.size/1000, contentWidth)
+	}
+
+	long := wrap(encode(strings.Repeat("x", 300)), body)
+	assert.Greater(t, len(long), 1)
+	assert.Equal(t, 300, len(bytes.Join(long, nil)))
+}
+
+func TestEncode(t *testing.T) {
+	assert.Equal(t, []byte("Gr\xfc\xdfe ? ok"), encode("Grüße 你 ok"))
+}